@@ -4,6 +4,7 @@ import (
 	"context"
 	"go.uber.org/zap"
 	"log"
+	"time"
 
 	"github.com/saiset-co/sai-service/sai"
 	"github.com/saiset-co/sai-service/service"
@@ -24,7 +25,8 @@ func main() {
 		log.Fatalf("Failed to create service: %v", err)
 	}
 
-	if err := initializeComponents(); err != nil {
+	storageService, err := initializeComponents()
+	if err != nil {
 		sai.Logger().Error("Failed to initialize components", zap.Error(err))
 		cancel()
 	}
@@ -33,9 +35,17 @@ func main() {
 		sai.Logger().Error("Failed to start service", zap.Error(err))
 		cancel()
 	}
+
+	if storageService != nil {
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer closeCancel()
+		if err := storageService.Close(closeCtx); err != nil {
+			sai.Logger().Error("Failed to close storage", zap.Error(err))
+		}
+	}
 }
 
-func initializeComponents() (err error) {
+func initializeComponents() (storageService *serviceLayer.StorageService, err error) {
 	var repo types.StorageRepository
 
 	storageType := sai.Config().GetValue("storage.type", "mongo").(string)
@@ -45,42 +55,85 @@ func initializeComponents() (err error) {
 	case "redis":
 		repo, err = redis.NewRepository()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	case "mongo":
 		fallthrough
 	default:
 		repo, err = mongo.NewRepository()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	var features types.StorageFeaturesConfig
 	_ = sai.Config().GetAs("storage.features", &features)
 
-	storageService := serviceLayer.NewStorageService(repo, features)
+	storageService = serviceLayer.NewStorageService(repo, features)
 	handler := handlers.NewHandler(storageService)
 
-	documents := sai.Router().Group("/api/v1").Group("/documents")
+	api := sai.Router().Group("/api/v1")
+	documents := api.Group("/documents")
 
 	documents.POST("/", handler.CreateDocuments).
 		WithDoc("Create Documents", "Create multiple documents in a collection", "documents", &types.CreateDocumentsRequest{}, &types.CreateDocumentsResponse{})
 
 	documents.GET("/", handler.ReadDocuments).
-		WithDoc("Get Documents", "Get documents with filtering and pagination. Add ?count=1 to include total count", "documents", &types.ReadDocumentsRequest{}, &types.ReadDocumentsResponse{})
+		WithDoc("Get Documents", "Get documents with filtering and pagination. Add ?count=1 to include total count, ?as_of=<unix ns or RFC 3339> to read the collection as it was at that time, ?include_deleted=1 to include soft-deleted documents", "documents", &types.ReadDocumentsRequest{}, &types.ReadDocumentsResponse{})
 
 	documents.POST("/aggregate", handler.AggregateDocuments).
 		WithDoc("Aggregate Documents", "Aggregate documents in a collection", "documents", &types.AggregateDocumentsRequest{}, &types.AggregateDocumentsResponse{})
 
+	documents.POST("/explain", handler.Explain).
+		WithDoc("Explain Query", "Return the winning plan, indexes used and examined counts of a find, aggregate, update or delete without running it", "documents", &types.ExplainRequest{}, &types.ExplainResponse{})
+
+	documents.GET("/{collection}/{internal_id}/history", handler.DocumentHistory).
+		WithDoc("Document History", "List archived versions of a document, oldest first", "documents", nil, &types.DocumentHistoryResponse{})
+
 	documents.PUT("/", handler.UpdateDocuments).
-		WithDoc("Update Documents", "Update multiple documents by filter", "documents", &types.UpdateDocumentsRequest{}, &types.UpdateDocumentsResponse{})
+		WithDoc("Update Documents", "Update multiple documents by filter. Set dry_run to preview matches and post-images without writing", "documents", &types.UpdateDocumentsRequest{}, &types.UpdateDocumentsResponse{})
 
 	documents.DELETE("/", handler.DeleteDocuments).
-		WithDoc("Delete Documents", "Delete multiple documents by filter", "documents", &types.DeleteDocumentsRequest{}, &types.DeleteDocumentsResponse{})
+		WithDoc("Delete Documents", "Delete multiple documents by filter. Soft-delete collections only set deleted_at. Set dry_run to preview matches without deleting", "documents", &types.DeleteDocumentsRequest{}, &types.DeleteDocumentsResponse{})
+
+	documents.POST("/undelete", handler.UndeleteDocuments).
+		WithDoc("Undelete Documents", "Restore soft-deleted documents matching a filter", "documents", &types.UndeleteDocumentsRequest{}, &types.UndeleteDocumentsResponse{})
+
+	archive := api.Group("/archive")
+
+	archive.GET("/operations", handler.ArchiveOperations).
+		WithDoc("Archive Operations", "List archived operations of a collection, newest first. Query: collection, archive (create, update or delete), search, skip, limit", "archive", nil, &types.ArchiveOperationsResponse{})
+
+	archive.POST("/restore", handler.RestoreArchive).
+		WithDoc("Restore Operation", "Undo an archived operation, optionally for a subset of documents. Set dry_run to preview the affected documents", "archive", &types.RestoreRequest{}, &types.RestoreResponse{})
+
+	queries := api.Group("/queries")
+
+	queries.POST("/run", handler.RunSavedQuery).
+		WithDoc("Run Saved Query", "Run a query saved in the admin panel by id. params fill its {{name:type}} placeholders; set dry_run to preview updates and deletes", "queries", &types.RunSavedQueryRequest{}, &types.RunSavedQueryResponse{})
+
+	collections := api.Group("/collections")
+
+	collections.POST("/", handler.CreateCollection).
+		WithDoc("Create Collection", "Create a regular, capped, time-series or clustered collection", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
+
+	collections.POST("/rename", handler.RenameCollection).
+		WithDoc("Rename Collection", "Rename a collection to \"to\" together with its request log and archives", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
+
+	collections.POST("/clone", handler.CloneCollection).
+		WithDoc("Clone Collection", "Copy a collection with its options and indexes to \"to\"", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
+
+	collections.POST("/truncate", handler.TruncateCollection).
+		WithDoc("Truncate Collection", "Delete all documents after taking a snapshot. confirm must repeat the collection name", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
+
+	collections.POST("/convert", handler.ConvertCollection).
+		WithDoc("Convert Collection", "Change a collection to the type given in options after taking a snapshot. confirm must repeat the collection name", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
+
+	collections.DELETE("/", handler.DropCollection).
+		WithDoc("Drop Collection", "Drop a collection after taking a snapshot. Its request log and archives are kept. confirm must repeat the collection name", "collections", &types.CollectionRequest{}, &types.CollectionResponse{})
 
 	storageService.LoadSettings(context.Background())
 	internal.SetupAdmin(storageService, handler)
 
-	return nil
+	return storageService, nil
 }
@@ -6,7 +6,6 @@ import (
 	"github.com/saiset-co/sai-service/sai"
 	"github.com/saiset-co/sai-storage/internal/handlers"
 	"github.com/saiset-co/sai-storage/internal/service"
-	"github.com/saiset-co/sai-storage/types"
 )
 
 
@@ -23,22 +22,17 @@ func SetupAdmin(storageService *service.StorageService, handler *handlers.Handle
 		handler: handler,
 	}
 
-	_ = storageService.GetRepo().CreateIndex(context.Background(), types.CreateIndexRequest{
-		Collection: "_admin_query_stats",
-		Keys:       map[string]int{"collection": 1, "operation": 1, "filter_fingerprint": 1},
-		Unique:     true,
-		Name:       "admin_query_stats_unique",
-	})
-	_ = storageService.GetRepo().CreateIndex(context.Background(), types.CreateIndexRequest{
-		Collection: "_admin_slow_queries",
-		Keys:       map[string]int{"ts": -1},
-		Name:       "admin_slow_queries_ts",
-	})
+	storageService.EnsureAdminIndexes(context.Background())
 
 	adminGroup := sai.Router().Group("/admin").WithAuthProvider("basic")
 	adminGroup.GET("/archive/docs", panel.handleArchiveDocs)
 	adminGroup.GET("/ajax/collection-browse", panel.handleAjaxCollectionBrowse)
+	adminGroup.GET("/ajax/collection-fields", panel.handleAjaxCollectionFields)
+	adminGroup.GET("/ajax/document-history", panel.handleAjaxDocumentHistory)
+	adminGroup.GET("/ajax/rollback-plan", panel.handleAjaxRollbackPlan)
+	adminGroup.GET("/ajax/slow-query-plan", panel.handleAjaxSlowQueryPlan)
 	adminGroup.GET("/ajax/indexes", panel.handleAjaxIndexes)
+	adminGroup.GET("/ajax/index-usage", panel.handleAjaxIndexUsage)
 	adminGroup.GET("/ajax/create-archive", panel.handleAjaxCreateArchive)
 	adminGroup.GET("/ajax/update-archive", panel.handleAjaxUpdateArchive)
 	adminGroup.GET("/ajax/delete-archive", panel.handleAjaxDeleteArchive)
@@ -47,16 +41,41 @@ func SetupAdmin(storageService *service.StorageService, handler *handlers.Handle
 	adminGroup.GET("/ajax/request-log-info", panel.handleAjaxRequestLogInfo)
 	adminGroup.GET("/ajax/service-logs", panel.handleAjaxServiceLogs)
 	adminGroup.GET("/custom-queries/run", panel.handleRunCustomQuery)
+	adminGroup.GET("/custom-queries/export", panel.handleExportCustomQuery)
+	adminGroup.GET("/collection-export", panel.handleExportCollection)
 	adminGroup.POST("/indexes", handler.CreateIndexFromForm)
+	adminGroup.POST("/indexes/drop", handler.DropIndex)
+	adminGroup.POST("/indexes/hidden", handler.SetIndexHidden)
+	adminGroup.POST("/indexes/rebuild", handler.RebuildIndex)
+	adminGroup.POST("/collections/create", handler.CreateCollectionFromForm)
+	adminGroup.POST("/collections/rename", handler.RenameCollectionFromForm)
+	adminGroup.POST("/collections/clone", handler.CloneCollectionFromForm)
+	adminGroup.POST("/collections/truncate", handler.TruncateCollectionFromForm)
+	adminGroup.POST("/collections/convert", handler.ConvertCollectionFromForm)
+	adminGroup.POST("/collections/drop", handler.DropCollectionFromForm)
+	adminGroup.POST("/documents/save", handler.SaveDocument)
+	adminGroup.POST("/documents/delete", handler.DeleteDocument)
 	adminGroup.POST("/restore/create", handler.RestoreCreate)
 	adminGroup.POST("/restore/update", handler.RestoreUpdate)
 	adminGroup.POST("/restore/delete", handler.RestoreDelete)
+	adminGroup.POST("/rollback/apply", handler.ApplyRollback)
 	adminGroup.POST("/slow-queries/threshold", handler.SetSlowQueryThreshold)
 	adminGroup.POST("/slow-queries/clear", handler.ClearSlowQueries)
 	adminGroup.POST("/query-stats/clear", handler.ClearQueryStats)
 	adminGroup.POST("/custom-queries", handler.SaveCustomQuery)
 	adminGroup.POST("/custom-queries/update", handler.UpdateCustomQuery)
 	adminGroup.POST("/custom-queries/delete", handler.DeleteCustomQuery)
+	adminGroup.POST("/custom-queries/schedule", handler.ScheduleCustomQuery)
+	adminGroup.POST("/custom-queries/run-now", handler.RunScheduledQueryNow)
+	adminGroup.POST("/access/roles", handler.SaveAccessRole)
+	adminGroup.POST("/access/roles/delete", handler.DeleteAccessRole)
+	adminGroup.POST("/access/keys", handler.CreateAPIKey)
+	adminGroup.POST("/access/keys/delete", handler.DeleteAPIKey)
+	adminGroup.POST("/tenant", handler.SelectTenant)
+	adminGroup.POST("/encryption/reload", handler.ReloadEncryptionKeys)
+	adminGroup.POST("/encryption/reencrypt", handler.ReencryptCollection)
+	adminGroup.POST("/retention/run", handler.RunRetention)
+	adminGroup.POST("/index-advisor/apply", handler.ApplyIndexRecommendations)
 
 	sai.Admin(adminGroup).
 		WithTitle("SAI Storage").
@@ -66,14 +85,22 @@ func SetupAdmin(storageService *service.StorageService, handler *handlers.Handle
 		WithHomePage("Коллекции", "Список коллекций и их статистика", panel.pageCollections).
 		Page("indexes", "Индексы", panel.pageIndexes).
 		Page("custom-queries", "Запросы", panel.pageCustomQueries).
+		Page("access", "Доступ", panel.pageAccess).
+		Page("encryption", "Шифрование", panel.pageEncryption).
 		Group("Аналитика").
 		Page("slow-queries", "Медленные", panel.pageSlowQueries).
 		Page("query-stats", "Частые", panel.pageQueryStats).
+		Page("index-advisor", "Советник", panel.pageIndexAdvisor).
+		Page("index-usage", "Использование", panel.pageIndexUsage).
+		Page("metrics", "Метрики", panel.pageMetrics).
 		Group("Логи").
 		Page("request-logs", "Запросы", panel.pageRequestLogs).
 		Page("create-archive", "Создания", panel.pageCreateArchive).
 		Page("update-archive", "Обновления", panel.pageUpdateArchive).
 		Page("delete-archive", "Удаления", panel.pageDeleteArchive).
+		Page("rollback", "Откат", panel.pageRollback).
 		Page("service-logs", "Сервис", panel.pageServiceLogs).
+		Page("query-runs", "Проверки", panel.pageQueryRuns).
+		Page("retention", "Хранение", panel.pageRetention).
 		Mount()
 }
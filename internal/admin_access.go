@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+)
+
+const accessRulesPlaceholder = `[{"collections":["orders*"],"operations":["read","aggregate"],"filter":{"tenant":"$user"}}]`
+
+func (p *AdminPanel) pageAccess(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	roles, err := p.service.ListAccessRoles(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.service.ListAPIKeys(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var rolesHTML strings.Builder
+	if !p.service.AccessControlEnabled() {
+		rolesHTML.WriteString(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">` +
+			`Контроль доступа выключен. Включите <code>access_control.enabled: true</code> в конфиге, чтобы правила применялись.</div>`)
+	}
+	rolesHTML.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	rolesHTML.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Роль", "Описание", "Правила", "Действия"} {
+		rolesHTML.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	rolesHTML.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	roleNames := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleNames = append(roleNames, template.HTMLEscapeString(role.Name))
+		rulesJSON, _ := json.MarshalIndent(role.Rules, "", "  ")
+
+		editBtn := fmt.Sprintf(
+			`<button type="button" data-name="%s" data-desc="%s" data-rules="%s" onclick="_openRoleEdit(this)" `+
+				`style="display:inline-flex;align-items:center;padding:5px 12px;background:#6366f1;border:none;cursor:pointer;font-size:12px;font-weight:600;color:white;border-radius:8px 0 0 8px;white-space:nowrap">Изменить</button>`,
+			template.HTMLEscapeString(role.Name), template.HTMLEscapeString(role.Description), template.HTMLEscapeString(string(rulesJSON)),
+		)
+		deleteBtn := fmt.Sprintf(
+			`<button type="button" data-field="name" data-value="%s" data-action="/admin/access/roles/delete" data-confirm="Удалить роль?" onclick="_accessDelete(this)" `+
+				`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#ef4444;background:none;border:none;cursor:pointer;white-space:nowrap" `+
+				`onmouseover="this.style.background='#fef2f2'" onmouseout="this.style.background=''">Удалить</button>`,
+			template.HTMLEscapeString(role.Name),
+		)
+
+		rolesHTML.WriteString(`<tr class="hover:bg-slate-50">`)
+		rolesHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono font-medium">%s</td>`, template.HTMLEscapeString(role.Name)))
+		rolesHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-slate-500">%s</td>`, template.HTMLEscapeString(role.Description)))
+		rolesHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3"><pre style="font-size:11px;margin:0;white-space:pre-wrap;max-width:480px">%s</pre></td>`, template.HTMLEscapeString(string(rulesJSON))))
+		rolesHTML.WriteString(`<td class="px-4 py-3">` + sdWrap(editBtn, "#6366f1", []string{deleteBtn}) + `</td>`)
+		rolesHTML.WriteString(`</tr>`)
+	}
+	rolesHTML.WriteString(`</tbody></table></div>`)
+	if len(roles) == 0 {
+		rolesHTML.WriteString(`<p class="text-slate-500 text-sm mt-4">Ролей нет.</p>`)
+	}
+
+	roleContent := mField("name", "Имя роли", "", "text") +
+		mField("description", "Описание (опционально)", "", "text") +
+		`<div><label class="mb-2 block text-sm font-medium text-slate-700">Правила (JSON)</label>` +
+		`<textarea name="rules" rows="8" placeholder="` + template.HTMLEscapeString(accessRulesPlaceholder) + `" ` +
+		`class="w-full rounded-xl border border-slate-300 bg-white px-4 py-3 text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100 font-mono resize-y"></textarea>` +
+		`<p class="mt-2 text-xs text-slate-500">Операции: read, create, update, delete, aggregate, manage, *; manage (управление коллекциями) не входит в * и выдаётся явно. Коллекции — glob-шаблоны. ` +
+		`<code>$user</code> в фильтре заменяется пользователем ключа.</p></div>`
+	rolesHTML.WriteString(modal("roleModal", "Роль", "roleForm", "roleErr", "roleBtn", "Сохранить", "/admin/access/roles", roleContent))
+
+	var keysHTML strings.Builder
+	keysHTML.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	keysHTML.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Имя", "Ключ", "Роль", "Пользователь", "Тенант", "Создан", "Действия"} {
+		keysHTML.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	keysHTML.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, key := range keys {
+		revokeBtn := fmt.Sprintf(
+			`<button type="button" data-field="id" data-value="%s" data-action="/admin/access/keys/delete" data-confirm="Отозвать ключ?" onclick="_accessDelete(this)" `+
+				`style="display:inline-flex;align-items:center;padding:5px 12px;background:#e11d48;border:none;cursor:pointer;font-size:12px;font-weight:600;color:white;border-radius:8px;white-space:nowrap">Отозвать</button>`,
+			template.HTMLEscapeString(key.InternalID),
+		)
+		keysHTML.WriteString(`<tr class="hover:bg-slate-50">`)
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-medium">%s</td>`, template.HTMLEscapeString(key.Name)))
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs text-slate-400">%s…</td>`, template.HTMLEscapeString(key.KeyPrefix)))
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(key.Role)))
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(key.User)))
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(key.Tenant)))
+		keysHTML.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-xs text-slate-500">%s</td>`, formatNanoTwoLine(key.CrTime)))
+		keysHTML.WriteString(`<td class="px-4 py-3">` + revokeBtn + `</td>`)
+		keysHTML.WriteString(`</tr>`)
+	}
+	keysHTML.WriteString(`</tbody></table></div>`)
+	if len(keys) == 0 {
+		keysHTML.WriteString(`<p class="text-slate-500 text-sm mt-4">Ключей нет.</p>`)
+	}
+	keysHTML.WriteString(fmt.Sprintf(`<p class="text-xs text-slate-400 mt-4">Ключ передаётся в заголовке <code>%s</code>.</p>`,
+		template.HTMLEscapeString(p.service.AccessKeyHeader())))
+	keysHTML.WriteString(apiKeyModal(roleNames))
+
+	keysHTML.WriteString(modalScript())
+	keysHTML.WriteString(accessScript())
+	keysHTML.WriteString(sdScript())
+
+	return &admin.PageData{
+		Notices: admin.ReadFlash(ctx, "/admin/pages/access"),
+		Sections: []admin.Section{
+			{
+				Title:       "Роли",
+				Actions:     template.HTML(`<button onclick="_openRoleEdit(null)" class="inline-flex h-9 items-center rounded-xl bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500">+ Добавить роль</button>`),
+				ContentHTML: template.HTML(rolesHTML.String()),
+			},
+			{
+				Title:       "Ключи доступа",
+				Actions:     template.HTML(openModalBtn("+ Создать ключ", "apiKeyModal", "inline-flex h-9 items-center rounded-xl bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500")),
+				ContentHTML: template.HTML(keysHTML.String()),
+			},
+		},
+	}, nil
+}
+
+func apiKeyModal(roles []string) string {
+	content := mField("name", "Имя (сервис или клиент)", "", "text") +
+		mSelect("role", "Роль", roles, nil) +
+		mField("user", "Пользователь для $user (опционально)", "", "text") +
+		mField("tenant", "Тенант (опционально)", "", "text")
+	return `<div id="apiKeyModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
+		`<div style="background:white;border-radius:16px;width:100%;max-width:560px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
+		`<div style="display:flex;align-items:center;justify-content:space-between;padding:24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<h2 style="font-size:18px;font-weight:700;color:#0f172a">Новый ключ доступа</h2>` +
+		`<button onclick="_apiKeyClose()" style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
+		`</div>` +
+		`<form id="apiKeyForm" onsubmit="_apiKeyCreate(event)" style="display:flex;flex:1 1 auto;min-height:0;flex-direction:column">` +
+		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px">` +
+		`<div id="apiKeyErr" style="display:none;padding:12px;border-radius:8px;background:#fef2f2;color:#ef4444;font-size:13px;margin-bottom:16px"></div>` +
+		`<div id="apiKeyResult" style="display:none;padding:12px;border-radius:8px;background:#f0fdf4;color:#166534;font-size:13px;margin-bottom:16px">` +
+		`<div style="margin-bottom:6px">Ключ создан. Скопируйте его сейчас — повторно он показан не будет:</div>` +
+		`<code id="apiKeyValue" style="display:block;font-size:13px;word-break:break-all;user-select:all"></code></div>` +
+		`<div class="grid gap-4">` + content + `</div>` +
+		`</div>` +
+		`<div style="padding:16px 24px;border-top:1px solid #e2e8f0;display:flex;justify-content:flex-end;flex:0 0 auto">` +
+		`<button type="submit" id="apiKeyBtn" class="inline-flex h-11 items-center rounded-xl bg-indigo-600 px-5 text-sm font-semibold text-white hover:bg-indigo-500">Создать</button>` +
+		`</div></form></div></div>`
+}
+
+func accessScript() string {
+	return `<script>if(!window._accessInit){window._accessInit=true;` +
+		`window._openRoleEdit=function(btn){` +
+		`var f=document.getElementById('roleForm');f.reset();` +
+		`document.getElementById('roleErr').style.display='none';` +
+		`if(btn){f.elements['name'].value=btn.getAttribute('data-name');f.elements['description'].value=btn.getAttribute('data-desc');f.elements['rules'].value=btn.getAttribute('data-rules');}` +
+		`document.getElementById('roleModal').style.display='flex';};` +
+		`window._accessDelete=function(btn){` +
+		`if(!confirm(btn.getAttribute('data-confirm')))return;` +
+		`var fd=new FormData();fd.append(btn.getAttribute('data-field'),btn.getAttribute('data-value'));` +
+		`fetch(window.location.origin+btn.getAttribute('data-action'),{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){if(d.ok){location.reload();}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){alert('Ошибка сети');});};` +
+		`window._apiKeyCreate=function(e){e.preventDefault();` +
+		`var btn=document.getElementById('apiKeyBtn'),err=document.getElementById('apiKeyErr');` +
+		`if(btn.getAttribute('data-done')){location.reload();return;}` +
+		`err.style.display='none';btn.disabled=true;` +
+		`fetch(window.location.origin+'/admin/access/keys',{method:'POST',headers:{'X-Requested-With':'fetch'},body:new FormData(e.target)})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;` +
+		`if(d.ok){document.getElementById('apiKeyValue').textContent=d.message;document.getElementById('apiKeyResult').style.display='block';` +
+		`btn.setAttribute('data-done','1');btn.textContent='Готово';}` +
+		`else{err.textContent=d.error||'Ошибка';err.style.display='block';}})` +
+		`.catch(function(){btn.disabled=false;});};` +
+		`window._apiKeyClose=function(){` +
+		`if(document.getElementById('apiKeyBtn').getAttribute('data-done')){location.reload();return;}` +
+		`document.getElementById('apiKeyModal').style.display='none';};` +
+		`}</script>`
+}
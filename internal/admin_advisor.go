@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+var redundantReasonLabels = map[string]string{
+	"duplicate": "дубликат",
+	"prefix":    "префикс",
+}
+
+func (p *AdminPanel) pageIndexAdvisor(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	advice, err := p.service.AdviseIndexes(p.handler.AdminContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	status := p.service.IndexAdvisorStatus()
+
+	var sb strings.Builder
+	sb.WriteString(`<dl class="grid gap-2 text-sm" style="grid-template-columns:max-content 1fr;margin-bottom:16px">`)
+	sb.WriteString(fmt.Sprintf(`<dt class="text-slate-500">Шаблонов запросов</dt><dd>%d, покрыто индексами: %d</dd>`, advice.Shapes, advice.Covered))
+	if status.AutoApply {
+		sb.WriteString(`<dt class="text-slate-500">Автоприменение</dt><dd>каждые ` + template.HTMLEscapeString(status.Interval.String()) + `</dd>`)
+		sb.WriteString(`<dt class="text-slate-500">Последний запуск</dt><dd>` + formatRetentionTime(status.LastRun) + `</dd>`)
+		if len(status.Created) > 0 {
+			sb.WriteString(`<dt class="text-slate-500">Создано</dt><dd class="font-mono text-xs">` + template.HTMLEscapeString(strings.Join(status.Created, ", ")) + `</dd>`)
+		}
+		if status.LastError != "" {
+			sb.WriteString(`<dt class="text-slate-500">Ошибка</dt><dd class="text-rose-600 text-xs">` + template.HTMLEscapeString(status.LastError) + `</dd>`)
+		}
+	} else {
+		sb.WriteString(`<dt class="text-slate-500">Автоприменение</dt><dd class="text-slate-400">выключено</dd>`)
+	}
+	sb.WriteString(`</dl>`)
+
+	sb.WriteString(`<h3 class="text-sm font-semibold text-slate-700 mb-2">Рекомендуемые индексы</h3>`)
+	sb.WriteString(`<div class="overflow-x-auto mb-6"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Коллекция", "Ключи", "Вызовов", "Медленных", "Шаблоны", "Действия"} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, rec := range advice.Recommendations {
+		spec := make([]indexKeySpec, 0, len(rec.Keys))
+		for _, k := range rec.Keys {
+			spec = append(spec, indexKeySpec{K: k.Field, D: k.Direction})
+		}
+		keysJSON, _ := ctx.Marshal(spec)
+		createBtn := fmt.Sprintf(
+			`<button type="button" data-collection="%s" data-keys="%s" onclick="_openIdxCreate(this)" `+
+				`style="display:inline-flex;align-items:center;padding:5px 12px;background:#6366f1;border:none;cursor:pointer;font-size:12px;font-weight:600;color:white;border-radius:8px;white-space:nowrap">Создать</button>`,
+			template.HTMLEscapeString(rec.Collection), template.HTMLEscapeString(string(keysJSON)),
+		)
+		shapes := make([]string, 0, len(rec.Shapes))
+		for _, shape := range rec.Shapes {
+			shapes = append(shapes, formatShape(shape))
+		}
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(rec.Collection)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(formatIndexKeys(rec.Keys))))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d</td>`, rec.Calls))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-rose-600">%d</td>`, rec.SlowCalls))
+		sb.WriteString(`<td class="px-4 py-3 font-mono text-xs text-slate-500">` + strings.Join(shapes, "<br>") + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3">` + createBtn + `</td>`)
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	if len(advice.Recommendations) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mb-6">Рекомендаций нет. Советник использует частые и медленные запросы, включите <code>track_query_stats: true</code>.</p>`)
+	}
+
+	sb.WriteString(`<h3 class="text-sm font-semibold text-slate-700 mb-2">Избыточные индексы</h3>`)
+	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Коллекция", "Индекс", "Ключи", "Причина", "Покрывается индексом"} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, r := range advice.Redundant {
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(r.Collection)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono font-medium">%s</td>`, template.HTMLEscapeString(r.Name)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(formatIndexKeys(r.Keys))))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-amber-600">%s</td>`, template.HTMLEscapeString(redundantReasonLabels[r.Reason])))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(r.CoveredBy)))
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	if len(advice.Redundant) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mt-4">Избыточных индексов не найдено.</p>`)
+	}
+	sb.WriteString(`<p class="text-xs text-slate-400 mt-4">Ключи строятся по правилу ESR: сначала поля равенства, затем сортировки, затем диапазона. ` +
+		`Избыточные индексы только отмечаются, советник их не удаляет.</p>`)
+
+	sb.WriteString(indexCreatorModal())
+	sb.WriteString(indexCreatorScript())
+	sb.WriteString(advisorScript())
+
+	actions := p.tenantSelector(ctx)
+	if len(advice.Recommendations) > 0 {
+		actions += `<button onclick="_advisorApply(this)" class="inline-flex h-9 items-center rounded-xl bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500">Создать все</button>`
+	}
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Советник по индексам", Actions: template.HTML(actions), ContentHTML: template.HTML(sb.String())},
+		},
+	}, nil
+}
+
+func formatIndexKeys(keys []types.IndexKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k.Type != "" {
+			parts = append(parts, k.Field+": "+k.Type)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", k.Field, k.Direction))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func formatShape(shape types.QueryShape) string {
+	var parts []string
+	if len(shape.Equality) > 0 {
+		parts = append(parts, "E: "+strings.Join(shape.Equality, ", "))
+	}
+	if len(shape.Sort) > 0 {
+		parts = append(parts, "S: "+formatIndexKeys(shape.Sort))
+	}
+	if len(shape.Range) > 0 {
+		parts = append(parts, "R: "+strings.Join(shape.Range, ", "))
+	}
+	return template.HTMLEscapeString(shape.Operation + " · " + strings.Join(parts, " · "))
+}
+
+func advisorScript() string {
+	return `<script>if(!window._advisorInit){window._advisorInit=true;` +
+		`window._advisorApply=function(btn){` +
+		`if(!confirm('Создать все рекомендуемые индексы?'))return;btn.disabled=true;` +
+		`fetch(window.location.origin+'/admin/index-advisor/apply',{method:'POST',headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(d.ok){alert(d.message);location.reload();}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){btn.disabled=false;alert('Ошибка сети');});};` +
+		`}</script>`
+}
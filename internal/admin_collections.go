@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+var collectionTypeLabels = map[string]string{
+	types.CollectionTypeRegular:    "обычная",
+	types.CollectionTypeCapped:     "capped",
+	types.CollectionTypeTimeSeries: "time-series",
+	types.CollectionTypeClustered:  "clustered",
+}
+
+// notifyModal is a modal whose success message is shown before the page
+// reloads, e.g. the snapshot a destructive operation left.
+func notifyModal(id, title, formID, errID, btnID, btnLabel, action, content string) string {
+	return strings.Replace(modal(id, title, formID, errID, btnID, btnLabel, action, content),
+		`<form id="`+formID+`"`, `<form id="`+formID+`" data-notify="1"`, 1)
+}
+
+// collectionModals are the create, rename, clone, convert, truncate and drop
+// dialogs of the Collections page. _colOp fills in the collection.
+func collectionModals() string {
+	target := `<input type="hidden" name="collection">` +
+		`<p class="text-sm text-slate-500">Коллекция: <strong class="font-mono col-name"></strong></p>`
+	confirm := mField("confirm", "Для подтверждения введите имя коллекции", "", "text")
+	snapshot := `<p class="text-xs text-slate-500">Перед операцией коллекция копируется в <span class="font-mono">_snapshot_&lt;имя&gt;_&lt;время&gt;</span> ` +
+		`вместе с индексами. Пустые коллекции не копируются. Чтобы отменить операцию, переименуйте снимок обратно.</p>`
+
+	var b strings.Builder
+	b.WriteString(notifyModal("colCreateModal", "Новая коллекция", "colCreateForm", "colCreateErr", "colCreateBtn", "Создать", "/admin/collections/create",
+		mField("collection", "Имя", "", "text")+collectionTypeFields()))
+	b.WriteString(notifyModal("colRenameModal", "Переименовать коллекцию", "colRenameForm", "colRenameErr", "colRenameBtn", "Переименовать", "/admin/collections/rename",
+		target+mField("to", "Новое имя", "", "text")+
+			`<p class="text-xs text-slate-500">Журнал запросов и архивы коллекции переименовываются вместе с ней. `+
+			`Настройки, где коллекция указана по имени (политики хранения, шифрование, сохранённые запросы), нужно поправить вручную.</p>`))
+	b.WriteString(notifyModal("colCloneModal", "Копировать коллекцию", "colCloneForm", "colCloneErr", "colCloneBtn", "Копировать", "/admin/collections/clone",
+		target+mField("to", "Имя копии", "", "text")+
+			`<p class="text-xs text-slate-500">Копируются документы, параметры и индексы. Журнал запросов и архивы не копируются.</p>`))
+	b.WriteString(notifyModal("colConvertModal", "Изменить тип коллекции", "colConvertForm", "colConvertErr", "colConvertBtn", "Преобразовать", "/admin/collections/convert",
+		target+collectionTypeFields()+
+			`<p class="text-xs text-slate-500">Обычная коллекция становится capped на месте. В остальных случаях документы копируются в новую коллекцию `+
+			`нужного типа, которая заменяет исходную; индексы создаются заново. Time-series требует дату в поле времени у каждого документа.</p>`+
+			snapshot+confirm))
+	b.WriteString(notifyModal("colTruncateModal", "Очистить коллекцию", "colTruncateForm", "colTruncateErr", "colTruncateBtn", "Очистить", "/admin/collections/truncate",
+		target+`<p class="text-sm text-slate-700">Все документы будут удалены. Индексы, параметры, журнал запросов и архивы сохранятся.</p>`+snapshot+confirm))
+	b.WriteString(notifyModal("colDropModal", "Удалить коллекцию", "colDropForm", "colDropErr", "colDropBtn", "Удалить", "/admin/collections/drop",
+		target+`<p class="text-sm text-rose-600">Коллекция будет удалена. Журнал запросов и архивы (<span class="font-mono">_request_logs</span>, `+
+			`<span class="font-mono">_create_archive</span>, <span class="font-mono">_update_archive</span>, <span class="font-mono">_delete_archive</span>) сохранятся.</p>`+snapshot+confirm))
+	return b.String()
+}
+
+// collectionTypeFields select the type of a new or converted collection; the
+// settings of other types are hidden.
+func collectionTypeFields() string {
+	return `<div><label class="mb-2 block text-sm font-medium text-slate-700">Тип</label>` +
+		`<select name="type" onchange="_colTypeFields(this)" class="h-11 w-full rounded-xl border border-slate-300 bg-white px-4 text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100">` +
+		`<option value="regular">Обычная</option>` +
+		`<option value="capped">Capped — фиксированного размера</option>` +
+		`<option value="timeseries">Time-series</option>` +
+		`<option value="clustered">Clustered — по _id</option>` +
+		`</select></div>` +
+		`<div data-kind="capped" class="grid grid-cols-2 gap-4" style="display:none">` +
+		mField("size", "Размер, байт", "", "number") +
+		mField("max", "Документов не больше (опционально)", "", "number") +
+		`</div>` +
+		`<div data-kind="timeseries" class="grid gap-4" style="display:none">` +
+		`<div class="grid grid-cols-2 gap-4">` +
+		mField("time_field", "Поле времени", "", "text") +
+		mField("meta_field", "Поле метаданных (опционально)", "", "text") +
+		`</div>` +
+		mSelect("granularity", "Гранулярность", []string{"по умолчанию", "seconds", "minutes", "hours"}, []string{"", "seconds", "minutes", "hours"}) +
+		`</div>`
+}
+
+// collectionActions is the action menu of a row on the Collections page.
+func collectionActions(name string) string {
+	return `<select data-collection="` + template.HTMLEscapeString(name) + `" onchange="_colOp(this)" ` +
+		`style="height:30px;border:1px solid #e2e8f0;border-radius:6px;padding:0 8px;font-size:12px;color:#475569;background:white;cursor:pointer">` +
+		`<option value="">Действия…</option>` +
+		`<option value="Rename">Переименовать</option>` +
+		`<option value="Clone">Копировать</option>` +
+		`<option value="Convert">Изменить тип</option>` +
+		`<option value="Truncate">Очистить</option>` +
+		`<option value="Drop">Удалить</option>` +
+		`</select>`
+}
+
+// collectionScript opens the operation modals. Destructive ones can only be
+// submitted once the collection name is typed in.
+func collectionScript() string {
+	return `<script>if(!window._colOpInit){window._colOpInit=true;` +
+		`window._colTypeFields=function(sel){` +
+		`sel.form.querySelectorAll('[data-kind]').forEach(function(d){d.style.display=d.dataset.kind===sel.value?'':'none';});};` +
+		`window._colOp=function(sel){var op=sel.value,name=sel.dataset.collection;sel.value='';if(!op)return;` +
+		`var m=document.getElementById('col'+op+'Modal'),f=document.getElementById('col'+op+'Form');` +
+		`f.reset();` +
+		`f.elements['collection'].value=name;` +
+		`m.querySelectorAll('.col-name').forEach(function(s){s.textContent=name;});` +
+		`var c=f.elements['confirm'],btn=document.getElementById('col'+op+'Btn');` +
+		`if(c){c.placeholder=name;btn.disabled=true;btn.style.opacity='0.5';` +
+		`c.oninput=function(){var ok=c.value===name;btn.disabled=!ok;btn.style.opacity=ok?'':'0.5';};}` +
+		`m.style.display='flex';};` +
+		`document.addEventListener('reset',function(e){` +
+		`e.target.querySelectorAll('[data-kind]').forEach(function(d){d.style.display='none';});},true);` +
+		`}</script>`
+}
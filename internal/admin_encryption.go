@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+)
+
+func (p *AdminPanel) pageEncryption(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	status := p.service.EncryptionStatus()
+
+	var sb strings.Builder
+	if !status.Enabled {
+		sb.WriteString(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">` +
+			`Шифрование полей выключено. Включите <code>encryption.enabled: true</code> в конфиге.</div>`)
+	}
+	if status.LoadError != "" {
+		sb.WriteString(`<div class="mb-4 rounded-xl border border-rose-200 bg-rose-50 px-4 py-3 text-sm text-rose-700">Ключи не загружены: ` +
+			template.HTMLEscapeString(status.LoadError) + `</div>`)
+	}
+
+	sb.WriteString(`<dl class="grid gap-2 text-sm" style="grid-template-columns:max-content 1fr;margin-bottom:16px">`)
+	sb.WriteString(`<dt class="text-slate-500">Файл ключей</dt><dd class="font-mono">` + template.HTMLEscapeString(status.KeyFile) + `</dd>`)
+	sb.WriteString(`<dt class="text-slate-500">Активный ключ</dt><dd class="font-mono font-semibold">` + template.HTMLEscapeString(status.ActiveKey) + `</dd>`)
+	sb.WriteString(`<dt class="text-slate-500">Все ключи</dt><dd class="font-mono">` + template.HTMLEscapeString(strings.Join(status.KeyIDs, ", ")) + `</dd>`)
+	sb.WriteString(`</dl>`)
+
+	collections := make([]string, 0, len(status.Collections))
+	for name := range status.Collections {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+
+	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Коллекция", "Детерминированные", "Рандомизированные", "Действия"} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, name := range collections {
+		cfg := status.Collections[name]
+		rotateBtn := fmt.Sprintf(
+			`<button type="button" data-collection="%s" onclick="_encReencrypt(this)" `+
+				`style="display:inline-flex;align-items:center;padding:5px 12px;background:#6366f1;border:none;cursor:pointer;font-size:12px;font-weight:600;color:white;border-radius:8px;white-space:nowrap">Перешифровать</button>`,
+			template.HTMLEscapeString(name),
+		)
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono font-medium">%s</td>`, template.HTMLEscapeString(name)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(strings.Join(cfg.Deterministic, ", "))))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(strings.Join(cfg.Randomized, ", "))))
+		sb.WriteString(`<td class="px-4 py-3">` + rotateBtn + `</td>`)
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	if len(collections) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mt-4">Зашифрованных полей не настроено.</p>`)
+	}
+	sb.WriteString(`<p class="text-xs text-slate-400 mt-4">После ротации добавьте новый ключ в файл, сделайте его активным, перечитайте ключи и перешифруйте коллекции. ` +
+		`Старый ключ можно удалить из файла только после этого.</p>`)
+	sb.WriteString(encryptionScript())
+
+	actions := `<button onclick="_encReload(this)" class="inline-flex h-9 items-center rounded-xl bg-slate-600 px-4 text-sm font-semibold text-white hover:bg-slate-500">Перечитать ключи</button>`
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Шифрование полей", Actions: template.HTML(p.tenantSelector(ctx) + actions), ContentHTML: template.HTML(sb.String())},
+		},
+	}, nil
+}
+
+func encryptionScript() string {
+	return `<script>if(!window._encInit){window._encInit=true;` +
+		`window._encPost=function(url,fd,btn){btn.disabled=true;` +
+		`fetch(window.location.origin+url,{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(d.ok){if(d.message)alert(d.message);location.reload();}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){btn.disabled=false;alert('Ошибка сети');});};` +
+		`window._encReload=function(btn){_encPost('/admin/encryption/reload',new FormData(),btn);};` +
+		`window._encReencrypt=function(btn){` +
+		`var c=btn.getAttribute('data-collection');` +
+		`if(!confirm('Перешифровать все документы коллекции '+c+' активным ключом?'))return;` +
+		`var fd=new FormData();fd.append('collection',c);_encPost('/admin/encryption/reencrypt',fd,btn);};` +
+		`}</script>`
+}
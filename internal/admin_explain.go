@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// explainRequestFromQuery builds an explain request from a parsed custom query.
+func explainRequestFromQuery(q *shell.Query) (types.ExplainRequest, error) {
+	req := types.ExplainRequest{
+		Collection: q.Collection,
+		Filter:     q.Filter,
+		Sort:       q.Sort,
+		Limit:      q.Limit,
+		Skip:       q.Skip,
+	}
+	switch q.Operation {
+	case shell.OpFind, shell.OpFindOne, shell.OpCount, shell.OpDistinct:
+		req.Operation = "find"
+	case shell.OpAggregate:
+		req.Operation = "aggregate"
+		req.Pipeline = q.Pipeline
+	case shell.OpUpdateOne, shell.OpUpdateMany, shell.OpReplaceOne, shell.OpFindOneAndUpdate:
+		req.Operation = "update"
+	case shell.OpDeleteOne, shell.OpDeleteMany:
+		req.Operation = "delete"
+	default:
+		return req, fmt.Errorf("операция %q не поддерживает explain", q.Method)
+	}
+	return req, nil
+}
+
+// explainPlanHTML renders a query plan: summary, examined counts and stages.
+func explainPlanHTML(ctx *saiTypes.RequestCtx, plan types.QueryPlan) string {
+	var sb strings.Builder
+	summaryColor := "#059669"
+	if strings.HasPrefix(plan.PlanSummary, "COLLSCAN") {
+		summaryColor = "#e11d48"
+	}
+	sb.WriteString(`<div style="display:flex;flex-wrap:wrap;gap:8px 24px;margin-bottom:14px;font-size:13px">`)
+	sb.WriteString(`<div><span style="color:#64748b">План:</span> <b style="font-family:monospace;color:` + summaryColor + `">` + template.HTMLEscapeString(plan.PlanSummary) + `</b></div>`)
+	sb.WriteString(fmt.Sprintf(`<div><span style="color:#64748b">Ключей просмотрено:</span> <b>%d</b></div>`, plan.KeysExamined))
+	sb.WriteString(fmt.Sprintf(`<div><span style="color:#64748b">Документов просмотрено:</span> <b>%d</b></div>`, plan.DocsExamined))
+	if plan.Returned > 0 || plan.ExecutionTimeMs > 0 {
+		sb.WriteString(fmt.Sprintf(`<div><span style="color:#64748b">Возвращено:</span> <b>%d</b></div>`, plan.Returned))
+		sb.WriteString(fmt.Sprintf(`<div><span style="color:#64748b">Время:</span> <b>%d мс</b></div>`, plan.ExecutionTimeMs))
+	}
+	sb.WriteString(`</div>`)
+	if len(plan.Stages) > 0 {
+		sb.WriteString(`<div style="font-size:12px;color:#64748b;margin-bottom:4px">Стадии:</div>`)
+		sb.WriteString(`<div style="font-family:monospace;font-size:12px;margin-bottom:14px">` + template.HTMLEscapeString(strings.Join(plan.Stages, " → ")) + `</div>`)
+	}
+	if plan.WinningPlan != nil {
+		b, _ := ctx.Marshal(plan.WinningPlan)
+		sb.WriteString(`<div style="font-size:12px;color:#64748b;margin-bottom:4px">Выигравший план:</div>`)
+		sb.WriteString(`<pre style="font-size:11px;background:#f8fafc;border:1px solid #e2e8f0;border-radius:6px;padding:10px;overflow-x:auto;white-space:pre-wrap;word-break:break-word;max-height:400px;margin:0">` + template.HTMLEscapeString(string(b)) + `</pre>`)
+	}
+	return sb.String()
+}
+
+// handleAjaxSlowQueryPlan renders the plan captured for the latest slow
+// query with the given collection, operation and filter fingerprint.
+func (p *AdminPanel) handleAjaxSlowQueryPlan(ctx *saiTypes.RequestCtx) {
+	ctx.SetContentType("text/html; charset=utf-8")
+	docs, _, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
+		Collection: "_admin_slow_queries",
+		Filter: map[string]interface{}{
+			"collection":         string(ctx.QueryArgs().Peek("collection")),
+			"operation":          string(ctx.QueryArgs().Peek("operation")),
+			"filter_fingerprint": string(ctx.QueryArgs().Peek("fingerprint")),
+			"plan_summary":       map[string]interface{}{"$exists": true},
+		},
+		Sort:  map[string]int{"ts": -1},
+		Limit: 1,
+	})
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+	if len(docs) == 0 {
+		ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">План не сохранён для этого запроса.</p>`)
+		return
+	}
+	doc := docs[0]
+	plan := types.QueryPlan{
+		KeysExamined: toAnyInt64(doc["keys_examined"]),
+		DocsExamined: toAnyInt64(doc["docs_examined"]),
+		Stages:       toStringSlice(doc["plan_stages"]),
+	}
+	plan.PlanSummary, _ = doc["plan_summary"].(string)
+	ctx.Response.SetBodyString(`<p class="text-xs text-slate-400 mb-3">Снят ` + formatNano(toAnyInt64(doc["ts"])) + `</p>` + explainPlanHTML(ctx, plan))
+}
+
+func explainModal() string {
+	return `<div id="explainModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
+		`<div style="background:white;border-radius:16px;width:100%;max-width:900px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
+		`<div style="display:flex;align-items:flex-start;justify-content:space-between;padding:20px 24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<div style="flex:1;min-width:0;padding-right:16px">` +
+		`<h2 style="font-size:18px;font-weight:700;color:#0f172a;margin-bottom:4px">План запроса</h2>` +
+		`<code id="explainQueryText" style="font-size:11px;color:#64748b;word-break:break-all;display:block"></code>` +
+		`</div>` +
+		`<button onclick="document.getElementById('explainModal').style.display='none'" ` +
+		`style="width:32px;height:32px;flex-shrink:0;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
+		`</div>` +
+		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px"><div id="explainContent" class="text-sm text-slate-500">—</div></div>` +
+		`</div></div>`
+}
+
+func explainScript() string {
+	return `<script>if(!window._explainInit){window._explainInit=true;` +
+		`window._openExplain=function(btn){` +
+		`document.getElementById('explainModal').style.display='flex';` +
+		`document.getElementById('explainQueryText').textContent=btn.getAttribute('data-q')||'';` +
+		`var c=document.getElementById('explainContent');` +
+		`c.innerHTML='<p class="text-slate-500 text-sm">Загрузка...</p>';` +
+		`fetch(window.location.origin+btn.getAttribute('data-url'),{headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.text();})` +
+		`.then(function(h){c.innerHTML=h;})` +
+		`.catch(function(){c.innerHTML='<p class="text-rose-500 text-sm">Ошибка запроса</p>';});};` +
+		`}</script>`
+}
+
+func explainBtn(queryStr, url string) string {
+	return fmt.Sprintf(
+		`<button type="button" data-q="%s" data-url="%s" onclick="_openExplain(this)" `+
+			`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;background:none;border:none;cursor:pointer;white-space:nowrap" `+
+			`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">Explain</button>`,
+		template.HTMLEscapeString(queryStr), template.HTMLEscapeString(url),
+	)
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/export"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// handleExportCustomQuery downloads the full result of a read query. The
+// query and its param_<name> values come as for handleRunCustomQuery.
+func (p *AdminPanel) handleExportCustomQuery(ctx *saiTypes.RequestCtx) {
+	queryRaw := strings.TrimSpace(string(ctx.QueryArgs().Peek("query_raw")))
+	params := make(map[string]string)
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if name, ok := strings.CutPrefix(string(key), "param_"); ok {
+			params[name] = string(value)
+		}
+	})
+	q, err := shell.Bind(queryRaw, params)
+	if err != nil {
+		exportError(ctx, "Ошибка разбора: "+shell.Russian(err))
+		return
+	}
+	if shell.IsWrite(q.Operation) {
+		exportError(ctx, fmt.Sprintf("Операция %s не выгружается, только чтение", q.Method))
+		return
+	}
+	p.streamExport(ctx, q, queryRaw)
+}
+
+// handleExportCollection downloads the documents of a collection matching
+// the JSON filter of the browse panel.
+func (p *AdminPanel) handleExportCollection(ctx *saiTypes.RequestCtx) {
+	q := browseQueryArgs(ctx)
+	if q.Collection == "" {
+		exportError(ctx, "Коллекция не указана")
+		return
+	}
+	filter, sortDoc, _, err := q.parse()
+	if err != nil {
+		exportError(ctx, err.Error())
+		return
+	}
+	p.streamExport(ctx, &shell.Query{
+		Collection: q.Collection,
+		Method:     shell.OpFind,
+		Operation:  shell.OpFind,
+		Filter:     filter,
+		Sort:       sortDoc,
+	}, "")
+}
+
+// streamExport writes the rows of q in the requested format. CSV and XLSX
+// without a column selection read the result twice: once to collect the
+// columns and once to write the rows. Errors after the first byte can only
+// be logged. A non-empty queryRaw is logged as a custom query.
+func (p *AdminPanel) streamExport(ctx *saiTypes.RequestCtx, q *shell.Query, queryRaw string) {
+	format := string(ctx.QueryArgs().Peek("format"))
+	if !export.Valid(format) {
+		exportError(ctx, fmt.Sprintf("Неизвестный формат %q", format))
+		return
+	}
+	requested, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("limit")))
+	limit := p.service.ExportLimit(requested)
+	if format == export.FormatXLSX && limit > export.MaxXLSXRows {
+		limit = export.MaxXLSXRows
+	}
+	columns := export.ParseColumns(string(ctx.QueryArgs().Peek("columns")))
+
+	adminCtx := p.handler.AdminContext(ctx)
+	if len(columns) == 0 && export.NeedsColumns(format) {
+		set := export.NewColumnSet()
+		if _, err := p.service.ForEachQueryRow(adminCtx, q, limit, set.Add); err != nil {
+			exportError(ctx, err.Error())
+			return
+		}
+		columns = set.Columns()
+	}
+
+	name := unsafeFileChars.ReplaceAllString(q.Collection, "_")
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102-150405"), format)
+	ctx.SetContentType(export.ContentType(format))
+	ctx.Response.Header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		writer, err := export.NewWriter(format, w, columns)
+		if err != nil {
+			sai.Logger().Warn("Export failed", zap.String("collection", q.Collection), zap.Error(err))
+			return
+		}
+		rows, err := p.service.ForEachQueryRow(adminCtx, q, limit, writer.WriteRow)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			sai.Logger().Warn("Export failed", zap.String("collection", q.Collection), zap.Int("rows", rows), zap.Error(err))
+		}
+		if queryRaw != "" {
+			p.logCustomQuery(adminCtx, q.Collection, queryRaw, int64(rows))
+		}
+	})
+}
+
+func exportError(ctx *saiTypes.RequestCtx, message string) {
+	ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.Response.SetBodyString(message)
+}
+
+// exportBar is a download form for a result. hidden holds the request that
+// produced it as name/value pairs.
+func (p *AdminPanel) exportBar(action string, hidden [][2]string) string {
+	maxRows := p.service.ExportLimit(0)
+	var b strings.Builder
+	b.WriteString(`<form method="GET" action="` + action + `" style="display:flex;flex-wrap:wrap;align-items:center;gap:8px;margin-bottom:12px;font-size:12px">`)
+	for _, kv := range hidden {
+		b.WriteString(`<input type="hidden" name="` + template.HTMLEscapeString(kv[0]) + `" value="` + template.HTMLEscapeString(kv[1]) + `">`)
+	}
+	inputStyle := `height:32px;border:1px solid #cbd5e1;border-radius:8px;padding:0 10px;font-size:12px;outline:none`
+	b.WriteString(`<select name="format" style="` + inputStyle + `;background:white">` +
+		`<option value="csv">CSV</option><option value="xlsx">XLSX</option><option value="ndjson">NDJSON</option></select>`)
+	b.WriteString(`<input type="text" name="columns" placeholder="Колонки через запятую, по умолчанию все" style="` + inputStyle + `;flex:1;min-width:220px;font-family:monospace">`)
+	b.WriteString(fmt.Sprintf(`<label style="color:#64748b">Строк не больше <input type="number" name="limit" value="%d" min="1" max="%d" style="%s;width:110px"></label>`, maxRows, maxRows, inputStyle))
+	b.WriteString(`<button type="submit" style="height:32px;border:1px solid #c7d2fe;border-radius:8px;background:#eef2ff;color:#4338ca;font-size:12px;font-weight:600;padding:0 14px;cursor:pointer">⬇ Скачать</button>`)
+	b.WriteString(`</form>`)
+	return b.String()
+}
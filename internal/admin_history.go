@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+)
+
+var historyOperationLabels = map[string]string{
+	"initial": "исходное",
+	"create":  "создание",
+	"update":  "обновление",
+	"delete":  "удаление",
+	"restore": "восстановление",
+}
+
+var historyOperationColors = map[string]string{
+	"create":  "#059669",
+	"update":  "#6366f1",
+	"delete":  "#e11d48",
+	"restore": "#d97706",
+}
+
+func (p *AdminPanel) handleAjaxDocumentHistory(ctx *saiTypes.RequestCtx) {
+	collection := string(ctx.QueryArgs().Peek("collection"))
+	internalID := string(ctx.QueryArgs().Peek("internal_id"))
+
+	ctx.SetContentType("text/html; charset=utf-8")
+
+	resp, err := p.service.DocumentHistory(p.handler.AdminContext(ctx), collection, internalID, nil)
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+	if len(resp.Data) == 0 {
+		ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">История не найдена.</p>`)
+		return
+	}
+
+	var sb strings.Builder
+	var previous map[string]interface{}
+	for _, v := range resp.Data {
+		color := historyOperationColors[v.Operation]
+		if color == "" {
+			color = "#64748b"
+		}
+		label := historyOperationLabels[v.Operation]
+		if label == "" {
+			label = v.Operation
+		}
+
+		sb.WriteString(`<div style="border-left:3px solid ` + color + `;padding:4px 0 12px 14px;margin-bottom:8px">`)
+		sb.WriteString(fmt.Sprintf(`<div style="display:flex;gap:10px;align-items:baseline;font-size:13px"><span style="font-weight:700">v%d</span>`, v.Version))
+		sb.WriteString(`<span style="color:` + color + `;font-weight:600">` + template.HTMLEscapeString(label) + `</span>`)
+		if v.Time > 0 {
+			sb.WriteString(`<span style="color:#64748b">` + formatNano(v.Time) + `</span>`)
+		}
+		if v.OperationID != "" {
+			sb.WriteString(`<span style="color:#94a3b8;font-family:monospace;font-size:11px">` + template.HTMLEscapeString(v.OperationID) + `</span>`)
+		}
+		sb.WriteString(`</div>`)
+
+		switch {
+		case v.Deleted:
+			sb.WriteString(`<p style="font-size:12px;color:#e11d48;margin-top:4px">Документ удалён.</p>`)
+			previous = nil
+		case v.Document == nil:
+			sb.WriteString(`<p style="font-size:12px;color:#94a3b8;margin-top:4px">Состояние после операции не сохранено.</p>`)
+		case previous == nil:
+			docJSON, _ := json.MarshalIndent(v.Document, "", "  ")
+			sb.WriteString(`<pre style="font-size:11px;font-family:monospace;white-space:pre-wrap;word-break:break-all;background:#f8fafc;border-radius:8px;padding:8px;margin-top:6px">` +
+				template.HTMLEscapeString(string(docJSON)) + `</pre>`)
+			previous = v.Document
+		default:
+			sb.WriteString(historyDiff(previous, v.Document))
+			previous = v.Document
+		}
+		sb.WriteString(`</div>`)
+	}
+
+	ctx.Response.SetBodyString(sb.String())
+}
+
+// historyDiff renders the fields that differ between two versions, ignoring
+// the timestamps every write changes.
+func historyDiff(before, after map[string]interface{}) string {
+	a := map[string]string{}
+	b := map[string]string{}
+	flattenForDiff("", before, a)
+	flattenForDiff("", after, b)
+
+	keySet := map[string]struct{}{}
+	for k := range a {
+		keySet[k] = struct{}{}
+	}
+	for k := range b {
+		keySet[k] = struct{}{}
+	}
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		if k != "cr_time" && k != "ch_time" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(`<table style="font-size:12px;font-family:monospace;margin-top:6px;border-collapse:collapse">`)
+	changes := 0
+	for _, k := range keys {
+		oldV, hadOld := a[k]
+		newV, hasNew := b[k]
+		if hadOld && hasNew && oldV == newV {
+			continue
+		}
+		changes++
+		sb.WriteString(`<tr><td style="padding:2px 10px 2px 0;color:#475569;vertical-align:top">` + template.HTMLEscapeString(k) + `</td><td style="padding:2px 0">`)
+		if hadOld {
+			sb.WriteString(`<span style="background:#ffe4e6;color:#9f1239;padding:0 4px;border-radius:4px;text-decoration:line-through">` + template.HTMLEscapeString(oldV) + `</span> `)
+		}
+		if hasNew {
+			sb.WriteString(`<span style="background:#dcfce7;color:#166534;padding:0 4px;border-radius:4px">` + template.HTMLEscapeString(newV) + `</span>`)
+		}
+		sb.WriteString(`</td></tr>`)
+	}
+	sb.WriteString(`</table>`)
+	if changes == 0 {
+		return `<p style="font-size:12px;color:#94a3b8;margin-top:4px">Без изменений.</p>`
+	}
+	return sb.String()
+}
+
+func flattenForDiff(prefix string, v interface{}, out map[string]string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		if len(m) == 0 && prefix != "" {
+			out[prefix] = "{}"
+			return
+		}
+		for k, item := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenForDiff(key, item, out)
+		}
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		out[prefix] = fmt.Sprint(v)
+		return
+	}
+	out[prefix] = string(raw)
+}
+
+func documentHistoryModal() string {
+	return `<div id="docHistoryModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
+		`<div style="background:white;border-radius:16px;width:100%;max-width:900px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
+		`<div style="display:flex;align-items:center;justify-content:space-between;padding:20px 24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<h2 style="font-size:18px;font-weight:700;color:#0f172a">История документа</h2>` +
+		`<button onclick="document.getElementById('docHistoryModal').style.display='none'" style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
+		`</div>` +
+		`<div id="docHistoryContent" style="flex:1 1 auto;overflow-y:auto;padding:24px"></div>` +
+		`</div></div>`
+}
+
+func documentHistoryScript() string {
+	return `<script>if(!window._docHistoryInit){window._docHistoryInit=true;` +
+		`window._docHistory=function(collection,id){` +
+		`document.getElementById('docHistoryContent').innerHTML='<p style="font-size:13px;color:#94a3b8">Загрузка...</p>';` +
+		`document.getElementById('docHistoryModal').style.display='flex';` +
+		`_loadPanel('/admin/ajax/document-history?collection='+encodeURIComponent(collection)+'&internal_id='+encodeURIComponent(id),'docHistoryContent',null);` +
+		`};}</script>`
+}
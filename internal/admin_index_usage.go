@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// pageIndexUsage lists collections for the index usage report. The number
+// of days after which an index counts as unused is a page parameter, so it
+// stays part of the panel URLs.
+func (p *AdminPanel) pageIndexUsage(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	collections, err := p.service.GetRepo().ListCollectionNames(p.handler.AdminContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	days, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("days")))
+
+	items := make([]twoColItem, 0, len(collections))
+	for _, c := range collections {
+		if !isAdminCollection(c) {
+			u := "/admin/ajax/index-usage?collection=" + url.QueryEscape(c)
+			if days > 0 {
+				u += "&days=" + strconv.Itoa(days)
+			}
+			items = append(items, twoColItem{Label: c, URL: u})
+		}
+	}
+
+	value := ""
+	if days > 0 {
+		value = strconv.Itoa(days)
+	}
+	actions := p.tenantSelector(ctx) +
+		`<form method="GET" style="display:inline-flex;align-items:center;gap:6px;font-size:12px;color:#64748b">Не используется дней` +
+		`<input type="number" name="days" min="1" value="` + value + `" placeholder="30" onchange="this.form.submit()" ` +
+		`style="height:32px;width:80px;border:1px solid #cbd5e1;border-radius:8px;padding:0 10px;font-size:12px;outline:none"></form>`
+
+	scripts := twoColScript() + indexScript()
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Использование индексов", Actions: template.HTML(actions), ContentHTML: template.HTML(twoColPage(items, "iuPanel", scripts))},
+		},
+	}, nil
+}
+
+func (p *AdminPanel) handleAjaxIndexUsage(ctx *saiTypes.RequestCtx) {
+	collection := string(ctx.QueryArgs().Peek("collection"))
+	ctx.SetContentType("text/html; charset=utf-8")
+
+	if collection == "" {
+		ctx.Response.SetBodyString(`<p style="font-size:13px;color:#94a3b8">Выберите коллекцию.</p>`)
+		return
+	}
+	days, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("days")))
+
+	report, err := p.service.IndexUsageReport(p.handler.AdminContext(ctx), collection, days)
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+
+	var unused, shadowed int
+	var candidateSize, totalSize int64
+	for _, entry := range report.Indexes {
+		totalSize += entry.Usage.Size
+		if entry.Unused {
+			unused++
+		}
+		if entry.ShadowedBy != "" {
+			shadowed++
+		}
+		if entry.Unused || entry.ShadowedBy != "" {
+			candidateSize += entry.Usage.Size
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<dl class="grid gap-2 text-sm" style="grid-template-columns:max-content 1fr;margin-bottom:16px">`)
+	sb.WriteString(fmt.Sprintf(`<dt class="text-slate-500">Индексов</dt><dd>%d, всего %s</dd>`, len(report.Indexes), formatBytes(totalSize)))
+	sb.WriteString(fmt.Sprintf(`<dt class="text-slate-500">Не используются %d дн.</dt><dd>%d</dd>`, report.UnusedDays, unused))
+	sb.WriteString(fmt.Sprintf(`<dt class="text-slate-500">Перекрыты другими</dt><dd>%d</dd>`, shadowed))
+	sb.WriteString(fmt.Sprintf(`<dt class="text-slate-500">Можно освободить</dt><dd>%s</dd>`, formatBytes(candidateSize)))
+	sb.WriteString(`</dl>`)
+
+	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Имя", "Ключи", "Операций", "С", "Размер", "Статус", "Шаблоны запросов", ""} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, entry := range report.Indexes {
+		idx := entry.Index
+		rowClass := "hover:bg-slate-50"
+		if entry.Unused || entry.ShadowedBy != "" {
+			rowClass = "bg-amber-50"
+		}
+		sb.WriteString(`<tr class="` + rowClass + `">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(idx.Name)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(formatIndexKeys(idx.CreateIndexRequest(collection).OrderedKeys))))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d</td>`, entry.Usage.Ops))
+		sb.WriteString(`<td class="px-4 py-3 text-xs text-slate-500" style="white-space:nowrap">` + formatRetentionTime(entry.Usage.Since) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3" style="white-space:nowrap">` + formatBytes(entry.Usage.Size) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3 text-xs">` + indexUsageBadges(entry) + indexOptionBadges(idx) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3 font-mono text-xs">` + indexUsageShapes(entry) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3" style="white-space:nowrap">` + indexActions(collection, idx, "iuPanel") + `</td>`)
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+
+	if len(report.Indexes) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mt-4">Индексов нет.</p>`)
+	}
+	sb.WriteString(`<p class="text-xs text-slate-400 mt-4">Счётчики операций ведёт MongoDB с момента создания индекса или перезапуска сервера, ` +
+		`поэтому индекс, наблюдаемый меньше заданного срока, неиспользуемым не считается. ` +
+		`Шаблоны берутся из частых и медленных запросов; серым показаны те, где индекс может помочь только первым ключом. ` +
+		`Перед удалением индекс можно скрыть и проверить, что запросы не замедлились.</p>`)
+
+	ctx.Response.SetBodyString(sb.String())
+}
+
+func indexUsageBadges(entry types.IndexUsageEntry) string {
+	var b strings.Builder
+	if entry.Unused {
+		b.WriteString(`<span class="inline-flex items-center rounded px-2 py-0.5 mr-1 mb-1 font-medium bg-rose-100 text-rose-700">не используется</span>`)
+	}
+	if entry.ShadowedBy != "" {
+		b.WriteString(`<span title="` + template.HTMLEscapeString(entry.ShadowedBy) + `" class="inline-flex items-center rounded px-2 py-0.5 mr-1 mb-1 font-medium bg-amber-100 text-amber-700">` +
+			template.HTMLEscapeString(redundantReasonLabels[entry.ShadowReason]+": "+entry.ShadowedBy) + `</span>`)
+	}
+	return b.String()
+}
+
+func indexUsageShapes(entry types.IndexUsageEntry) string {
+	calls := func(shape types.QueryShape) string {
+		s := fmt.Sprintf(" ×%d", shape.Calls)
+		if shape.SlowCalls > 0 {
+			s += fmt.Sprintf(`, <span class="text-rose-600">медленных %d</span>`, shape.SlowCalls)
+		}
+		return s
+	}
+	lines := make([]string, 0, len(entry.Shapes)+len(entry.PartialShapes))
+	for _, shape := range entry.Shapes {
+		lines = append(lines, formatShape(shape)+`<span class="text-slate-400">`+calls(shape)+`</span>`)
+	}
+	for _, shape := range entry.PartialShapes {
+		lines = append(lines, `<span class="text-slate-400">`+formatShape(shape)+calls(shape)+`</span>`)
+	}
+	if len(lines) == 0 {
+		return `<span class="text-slate-400">—</span>`
+	}
+	return strings.Join(lines, "<br>")
+}
@@ -0,0 +1,394 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+type metricsRange struct {
+	key   string
+	label string
+	span  time.Duration
+	step  time.Duration
+}
+
+// metricsRanges are the time ranges of the dashboard. Steps keep a chart
+// under about a hundred points and divide a day, so periods line up with
+// the buckets MongoDB groups by.
+var metricsRanges = []metricsRange{
+	{"1h", "1 час", time.Hour, time.Minute},
+	{"6h", "6 часов", 6 * time.Hour, 5 * time.Minute},
+	{"24h", "24 часа", 24 * time.Hour, 15 * time.Minute},
+	{"7d", "7 дней", 7 * 24 * time.Hour, 2 * time.Hour},
+	{"30d", "30 дней", 30 * 24 * time.Hour, 8 * time.Hour},
+}
+
+var metricsOperations = []string{"find", "aggregate", "create", "update", "delete"}
+
+func (p *AdminPanel) pageMetrics(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	adminCtx := p.handler.AdminContext(ctx)
+	args := ctx.QueryArgs()
+	collection := string(args.Peek("collection"))
+	operation := string(args.Peek("operation"))
+	rng := metricsRanges[2]
+	for _, r := range metricsRanges {
+		if r.key == string(args.Peek("range")) {
+			rng = r
+		}
+	}
+
+	to := time.Now().Truncate(time.Minute).Add(time.Minute)
+	report, err := p.service.MetricsReport(adminCtx, types.MetricsQuery{
+		Collection: collection,
+		Operation:  operation,
+		From:       to.Add(-rng.span),
+		To:         to,
+		Step:       rng.step,
+	})
+	if err != nil {
+		return nil, err
+	}
+	collections, err := p.service.GetRepo().ListCollectionNames(adminCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	if !p.service.MetricsEnabled() {
+		sb.WriteString(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">` +
+			`Сбор метрик выключен. Включите <code>metrics.enabled: true</code> в конфиге.</div>`)
+	}
+
+	total := report.Total
+	sb.WriteString(`<div style="display:grid;grid-template-columns:repeat(auto-fill,minmax(160px,1fr));gap:12px;margin-bottom:20px">`)
+	sb.WriteString(metricsCard("Операций", formatCount(total.Count), fmt.Sprintf("%s в минуту", formatMetric(perMinute(total.Count, rng.span)))))
+	sb.WriteString(metricsCard("Ошибок", formatCount(total.Errors), errorRate(total)))
+	sb.WriteString(metricsCard("Задержка p50", formatMs(total.P50Ms), "среднее "+formatMs(total.AvgMs)))
+	sb.WriteString(metricsCard("Задержка p95", formatMs(total.P95Ms), "p99 "+formatMs(total.P99Ms)))
+	sb.WriteString(metricsCard("Прочитано", formatCount(total.Read), "документов"))
+	sb.WriteString(metricsCard("Записано", formatCount(total.Written), "создано, изменено, удалено"))
+	sb.WriteString(`</div>`)
+
+	if total.Count == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mb-4">За выбранный период операций нет.</p>`)
+	}
+
+	minutes := rng.step.Minutes()
+	times := make([]time.Time, len(report.Points))
+	rate := make([]float64, len(report.Points))
+	errorsPct := make([]float64, len(report.Points))
+	p50 := make([]float64, len(report.Points))
+	p95 := make([]float64, len(report.Points))
+	p99 := make([]float64, len(report.Points))
+	read := make([]float64, len(report.Points))
+	written := make([]float64, len(report.Points))
+	for i, pt := range report.Points {
+		times[i] = pt.Time
+		rate[i] = float64(pt.Count) / minutes
+		read[i] = float64(pt.Read) / minutes
+		written[i] = float64(pt.Written) / minutes
+		if pt.Count == 0 {
+			errorsPct[i], p50[i], p95[i], p99[i] = math.NaN(), math.NaN(), math.NaN(), math.NaN()
+			continue
+		}
+		errorsPct[i] = float64(pt.Errors) / float64(pt.Count) * 100
+		p50[i], p95[i], p99[i] = pt.P50Ms, pt.P95Ms, pt.P99Ms
+	}
+
+	sb.WriteString(`<div style="display:grid;grid-template-columns:repeat(auto-fit,minmax(440px,1fr));gap:16px">`)
+	sb.WriteString(svgChart("Операций в минуту", "", times, []chartSeries{{"операций", "#6366f1", rate}}))
+	sb.WriteString(svgChart("Ошибки", "%", times, []chartSeries{{"ошибок", "#e11d48", errorsPct}}))
+	sb.WriteString(svgChart("Задержка", "мс", times, []chartSeries{{"p50", "#10b981", p50}, {"p95", "#f59e0b", p95}, {"p99", "#e11d48", p99}}))
+	sb.WriteString(svgChart("Документов в минуту", "", times, []chartSeries{{"прочитано", "#6366f1", read}, {"записано", "#10b981", written}}))
+	sb.WriteString(`</div>`)
+
+	var rows strings.Builder
+	rows.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	rows.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Коллекция", "Операция", "Операций", "Ошибок", "p50", "p95", "p99", "Прочитано", "Записано"} {
+		rows.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	rows.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, r := range report.Rows {
+		link := metricsURL(rng.key, r.Collection, r.Operation)
+		rows.WriteString(`<tr class="hover:bg-slate-50">`)
+		rows.WriteString(fmt.Sprintf(`<td class="px-4 py-3"><a href="%s" class="font-medium text-indigo-600 hover:underline">%s</a></td>`,
+			template.HTMLEscapeString(metricsURL(rng.key, r.Collection, "")), template.HTMLEscapeString(r.Collection)))
+		rows.WriteString(fmt.Sprintf(`<td class="px-4 py-3"><a href="%s" class="font-mono text-xs text-indigo-600 hover:underline">%s</a></td>`,
+			template.HTMLEscapeString(link), template.HTMLEscapeString(r.Operation)))
+		rows.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, formatCount(r.Count)))
+		errCell := formatCount(r.Errors)
+		if r.Errors > 0 {
+			errCell = `<span class="text-rose-600">` + errCell + ` (` + errorRate(r.MetricsPoint) + `)</span>`
+		}
+		rows.WriteString(`<td class="px-4 py-3">` + errCell + `</td>`)
+		for _, ms := range []float64{r.P50Ms, r.P95Ms, r.P99Ms} {
+			rows.WriteString(`<td class="px-4 py-3">` + formatMs(ms) + `</td>`)
+		}
+		rows.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td><td class="px-4 py-3">%s</td>`, formatCount(r.Read), formatCount(r.Written)))
+		rows.WriteString(`</tr>`)
+	}
+	rows.WriteString(`</tbody></table></div>`)
+	if len(report.Rows) == 0 {
+		rows.WriteString(`<p class="text-slate-500 text-sm mt-4">Нет данных.</p>`)
+	}
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Метрики", Actions: template.HTML(p.tenantSelector(ctx) + metricsFilter(rng.key, collection, operation, collections)), ContentHTML: template.HTML(sb.String())},
+			{Title: "По коллекциям и операциям", ContentHTML: template.HTML(rows.String())},
+		},
+	}, nil
+}
+
+func metricsURL(rangeKey, collection, operation string) string {
+	v := url.Values{}
+	v.Set("range", rangeKey)
+	if collection != "" {
+		v.Set("collection", collection)
+	}
+	if operation != "" {
+		v.Set("operation", operation)
+	}
+	return "/admin/pages/metrics?" + v.Encode()
+}
+
+func metricsFilter(rangeKey, collection, operation string, collections []string) string {
+	sel := `height:32px;border:1px solid #cbd5e1;border-radius:8px;padding:0 10px;font-size:12px;outline:none;background:white`
+	option := func(value, label, current string) string {
+		selected := ""
+		if value == current {
+			selected = " selected"
+		}
+		return `<option value="` + template.HTMLEscapeString(value) + `"` + selected + `>` + template.HTMLEscapeString(label) + `</option>`
+	}
+
+	var b strings.Builder
+	b.WriteString(`<form method="GET" style="display:inline-flex;align-items:center;gap:6px">`)
+	b.WriteString(`<select name="collection" onchange="this.form.submit()" style="` + sel + `">` + option("", "Все коллекции", collection))
+	for _, c := range collections {
+		if !isAdminCollection(c) {
+			b.WriteString(option(c, c, collection))
+		}
+	}
+	b.WriteString(`</select>`)
+	b.WriteString(`<select name="operation" onchange="this.form.submit()" style="` + sel + `">` + option("", "Все операции", operation))
+	for _, op := range metricsOperations {
+		b.WriteString(option(op, op, operation))
+	}
+	b.WriteString(`</select>`)
+	b.WriteString(`<select name="range" onchange="this.form.submit()" style="` + sel + `">`)
+	for _, r := range metricsRanges {
+		b.WriteString(option(r.key, r.label, rangeKey))
+	}
+	b.WriteString(`</select></form>`)
+	return b.String()
+}
+
+func metricsCard(label, value, note string) string {
+	return `<div class="rounded-xl border border-slate-200 px-4 py-3">` +
+		`<div class="text-xs text-slate-500">` + label + `</div>` +
+		`<div class="text-xl font-semibold text-slate-900">` + value + `</div>` +
+		`<div class="text-xs text-slate-400">` + note + `</div></div>`
+}
+
+func perMinute(count int64, span time.Duration) float64 {
+	return float64(count) / span.Minutes()
+}
+
+func errorRate(p types.MetricsPoint) string {
+	if p.Count == 0 {
+		return "—"
+	}
+	return formatMetric(float64(p.Errors)/float64(p.Count)*100) + "%"
+}
+
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return s
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + " " + s[i:]
+	}
+	return s
+}
+
+func formatMs(ms float64) string {
+	if ms == 0 {
+		return "—"
+	}
+	return formatMetric(ms) + " мс"
+}
+
+// formatMetric keeps about three significant digits.
+func formatMetric(v float64) string {
+	switch {
+	case v == 0:
+		return "0"
+	case math.Abs(v) < 10:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case math.Abs(v) < 100:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+type chartSeries struct {
+	label  string
+	color  string
+	values []float64
+}
+
+// svgChart draws series over times as lines on one y axis starting at
+// zero. NaN values are gaps. Hovering a period shows its values.
+func svgChart(title, unit string, times []time.Time, series []chartSeries) string {
+	const (
+		width  = 720.0
+		height = 200.0
+		left   = 52.0
+		right  = 12.0
+		top    = 12.0
+		bottom = 24.0
+	)
+	plotW, plotH := width-left-right, height-top-bottom
+
+	maxV := 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			if !math.IsNaN(v) && v > maxV {
+				maxV = v
+			}
+		}
+	}
+	maxV = niceCeil(maxV)
+
+	n := len(times)
+	x := func(i int) float64 {
+		if n < 2 {
+			return left + plotW/2
+		}
+		return left + plotW*float64(i)/float64(n-1)
+	}
+	y := func(v float64) float64 { return top + plotH*(1-v/maxV) }
+
+	var b strings.Builder
+	b.WriteString(`<div class="rounded-xl border border-slate-200 p-4">`)
+	b.WriteString(`<div style="display:flex;align-items:center;gap:12px;margin-bottom:8px">`)
+	b.WriteString(`<div class="text-sm font-semibold text-slate-700" style="flex:1">` + template.HTMLEscapeString(title) + `</div>`)
+	for _, s := range series {
+		b.WriteString(`<span style="display:inline-flex;align-items:center;gap:4px;font-size:11px;color:#64748b">` +
+			`<span style="width:10px;height:3px;border-radius:2px;background:` + s.color + `"></span>` + template.HTMLEscapeString(s.label) + `</span>`)
+	}
+	b.WriteString(`</div>`)
+	b.WriteString(fmt.Sprintf(`<svg viewBox="0 0 %.0f %.0f" style="width:100%%;height:auto;display:block" font-size="10" font-family="sans-serif">`, width, height))
+
+	for i := 0; i <= 4; i++ {
+		v := maxV * float64(i) / 4
+		yy := y(v)
+		b.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e2e8f0"/>`, left, yy, width-right, yy))
+		b.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" text-anchor="end" fill="#94a3b8">%s</text>`, left-6, yy+3, template.HTMLEscapeString(formatMetric(v)+unit)))
+	}
+
+	layout := "15:04"
+	if n > 0 && times[n-1].Sub(times[0]) > 24*time.Hour {
+		layout = "02.01 15:04"
+	}
+	for _, i := range chartTicks(n, 6) {
+		anchor := "middle"
+		if i == 0 {
+			anchor = "start"
+		} else if i == n-1 {
+			anchor = "end"
+		}
+		b.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" text-anchor="%s" fill="#94a3b8">%s</text>`, x(i), height-6, anchor, times[i].Local().Format(layout)))
+	}
+
+	for _, s := range series {
+		var segment []string
+		flush := func() {
+			switch len(segment) {
+			case 0:
+			case 1:
+				xy := strings.Split(segment[0], ",")
+				b.WriteString(fmt.Sprintf(`<circle cx="%s" cy="%s" r="2" fill="%s"/>`, xy[0], xy[1], s.color))
+			default:
+				b.WriteString(fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-linejoin="round"/>`, strings.Join(segment, " "), s.color))
+			}
+			segment = segment[:0]
+		}
+		for i, v := range s.values {
+			if math.IsNaN(v) {
+				flush()
+				continue
+			}
+			segment = append(segment, fmt.Sprintf("%.1f,%.1f", x(i), y(v)))
+		}
+		flush()
+	}
+
+	// Transparent columns carry the tooltips of each period.
+	colW := plotW
+	if n > 1 {
+		colW = plotW / float64(n-1)
+	}
+	for i := range times {
+		lines := []string{times[i].Local().Format("02.01.2006 15:04")}
+		for _, s := range series {
+			v := "—"
+			if !math.IsNaN(s.values[i]) {
+				v = formatMetric(s.values[i]) + unit
+			}
+			lines = append(lines, s.label+": "+v)
+		}
+		b.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="transparent"><title>%s</title></rect>`,
+			x(i)-colW/2, top, colW, plotH, template.HTMLEscapeString(strings.Join(lines, "\n"))))
+	}
+
+	b.WriteString(`</svg></div>`)
+	return b.String()
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten, so the grid
+// lines get round labels. It is at least 1.
+func niceCeil(v float64) float64 {
+	if v <= 1 {
+		return 1
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*pow {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
+
+// chartTicks picks up to max evenly spaced indexes out of n, always
+// including the first and the last.
+func chartTicks(n, max int) []int {
+	if n == 0 {
+		return nil
+	}
+	if n <= max {
+		ticks := make([]int, n)
+		for i := range ticks {
+			ticks[i] = i
+		}
+		return ticks
+	}
+	ticks := make([]int, max)
+	for i := range ticks {
+		ticks[i] = int(math.Round(float64(i) * float64(n-1) / float64(max-1)))
+	}
+	return ticks
+}
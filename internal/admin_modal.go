@@ -40,7 +40,7 @@ func modalScript() string {
 		`fetch(window.location.origin+action,{method:'POST',headers:{'X-Requested-With':'fetch'},body:new FormData(e.target)})` +
 		`.then(function(r){return r.json();})` +
 		`.then(function(d){btn.disabled=false;btn.textContent=orig;` +
-		`if(d.ok){if(modalID)_closeModal(modalID,formID,errID);location.reload();}` +
+		`if(d.ok){if(modalID)_closeModal(modalID,formID,errID);if(d.message&&e.target.dataset.notify)alert(d.message);location.reload();}` +
 		`else{err.textContent=d.error||'Ошибка';err.style.display='block';}})` +
 		`.catch(function(ex){btn.disabled=false;btn.textContent=orig;});` +
 		`}}</script>`
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/saiset-co/sai-service/admin"
 	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/internal/shell"
 	"github.com/saiset-co/sai-storage/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -31,7 +34,7 @@ func (p *AdminPanel) pageQueryStats(ctx *saiTypes.RequestCtx) (*admin.PageData,
 	page := pageNum(ctx)
 	skip := (page - 1) * adminPerPage
 
-	docs, total, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	docs, total, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
 		Collection: "_admin_query_stats",
 		Sort:       map[string]int{"count": -1},
 		Limit:      adminPerPage,
@@ -104,7 +107,7 @@ func (p *AdminPanel) pageQueryStats(ctx *saiTypes.RequestCtx) (*admin.PageData,
 		Sections: []admin.Section{
 			{
 				Title:       "Частые запросы",
-				Actions:     template.HTML(clearBtn("/admin/query-stats/clear", "Очистить всё")),
+				Actions:     template.HTML(p.tenantSelector(ctx) + clearBtn("/admin/query-stats/clear", "Очистить всё")),
 				ContentHTML: template.HTML(sb.String()),
 			},
 		},
@@ -128,9 +131,11 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 		{Key: "last_seen", Value: bson.D{{Key: "$max", Value: "$ts"}}},
 		{Key: "filter_keys", Value: bson.D{{Key: "$first", Value: "$filter_keys"}}},
 		{Key: "operation_id", Value: bson.D{{Key: "$last", Value: "$operation_id"}}},
+		{Key: "plan_summary", Value: bson.D{{Key: "$last", Value: "$plan_summary"}}},
 	}}}
 
-	countDocs, _, _ := p.service.GetRepo().AggregateDocuments(context.Background(), types.AggregateDocumentsRequest{
+	adminCtx := p.handler.AdminContext(ctx)
+	countDocs, _, _ := p.service.GetRepo().AggregateDocuments(adminCtx, types.AggregateDocumentsRequest{
 		Collection: "_admin_slow_queries",
 		Pipeline:   types.OrderedPipeline{sortByTs, groupStage, bson.D{{Key: "$count", Value: "n"}}},
 	})
@@ -139,7 +144,7 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 		total = toAnyInt64(countDocs[0]["n"])
 	}
 
-	docs, _, err := p.service.GetRepo().AggregateDocuments(context.Background(), types.AggregateDocumentsRequest{
+	docs, _, err := p.service.GetRepo().AggregateDocuments(adminCtx, types.AggregateDocumentsRequest{
 		Collection: "_admin_slow_queries",
 		Pipeline: types.OrderedPipeline{
 			sortByTs,
@@ -164,7 +169,7 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 
 	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
-	for _, h := range []string{"Коллекция", "Операция", "Вызовов", "Последний", "Поля фильтра", "Макс. мс", "Макс. docs", "Действия"} {
+	for _, h := range []string{"Коллекция", "Операция", "Вызовов", "Последний", "Поля фильтра", "Макс. мс", "Макс. docs", "План", "Действия"} {
 		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
 	}
 	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
@@ -198,6 +203,13 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 			template.HTMLEscapeString(collection), template.HTMLEscapeString(string(keysJSON)),
 		)
 		dropdownItems := []string{idxBtn}
+		planSummary, _ := doc["plan_summary"].(string)
+		if planSummary != "" {
+			fingerprint, _ := idMap["filter_fingerprint"].(string)
+			planURL := "/admin/ajax/slow-query-plan?collection=" + url.QueryEscape(collection) +
+				"&operation=" + url.QueryEscape(operation) + "&fingerprint=" + url.QueryEscape(fingerprint)
+			dropdownItems = append(dropdownItems, explainBtn(queryStr, planURL))
+		}
 
 		docsCell := slowDocsCell(maxDocs)
 
@@ -209,6 +221,7 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-center">%d</td>`, len(fKeys)))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-semibold text-rose-600">%d мс</td>`, durationMs))
 		sb.WriteString(`<td class="px-4 py-3">` + docsCell + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3 font-mono text-xs">` + template.HTMLEscapeString(planSummary) + `</td>`)
 		sb.WriteString(`<td class="px-4 py-3">` + sdWrap(viewBtn, "#6366f1", dropdownItems) + `</td>`)
 		sb.WriteString(`</tr>`)
 	}
@@ -221,13 +234,15 @@ func (p *AdminPanel) pageSlowQueries(ctx *saiTypes.RequestCtx) (*admin.PageData,
 
 	sb.WriteString(queryPreviewModal())
 	sb.WriteString(queryPreviewScript())
+	sb.WriteString(explainModal())
+	sb.WriteString(explainScript())
 	sb.WriteString(indexCreatorModal())
 	sb.WriteString(indexCreatorScript())
 	sb.WriteString(sdScript())
 
-	actions := template.HTML(
+	actions := template.HTML(p.tenantSelector(ctx) +
 		openModalBtn("Настроить порог", "thresholdModal", "inline-flex h-9 items-center rounded-xl bg-slate-600 px-4 text-sm font-semibold text-white hover:bg-slate-500") +
-			clearBtn("/admin/slow-queries/clear", "Очистить всё"),
+		clearBtn("/admin/slow-queries/clear", "Очистить всё"),
 	)
 
 	return &admin.PageData{
@@ -248,7 +263,7 @@ func (p *AdminPanel) pageCustomQueries(ctx *saiTypes.RequestCtx) (*admin.PageDat
 	sb.WriteString(jsSearch("Поиск по имени или запросу...", "tbl-custom-queries"))
 	sb.WriteString(`<div class="overflow-x-auto"><table id="tbl-custom-queries" class="min-w-full divide-y divide-slate-200 text-sm">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
-	for _, h := range []string{"Имя", "Описание", "Действия"} {
+	for _, h := range []string{"Имя", "Описание", "Расписание", "Действия"} {
 		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
 	}
 	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
@@ -273,11 +288,20 @@ func (p *AdminPanel) pageCustomQueries(ctx *saiTypes.RequestCtx) (*admin.PageDat
 				`style="display:inline-flex;align-items:center;padding:5px 12px;background:#6366f1;border:none;cursor:pointer;font-size:12px;font-weight:600;color:white;border-radius:8px 0 0 8px;white-space:nowrap">Детали</button>`,
 			template.HTMLEscapeString(queryFull),
 		)
+		writeAttr := ""
+		if shell.IsWrite(operation) {
+			writeAttr = ` data-write="1"`
+		}
+		paramsJSON := "[]"
+		if params, err := shell.Params(queryFull); err == nil && len(params) > 0 {
+			b, _ := json.Marshal(params)
+			paramsJSON = string(b)
+		}
 		runBtn := fmt.Sprintf(
-			`<button type="button" data-query="%s" onclick="_runCQ(this)" `+
+			`<button type="button" data-query="%s" data-op="%s" data-params="%s"%s onclick="_runCQ(this)" `+
 				`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;background:none;border:none;cursor:pointer;white-space:nowrap" `+
 				`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">Запустить</button>`,
-			template.HTMLEscapeString(queryFull),
+			template.HTMLEscapeString(queryFull), template.HTMLEscapeString(operation), template.HTMLEscapeString(paramsJSON), writeAttr,
 		)
 		editBtn := fmt.Sprintf(
 			`<button type="button" data-id="%s" data-query="%s" data-name="%s" data-desc="%s" onclick="_openCQEdit(this)" `+
@@ -292,11 +316,35 @@ func (p *AdminPanel) pageCustomQueries(ctx *saiTypes.RequestCtx) (*admin.PageDat
 				`onmouseover="this.style.background='#fef2f2'" onmouseout="this.style.background=''">Удалить</button>`,
 			template.HTMLEscapeString(id),
 		)
-		dropdownItems := []string{runBtn, editBtn, deleteBtn}
+		explainItem := explainBtn(queryFull, "/admin/custom-queries/run?explain=1&query_raw="+url.QueryEscape(queryFull))
+		schedule := service.QuerySchedule(doc)
+		dropdownItems := []string{runBtn, explainItem}
+		if builderOperation(operation) && paramsJSON == "[]" {
+			dropdownItems = append(dropdownItems, fmt.Sprintf(
+				`<a href="/admin?collection=%s&saved=%s" `+
+					`style="display:block;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;text-decoration:none;white-space:nowrap" `+
+					`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">В конструкторе</a>`,
+				template.HTMLEscapeString(url.QueryEscape(collection)), template.HTMLEscapeString(url.QueryEscape(id)),
+			))
+		}
+		if !shell.IsWrite(operation) {
+			dropdownItems = append(dropdownItems, queryScheduleItems(id, paramsJSON, schedule)...)
+		}
+		dropdownItems = append(dropdownItems, editBtn, deleteBtn)
+		if isDestructiveQuery(operation) {
+			previewBtn := fmt.Sprintf(
+				`<button type="button" data-query="%s" data-params="%s" onclick="_runCQ(this,true)" `+
+					`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;background:none;border:none;cursor:pointer;white-space:nowrap" `+
+					`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">Предпросмотр</button>`,
+				template.HTMLEscapeString(queryFull), template.HTMLEscapeString(paramsJSON),
+			)
+			dropdownItems = []string{previewBtn, runBtn, explainItem, editBtn, deleteBtn}
+		}
 
 		sb.WriteString(fmt.Sprintf(`<tr class="hover:bg-slate-50" data-search="%s">`, searchVal))
-		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-medium">%s</td>`, template.HTMLEscapeString(name)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-medium">%s<div class="font-mono text-xs font-normal text-slate-400">%s</div></td>`, template.HTMLEscapeString(name), template.HTMLEscapeString(id)))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-sm text-slate-500">%s</td>`, template.HTMLEscapeString(description)))
+		sb.WriteString(`<td class="px-4 py-3">` + p.queryScheduleCell(id, schedule) + `</td>`)
 		sb.WriteString(`<td class="px-4 py-3">` + sdWrap(primaryBtn, "#6366f1", dropdownItems) + `</td>`)
 		sb.WriteString(`</tr>`)
 	}
@@ -308,7 +356,9 @@ func (p *AdminPanel) pageCustomQueries(ctx *saiTypes.RequestCtx) (*admin.PageDat
 
 	cqContent := mTextarea("query", "Запрос", "db.collection.find({})") +
 		mField("name", "Имя (опционально)", "", "text") +
-		mField("description", "Описание (опционально)", "", "text")
+		mField("description", "Описание (опционально)", "", "text") +
+		`<p class="text-xs text-slate-400">Параметры задаются как <code>{{имя:тип=значение}}</code>, например <code>{customer_id: {{customer_id:string}}, ts: {$gte: {{since:date=2024-01-01}}}}</code>. ` +
+		`Типы: string, int, number, bool, date, objectid.</p>`
 
 	sb.WriteString(modal("customQueryModal", "Добавить кастомный запрос", "customQueryForm", "customQueryErr", "customQueryBtn", "Сохранить", "/admin/custom-queries", cqContent))
 	sb.WriteString(modalScript())
@@ -318,7 +368,11 @@ func (p *AdminPanel) pageCustomQueries(ctx *saiTypes.RequestCtx) (*admin.PageDat
 	sb.WriteString(customQueryEditScript())
 	sb.WriteString(customQueryRunModal())
 	sb.WriteString(customQueryRunScript())
+	sb.WriteString(explainModal())
+	sb.WriteString(explainScript())
 	sb.WriteString(cqDeleteScript())
+	sb.WriteString(queryScheduleModal())
+	sb.WriteString(queryScheduleScript())
 	sb.WriteString(sdScript())
 
 	return &admin.PageData{
@@ -351,7 +405,7 @@ func (p *AdminPanel) handleAjaxRequestLogInfo(ctx *saiTypes.RequestCtx) {
 	if opID == "" || logCollection == "" {
 		return
 	}
-	docs, _, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	docs, _, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
 		Collection: logCollection,
 		Filter:     map[string]interface{}{"operation_id": opID},
 		Limit:      1,
@@ -395,7 +449,7 @@ func (p *AdminPanel) handleAjaxRequestLogBody(ctx *saiTypes.RequestCtx) {
 		ctx.Response.SetBodyString("")
 		return
 	}
-	docs, _, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	docs, _, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
 		Collection: logCollection,
 		Filter:     map[string]interface{}{"operation_id": opID},
 		Limit:      1,
@@ -539,149 +593,156 @@ func (p *AdminPanel) handleRunCustomQuery(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
-	collection, operation, rawBody, err := extractQueryParts(queryRaw)
+	explain := string(ctx.QueryArgs().Peek("explain")) == "1"
+	params := make(map[string]string)
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if name := strings.TrimPrefix(string(key), "param_"); name != string(key) {
+			params[name] = string(value)
+		}
+	})
+	// Explain has no parameter form; placeholders take their defaults or zero values.
+	var q *shell.Query
+	var err error
+	if explain {
+		q, err = shell.Parse(queryRaw)
+	} else {
+		q, err = shell.Bind(queryRaw, params)
+	}
 	if err != nil {
-		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">Ошибка разбора: ` + template.HTMLEscapeString(shell.Russian(err)) + `</p>`)
 		return
 	}
 
-	opLower := strings.ToLower(operation)
-	var docs []map[string]interface{}
-	var total int64
-
-	switch opLower {
-	case "find", "findone":
-		var filter map[string]interface{}
-		if rawBody != "" {
-			ctx.Unmarshal([]byte(rawBody), &filter)
-		}
-		limit := 100
-		if opLower == "findone" {
-			limit = 1
-		}
-		resp, e := p.service.ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-			Collection: collection,
-			Filter:     filter,
-			Limit:      limit,
-			Count:      1,
-		})
-		docs, total, err = resp.Data, resp.Total, e
-	case "aggregate":
-		req := types.AggregateDocumentsRequest{Collection: collection, Count: 1}
-		ctx.Unmarshal([]byte(rawBody), &req.Pipeline)
-		resp, e := p.service.AggregateDocuments(context.Background(), req)
-		docs, total, err = resp.Data, resp.Total, e
-	case "updateone":
-		arg1, arg2, parseErr := splitTwoArgs(rawBody)
-		if parseErr != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(parseErr.Error()) + `</p>`)
-			return
+	adminCtx := p.handler.AdminContext(ctx)
+	dryRun := string(ctx.QueryArgs().Peek("dry_run")) == "1"
+	if explain {
+		req, err := explainRequestFromQuery(q)
+		if err == nil {
+			var resp types.ExplainResponse
+			resp, err = p.service.Explain(adminCtx, req)
+			if err == nil {
+				ctx.Response.SetBodyString(explainPlanHTML(ctx, resp.Data))
+				return
+			}
 		}
-		var filterMap, updateMap map[string]interface{}
-		ctx.Unmarshal([]byte(arg1), &filterMap)
-		ctx.Unmarshal([]byte(arg2), &updateMap)
-		resp, e := p.service.UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
-			Collection: collection,
-			Filter:     filterMap,
-			Data:       updateMap,
-		})
-		p.service.LogRequest(context.Background(), collection, map[string]interface{}{
-			"method": "CUSTOM_QUERY", "path": "/admin/custom-queries/run",
-			"query_raw": queryRaw, "request_time": time.Now().Format(time.RFC3339),
-			"request_unix": time.Now().Unix(), "results": resp.Updated,
-		})
-		if e != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(e.Error()) + `</p>`)
-			return
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+	if dryRun && !isDestructiveQuery(q.Operation) {
+		ctx.Response.SetBodyString(`<p class="text-amber-600 text-sm">Предпросмотр для операции "<b>` + template.HTMLEscapeString(q.Method) + `</b>" недоступен.</p>`)
+		return
+	}
+
+	result, err := p.service.RunQuery(adminCtx, q, dryRun, "")
+	if dryRun {
+		countLabel, docsLabel := "Будет обновлено документов", "Состояние после обновления"
+		if q.Operation == shell.OpDeleteOne || q.Operation == shell.OpDeleteMany {
+			countLabel, docsLabel = "Будет удалено документов", "Документы к удалению"
 		}
-		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Обновлено документов: %d</p>`, resp.Updated))
+		writeDryRunPreview(ctx, err, result.Matched, result.Sample, countLabel, docsLabel)
 		return
-	case "updatemany", "update":
-		arg1, arg2, parseErr := splitTwoArgs(rawBody)
-		if parseErr != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(parseErr.Error()) + `</p>`)
-			return
+	}
+	if shell.IsWrite(q.Operation) {
+		p.logCustomQuery(adminCtx, q.Collection, queryRaw, result.Created+result.Updated+result.Deleted)
+	}
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+
+	switch q.Operation {
+	case shell.OpCount:
+		p.logCustomQuery(adminCtx, q.Collection, queryRaw, result.Total)
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-sm text-slate-700">Количество документов: <b>%d</b></p>`, result.Total))
+		return
+	case shell.OpDistinct:
+		p.logCustomQuery(adminCtx, q.Collection, queryRaw, int64(len(result.Values)))
+		rows := make([]map[string]interface{}, 0, len(result.Values))
+		for _, v := range result.Values {
+			rows = append(rows, map[string]interface{}{q.Field: v})
 		}
-		var filterMap, updateMap map[string]interface{}
-		ctx.Unmarshal([]byte(arg1), &filterMap)
-		ctx.Unmarshal([]byte(arg2), &updateMap)
-		resp, e := p.service.UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
-			Collection: collection,
-			Filter:     filterMap,
-			Data:       updateMap,
-		})
-		p.service.LogRequest(context.Background(), collection, map[string]interface{}{
-			"method": "CUSTOM_QUERY", "path": "/admin/custom-queries/run",
-			"query_raw": queryRaw, "request_time": time.Now().Format(time.RFC3339),
-			"request_unix": time.Now().Unix(), "results": resp.Updated,
-		})
-		if e != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(e.Error()) + `</p>`)
-			return
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf(`<p class="text-xs text-slate-500 mb-3">Различных значений: %d</p>`, len(result.Values)))
+		if len(rows) > 0 {
+			sb.WriteString(p.exportBar("/admin/custom-queries/export", queryExportArgs(queryRaw, params)))
+			sb.WriteString(documentsTable(ctx, rows))
 		}
-		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Обновлено документов: %d</p>`, resp.Updated))
+		ctx.Response.SetBodyString(sb.String())
+		return
+	case shell.OpInsertOne, shell.OpInsertMany:
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Создано документов: %d</p>`, result.Created))
 		return
-	case "deleteone":
-		var filterMap map[string]interface{}
-		ctx.Unmarshal([]byte(rawBody), &filterMap)
-		resp, e := p.service.DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-			Collection: collection,
-			Filter:     filterMap,
-		})
-		if e != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(e.Error()) + `</p>`)
+	case shell.OpUpdateOne, shell.OpUpdateMany:
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Обновлено документов: %d</p>`, result.Updated))
+		return
+	case shell.OpReplaceOne:
+		if result.Matched == 0 && result.Updated == 0 {
+			ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">Документов не найдено.</p>`)
 			return
 		}
-		deleted := resp.Deleted
-		p.service.LogRequest(context.Background(), collection, map[string]interface{}{
-			"method": "CUSTOM_QUERY", "path": "/admin/custom-queries/run",
-			"query_raw": queryRaw, "request_time": time.Now().Format(time.RFC3339),
-			"request_unix": time.Now().Unix(), "results": deleted,
-		})
-		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-rose-600 text-sm font-medium">✓ Удалено документов: %d</p>`, deleted))
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Заменено документов: %d</p>`, result.Updated))
 		return
-	case "deletemany", "delete":
-		var filterMap map[string]interface{}
-		ctx.Unmarshal([]byte(rawBody), &filterMap)
-		resp, e := p.service.DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-			Collection: collection,
-			Filter:     filterMap,
-		})
-		p.service.LogRequest(context.Background(), collection, map[string]interface{}{
-			"method": "CUSTOM_QUERY", "path": "/admin/custom-queries/run",
-			"query_raw": queryRaw, "request_time": time.Now().Format(time.RFC3339),
-			"request_unix": time.Now().Unix(), "results": resp.Deleted,
-		})
-		if e != nil {
-			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(e.Error()) + `</p>`)
+	case shell.OpFindOneAndUpdate:
+		if len(result.Documents) == 0 {
+			if result.Updated > 0 {
+				ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-emerald-600 text-sm font-medium">✓ Документ создан (upsert), обновлено: %d</p>`, result.Updated))
+				return
+			}
+			ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">Документов не найдено.</p>`)
 			return
 		}
-		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-rose-600 text-sm font-medium">✓ Удалено документов: %d</p>`, resp.Deleted))
+		label := "Документ до обновления"
+		if q.ReturnNew {
+			label = "Документ после обновления"
+		}
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-xs text-slate-500 mb-3">Обновлено документов: %d. %s:</p>`, result.Updated, label) + documentsTable(ctx, result.Documents))
 		return
-	default:
-		ctx.Response.SetBodyString(`<p class="text-amber-600 text-sm">Операция "<b>` + template.HTMLEscapeString(operation) + `</b>" не поддерживается. Поддерживаются: find, findOne, aggregate, updateOne, updateMany, deleteOne, deleteMany.</p>`)
+	case shell.OpDeleteOne, shell.OpDeleteMany:
+		ctx.Response.SetBodyString(fmt.Sprintf(`<p class="text-rose-600 text-sm font-medium">✓ Удалено документов: %d</p>`, result.Deleted))
 		return
 	}
 
-	if err != nil {
-		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+	p.logCustomQuery(adminCtx, q.Collection, queryRaw, result.Total)
+
+	if len(result.Documents) == 0 {
+		ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">Документов не найдено.</p>`)
 		return
 	}
 
-	p.service.LogRequest(context.Background(), collection, map[string]interface{}{
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<p class="text-xs text-slate-500 mb-3">Найдено: %d, показано: %d</p>`, result.Total, len(result.Documents)))
+	sb.WriteString(p.exportBar("/admin/custom-queries/export", queryExportArgs(queryRaw, params)))
+	sb.WriteString(documentsTable(ctx, result.Documents))
+	ctx.Response.SetBodyString(sb.String())
+}
+
+// queryExportArgs carries a query and its parameter values to the export.
+func queryExportArgs(queryRaw string, params map[string]string) [][2]string {
+	args := [][2]string{{"query_raw", queryRaw}}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, [2]string{"param_" + name, params[name]})
+	}
+	return args
+}
+
+func (p *AdminPanel) logCustomQuery(ctx context.Context, collection, queryRaw string, results int64) {
+	p.service.LogRequest(ctx, collection, map[string]interface{}{
 		"method":       "CUSTOM_QUERY",
 		"path":         "/admin/custom-queries/run",
 		"query_raw":    queryRaw,
 		"request_time": time.Now().Format(time.RFC3339),
 		"request_unix": time.Now().Unix(),
-		"results":      total,
+		"results":      results,
 	})
+}
 
-	if len(docs) == 0 {
-		ctx.Response.SetBodyString(`<p class="text-slate-500 text-sm">Документов не найдено.</p>`)
-		return
-	}
-
+// documentsTable renders documents as a table with one column per field.
+func documentsTable(ctx *saiTypes.RequestCtx, docs []map[string]interface{}) string {
 	headerSet := make(map[string]struct{})
 	for _, doc := range docs {
 		for k := range doc {
@@ -697,7 +758,6 @@ func (p *AdminPanel) handleRunCustomQuery(ctx *saiTypes.RequestCtx) {
 	sort.Strings(headers)
 
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf(`<p class="text-xs text-slate-500 mb-3">Найдено: %d, показано: %d</p>`, total, len(docs)))
 	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-xs">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
 	for _, h := range headers {
@@ -723,6 +783,32 @@ func (p *AdminPanel) handleRunCustomQuery(ctx *saiTypes.RequestCtx) {
 		sb.WriteString(`</tr>`)
 	}
 	sb.WriteString(`</tbody></table></div>`)
+	return sb.String()
+}
+
+// isDestructiveQuery reports whether a query can be previewed with dry_run
+// before it changes documents.
+func isDestructiveQuery(operation string) bool {
+	switch shell.CanonicalOperation(operation) {
+	case shell.OpUpdateOne, shell.OpUpdateMany, shell.OpReplaceOne, shell.OpFindOneAndUpdate, shell.OpDeleteOne, shell.OpDeleteMany:
+		return true
+	}
+	return false
+}
+
+// writeDryRunPreview renders the result of a dry-run update or delete.
+func writeDryRunPreview(ctx *saiTypes.RequestCtx, err error, matched int64, docs []map[string]interface{}, countLabel, docsLabel string) {
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(`<div class="mb-3 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">` +
+		fmt.Sprintf(`Предпросмотр, данные не изменены. %s: <b>%d</b>`, countLabel, matched) + `</div>`)
+	if len(docs) > 0 {
+		sb.WriteString(fmt.Sprintf(`<p class="text-xs text-slate-500 mb-3">%s (показано: %d)</p>`, docsLabel, len(docs)))
+		sb.WriteString(documentsTable(ctx, docs))
+	}
 	ctx.Response.SetBodyString(sb.String())
 }
 
@@ -893,58 +979,6 @@ func queryPreviewScript() string {
 		`}</script>`
 }
 
-func splitTwoArgs(body string) (arg1, arg2 string, err error) {
-	body = strings.TrimSpace(body)
-	if body == "" || body[0] != '{' {
-		return body, "", nil
-	}
-	depth := 0
-	for i, ch := range body {
-		switch ch {
-		case '{':
-			depth++
-		case '}':
-			depth--
-			if depth == 0 {
-				arg1 = strings.TrimSpace(body[:i+1])
-				rest := strings.TrimSpace(body[i+1:])
-				if len(rest) > 0 && rest[0] == ',' {
-					arg2 = strings.TrimSpace(rest[1:])
-				}
-				return arg1, arg2, nil
-			}
-		}
-	}
-	return body, "", fmt.Errorf("несбалансированные скобки")
-}
-
-func extractQueryParts(queryRaw string) (collection, operation, rawBody string, err error) {
-	if !strings.HasPrefix(queryRaw, "db.") {
-		err = fmt.Errorf("запрос должен начинаться с db.")
-		return
-	}
-	rest := queryRaw[3:]
-	dotIdx := strings.Index(rest, ".")
-	if dotIdx < 0 {
-		err = fmt.Errorf("не найдено имя коллекции")
-		return
-	}
-	collection = rest[:dotIdx]
-	rest = rest[dotIdx+1:]
-	parenIdx := strings.Index(rest, "(")
-	if parenIdx < 0 {
-		err = fmt.Errorf("не найдена открывающая скобка")
-		return
-	}
-	operation = rest[:parenIdx]
-	start := strings.Index(queryRaw, "(")
-	end := strings.LastIndex(queryRaw, ")")
-	if start >= 0 && end > start {
-		rawBody = strings.TrimSpace(queryRaw[start+1 : end])
-	}
-	return
-}
-
 func customQueryEditModal() string {
 	return `<div id="cqEditModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
 		`<div style="background:white;border-radius:16px;width:100%;max-width:560px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
@@ -992,7 +1026,9 @@ func customQueryRunModal() string {
 		`<button onclick="document.getElementById('cqRunModal').style.display='none'" ` +
 		`style="width:32px;height:32px;flex-shrink:0;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
 		`</div>` +
-		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px"><div id="cqRunContent" class="text-sm text-slate-500">—</div></div>` +
+		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px">` +
+		`<form id="cqRunParams" style="display:none;grid-template-columns:repeat(auto-fill,minmax(200px,1fr));gap:12px;align-items:end;margin-bottom:16px;padding-bottom:16px;border-bottom:1px solid #e2e8f0"></form>` +
+		`<div id="cqRunContent" class="text-sm text-slate-500">—</div></div>` +
 		`</div></div>`
 }
 
@@ -1008,18 +1044,40 @@ func cqDeleteScript() string {
 		`.catch(function(){alert('Ошибка сети');});};}</script>`
 }
 
+// customQueryRunScript opens the run modal. Queries with {{name:type}}
+// placeholders first get a form; its values are sent as param_<name>.
 func customQueryRunScript() string {
 	return `<script>if(!window._cqRunInit){window._cqRunInit=true;` +
-		`window._runCQ=function(btn){` +
+		`window._runCQ=function(btn,dryRun){` +
 		`var q=btn.getAttribute('data-query');` +
-		`var opM=q.match(/\.([a-zA-Z]+)\s*\(/);` +
-		`var op=(opM?opM[1]:'').toLowerCase();` +
-		`var destructive=['update','updateone','updatemany','delete','deleteone','deletemany'].indexOf(op)>=0;` +
-		`if(destructive&&!confirm('Операция "'+( opM?opM[1]:op)+'" изменит данные. Выполнить?')){return;}` +
+		`var params=JSON.parse(btn.getAttribute('data-params')||'[]');` +
+		`var confirmed=function(){return btn.getAttribute('data-write')!=='1'||dryRun||confirm('Операция "'+btn.getAttribute('data-op')+'" изменит данные. Выполнить?');};` +
+		`var f=document.getElementById('cqRunParams');f.innerHTML='';f.style.display='none';` +
+		`if(!params.length){if(!confirmed()){return;}_openCQRun(q);_execCQ(q,dryRun,'');return;}` +
+		`_openCQRun(q);` +
+		`params.forEach(function(p){` +
+		`var w=document.createElement('div');var l=document.createElement('label');` +
+		`l.className='mb-1 block text-xs font-medium text-slate-600';l.textContent=p.name+' ('+p.type+')';var i;` +
+		`if(p.type==='bool'){i=document.createElement('select');['true','false'].forEach(function(v){var o=document.createElement('option');o.value=v;o.textContent=v;i.appendChild(o);});}` +
+		`else{i=document.createElement('input');i.type=(p.type==='int'||p.type==='number')?'number':'text';if(p.type==='number'){i.step='any';}` +
+		`if(p.type==='date'){i.placeholder='YYYY-MM-DD';}if(p.type==='objectid'){i.placeholder='24 hex';}}` +
+		`i.name='param_'+p.name;if(p.has_default){i.value=p.default;}else{i.required=true;}` +
+		`i.className='h-9 w-full rounded-lg border border-slate-300 bg-white px-3 text-sm text-slate-900 outline-none focus:border-indigo-500';` +
+		`w.appendChild(l);w.appendChild(i);f.appendChild(w);});` +
+		`var b=document.createElement('button');b.type='submit';b.textContent=dryRun?'Предпросмотр':'Выполнить';` +
+		`b.className='inline-flex h-9 items-center justify-center rounded-lg bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500';` +
+		`f.appendChild(b);` +
+		`f.onsubmit=function(e){e.preventDefault();if(!confirmed()){return;}var qs='';` +
+		`Array.prototype.forEach.call(f.elements,function(el){if(el.name){qs+='&'+encodeURIComponent(el.name)+'='+encodeURIComponent(el.value);}});` +
+		`_execCQ(q,dryRun,qs);};` +
+		`f.style.display='grid';` +
+		`document.getElementById('cqRunContent').innerHTML='<p class="text-slate-500 text-sm">Заполните параметры запроса.</p>';};` +
+		`window._openCQRun=function(q){` +
 		`document.getElementById('cqRunModal').style.display='flex';` +
-		`document.getElementById('cqRunQueryText').textContent=q;` +
+		`document.getElementById('cqRunQueryText').textContent=q;};` +
+		`window._execCQ=function(q,dryRun,qs){` +
 		`document.getElementById('cqRunContent').innerHTML='<p class="text-slate-500 text-sm">Загрузка...</p>';` +
-		`fetch(window.location.origin+'/admin/custom-queries/run?query_raw='+encodeURIComponent(q),{headers:{'X-Requested-With':'fetch'}})` +
+		`fetch(window.location.origin+'/admin/custom-queries/run?query_raw='+encodeURIComponent(q)+(dryRun?'&dry_run=1':'')+qs,{headers:{'X-Requested-With':'fetch'}})` +
 		`.then(function(r){return r.text();})` +
 		`.then(function(h){document.getElementById('cqRunContent').innerHTML=h;})` +
 		`.catch(function(){document.getElementById('cqRunContent').innerHTML='<p class="text-rose-500 text-sm">Ошибка запроса</p>';});};` +
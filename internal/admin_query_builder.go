@@ -0,0 +1,511 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/handlers"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// browseQuery is what the collection browser runs: an Extended JSON filter,
+// a JSON sort document and a comma-separated list of fields shown as extra
+// columns. Saved is the saved query the builder was opened from; it stays
+// in the browser URLs as ref, so the builder can still update it.
+type browseQuery struct {
+	Collection string
+	Filter     string
+	Sort       string
+	Fields     string
+	Builder    bool
+	Saved      *savedQueryRef
+}
+
+type savedQueryRef struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// builderState is handed to the query builder script to restore its rows.
+type builderState struct {
+	Collection string          `json:"collection"`
+	Filter     json.RawMessage `json:"filter"`
+	Sort       map[string]int  `json:"sort"`
+	Fields     []string        `json:"fields"`
+	Saved      *savedQueryRef  `json:"saved,omitempty"`
+}
+
+func browseQueryArgs(ctx *saiTypes.RequestCtx) browseQuery {
+	args := ctx.QueryArgs()
+	q := browseQuery{
+		Collection: string(args.Peek("collection")),
+		Filter:     strings.TrimSpace(string(args.Peek("query"))),
+		Sort:       strings.TrimSpace(string(args.Peek("sort"))),
+		Fields:     strings.TrimSpace(string(args.Peek("fields"))),
+		Builder:    string(args.Peek("builder")) == "1",
+	}
+	if q.Filter == "" {
+		q.Filter = "{}"
+	}
+	return q
+}
+
+// params returns the query as URL parameters, without the page.
+func (q browseQuery) params() [][2]string {
+	out := [][2]string{{"collection", q.Collection}, {"query", q.Filter}}
+	if q.Sort != "" {
+		out = append(out, [2]string{"sort", q.Sort})
+	}
+	if q.Fields != "" {
+		out = append(out, [2]string{"fields", q.Fields})
+	}
+	return out
+}
+
+func (q browseQuery) url() string {
+	v := url.Values{}
+	for _, kv := range q.params() {
+		v.Set(kv[0], kv[1])
+	}
+	if q.Builder {
+		v.Set("builder", "1")
+	}
+	if q.Saved != nil {
+		v.Set("ref", q.Saved.ID)
+	}
+	return "/admin/ajax/collection-browse?" + v.Encode()
+}
+
+// parse reads the filter, sort and fields of the query.
+func (q browseQuery) parse() (map[string]interface{}, map[string]int, []string, error) {
+	filter, err := handlers.ParseDocumentJSON(q.Filter)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("неверный JSON: %v", err)
+	}
+	var sortDoc map[string]int
+	if q.Sort != "" {
+		if err := json.Unmarshal([]byte(q.Sort), &sortDoc); err != nil {
+			return nil, nil, nil, fmt.Errorf("неверная сортировка: %v", err)
+		}
+		for k, dir := range sortDoc {
+			if dir != 1 && dir != -1 {
+				return nil, nil, nil, fmt.Errorf("сортировка %s: ожидается 1 или -1", k)
+			}
+		}
+	}
+	var fields []string
+	for _, f := range strings.Split(q.Fields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return filter, sortDoc, fields, nil
+}
+
+// savedBrowseQuery opens a saved find query in the collection browser.
+// Limit and skip of the saved query are not kept: the browser pages
+// through all matches. Queries with parameters cannot be opened.
+func (p *AdminPanel) savedBrowseQuery(id string) (browseQuery, error) {
+	doc, err := p.savedQueryDoc(id)
+	if err != nil {
+		return browseQuery{}, err
+	}
+	queryRaw, _ := doc["query_raw"].(string)
+	if params, err := shell.Params(queryRaw); err != nil {
+		return browseQuery{}, errors.New(shell.Russian(err))
+	} else if len(params) > 0 {
+		return browseQuery{}, fmt.Errorf("запрос с параметрами нельзя открыть в конструкторе")
+	}
+	parsed, err := shell.Parse(queryRaw)
+	if err != nil {
+		return browseQuery{}, errors.New(shell.Russian(err))
+	}
+	if !builderOperation(parsed.Operation) {
+		return browseQuery{}, fmt.Errorf("в конструкторе открываются только запросы find, а не %s", parsed.Method)
+	}
+
+	filter, err := extJSONFilter(parsed.Filter)
+	if err != nil {
+		return browseQuery{}, err
+	}
+	q := browseQuery{
+		Collection: parsed.Collection,
+		Filter:     filter,
+		Fields:     strings.Join(parsed.Fields, ","),
+		Builder:    true,
+		Saved:      savedRef(id, doc),
+	}
+	if len(parsed.Sort) > 0 {
+		b, err := json.Marshal(parsed.Sort)
+		if err != nil {
+			return browseQuery{}, err
+		}
+		q.Sort = string(b)
+	}
+	return q, nil
+}
+
+func (p *AdminPanel) savedQueryDoc(id string) (map[string]interface{}, error) {
+	docs, _, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+		Collection: service.SavedQueriesCollection,
+		Filter:     map[string]interface{}{"internal_id": id},
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("запрос %s не найден", id)
+	}
+	return docs[0], nil
+}
+
+func savedRef(id string, doc map[string]interface{}) *savedQueryRef {
+	ref := &savedQueryRef{ID: id}
+	ref.Name, _ = doc["name"].(string)
+	ref.Description, _ = doc["description"].(string)
+	return ref
+}
+
+func builderOperation(op string) bool {
+	return op == shell.OpFind || op == shell.OpFindOne
+}
+
+// extJSONFilter renders a filter parsed from the shell as relaxed Extended
+// JSON. Regular expressions become $regex and $options, which the builder
+// shows as operators; inside arrays they are kept as they are.
+func extJSONFilter(filter map[string]interface{}) (string, error) {
+	if len(filter) == 0 {
+		return "{}", nil
+	}
+	b, err := bson.MarshalExtJSON(regexOperators(filter), false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func regexOperators(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			if re, ok := child.(primitive.Regex); ok {
+				child = regexOperator(re)
+			}
+			out[k] = regexOperators(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			if _, ok := child.(primitive.Regex); ok {
+				out[i] = child
+				continue
+			}
+			out[i] = regexOperators(child)
+		}
+		return out
+	}
+	return v
+}
+
+func regexOperator(re primitive.Regex) map[string]interface{} {
+	m := map[string]interface{}{"$regex": re.Pattern}
+	if re.Options != "" {
+		m["$options"] = re.Options
+	}
+	return m
+}
+
+// fieldValue follows a dotted path through embedded documents.
+func fieldValue(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		var m map[string]interface{}
+		switch t := cur.(type) {
+		case map[string]interface{}:
+			m = t
+		case primitive.M:
+			m = t
+		case primitive.D:
+			m = t.Map()
+		default:
+			return nil, false
+		}
+		v, ok := m[part]
+		if !ok {
+			return nil, false
+		}
+		cur = v
+	}
+	return cur, true
+}
+
+// fieldCell renders a field value for a table cell.
+func fieldCell(v interface{}) string {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = t
+	case time.Time:
+		s = t.Local().Format("02.01.2006 15:04:05")
+	case primitive.DateTime:
+		s = t.Time().Local().Format("02.01.2006 15:04:05")
+	case primitive.ObjectID:
+		s = t.Hex()
+	default:
+		typ, data, err := bson.MarshalValue(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		} else {
+			s = bson.RawValue{Type: typ, Value: data}.String()
+		}
+	}
+	if len([]rune(s)) > 80 {
+		s = string([]rune(s)[:77]) + "..."
+	}
+	return s
+}
+
+// handleAjaxCollectionFields returns the fields inferred from a sample of the
+// collection as JSON. The query builder offers them as suggestions.
+func (p *AdminPanel) handleAjaxCollectionFields(ctx *saiTypes.RequestCtx) {
+	collection := string(ctx.QueryArgs().Peek("collection"))
+	ctx.SetContentType("application/json")
+	fields := []types.FieldInfo{}
+	if collection != "" {
+		if sampled, err := p.service.SampleFields(p.handler.AdminContext(ctx), collection, 0); err == nil {
+			fields = sampled
+		}
+	}
+	b, _ := json.Marshal(fields)
+	ctx.Response.SetBody(b)
+}
+
+// queryBuilder renders the query builder of the collection browser. The
+// rows are restored from the query by queryBuilderScript when the block is
+// first opened.
+func queryBuilder(q browseQuery, filter map[string]interface{}, sortDoc map[string]int, fields []string) string {
+	filterJSON, err := handlers.DocumentJSON(filter)
+	if err != nil {
+		filterJSON = "{}"
+	}
+	state, err := json.Marshal(builderState{
+		Collection: q.Collection,
+		Filter:     json.RawMessage(filterJSON),
+		Sort:       sortDoc,
+		Fields:     fields,
+		Saved:      q.Saved,
+	})
+	if err != nil {
+		return ""
+	}
+
+	label := `font-size:12px;font-weight:600;color:#64748b;margin:14px 0 6px`
+	input := `height:32px;border:1px solid #cbd5e1;border-radius:8px;padding:0 10px;font-size:12px;outline:none;background:white`
+	btn := `height:32px;border-radius:8px;font-size:12px;font-weight:600;padding:0 14px;cursor:pointer;`
+	open := ""
+	if q.Builder {
+		open = " open"
+	}
+
+	var b strings.Builder
+	b.WriteString(`<details id="qbBox"` + open + ` ontoggle="_qbInit(this)" style="margin-bottom:12px;border:1px solid #e2e8f0;border-radius:10px;padding:10px 14px">`)
+	b.WriteString(`<summary style="cursor:pointer;font-size:13px;font-weight:600;color:#334155">Конструктор запроса</summary>`)
+	b.WriteString(`<script type="application/json" id="qbState">` + string(state) + `</script>`)
+	b.WriteString(`<datalist id="qbFieldList"></datalist>`)
+	b.WriteString(`<div id="qbNotice" style="display:none;margin-top:10px;font-size:12px;color:#92400e;background:#fffbeb;border:1px solid #fde68a;border-radius:8px;padding:8px 10px"></div>`)
+	b.WriteString(`<div style="` + label + `">Условия — должны выполняться все</div>`)
+	b.WriteString(`<div id="qbRows" style="display:flex;flex-direction:column;gap:6px"></div>`)
+	b.WriteString(`<button type="button" onclick="_qbAddRow({});_qbRender()" style="` + btn + `margin-top:6px;border:1px dashed #cbd5e1;background:white;color:#475569">+ Условие</button>`)
+	b.WriteString(`<div style="` + label + `">Сортировка</div>`)
+	b.WriteString(`<div style="display:flex;gap:6px">`)
+	b.WriteString(`<input id="qbSortField" list="qbFieldList" placeholder="Поле" oninput="_qbRender()" style="` + input + `;flex:1;font-family:monospace">`)
+	b.WriteString(`<select id="qbSortDir" onchange="_qbRender()" style="` + input + `"><option value="1">по возрастанию</option><option value="-1">по убыванию</option></select>`)
+	b.WriteString(`</div>`)
+	b.WriteString(`<div style="` + label + `">Поля в таблице</div>`)
+	b.WriteString(`<div id="qbFields" style="display:flex;flex-wrap:wrap;gap:4px 14px;max-height:120px;overflow-y:auto;font-size:12px;font-family:monospace;color:#334155"></div>`)
+	b.WriteString(`<div style="` + label + `">Фильтр</div>`)
+	b.WriteString(`<pre id="qbPreview" style="font-size:12px;font-family:monospace;white-space:pre-wrap;word-break:break-all;margin:0;padding:10px;background:#f8fafc;border-radius:8px;color:#0f172a"></pre>`)
+	b.WriteString(`<pre id="qbShellPreview" style="font-size:11px;font-family:monospace;white-space:pre-wrap;word-break:break-all;margin:6px 0 0;color:#94a3b8"></pre>`)
+	b.WriteString(`<div id="qbErr" style="display:none;margin-top:8px;font-size:12px;color:#e11d48"></div>`)
+	b.WriteString(`<div style="display:flex;flex-wrap:wrap;align-items:center;gap:6px;margin-top:12px">`)
+	b.WriteString(`<button type="button" onclick="_qbApply()" style="` + btn + `border:none;background:#0f172a;color:white">Применить</button>`)
+	b.WriteString(`<span style="flex:1"></span>`)
+	b.WriteString(`<input id="qbName" placeholder="Имя запроса" style="` + input + `;width:220px">`)
+	b.WriteString(`<button type="button" onclick="_qbSave(false)" style="` + btn + `border:1px solid #c7d2fe;background:#eef2ff;color:#4338ca">Сохранить как новый</button>`)
+	b.WriteString(`<button type="button" id="qbUpdate" onclick="_qbSave(true)" style="` + btn + `display:none;border:1px solid #c7d2fe;background:#eef2ff;color:#4338ca">Обновить сохранённый</button>`)
+	b.WriteString(`</div></details>`)
+	return b.String()
+}
+
+// queryBuilderScript keeps the builder rows and the generated filter in
+// sync. Values are converted by kind; the kind of a row follows the types
+// sampled for its field, and a loaded filter keeps the kinds of its values.
+// Conditions the rows cannot express are kept whole as a JSON expression.
+func queryBuilderScript() string {
+	return `<script>if(!window._qbInitDone){window._qbInitDone=true;` +
+		`window._qbFieldInfo={};` +
+		`var _qbOps=[['$eq','='],['$ne','≠'],['$in','в списке'],['$nin','не в списке'],['$gt','>'],['$gte','≥'],['$lt','<'],['$lte','≤'],` +
+		`['regex','регулярное выражение'],['iregex','рег. выражение без учёта регистра'],['$exists','существует'],['expr','выражение JSON']];` +
+		`var _qbKinds=[['','авто'],['string','строка'],['number','число'],['bool','логическое'],['date','дата'],['objectId','ObjectId'],['json','JSON']];` +
+		`var _qbWrappers=['$oid','$date','$numberLong','$numberDecimal','$numberInt','$numberDouble','$regularExpression','$binary','$timestamp'];` +
+		`var _qbInput='height:32px;border:1px solid #cbd5e1;border-radius:8px;padding:0 10px;font-size:12px;outline:none;background:white';` +
+		`function _qbSelect(opts,value){var s=document.createElement('select');s.style.cssText=_qbInput;` +
+		`opts.forEach(function(o){var e=document.createElement('option');e.value=o[0];e.textContent=o[1];s.appendChild(e);});` +
+		`s.value=value||opts[0][0];s.onchange=_qbRender;return s;}` +
+		`function _qbIsOps(v){if(!v||typeof v!=='object'||Array.isArray(v))return false;var k=Object.keys(v);` +
+		`if(!k.length)return false;if(k.length===1&&_qbWrappers.indexOf(k[0])>=0)return false;` +
+		`return k.every(function(x){return x.charAt(0)==='$';});}` +
+		`window._qbKindOf=function(field){var f=window._qbFieldInfo[field];if(!f)return '';` +
+		`var t=(f.types||[]).filter(function(x){return x!=='null';});` +
+		`return t.length===1&&['string','number','bool','date','objectId'].indexOf(t[0])>=0?t[0]:'';};` +
+		`window._qbAddRow=function(r){var row=document.createElement('div');row.className='qb-row';row.style.cssText='display:flex;gap:6px;align-items:center';` +
+		`var f=document.createElement('input');f.className='qb-field';f.setAttribute('list','qbFieldList');f.placeholder='Поле';f.value=r.field||'';` +
+		`f.style.cssText=_qbInput+';width:200px;font-family:monospace';` +
+		`var op=_qbSelect(_qbOps,r.op);op.className='qb-op';` +
+		`var kind=_qbSelect(_qbKinds,r.kind);kind.className='qb-kind';` +
+		`var v=document.createElement('input');v.className='qb-val';v.value=r.value===undefined?'':r.value;` +
+		`v.style.cssText=_qbInput+';flex:1;min-width:0;font-family:monospace';v.oninput=_qbRender;` +
+		`f.oninput=function(){kind.value=_qbKindOf(f.value.trim());_qbRender();};` +
+		`var del=document.createElement('button');del.type='button';del.textContent='×';` +
+		`del.style.cssText='width:32px;height:32px;border-radius:8px;border:1px solid #e2e8f0;background:white;color:#94a3b8;cursor:pointer';` +
+		`del.onclick=function(){row.remove();_qbRender();};` +
+		`[f,op,kind,v,del].forEach(function(e){row.appendChild(e);});` +
+		`document.getElementById('qbRows').appendChild(row);};` +
+		// Values: text of the inputs to Extended JSON and back.
+		`function _qbScalar(raw,kind){var t=raw.trim();` +
+		`if(kind==='string')return raw;` +
+		`if(kind==='number'){if(t===''||isNaN(Number(t)))throw new Error('не число: '+raw);` +
+		`return /^-?\d+$/.test(t)&&!Number.isSafeInteger(Number(t))?{'$numberLong':t}:Number(t);}` +
+		`if(kind==='bool'){if(['true','да','1'].indexOf(t)>=0)return true;if(['false','нет','0'].indexOf(t)>=0)return false;throw new Error('не логическое значение: '+raw);}` +
+		`if(kind==='date'){var d=new Date(/^\d{4}-\d{2}-\d{2}$/.test(t)?t+'T00:00:00Z':t);if(t===''||isNaN(d.getTime()))throw new Error('не дата: '+raw);return {'$date':d.toISOString()};}` +
+		`if(kind==='objectId'){if(!/^[0-9a-fA-F]{24}$/.test(t))throw new Error('не ObjectId: '+raw);return {'$oid':t.toLowerCase()};}` +
+		`if(kind==='json'){try{return JSON.parse(raw);}catch(e){throw new Error('неверный JSON: '+raw);}}` +
+		`if(t==='true'||t==='false')return t==='true';if(t==='null')return null;` +
+		`if(/^-?\d+(\.\d+)?([eE][+-]?\d+)?$/.test(t))return _qbScalar(t,'number');return raw;}` +
+		`function _qbText(v){if(v===null)return {kind:'',text:'null'};` +
+		`if(typeof v==='string')return {kind:'string',text:v};` +
+		`if(typeof v==='number')return {kind:'number',text:String(v)};` +
+		`if(typeof v==='boolean')return {kind:'bool',text:String(v)};` +
+		`if(typeof v==='object'&&!Array.isArray(v)){var k=Object.keys(v);if(k.length===1){` +
+		`if(k[0]==='$oid')return {kind:'objectId',text:v.$oid};` +
+		`if(k[0]==='$date'){var d=v.$date;if(d&&typeof d==='object'&&d.$numberLong!==undefined)d=new Date(Number(d.$numberLong)).toISOString();return {kind:'date',text:String(d)};}` +
+		`if(k[0]==='$numberLong')return {kind:'number',text:v.$numberLong};}}` +
+		`return {kind:'json',text:JSON.stringify(v)};}` +
+		`function _qbList(raw,kind){if(kind==='json'){var a=_qbScalar(raw,'json');if(!Array.isArray(a))throw new Error('ожидался JSON-массив');return a;}` +
+		`return raw.split(',').map(function(x){return x.trim();}).filter(function(x){return x!=='';}).map(function(x){return _qbScalar(x,kind);});}` +
+		`function _qbListText(a){var items=a.map(_qbText),kind=items.length?items[0].kind:'string';` +
+		`if(items.every(function(i){return i.kind===kind&&kind!=='json'&&i.text.indexOf(',')<0&&i.text.trim()===i.text&&i.text!=='';}))` +
+		`return {kind:kind,text:items.map(function(i){return i.text;}).join(', ')};` +
+		`return {kind:'json',text:JSON.stringify(a)};}` +
+		// Rows to a filter.
+		`function _qbCond(op,raw,kind){` +
+		`if(op==='$in'||op==='$nin'){var o={};o[op]=_qbList(raw,kind);return o;}` +
+		`if(op==='regex'||op==='iregex'){var r={'$regex':raw};if(op==='iregex')r.$options='i';return r;}` +
+		`if(op==='$exists'){var t=raw.trim();return {'$exists':t===''?true:_qbScalar(t,'bool')};}` +
+		`if(op==='expr'){var e=_qbScalar(raw,'json');if(!_qbIsOps(e))throw new Error('выражение должно быть объектом операторов, например {"$size": 2}');return e;}` +
+		`var c={};c[op]=_qbScalar(raw,kind);return c;}` +
+		`function _qbSimplify(c){var k=Object.keys(c);return k.length===1&&k[0]==='$eq'&&!_qbIsOps(c.$eq)?c.$eq:c;}` +
+		`window._qbFilter=function(){var by={},order=[],all=[],dup=false;` +
+		`document.querySelectorAll('#qbRows .qb-row').forEach(function(row){` +
+		`var field=row.querySelector('.qb-field').value.trim();if(!field)return;` +
+		`if(field.charAt(0)==='$')throw new Error('имя поля не может начинаться с $: '+field);` +
+		`var c=_qbCond(row.querySelector('.qb-op').value,row.querySelector('.qb-val').value,row.querySelector('.qb-kind').value);` +
+		`var one={};one[field]=_qbSimplify(c);all.push(one);` +
+		`if(!by[field]){by[field]={};order.push(field);}` +
+		`for(var k in c){if(k in by[field])dup=true;by[field][k]=c[k];}});` +
+		`if(dup)return {'$and':all};` +
+		`var f={};order.forEach(function(k){f[k]=_qbSimplify(by[k]);});return f;};` +
+		// A filter back to rows; null when it cannot be shown.
+		`function _qbRows(f,out){for(var key in f){var v=f[key];` +
+		`if(key==='$and'){if(!Array.isArray(v))return 'неверный $and';` +
+		`for(var i=0;i<v.length;i++){if(!v[i]||typeof v[i]!=='object'||Array.isArray(v[i]))return 'неверный $and';var e=_qbRows(v[i],out);if(e)return e;}continue;}` +
+		`if(key.charAt(0)==='$')return 'оператор '+key+' не поддерживается конструктором';` +
+		`if(!_qbIsOps(v)){var t=_qbText(v);out.push({field:key,op:'$eq',kind:t.kind,value:t.text});continue;}` +
+		`var ok=Object.keys(v).every(function(op){` +
+		`if(['$eq','$ne','$gt','$gte','$lt','$lte'].indexOf(op)>=0)return true;` +
+		`if(op==='$in'||op==='$nin')return Array.isArray(v[op]);` +
+		`if(op==='$exists')return typeof v[op]==='boolean';` +
+		`if(op==='$regex')return typeof v.$regex==='string'&&(v.$options===undefined||v.$options===''||v.$options==='i');` +
+		`return op==='$options'&&v.$regex!==undefined;});` +
+		`if(!ok){out.push({field:key,op:'expr',kind:'json',value:JSON.stringify(v)});continue;}` +
+		`Object.keys(v).forEach(function(op){var t;` +
+		`if(op==='$options')return;` +
+		`if(op==='$regex'){out.push({field:key,op:v.$options==='i'?'iregex':'regex',kind:'string',value:v.$regex});return;}` +
+		`if(op==='$exists'){out.push({field:key,op:op,kind:'bool',value:String(v[op])});return;}` +
+		`t=op==='$in'||op==='$nin'?_qbListText(v[op]):_qbText(v[op]);` +
+		`out.push({field:key,op:op,kind:t.kind,value:t.text});});}` +
+		`return null;}` +
+		// Shell text of the query, as saved with the other queries.
+		`function _qbShell(v){if(v===null)return 'null';` +
+		`if(Array.isArray(v))return '['+v.map(_qbShell).join(', ')+']';` +
+		`if(typeof v==='object'){var k=Object.keys(v);if(k.length===1){` +
+		`if(k[0]==='$oid')return 'ObjectId('+JSON.stringify(v.$oid)+')';` +
+		`if(k[0]==='$date'){var d=v.$date;if(d&&typeof d==='object')d=new Date(Number(d.$numberLong)).toISOString();return 'ISODate('+JSON.stringify(d)+')';}` +
+		`if(k[0]==='$numberLong')return 'NumberLong('+JSON.stringify(v.$numberLong)+')';` +
+		`if(k[0]==='$numberDecimal')return 'NumberDecimal('+JSON.stringify(v.$numberDecimal)+')';` +
+		`if(k[0]==='$regularExpression'){var re=v.$regularExpression;` +
+		`return '/'+re.pattern.replace(/\\.|\//g,function(m){return m==='/'?'\\/':m;})+'/'+(re.options||'');}}` +
+		`return '{'+k.map(function(x){return JSON.stringify(x)+': '+_qbShell(v[x]);}).join(', ')+'}';}` +
+		`return JSON.stringify(v);}` +
+		`function _qbSort(){var f=document.getElementById('qbSortField').value.trim();if(!f)return null;` +
+		`var s={};s[f]=Number(document.getElementById('qbSortDir').value);return s;}` +
+		`function _qbProjection(){var out=[];document.querySelectorAll('#qbFields input:checked').forEach(function(c){out.push(c.value);});return out;}` +
+		`function _qbQueryText(filter,sort,fields){` +
+		`var q='db.getCollection('+JSON.stringify(window._qbState.collection)+').find('+_qbShell(filter);` +
+		`if(fields.length){var p={};fields.forEach(function(f){p[f]=1;});q+=', '+_qbShell(p);}` +
+		`q+=')';if(sort)q+='.sort('+_qbShell(sort)+')';return q;}` +
+		`window._qbRender=function(){var err=document.getElementById('qbErr');err.style.display='none';` +
+		`try{var f=_qbFilter();document.getElementById('qbPreview').textContent=JSON.stringify(f,null,2);` +
+		`document.getElementById('qbShellPreview').textContent=_qbQueryText(f,_qbSort(),_qbProjection());return f;}` +
+		`catch(e){err.textContent=e.message;err.style.display='block';return null;}};` +
+		`function _qbFieldBox(name,checked){var box=document.getElementById('qbFields');` +
+		`if(box.querySelector('input[value="'+CSS.escape(name)+'"]'))return;` +
+		`var l=document.createElement('label');l.style.cssText='display:inline-flex;align-items:center;gap:4px;cursor:pointer';` +
+		`var c=document.createElement('input');c.type='checkbox';c.value=name;c.checked=checked;c.onchange=_qbRender;` +
+		`l.appendChild(c);l.appendChild(document.createTextNode(name));box.appendChild(l);}` +
+		`window._qbInit=function(box){if(!box.open||box.dataset.init)return;box.dataset.init='1';` +
+		`var st=JSON.parse(document.getElementById('qbState').textContent);window._qbState=st;` +
+		`var notes=[],rows=[],e=_qbRows(st.filter||{},rows);` +
+		`if(e){notes.push('Фильтр нельзя показать в конструкторе: '+e+'. Он остаётся в строке запроса; «Применить» заменит его.');rows=[];}` +
+		`rows.forEach(_qbAddRow);if(!rows.length)_qbAddRow({});` +
+		`var sk=Object.keys(st.sort||{});if(sk.length){document.getElementById('qbSortField').value=sk[0];document.getElementById('qbSortDir').value=String(st.sort[sk[0]]);}` +
+		`if(sk.length>1)notes.push('Конструктор сортирует по одному полю, остальные поля сортировки не сохранятся: '+sk.slice(1).join(', ')+'.');` +
+		`(st.fields||[]).forEach(function(f){_qbFieldBox(f,true);});` +
+		`if(st.saved){document.getElementById('qbName').value=st.saved.name||'';var u=document.getElementById('qbUpdate');u.style.display='';u.textContent='Обновить «'+(st.saved.name||st.saved.id)+'»';}` +
+		`if(notes.length){var n=document.getElementById('qbNotice');n.textContent=notes.join(' ');n.style.display='block';}` +
+		`_qbRender();` +
+		`fetch(window.location.origin+'/admin/ajax/collection-fields?collection='+encodeURIComponent(st.collection),{headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.json();}).then(function(list){var dl=document.getElementById('qbFieldList');if(!dl)return;` +
+		`window._qbFieldInfo={};list.forEach(function(f){window._qbFieldInfo[f.path]=f;` +
+		`var o=document.createElement('option');o.value=f.path;o.label=f.types.join(', ');dl.appendChild(o);_qbFieldBox(f.path,false);});` +
+		`document.querySelectorAll('#qbRows .qb-row').forEach(function(row){var k=row.querySelector('.qb-kind');` +
+		`if(!k.value)k.value=_qbKindOf(row.querySelector('.qb-field').value.trim());});_qbRender();}).catch(function(){});};` +
+		`window._qbApply=function(){var f=_qbRender();if(!f)return;var s=_qbSort();` +
+		`document.getElementById('cbQueryInput').value=JSON.stringify(f);` +
+		`document.getElementById('cbSort').value=s?JSON.stringify(s):'';` +
+		`document.getElementById('cbFields').value=_qbProjection().join(',');` +
+		`_cbExec('colBrowsePanel');};` +
+		`window._qbSave=function(update){var f=_qbRender();if(!f)return;var st=window._qbState,err=document.getElementById('qbErr');` +
+		`var fd=new FormData();fd.append('query',_qbQueryText(f,_qbSort(),_qbProjection()));fd.append('name',document.getElementById('qbName').value.trim());` +
+		`if(update){fd.append('id',st.saved.id);fd.append('description',st.saved.description||'');}` +
+		`fetch(window.location.origin+(update?'/admin/custom-queries/update':'/admin/custom-queries'),{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();}).then(function(d){if(d.ok){alert(d.message||'Сохранено');}else{err.textContent=d.error||'Ошибка';err.style.display='block';}})` +
+		`.catch(function(){err.textContent='Ошибка';err.style.display='block';});};` +
+		`}</script>`
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pageQueryRuns lists the runs of scheduled queries, newest first, for all
+// queries or for the one in ?query_id=.
+func (p *AdminPanel) pageQueryRuns(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	page := pageNum(ctx)
+	queryID := string(ctx.QueryArgs().Peek("query_id"))
+	baseURL := "/admin/pages/query-runs"
+	filter := map[string]interface{}{}
+	if queryID != "" {
+		filter["query_id"] = queryID
+		baseURL += "?query_id=" + url.QueryEscape(queryID)
+	}
+
+	docs, total, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Filter:     filter,
+		Sort:       map[string]int{"ts": -1},
+		Skip:       (page - 1) * adminPerPage,
+		Limit:      adminPerPage,
+		Count:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	showTenant := p.service.TenancyEnabled()
+	headers := []string{"Время", "Запрос", "Строк", "Длительность", "Оповещение", "Результат"}
+	if showTenant {
+		headers = []string{"Время", "Запрос", "Арендатор", "Строк", "Длительность", "Оповещение", "Результат"}
+	}
+
+	var sb strings.Builder
+	if queryID != "" {
+		sb.WriteString(`<div class="mb-4 text-sm"><a href="/admin/pages/query-runs" class="text-indigo-600 hover:underline">← Все проверки</a></div>`)
+	}
+	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range headers {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+
+	for _, doc := range docs {
+		id, _ := doc["query_id"].(string)
+		name, _ := doc["name"].(string)
+		collection, _ := doc["collection"].(string)
+		tenant, _ := doc["tenant"].(string)
+		alert, _ := doc["alert"].(string)
+		webhookErr, _ := doc["webhook_error"].(string)
+		runErr, _ := doc["error"].(string)
+
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-xs text-slate-500">%s</td>`, formatNanoTwoLine(toAnyInt64(doc["ts"]))))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3"><a href="/admin/pages/query-runs?query_id=%s" class="font-medium text-indigo-600 hover:underline">%s</a><div class="font-mono text-xs text-slate-400">%s</div></td>`,
+			url.QueryEscape(id), template.HTMLEscapeString(name), template.HTMLEscapeString(collection)))
+		if showTenant {
+			sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(tenant)))
+		}
+		if runErr != "" {
+			sb.WriteString(`<td class="px-4 py-3 text-slate-400">—</td>`)
+		} else {
+			sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-semibold">%d</td>`, toAnyInt64(doc["count"])))
+		}
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d мс</td>`, toAnyInt64(doc["duration_ms"])))
+
+		sb.WriteString(`<td class="px-4 py-3 text-xs">`)
+		if alert != "" {
+			sb.WriteString(`<span class="inline-flex rounded-full bg-amber-100 px-2 py-0.5 font-medium text-amber-700">` + template.HTMLEscapeString(alert) + `</span>`)
+		}
+		if webhookErr != "" {
+			sb.WriteString(`<div class="mt-1 text-rose-500">Вебхук: ` + template.HTMLEscapeString(webhookErr) + `</div>`)
+		}
+		sb.WriteString(`</td>`)
+
+		sb.WriteString(`<td class="px-4 py-3 text-xs">`)
+		switch {
+		case runErr != "":
+			sb.WriteString(`<span class="text-rose-600">` + template.HTMLEscapeString(runErr) + `</span>`)
+		case doc["snapshot"] != nil:
+			snapshot, _ := json.MarshalIndent(doc["snapshot"], "", "  ")
+			label := "Снимок"
+			if truncated, _ := doc["snapshot_truncated"].(bool); truncated {
+				label = fmt.Sprintf("Снимок (%d из %d)", snapshotLen(doc["snapshot"]), toAnyInt64(doc["count"]))
+			}
+			sb.WriteString(fmt.Sprintf(`<button type="button" data-title="%s" data-json="%s" onclick="_openQRSnapshot(this)" class="text-indigo-600 hover:underline">%s</button>`,
+				template.HTMLEscapeString(name), template.HTMLEscapeString(string(snapshot)), label))
+		default:
+			sb.WriteString(`<span class="text-slate-400">—</span>`)
+		}
+		sb.WriteString(`</td></tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	sb.WriteString(paginationBar(page, total, adminPerPage, baseURL))
+
+	if len(docs) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mt-4">Запусков нет. Расписание задаётся на странице «Запросы».</p>`)
+	}
+	sb.WriteString(querySnapshotModal())
+	sb.WriteString(queryScheduleScript())
+
+	title := "Проверки по расписанию"
+	var actions string
+	if queryID != "" {
+		if name, ok := docsName(docs); ok {
+			title += ": " + name
+		}
+		actions = fmt.Sprintf(`<button type="button" data-id="%s" onclick="_cqRunNow(this)" class="inline-flex h-9 items-center rounded-xl bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500">Выполнить сейчас</button>`,
+			template.HTMLEscapeString(queryID))
+	}
+
+	return &admin.PageData{
+		Notices: admin.ReadFlash(ctx, "/admin/pages/query-runs"),
+		Sections: []admin.Section{
+			{Title: title, Actions: template.HTML(actions), ContentHTML: template.HTML(sb.String())},
+		},
+	}, nil
+}
+
+func docsName(docs []map[string]interface{}) (string, bool) {
+	if len(docs) == 0 {
+		return "", false
+	}
+	name, _ := docs[0]["name"].(string)
+	return name, name != ""
+}
+
+// snapshotLen counts the rows of a stored snapshot.
+func snapshotLen(v interface{}) int {
+	switch a := v.(type) {
+	case []interface{}:
+		return len(a)
+	case primitive.A:
+		return len(a)
+	}
+	return 0
+}
+
+// queryScheduleCell shows the cron expression, next run and alert rule of a
+// saved query in the list.
+func (p *AdminPanel) queryScheduleCell(id string, schedule types.QuerySchedule) string {
+	if schedule.Cron == "" {
+		return `<span class="text-slate-400">—</span>`
+	}
+	var b strings.Builder
+	b.WriteString(`<div class="font-mono text-xs">` + template.HTMLEscapeString(schedule.Cron) + `</div>`)
+	b.WriteString(`<div class="text-xs text-slate-500">след.: ` + formatRetentionTime(p.service.NextQueryRun(id)) + `</div>`)
+	if schedule.Alert != "" {
+		b.WriteString(`<div class="text-xs text-amber-600">` + template.HTMLEscapeString(schedule.Alert) + `</div>`)
+	}
+	return b.String()
+}
+
+// queryScheduleItems are the dropdown items of a saved query for its
+// schedule and run history.
+func queryScheduleItems(id, paramsJSON string, schedule types.QuerySchedule) []string {
+	values, _ := json.Marshal(schedule.Params)
+	items := []string{fmt.Sprintf(
+		`<button type="button" data-id="%s" data-cron="%s" data-alert="%s" data-webhook="%s" data-params="%s" data-values="%s" onclick="_openCQSchedule(this)" `+
+			`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;background:none;border:none;cursor:pointer;white-space:nowrap" `+
+			`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">Расписание</button>`,
+		template.HTMLEscapeString(id), template.HTMLEscapeString(schedule.Cron), template.HTMLEscapeString(schedule.Alert),
+		template.HTMLEscapeString(schedule.Webhook), template.HTMLEscapeString(paramsJSON), template.HTMLEscapeString(string(values)),
+	)}
+	if schedule.Cron != "" {
+		items = append(items, fmt.Sprintf(
+			`<button type="button" data-id="%s" onclick="_cqRunNow(this)" `+
+				`style="display:block;width:100%%;text-align:left;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;background:none;border:none;cursor:pointer;white-space:nowrap" `+
+				`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">Проверить сейчас</button>`,
+			template.HTMLEscapeString(id),
+		))
+	}
+	items = append(items, fmt.Sprintf(
+		`<a href="/admin/pages/query-runs?query_id=%s" `+
+			`style="display:block;padding:6px 10px;border-radius:6px;font-size:12px;font-weight:500;color:#334155;text-decoration:none;white-space:nowrap" `+
+			`onmouseover="this.style.background='#f1f5f9'" onmouseout="this.style.background=''">История</a>`,
+		url.QueryEscape(id),
+	))
+	return items
+}
+
+func queryScheduleModal() string {
+	return `<div id="cqSchedModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
+		`<div style="background:white;border-radius:16px;width:100%;max-width:560px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
+		`<div style="display:flex;align-items:center;justify-content:space-between;padding:24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<h2 style="font-size:18px;font-weight:700;color:#0f172a">Расписание запроса</h2>` +
+		`<button onclick="_closeModal('cqSchedModal','cqSchedForm','cqSchedErr')" style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
+		`</div>` +
+		`<form id="cqSchedForm" onsubmit="_doModal(event,'/admin/custom-queries/schedule','cqSchedBtn','cqSchedErr','cqSchedModal','cqSchedForm')" style="display:flex;flex:1 1 auto;min-height:0;flex-direction:column">` +
+		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px">` +
+		`<div id="cqSchedErr" style="display:none;padding:12px;border-radius:8px;background:#fef2f2;color:#ef4444;font-size:13px;margin-bottom:16px"></div>` +
+		`<input type="hidden" id="cqSchedId" name="id">` +
+		`<div class="grid gap-4">` +
+		`<div><label class="mb-2 block text-sm font-medium text-slate-700">Cron</label>` +
+		`<input id="cqSchedCron" type="text" name="cron" placeholder="0 9 * * 1-5" class="h-11 w-full rounded-xl border border-slate-300 bg-white px-4 font-mono text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100">` +
+		`<p class="mt-1 text-xs text-slate-400">Минута, час, день, месяц, день недели, либо @hourly, @daily, @every 30m. Пустое значение отключает расписание.</p></div>` +
+		`<div><label class="mb-2 block text-sm font-medium text-slate-700">Оповещение (опционально)</label>` +
+		`<input id="cqSchedAlert" type="text" name="alert" placeholder="count > 0" class="h-11 w-full rounded-xl border border-slate-300 bg-white px-4 font-mono text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100">` +
+		`<p class="mt-1 text-xs text-slate-400">Например <code>count &gt; 0</code>, <code>count == 0</code> или <code>count changed by 20%</code>.</p></div>` +
+		`<div><label class="mb-2 block text-sm font-medium text-slate-700">Вебхук (опционально)</label>` +
+		`<input id="cqSchedWebhook" type="text" name="webhook" placeholder="по умолчанию из конфига" class="h-11 w-full rounded-xl border border-slate-300 bg-white px-4 text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100"></div>` +
+		`<div id="cqSchedParams" class="grid gap-4"></div>` +
+		`</div></div>` +
+		`<div style="padding:16px 24px;border-top:1px solid #e2e8f0;display:flex;justify-content:flex-end;flex:0 0 auto">` +
+		`<button type="submit" id="cqSchedBtn" class="inline-flex h-11 items-center rounded-xl bg-indigo-600 px-5 text-sm font-semibold text-white hover:bg-indigo-500">Сохранить</button>` +
+		`</div></form></div></div>`
+}
+
+// queryScheduleScript opens the schedule modal with an input per query
+// parameter, and runs a scheduled query on demand.
+func queryScheduleScript() string {
+	return `<script>if(!window._cqSchedInit){window._cqSchedInit=true;` +
+		`window._openCQSchedule=function(btn){` +
+		`document.getElementById('cqSchedId').value=btn.getAttribute('data-id');` +
+		`document.getElementById('cqSchedCron').value=btn.getAttribute('data-cron');` +
+		`document.getElementById('cqSchedAlert').value=btn.getAttribute('data-alert');` +
+		`document.getElementById('cqSchedWebhook').value=btn.getAttribute('data-webhook');` +
+		`var params=JSON.parse(btn.getAttribute('data-params')||'[]');` +
+		`var values=JSON.parse(btn.getAttribute('data-values')||'null')||{};` +
+		`var box=document.getElementById('cqSchedParams');box.innerHTML='';` +
+		`params.forEach(function(p){` +
+		`var w=document.createElement('div');var l=document.createElement('label');` +
+		`l.className='mb-2 block text-sm font-medium text-slate-700';l.textContent=p.name+' ('+p.type+')';` +
+		`var i=document.createElement('input');i.type='text';i.name='param_'+p.name;` +
+		`i.value=(p.name in values)?values[p.name]:(p.has_default?p.default:'');if(!p.has_default){i.required=true;}` +
+		`i.className='h-11 w-full rounded-xl border border-slate-300 bg-white px-4 text-sm text-slate-900 outline-none transition focus:border-indigo-500 focus:ring-2 focus:ring-indigo-100';` +
+		`w.appendChild(l);w.appendChild(i);box.appendChild(w);});` +
+		`document.getElementById('cqSchedErr').style.display='none';` +
+		`document.getElementById('cqSchedModal').style.display='flex';};` +
+		`window._cqRunNow=function(btn){btn.disabled=true;` +
+		`var fd=new FormData();fd.append('id',btn.getAttribute('data-id'));` +
+		`fetch(window.location.origin+'/admin/custom-queries/run-now',{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(d.ok){alert(d.message);location.reload();}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){btn.disabled=false;alert('Ошибка сети');});};` +
+		`}</script>`
+}
+
+func querySnapshotModal() string {
+	return `<div id="qrSnapshotModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
+		`<div style="background:white;border-radius:16px;width:100%;max-width:900px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
+		`<div style="display:flex;align-items:center;justify-content:space-between;padding:20px 24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<h2 id="qrSnapshotTitle" style="font-size:18px;font-weight:700;color:#0f172a"></h2>` +
+		`<button onclick="document.getElementById('qrSnapshotModal').style.display='none'" style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
+		`</div>` +
+		`<pre id="qrSnapshotBody" style="flex:1 1 auto;overflow:auto;margin:0;padding:24px;font-size:12px;color:#334155;background:#f8fafc"></pre>` +
+		`</div></div>` +
+		`<script>if(!window._qrSnapshotInit){window._qrSnapshotInit=true;` +
+		`window._openQRSnapshot=function(btn){` +
+		`document.getElementById('qrSnapshotTitle').textContent=btn.getAttribute('data-title');` +
+		`document.getElementById('qrSnapshotBody').textContent=btn.getAttribute('data-json');` +
+		`document.getElementById('qrSnapshotModal').style.display='flex';};}</script>`
+}
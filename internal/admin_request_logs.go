@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -13,8 +12,8 @@ import (
 	"github.com/saiset-co/sai-storage/types"
 )
 
-func (p *AdminPanel) pageRequestLogs(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	collections, err := p.service.GetRepo().ListCollectionNames(context.Background())
+func (p *AdminPanel) pageRequestLogs(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	collections, err := p.service.GetRepo().ListCollectionNames(p.handler.AdminContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -31,9 +30,15 @@ func (p *AdminPanel) pageRequestLogs(_ *saiTypes.RequestCtx) (*admin.PageData, e
 
 	scripts := twoColScript() + requestLogFilterScript() + archiveDocsScript()
 
+	content := twoColPage(items, "rlPanel", scripts)
+	if dropped := p.service.DroppedWrites(); dropped > 0 {
+		content = fmt.Sprintf(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">`+
+			`Буфер записи переполнялся: пропущено %d записей логов и статистики с момента запуска.</div>`, dropped) + content
+	}
+
 	return &admin.PageData{
 		Sections: []admin.Section{
-			{Title: "Логи запросов", ContentHTML: template.HTML(twoColPage(items, "rlPanel", scripts))},
+			{Title: "Логи запросов", Actions: template.HTML(p.tenantSelector(ctx)), ContentHTML: template.HTML(content)},
 		},
 	}, nil
 }
@@ -98,7 +103,7 @@ func (p *AdminPanel) handleAjaxRequestLogs(ctx *saiTypes.RequestCtx) {
 	page := pageNum(ctx)
 	skip := (page - 1) * adminPerPage
 
-	docs, total, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	docs, total, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
 		Collection: collection,
 		Filter:     filter,
 		Sort:       map[string]int{"request_unix": -1},
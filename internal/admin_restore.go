@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -13,20 +12,20 @@ import (
 	"github.com/saiset-co/sai-storage/types"
 )
 
-func (p *AdminPanel) pageCreateArchive(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	return p.buildArchivePage("create_archive", "Логи созданий", "crtArcPanel")
+func (p *AdminPanel) pageCreateArchive(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	return p.buildArchivePage(ctx, "create_archive", "Логи созданий", "crtArcPanel")
 }
 
-func (p *AdminPanel) pageUpdateArchive(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	return p.buildArchivePage("update_archive", "Логи обновлений", "updArcPanel")
+func (p *AdminPanel) pageUpdateArchive(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	return p.buildArchivePage(ctx, "update_archive", "Логи обновлений", "updArcPanel")
 }
 
-func (p *AdminPanel) pageDeleteArchive(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	return p.buildArchivePage("delete_archive", "Логи удалений", "delArcPanel")
+func (p *AdminPanel) pageDeleteArchive(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	return p.buildArchivePage(ctx, "delete_archive", "Логи удалений", "delArcPanel")
 }
 
-func (p *AdminPanel) buildArchivePage(suffix, title, panelID string) (*admin.PageData, error) {
-	collections, err := p.service.GetRepo().ListCollectionNames(context.Background())
+func (p *AdminPanel) buildArchivePage(ctx *saiTypes.RequestCtx, suffix, title, panelID string) (*admin.PageData, error) {
+	collections, err := p.service.GetRepo().ListCollectionNames(p.handler.AdminContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +45,7 @@ func (p *AdminPanel) buildArchivePage(suffix, title, panelID string) (*admin.Pag
 
 	return &admin.PageData{
 		Sections: []admin.Section{
-			{Title: title, ContentHTML: template.HTML(twoColPage(items, panelID, scripts))},
+			{Title: title, Actions: template.HTML(p.tenantSelector(ctx)), ContentHTML: template.HTML(twoColPage(items, panelID, scripts))},
 		},
 	}, nil
 }
@@ -77,7 +76,7 @@ func (p *AdminPanel) buildAjaxArchiveContent(ctx *saiTypes.RequestCtx, suffix, r
 	page := pageNum(ctx)
 	skip := (page - 1) * adminPerPage
 
-	groups, total, err := p.service.GetRepo().GetArchiveGroups(context.Background(), collection, search, skip, adminPerPage)
+	groups, total, err := p.service.GetRepo().GetArchiveGroups(p.handler.AdminContext(ctx), collection, search, skip, adminPerPage)
 	if err != nil {
 		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
 		return
@@ -147,7 +146,7 @@ func (p *AdminPanel) handleArchiveDocs(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
-	docs, _, err := p.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	docs, _, err := p.service.GetRepo().ReadDocuments(p.handler.AdminContext(ctx), types.ReadDocumentsRequest{
 		Collection: archiveCollection,
 		Filter:     map[string]interface{}{"archive_operation_id": opID},
 		Sort:       map[string]int{"cr_time": 1},
@@ -168,9 +167,13 @@ func (p *AdminPanel) handleArchiveDocs(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	sb.WriteString(archiveDiffSection(docs))
+
 	metaSkip := map[string]bool{
 		"_id": true, "archive_operation_id": true, "archive_time": true,
 		"source_collection": true, "archive_filter": true, "archive_update": true,
+		"archive_post_image": true, "archive_diff": true,
+		types.RetentionTimeField: true,
 	}
 
 	headerSet := make(map[string]struct{})
@@ -217,6 +220,67 @@ func (p *AdminPanel) handleArchiveDocs(ctx *saiTypes.RequestCtx) {
 	ctx.Response.SetBodyString(sb.String())
 }
 
+// archiveDiffSection renders the field diffs stored with update archives, one
+// block per document. Archives written without a diff render nothing.
+func archiveDiffSection(docs []map[string]interface{}) string {
+	var sb strings.Builder
+	for _, doc := range docs {
+		raw, ok := doc["archive_diff"]
+		if !ok || raw == nil {
+			continue
+		}
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+		var changes []types.FieldChange
+		if err := json.Unmarshal(encoded, &changes); err != nil {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString(`<div style="font-size:13px;font-weight:600;color:#334155;margin-bottom:8px">Изменения</div>`)
+		}
+
+		internalID, _ := doc["internal_id"].(string)
+		sb.WriteString(`<div style="margin-bottom:12px">`)
+		sb.WriteString(`<div style="font-family:monospace;font-size:11px;color:#64748b;margin-bottom:4px">` + template.HTMLEscapeString(internalID) + `</div>`)
+		if len(changes) == 0 {
+			sb.WriteString(`<p style="font-size:12px;color:#94a3b8">Без изменений.</p></div>`)
+			continue
+		}
+		sb.WriteString(`<table class="min-w-full divide-y divide-slate-200 text-xs"><thead class="bg-slate-50"><tr>` +
+			`<th class="px-3 py-2 text-left font-medium text-slate-600">Поле</th>` +
+			`<th class="px-3 py-2 text-left font-medium text-slate-600">Было</th>` +
+			`<th class="px-3 py-2 text-left font-medium text-slate-600">Стало</th>` +
+			`</tr></thead><tbody class="divide-y divide-slate-100">`)
+		for _, c := range changes {
+			sb.WriteString(`<tr><td class="px-3 py-2 font-mono text-slate-600">` + template.HTMLEscapeString(c.Path) + `</td>`)
+			sb.WriteString(`<td class="px-3 py-2 font-mono">`)
+			if c.Op != "added" {
+				sb.WriteString(`<span style="background:#ffe4e6;color:#9f1239;padding:0 4px;border-radius:4px">` + template.HTMLEscapeString(truncate(diffValue(c.Old), 80)) + `</span>`)
+			}
+			sb.WriteString(`</td><td class="px-3 py-2 font-mono">`)
+			if c.Op != "removed" {
+				sb.WriteString(`<span style="background:#dcfce7;color:#166534;padding:0 4px;border-radius:4px">` + template.HTMLEscapeString(truncate(diffValue(c.New), 80)) + `</span>`)
+			}
+			sb.WriteString(`</td></tr>`)
+		}
+		sb.WriteString(`</tbody></table></div>`)
+	}
+	return sb.String()
+}
+
+func diffValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
 func archiveQueryModal() string {
 	return `<div id="archiveQueryModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
 		`<div style="background:white;border-radius:16px;width:100%;max-width:900px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
@@ -228,6 +292,7 @@ func archiveQueryModal() string {
 		`<input type="hidden" id="archiveRestoreOpID" name="archive_operation_id">` +
 		`<button id="archiveRestoreBtn" type="submit" class="inline-flex h-9 items-center rounded-xl bg-amber-500 px-4 text-sm font-semibold text-white hover:bg-amber-400">Восстановить</button>` +
 		`</form>` +
+		`<a id="archiveRollbackLink" href="#" style="display:none" class="inline-flex h-9 items-center rounded-xl bg-white border border-slate-300 px-4 text-sm font-semibold text-slate-700 hover:bg-slate-50">Откат цепочки</a>` +
 		`<button onclick="document.getElementById('archiveQueryModal').style.display='none'" ` +
 		`style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
 		`</div></div>` +
@@ -270,6 +335,8 @@ func archiveDocsScript() string {
 		`if(restored>0){rb.disabled=true;rb.textContent='Уже восстановлено';rb.className='inline-flex h-9 items-center rounded-xl bg-slate-300 px-4 text-sm font-semibold text-white';}` +
 		`else{rb.disabled=false;rb.textContent=count>0?'Восстановить '+count+' документов':'Восстановить';rb.className='inline-flex h-9 items-center rounded-xl bg-amber-500 px-4 text-sm font-semibold text-white hover:bg-amber-400';}` +
 		`}else{restoreForm.style.display='none';}` +
+		`var rl=document.getElementById('archiveRollbackLink');` +
+		`if(srcCol&&opID){rl.href='/admin/pages/rollback?collection='+encodeURIComponent(srcCol)+'&operation_id='+encodeURIComponent(opID);rl.style.display='inline-flex';}else{rl.style.display='none';}` +
 		`document.getElementById('archiveQueryModal').style.display='flex';` +
 		`if(opID&&logCol){` +
 		`fetch(window.location.origin+'/admin/ajax/request-log-info?op_id='+encodeURIComponent(opID)+'&log_collection='+encodeURIComponent(logCol),{headers:{'X-Requested-With':'fetch'}})` +
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func (p *AdminPanel) pageRetention(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	status := p.service.RetentionStatus()
+
+	var sb strings.Builder
+	if !status.Enabled {
+		sb.WriteString(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">` +
+			`Автоочистка выключена. Включите <code>retention.enabled: true</code> в конфиге.</div>`)
+	}
+
+	sb.WriteString(`<dl class="grid gap-2 text-sm" style="grid-template-columns:max-content 1fr;margin-bottom:16px">`)
+	sb.WriteString(`<dt class="text-slate-500">Интервал</dt><dd>` + template.HTMLEscapeString(status.Interval.String()) + `</dd>`)
+	sb.WriteString(`<dt class="text-slate-500">Последний запуск</dt><dd>` + formatRetentionTime(status.LastRun) + `</dd>`)
+	next := formatRetentionTime(status.NextRun)
+	if status.Running {
+		next = "выполняется"
+	}
+	sb.WriteString(`<dt class="text-slate-500">Следующий запуск</dt><dd>` + next + `</dd>`)
+	sb.WriteString(`</dl>`)
+
+	sb.WriteString(`<h3 class="text-sm font-semibold text-slate-700 mb-2">Политики</h3>`)
+	sb.WriteString(`<div class="overflow-x-auto mb-6"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"Шаблон", "Макс. возраст", "Макс. документов"} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, policy := range status.Policies {
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono font-medium">%s</td>`, template.HTMLEscapeString(policy.Pattern)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, retentionAge(policy)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, retentionMaxDocs(policy)))
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	if len(status.Policies) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mb-6">Политики не настроены.</p>`)
+	}
+
+	sb.WriteString(`<h3 class="text-sm font-semibold text-slate-700 mb-2">Результат последнего запуска</h3>`)
+	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	headers := []string{"Коллекция", "Шаблон", "TTL-индекс", "Удалено", "Ошибка"}
+	if p.service.TenancyEnabled() {
+		headers = append([]string{"Тенант"}, headers...)
+	}
+	for _, h := range headers {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for _, c := range status.Collections {
+		ttl := `<span class="text-slate-400">нет</span>`
+		if c.TTL {
+			ttl = `<span class="text-emerald-600 font-semibold">да</span>`
+		}
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		if p.service.TenancyEnabled() {
+			sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(c.Tenant)))
+		}
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono font-medium">%s</td>`, template.HTMLEscapeString(c.Collection)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(c.Policy.Pattern)))
+		sb.WriteString(`<td class="px-4 py-3">` + ttl + `</td>`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d</td>`, c.Deleted))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-rose-600 text-xs">%s</td>`, template.HTMLEscapeString(c.Error)))
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+	if len(status.Collections) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm mt-4">Подходящих коллекций пока не найдено.</p>`)
+	}
+	sb.WriteString(`<p class="text-xs text-slate-400 mt-4">Политики применяются только к логам запросов, архивам, медленным и частым запросам. ` +
+		`Для MongoDB максимальный возраст дополнительно поддерживается TTL-индексом.</p>`)
+	sb.WriteString(retentionScript())
+
+	actions := `<button onclick="_retentionRun(this)" class="inline-flex h-9 items-center rounded-xl bg-slate-600 px-4 text-sm font-semibold text-white hover:bg-slate-500">Запустить сейчас</button>`
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Хранение логов и архивов", Actions: template.HTML(actions), ContentHTML: template.HTML(sb.String())},
+		},
+	}, nil
+}
+
+func formatRetentionTime(t time.Time) string {
+	if t.IsZero() {
+		return `<span class="text-slate-400">—</span>`
+	}
+	return template.HTMLEscapeString(t.Format("2006-01-02 15:04:05"))
+}
+
+func retentionAge(policy types.RetentionPolicy) string {
+	if policy.MaxAgeDays <= 0 {
+		return `<span class="text-slate-400">—</span>`
+	}
+	return fmt.Sprintf("%d дн.", policy.MaxAgeDays)
+}
+
+func retentionMaxDocs(policy types.RetentionPolicy) string {
+	if policy.MaxDocuments <= 0 {
+		return `<span class="text-slate-400">—</span>`
+	}
+	return fmt.Sprintf("%d", policy.MaxDocuments)
+}
+
+func retentionScript() string {
+	return `<script>if(!window._retentionInit){window._retentionInit=true;` +
+		`window._retentionRun=function(btn){btn.disabled=true;` +
+		`fetch(window.location.origin+'/admin/retention/run',{method:'POST',headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(d.ok){if(d.message)alert(d.message);setTimeout(function(){location.reload();},1000);}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){btn.disabled=false;alert('Ошибка сети');});};` +
+		`}</script>`
+}
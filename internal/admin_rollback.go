@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+)
+
+var rollbackActionLabels = map[string]string{
+	"delete":  "удалить",
+	"restore": "вернуть прежнее состояние",
+}
+
+func (p *AdminPanel) pageRollback(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	collection := template.HTMLEscapeString(string(ctx.QueryArgs().Peek("collection")))
+	operationID := template.HTMLEscapeString(string(ctx.QueryArgs().Peek("operation_id")))
+
+	var sb strings.Builder
+	sb.WriteString(`<form id="rollbackForm" onsubmit="return _rollbackPlan(event)" class="grid gap-4 mb-6" style="grid-template-columns:repeat(auto-fit,minmax(220px,1fr))">`)
+	sb.WriteString(mField("collection", "Коллекция", collection, ""))
+	sb.WriteString(mField("operation_id", "ID операции", operationID, ""))
+	sb.WriteString(mField("from", "Начало периода", "", "datetime-local"))
+	sb.WriteString(mField("to", "Конец периода", "", "datetime-local"))
+	sb.WriteString(mField("internal_ids", "internal_id документов (через запятую)", "", ""))
+	sb.WriteString(`<div style="display:flex;align-items:flex-end"><button type="submit" class="inline-flex h-11 items-center rounded-xl bg-indigo-600 px-5 text-sm font-semibold text-white hover:bg-indigo-500">Построить план</button></div>`)
+	sb.WriteString(`</form>`)
+	sb.WriteString(`<p class="text-xs text-slate-400 mb-4">Откат начинается с указанной операции или с начала периода и включает все более поздние изменения выбранных документов. ` +
+		`Без списка документов берутся документы операции или все документы, изменённые за период. Откат выполняется как новая операция и сам попадает в архивы.</p>`)
+	sb.WriteString(`<div id="rollbackPlan"></div>`)
+	sb.WriteString(rollbackScript())
+
+	return &admin.PageData{
+		Sections: []admin.Section{
+			{Title: "Откат цепочки операций", ContentHTML: template.HTML(sb.String())},
+		},
+	}, nil
+}
+
+func (p *AdminPanel) handleAjaxRollbackPlan(ctx *saiTypes.RequestCtx) {
+	ctx.SetContentType("text/html; charset=utf-8")
+
+	req, err := p.handler.RollbackRequestFromForm(ctx)
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+	plan, err := p.service.PlanRollback(p.handler.AdminContext(ctx), req)
+	if err != nil {
+		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<p class="text-sm text-slate-600 mb-4">Документов: <b>%d</b>, шагов: <b>%d</b>, начиная с %s.</p>`,
+		plan.Documents, len(plan.Steps), formatNano(plan.From)))
+
+	if len(plan.Conflicts) > 0 {
+		sb.WriteString(`<div class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-700">`)
+		sb.WriteString(fmt.Sprintf(`<div class="font-semibold mb-2">Конфликты: %d</div>`, len(plan.Conflicts)))
+		sb.WriteString(`<table class="text-xs"><tbody>`)
+		for _, c := range plan.Conflicts {
+			sb.WriteString(`<tr><td class="pr-4 py-1 font-mono">` + template.HTMLEscapeString(c.InternalID) + `</td>`)
+			sb.WriteString(`<td class="pr-4 py-1">` + template.HTMLEscapeString(c.Reason) + `</td>`)
+			detail := ""
+			if c.OperationID != "" {
+				detail = c.OperationID + " · " + formatNano(c.Time)
+			}
+			sb.WriteString(`<td class="py-1 font-mono text-amber-600">` + template.HTMLEscapeString(detail) + `</td></tr>`)
+		}
+		sb.WriteString(`</tbody></table></div>`)
+	}
+
+	sb.WriteString(`<div class="overflow-x-auto mb-4"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
+	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
+	for _, h := range []string{"#", "Время", "Операция", "ID операции", "internal_id", "Действие"} {
+		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
+	}
+	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
+	for i, step := range plan.Steps {
+		color := historyOperationColors[step.Operation]
+		sb.WriteString(`<tr class="hover:bg-slate-50">`)
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-2 text-slate-400">%d</td>`, i+1))
+		sb.WriteString(`<td class="px-4 py-2 text-xs text-slate-500 whitespace-nowrap">` + formatNano(step.Time) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-2" style="color:` + color + `;font-weight:600">` + template.HTMLEscapeString(historyOperationLabels[step.Operation]) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-2 font-mono text-xs text-slate-400">` + template.HTMLEscapeString(step.OperationID) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-2 font-mono text-xs">` + template.HTMLEscapeString(step.InternalID) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-2 text-xs">` + template.HTMLEscapeString(rollbackActionLabels[step.Action]) + `</td>`)
+		sb.WriteString(`</tr>`)
+	}
+	sb.WriteString(`</tbody></table></div>`)
+
+	if len(plan.Steps) == 0 {
+		sb.WriteString(`<p class="text-slate-500 text-sm">Откатывать нечего.</p>`)
+		ctx.Response.SetBodyString(sb.String())
+		return
+	}
+
+	sb.WriteString(`<div style="display:flex;align-items:center;gap:16px">`)
+	if len(plan.Conflicts) > 0 {
+		sb.WriteString(`<label class="text-sm text-slate-700" style="display:flex;align-items:center;gap:6px"><input type="checkbox" id="rollbackForce"> Откатить несмотря на конфликты</label>`)
+	}
+	sb.WriteString(`<button id="rollbackApplyBtn" onclick="_rollbackApply(this)" class="inline-flex h-9 items-center rounded-xl bg-amber-500 px-4 text-sm font-semibold text-white hover:bg-amber-400">Применить откат</button>`)
+	sb.WriteString(`</div>`)
+
+	ctx.Response.SetBodyString(sb.String())
+}
+
+func rollbackScript() string {
+	return `<script>if(!window._rollbackInit){window._rollbackInit=true;` +
+		`window._rollbackForm=function(){var fd=new FormData(document.getElementById('rollbackForm'));` +
+		`['from','to'].forEach(function(k){if(!fd.get(k))fd.delete(k);});return fd;};` +
+		`window._rollbackPlan=function(e){e.preventDefault();` +
+		`var panel=document.getElementById('rollbackPlan');` +
+		`panel.innerHTML='<p style="font-size:13px;color:#94a3b8">Загрузка...</p>';` +
+		`fetch(window.location.origin+'/admin/ajax/rollback-plan?'+new URLSearchParams(_rollbackForm()).toString(),{headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.text();})` +
+		`.then(function(h){panel.innerHTML=h;})` +
+		`.catch(function(){panel.innerHTML='<p style="font-size:13px;color:#ef4444">Ошибка загрузки</p>';});` +
+		`return false;};` +
+		`window._rollbackApply=function(btn){` +
+		`if(!confirm('Откатить все шаги плана?'))return;` +
+		`var fd=_rollbackForm();var force=document.getElementById('rollbackForce');` +
+		`if(force&&force.checked)fd.append('force','true');` +
+		`btn.disabled=true;` +
+		`fetch(window.location.origin+'/admin/rollback/apply',{method:'POST',body:fd,headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(d.ok){alert(d.message);document.getElementById('rollbackPlan').innerHTML='';}else{alert(d.error||'Ошибка');}})` +
+		`.catch(function(){btn.disabled=false;alert('Ошибка сети');});};` +
+		`}</script>`
+}
@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -11,11 +10,12 @@ import (
 
 	"github.com/saiset-co/sai-service/admin"
 	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/handlers"
 	"github.com/saiset-co/sai-storage/types"
 )
 
-func (p *AdminPanel) pageCollections(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	stats, err := p.service.GetRepo().GetAdminCollectionStats(context.Background())
+func (p *AdminPanel) pageCollections(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	stats, err := p.service.GetRepo().GetAdminCollectionStats(p.handler.AdminContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +30,7 @@ func (p *AdminPanel) pageCollections(_ *saiTypes.RequestCtx) (*admin.PageData, e
 	sb.WriteString(jsSearch("Фильтр по коллекции...", "tbl-collections"))
 	sb.WriteString(`<div class="overflow-x-auto"><table id="tbl-collections" class="min-w-full divide-y divide-slate-200 text-sm">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
-	for _, h := range []string{"Коллекция", "Документов", "Размер", "Индексов"} {
+	for _, h := range []string{"Коллекция", "Тип", "Документов", "Размер", "Индексов", ""} {
 		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
 	}
 	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
@@ -40,76 +40,124 @@ func (p *AdminPanel) pageCollections(_ *saiTypes.RequestCtx) (*admin.PageData, e
 			`<td class="px-4 py-3"><button class="text-indigo-600 hover:text-indigo-800 font-semibold text-left" onclick="_colOpen('%s')">%s</button></td>`,
 			template.JSEscapeString(s.Name), template.HTMLEscapeString(s.Name),
 		))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 text-slate-500">%s</td>`, collectionTypeLabels[s.Type]))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d</td>`, s.Count))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, formatBytes(s.StorageSize)))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%d</td>`, s.NumIndexes))
+		sb.WriteString(`<td class="px-4 py-3">` + collectionActions(s.Name) + `</td>`)
 		sb.WriteString(`</tr>`)
 	}
 	sb.WriteString(`</tbody></table></div></div>`)
 
 	sb.WriteString(`<div id="colBrowsePanel"></div>`)
 
+	sb.WriteString(collectionModals())
 	sb.WriteString(docViewModal())
+	sb.WriteString(documentHistoryModal())
 	sb.WriteString(twoColScript())
 	sb.WriteString(collectionBrowseScript())
+	sb.WriteString(queryBuilderScript())
 	sb.WriteString(modalScript())
 	sb.WriteString(docViewScript())
+	sb.WriteString(documentHistoryScript())
+	sb.WriteString(collectionScript())
 	sb.WriteString(`<script>if(!window._colOpenInit){window._colOpenInit=true;` +
-		`window._colOpen=function(name){` +
+		`window._colOpen=function(name,extra){` +
 		`document.getElementById('colStatsTable').style.display='none';` +
 		`document.getElementById('colBackBtn').style.display='block';` +
-		`_loadPanel('/admin/ajax/collection-browse?collection='+encodeURIComponent(name),'colBrowsePanel',null);` +
+		`_loadPanel('/admin/ajax/collection-browse?collection='+encodeURIComponent(name)+(extra||''),'colBrowsePanel',null);` +
 		`};` +
 		`window._colBack=function(){` +
 		`document.getElementById('colStatsTable').style.display='';` +
 		`document.getElementById('colBackBtn').style.display='none';` +
 		`document.getElementById('colBrowsePanel').innerHTML='';` +
 		`};}</script>`)
+	if saved := string(ctx.QueryArgs().Peek("saved")); saved != "" {
+		sb.WriteString(fmt.Sprintf(`<script>_colOpen('%s','&saved=%s');</script>`,
+			template.JSEscapeString(string(ctx.QueryArgs().Peek("collection"))), template.JSEscapeString(url.QueryEscape(saved))))
+	}
 
 	return &admin.PageData{
 		Sections: []admin.Section{
-			{Title: "Коллекции", ContentHTML: template.HTML(sb.String())},
+			{Title: "Коллекции", Actions: template.HTML(p.tenantSelector(ctx) + openModalBtn("+ Коллекция", "colCreateModal", "inline-flex h-9 items-center rounded-xl bg-indigo-600 px-4 text-sm font-semibold text-white hover:bg-indigo-500")), ContentHTML: template.HTML(sb.String())},
 		},
 	}, nil
 }
 
+// handleAjaxCollectionBrowse renders a page of documents matching the
+// browser query. Fields of the query are shown as extra columns; documents
+// are still read whole, so the editor never saves a projection.
 func (p *AdminPanel) handleAjaxCollectionBrowse(ctx *saiTypes.RequestCtx) {
-	collection := string(ctx.QueryArgs().Peek("collection"))
-	filterRaw := strings.TrimSpace(string(ctx.QueryArgs().Peek("query")))
+	q := browseQueryArgs(ctx)
 	page := pageNum(ctx)
 
 	ctx.SetContentType("text/html; charset=utf-8")
 
-	if collection == "" {
-		ctx.Response.SetBodyString(`<p style="font-size:13px;color:#94a3b8">Выберите коллекцию.</p>`)
-		return
+	if savedID := string(ctx.QueryArgs().Peek("saved")); savedID != "" {
+		saved, err := p.savedBrowseQuery(savedID)
+		if err != nil {
+			ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
+			return
+		}
+		q = saved
+	} else if ref := string(ctx.QueryArgs().Peek("ref")); ref != "" {
+		if doc, err := p.savedQueryDoc(ref); err == nil {
+			q.Saved = savedRef(ref, doc)
+		}
 	}
 
-	if filterRaw == "" {
-		filterRaw = "{}"
+	if q.Collection == "" {
+		ctx.Response.SetBodyString(`<p style="font-size:13px;color:#94a3b8">Выберите коллекцию.</p>`)
+		return
 	}
+	collection := q.Collection
 
 	var sb strings.Builder
 
 	sb.WriteString(`<div style="display:flex;align-items:center;gap:8px;margin-bottom:12px">`)
 	sb.WriteString(`<input type="hidden" id="cbCollection" value="` + template.HTMLEscapeString(collection) + `">`)
+	sb.WriteString(`<input type="hidden" id="cbSort" value="` + template.HTMLEscapeString(q.Sort) + `">`)
+	sb.WriteString(`<input type="hidden" id="cbFields" value="` + template.HTMLEscapeString(q.Fields) + `">`)
+	if q.Saved != nil {
+		sb.WriteString(`<input type="hidden" id="cbRef" value="` + template.HTMLEscapeString(q.Saved.ID) + `">`)
+	}
 	sb.WriteString(`<input type="text" id="cbQueryInput" onkeydown="_cbKeyExec(event,'colBrowsePanel')" placeholder="{}" ` +
 		`style="flex:1;font-family:monospace;font-size:13px;border:1px solid #cbd5e1;border-radius:8px;padding:0 12px;height:36px;outline:none;min-width:0" ` +
-		`value="` + template.HTMLEscapeString(filterRaw) + `">`)
+		`value="` + template.HTMLEscapeString(q.Filter) + `">`)
 	sb.WriteString(`<button onclick="_cbExec('colBrowsePanel')" style="flex-shrink:0;height:36px;border:none;border-radius:8px;background:#0f172a;color:white;font-size:13px;font-weight:600;padding:0 16px;cursor:pointer">▶ Выполнить</button>`)
+	sb.WriteString(`<button onclick="_docNew()" style="flex-shrink:0;height:36px;border:1px solid #c7d2fe;border-radius:8px;background:#eef2ff;color:#4338ca;font-size:13px;font-weight:600;padding:0 16px;cursor:pointer">+ Документ</button>`)
 	sb.WriteString(`</div>`)
+	if q.Sort != "" || q.Fields != "" {
+		sb.WriteString(`<div style="display:flex;flex-wrap:wrap;gap:4px 16px;margin:-4px 0 12px;font-size:12px;color:#64748b">`)
+		if q.Sort != "" {
+			sb.WriteString(`<span>Сортировка: <code>` + template.HTMLEscapeString(q.Sort) + `</code></span>`)
+		}
+		if q.Fields != "" {
+			sb.WriteString(`<span>Поля: <code>` + template.HTMLEscapeString(q.Fields) + `</code></span>`)
+		}
+		sb.WriteString(`<button onclick="_cbResetView('colBrowsePanel')" style="font-size:12px;color:#6366f1;background:none;border:none;cursor:pointer;padding:0">сбросить</button></div>`)
+	}
 
-	var filter map[string]interface{}
-	if err := ctx.Unmarshal([]byte(filterRaw), &filter); err != nil {
-		sb.WriteString(`<p class="text-rose-500 text-sm">Неверный JSON: ` + template.HTMLEscapeString(err.Error()) + `</p>`)
+	adminCtx := p.handler.AdminContext(ctx)
+	if schema, err := p.service.CollectionSchema(adminCtx, collection); err == nil && len(schema) > 0 {
+		if schemaJSON, err := handlers.DocumentJSON(schema); err == nil {
+			sb.WriteString(`<pre id="cbSchema" style="display:none">` + template.HTMLEscapeString(schemaJSON) + `</pre>`)
+		}
+	}
+
+	filter, sortDoc, fields, err := q.parse()
+	if err != nil {
+		sb.WriteString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
 		ctx.Response.SetBodyString(sb.String())
 		return
 	}
+	sb.WriteString(queryBuilder(q, filter, sortDoc, fields))
 
 	skip := (page - 1) * adminPerPage
-	resp, execErr := p.service.ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+	resp, execErr := p.service.ReadDocuments(adminCtx, types.ReadDocumentsRequest{
 		Collection: collection,
 		Filter:     filter,
+		Sort:       sortDoc,
 		Limit:      adminPerPage,
 		Skip:       skip,
 		Count:      1,
@@ -130,33 +178,42 @@ func (p *AdminPanel) handleAjaxCollectionBrowse(ctx *saiTypes.RequestCtx) {
 		ctx.Response.SetBodyString(sb.String())
 		return
 	}
+	sb.WriteString(p.exportBar("/admin/collection-export", q.params()))
 
 	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-xs">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
-	for _, h := range []string{"internal_id", "cr_time", "ch_time", ""} {
-		sb.WriteString(`<th class="px-3 py-2 text-left font-medium text-slate-600">` + h + `</th>`)
+	for _, h := range append(append([]string{"internal_id"}, fields...), "cr_time", "ch_time", "") {
+		sb.WriteString(`<th class="px-3 py-2 text-left font-medium text-slate-600">` + template.HTMLEscapeString(h) + `</th>`)
 	}
 	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
 	for _, doc := range docs {
-		docJSON, _ := json.MarshalIndent(doc, "", "  ")
+		docJSON, err := handlers.DocumentJSON(doc)
+		if err != nil {
+			docJSON = err.Error()
+		}
 		internalID, _ := doc["internal_id"].(string)
 		crTime := docNano(doc, "cr_time")
 		chTime := docNano(doc, "ch_time")
 		sb.WriteString(`<tr class="hover:bg-slate-50">`)
 		sb.WriteString(`<td class="px-3 py-2 font-mono">` + template.HTMLEscapeString(internalID) + `</td>`)
+		for _, f := range fields {
+			v, _ := fieldValue(doc, f)
+			sb.WriteString(`<td class="px-3 py-2 font-mono">` + template.HTMLEscapeString(fieldCell(v)) + `</td>`)
+		}
 		sb.WriteString(`<td class="px-3 py-2">` + crTime + `</td>`)
 		sb.WriteString(`<td class="px-3 py-2">` + chTime + `</td>`)
 		sb.WriteString(fmt.Sprintf(
-			`<td class="px-3 py-2"><button data-doc='%s' onclick="_docView(this.dataset.doc)" style="font-size:12px;color:#6366f1;font-weight:500;border:1px solid #e0e7ff;background:none;cursor:pointer;padding:2px 8px;border-radius:4px">Просмотр</button></td>`,
-			template.HTMLEscapeString(string(docJSON)),
+			`<td class="px-3 py-2" style="white-space:nowrap"><button data-doc='%s' onclick="_docView(this.dataset.doc)" style="font-size:12px;color:#6366f1;font-weight:500;border:1px solid #e0e7ff;background:none;cursor:pointer;padding:2px 8px;border-radius:4px">Открыть</button> `+
+				`<button data-collection="%s" data-id="%s" onclick="_docHistory(this.dataset.collection,this.dataset.id)" style="font-size:12px;color:#475569;font-weight:500;border:1px solid #e2e8f0;background:none;cursor:pointer;padding:2px 8px;border-radius:4px">История</button></td>`,
+			template.HTMLEscapeString(docJSON),
+			template.HTMLEscapeString(collection),
+			template.HTMLEscapeString(internalID),
 		))
 		sb.WriteString(`</tr>`)
 	}
 	sb.WriteString(`</tbody></table></div>`)
 
-	baseURL := fmt.Sprintf("/admin/ajax/collection-browse?collection=%s&query=%s",
-		url.QueryEscape(collection), url.QueryEscape(filterRaw))
-	sb.WriteString(ajaxPaginationBar(page, total, adminPerPage, baseURL, "colBrowsePanel"))
+	sb.WriteString(ajaxPaginationBar(page, total, adminPerPage, q.url(), "colBrowsePanel"))
 
 	ctx.Response.SetBodyString(sb.String())
 }
@@ -200,25 +257,78 @@ func browseDocHeaders(docs []map[string]interface{}) []string {
 	return keys
 }
 
+// docViewModal is the document editor of the collection browser. The text is
+// Extended JSON as rendered by handlers.DocumentJSON.
 func docViewModal() string {
+	btn := `height:36px;border-radius:8px;font-size:13px;font-weight:600;padding:0 16px;cursor:pointer;`
 	return `<div id="docViewModal" style="display:none;position:fixed;inset:0;background:rgba(15,23,42,0.5);z-index:50;align-items:center;justify-content:center;padding:16px">` +
 		`<div style="background:white;border-radius:16px;width:100%;max-width:800px;max-height:90vh;overflow:hidden;display:flex;flex-direction:column;box-shadow:0 25px 50px rgba(0,0,0,0.3)">` +
 		`<div style="display:flex;align-items:center;justify-content:space-between;padding:20px 24px;border-bottom:1px solid #e2e8f0;flex:0 0 auto">` +
-		`<h2 style="font-size:18px;font-weight:700;color:#0f172a">Документ</h2>` +
+		`<div><h2 id="docEditTitle" style="font-size:18px;font-weight:700;color:#0f172a">Документ</h2>` +
+		`<div id="docEditSub" style="font-size:12px;color:#94a3b8;font-family:monospace"></div></div>` +
 		`<button onclick="document.getElementById('docViewModal').style.display='none'" style="width:32px;height:32px;border-radius:8px;background:#f1f5f9;border:none;cursor:pointer;font-size:18px;color:#64748b">×</button>` +
 		`</div>` +
-		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px">` +
-		`<pre id="docViewContent" style="font-size:12px;font-family:monospace;white-space:pre-wrap;word-break:break-all;margin:0;color:#0f172a"></pre>` +
+		`<div style="flex:1 1 auto;overflow-y:auto;padding:24px;display:flex;flex-direction:column;gap:12px">` +
+		`<details id="docEditSchema" style="display:none;font-size:12px;color:#475569"><summary style="cursor:pointer">Схема коллекции</summary>` +
+		`<pre id="docEditSchemaContent" style="font-size:12px;font-family:monospace;white-space:pre-wrap;word-break:break-all;margin:8px 0 0;padding:10px;background:#f8fafc;border-radius:8px"></pre></details>` +
+		`<textarea id="docViewContent" spellcheck="false" oninput="_docCheck()" style="width:100%;min-height:420px;font-size:12px;font-family:monospace;border:1px solid #cbd5e1;border-radius:8px;padding:12px;outline:none;resize:vertical;color:#0f172a"></textarea>` +
+		`<div id="docEditErr" style="display:none;font-size:13px;color:#e11d48;white-space:pre-wrap"></div>` +
+		`<div style="font-size:11px;color:#94a3b8">Extended JSON: {"$oid": "..."}, {"$date": "..."}, {"$numberLong": "..."}, {"$numberDecimal": "..."}. Схему коллекции проверяет база при сохранении.</div>` +
+		`</div>` +
+		`<div style="display:flex;align-items:center;gap:8px;padding:16px 24px;border-top:1px solid #e2e8f0;flex:0 0 auto">` +
+		`<button id="docEditDelete" onclick="_docDelete()" style="` + btn + `border:1px solid #fecdd3;background:#fff1f2;color:#e11d48">Удалить</button>` +
+		`<button id="docEditCopy" onclick="_docSave(true)" style="` + btn + `border:1px solid #e2e8f0;background:white;color:#475569">Дублировать</button>` +
+		`<span style="flex:1"></span>` +
+		`<button onclick="document.getElementById('docViewModal').style.display='none'" style="` + btn + `border:1px solid #e2e8f0;background:white;color:#475569">Отмена</button>` +
+		`<button id="docEditSave" onclick="_docSave(false)" style="` + btn + `border:none;background:#0f172a;color:white">Сохранить</button>` +
 		`</div></div></div>`
 }
 
+// docViewScript opens documents in the editor and sends the changes. An
+// edited or deleted document carries the ch_time it was opened with, so a
+// change made meanwhile is not overwritten.
 func docViewScript() string {
 	return `<script>if(!window._docViewInit){window._docViewInit=true;` +
-		`window._docView=function(jsonStr){` +
-		`try{var o=JSON.parse(jsonStr);document.getElementById('docViewContent').textContent=JSON.stringify(o,null,2);}` +
-		`catch(e){document.getElementById('docViewContent').textContent=jsonStr;}` +
-		`document.getElementById('docViewModal').style.display='flex';` +
-		`};}</script>`
+		`window._docOpen=function(text,isNew){` +
+		`var st={isNew:isNew,id:'',ch:''};` +
+		`if(!isNew){try{var o=JSON.parse(text);st.id=o.internal_id||'';st.ch=JSON.stringify(o.ch_time===undefined?null:o.ch_time);}catch(e){}}` +
+		`window._docState=st;` +
+		`document.getElementById('docViewContent').value=text;` +
+		`document.getElementById('docEditTitle').textContent=isNew?'Новый документ':'Документ';` +
+		`document.getElementById('docEditSub').textContent=isNew?'':st.id;` +
+		`document.getElementById('docEditDelete').style.display=isNew?'none':'';` +
+		`document.getElementById('docEditCopy').style.display=isNew?'none':'';` +
+		`var sc=document.getElementById('cbSchema'),sd=document.getElementById('docEditSchema');` +
+		`if(sc&&sc.textContent){document.getElementById('docEditSchemaContent').textContent=sc.textContent;sd.style.display='';}else{sd.style.display='none';}` +
+		`document.getElementById('docEditErr').style.display='none';` +
+		`document.getElementById('docViewModal').style.display='flex';};` +
+		`window._docView=function(text){_docOpen(text,false);};` +
+		`window._docNew=function(){_docOpen('{\n  \n}',true);};` +
+		`window._docParse=function(){` +
+		`var o=JSON.parse(document.getElementById('docViewContent').value);` +
+		`if(!o||typeof o!=='object'||Array.isArray(o))throw new Error('документ должен быть объектом');return o;};` +
+		`window._docCheck=function(){var ta=document.getElementById('docViewContent');` +
+		`try{_docParse();ta.style.borderColor='#cbd5e1';}catch(e){ta.style.borderColor='#fda4af';}};` +
+		`window._docFail=function(msg){var err=document.getElementById('docEditErr');err.textContent=msg;err.style.display='block';};` +
+		`window._docPost=function(action,fd){` +
+		`var col=document.getElementById('cbCollection');fd.append('collection',col?col.value:'');` +
+		`document.getElementById('docEditErr').style.display='none';` +
+		`fetch(window.location.origin+action,{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){if(d.ok){document.getElementById('docViewModal').style.display='none';_cbExec('colBrowsePanel');}` +
+		`else{_docFail(d.error||'Ошибка');}})` +
+		`.catch(function(ex){_docFail(String(ex));});};` +
+		`window._docSave=function(copy){` +
+		`try{_docParse();}catch(e){_docFail('Ошибка синтаксиса JSON: '+e.message);return;}` +
+		`var st=window._docState,fd=new FormData();` +
+		`fd.append('document',document.getElementById('docViewContent').value);` +
+		`if(copy){fd.append('copy','1');}else if(!st.isNew){fd.append('internal_id',st.id);fd.append('ch_time',st.ch);}` +
+		`_docPost('/admin/documents/save',fd);};` +
+		`window._docDelete=function(){var st=window._docState;` +
+		`if(!confirm('Удалить документ '+st.id+'?'))return;` +
+		`var fd=new FormData();fd.append('internal_id',st.id);fd.append('ch_time',st.ch);` +
+		`_docPost('/admin/documents/delete',fd);};` +
+		`}</script>`
 }
 
 func collectionBrowseScript() string {
@@ -228,13 +338,19 @@ func collectionBrowseScript() string {
 		`var q=document.getElementById('cbQueryInput');` +
 		`if(!col||!q)return;` +
 		`var u='/admin/ajax/collection-browse?collection='+encodeURIComponent(col.value)+'&query='+encodeURIComponent(q.value);` +
+		`var s=document.getElementById('cbSort'),f=document.getElementById('cbFields'),b=document.getElementById('qbBox');` +
+		`if(s&&s.value)u+='&sort='+encodeURIComponent(s.value);` +
+		`if(f&&f.value)u+='&fields='+encodeURIComponent(f.value);` +
+		`if(b&&b.open)u+='&builder=1';` +
+		`var r=document.getElementById('cbRef');if(r)u+='&ref='+encodeURIComponent(r.value);` +
 		`_loadPanel(u,panelID,null);};` +
+		`window._cbResetView=function(panelID){document.getElementById('cbSort').value='';document.getElementById('cbFields').value='';_cbExec(panelID);};` +
 		`window._cbKeyExec=function(e,panelID){if(e.key==='Enter'){e.preventDefault();_cbExec(panelID);}};` +
 		`}</script>`
 }
 
-func (p *AdminPanel) pageIndexes(_ *saiTypes.RequestCtx) (*admin.PageData, error) {
-	collections, err := p.service.GetRepo().ListCollectionNames(context.Background())
+func (p *AdminPanel) pageIndexes(ctx *saiTypes.RequestCtx) (*admin.PageData, error) {
+	collections, err := p.service.GetRepo().ListCollectionNames(p.handler.AdminContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -249,11 +365,11 @@ func (p *AdminPanel) pageIndexes(_ *saiTypes.RequestCtx) (*admin.PageData, error
 		}
 	}
 
-	scripts := twoColScript() + modalScript()
+	scripts := twoColScript() + modalScript() + indexScript()
 
 	return &admin.PageData{
 		Sections: []admin.Section{
-			{Title: "Индексы", ContentHTML: template.HTML(twoColPage(items, "idxPanel", scripts))},
+			{Title: "Индексы", Actions: template.HTML(p.tenantSelector(ctx)), ContentHTML: template.HTML(twoColPage(items, "idxPanel", scripts))},
 		},
 	}, nil
 }
@@ -267,7 +383,8 @@ func (p *AdminPanel) handleAjaxIndexes(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
-	indexes, err := p.service.GetRepo().ListIndexes(context.Background(), collection)
+	adminCtx := p.handler.AdminContext(ctx)
+	indexes, err := p.service.GetRepo().ListIndexes(adminCtx, collection)
 	if err != nil {
 		ctx.Response.SetBodyString(`<p class="text-rose-500 text-sm">` + template.HTMLEscapeString(err.Error()) + `</p>`)
 		return
@@ -275,13 +392,43 @@ func (p *AdminPanel) handleAjaxIndexes(ctx *saiTypes.RequestCtx) {
 
 	var sb strings.Builder
 
+	builds, buildsErr := p.service.IndexBuilds(adminCtx, collection)
+	if buildsErr != nil {
+		sb.WriteString(`<p class="text-xs text-slate-400 mb-3">Прогресс построения недоступен: ` + template.HTMLEscapeString(buildsErr.Error()) + `</p>`)
+	}
+	if len(builds) > 0 {
+		sb.WriteString(`<div id="idxBuilding" class="mb-4 rounded-xl border border-amber-200 bg-amber-50 px-4 py-3 text-sm text-amber-800">`)
+		for _, build := range builds {
+			progress := ""
+			if build.Total > 0 {
+				progress = fmt.Sprintf(" — %d / %d (%d%%)", build.Done, build.Total, build.Done*100/build.Total)
+			}
+			sb.WriteString(fmt.Sprintf(`<div>Строится <span class="font-mono">%s</span>: %s%s, %d с</div>`,
+				template.HTMLEscapeString(strings.Join(build.Indexes, ", ")),
+				template.HTMLEscapeString(build.Phase), progress, build.Seconds))
+		}
+		sb.WriteString(`</div>`)
+	}
+
 	indexModalContent := `<input type="hidden" name="collection" value="` + template.HTMLEscapeString(collection) + `">` +
 		`<p class="text-sm text-slate-500">Коллекция: <strong>` + template.HTMLEscapeString(collection) + `</strong></p>` +
-		mField("keys_raw", "Поля (field:1,field2:-1)", "", "text") +
+		mField("keys_raw", "Ключи по порядку (field:1, field2:-1, body:text, loc:2dsphere, id:hashed, $**:1)", "", "text") +
 		mField("name", "Имя индекса (опционально)", "", "text") +
-		`<div class="flex gap-6">` +
+		`<div class="flex flex-wrap gap-6">` +
 		`<label class="inline-flex items-center gap-2 text-sm text-slate-700"><input type="checkbox" name="unique" value="true" class="rounded"> Unique</label>` +
 		`<label class="inline-flex items-center gap-2 text-sm text-slate-700"><input type="checkbox" name="sparse" value="true" class="rounded"> Sparse</label>` +
+		`<label class="inline-flex items-center gap-2 text-sm text-slate-700"><input type="checkbox" name="hidden" value="true" class="rounded"> Скрытый</label>` +
+		`</div>` +
+		mField("expire_after_seconds", "TTL, секунд (для поля с датой)", "", "number") +
+		mTextarea("partial_filter", "Частичный фильтр, JSON (partialFilterExpression)", template.HTMLEscapeString(`{"status": {"$eq": "active"}}`)) +
+		`<div class="grid grid-cols-2 gap-4">` +
+		mField("collation_locale", "Collation: локаль (ru, en, ...)", "", "text") +
+		mSelect("collation_strength", "Collation: strength", []string{"по умолчанию", "1 — без регистра и диакритики", "2 — без регистра", "3"}, []string{"", "1", "2", "3"}) +
+		`</div>` +
+		`<label class="inline-flex items-center gap-2 text-sm text-slate-700"><input type="checkbox" name="collation_numeric" value="true" class="rounded"> Числовое сравнение строк</label>` +
+		`<div class="grid grid-cols-2 gap-4">` +
+		mField("weights", "Text: веса (title:10, body:1)", "", "text") +
+		mField("default_language", "Text: язык (russian, english, none)", "", "text") +
 		`</div>`
 	sb.WriteString(modal("addIndexModal", "Добавить индекс", "addIndexForm", "addIndexErr", "addIndexBtn", "Создать", "/admin/indexes", indexModalContent))
 
@@ -291,17 +438,19 @@ func (p *AdminPanel) handleAjaxIndexes(ctx *saiTypes.RequestCtx) {
 
 	sb.WriteString(`<div class="overflow-x-auto"><table class="min-w-full divide-y divide-slate-200 text-sm">`)
 	sb.WriteString(`<thead class="bg-slate-50"><tr>`)
-	for _, h := range []string{"Имя", "Поля", "Unique", "Sparse"} {
+	for _, h := range []string{"Имя", "Ключи", "Unique", "Sparse", "Параметры", ""} {
 		sb.WriteString(fmt.Sprintf(`<th class="px-4 py-3 text-left font-medium text-slate-600">%s</th>`, h))
 	}
 	sb.WriteString(`</tr></thead><tbody class="divide-y divide-slate-100">`)
 	for _, idx := range indexes {
-		fields := formatIndexFields(idx.Fields)
+		keys := formatIndexKeys(idx.CreateIndexRequest(collection).OrderedKeys)
 		sb.WriteString(`<tr class="hover:bg-slate-50">`)
-		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, idx.Name))
-		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, fields))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono">%s</td>`, template.HTMLEscapeString(idx.Name)))
+		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3 font-mono text-xs">%s</td>`, template.HTMLEscapeString(keys)))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, boolBadge(idx.Unique)))
 		sb.WriteString(fmt.Sprintf(`<td class="px-4 py-3">%s</td>`, boolBadge(idx.Sparse)))
+		sb.WriteString(`<td class="px-4 py-3 text-xs">` + indexOptionBadges(idx) + `</td>`)
+		sb.WriteString(`<td class="px-4 py-3" style="white-space:nowrap">` + indexActions(collection, idx, "idxPanel") + `</td>`)
 		sb.WriteString(`</tr>`)
 	}
 	sb.WriteString(`</tbody></table></div>`)
@@ -313,6 +462,78 @@ func (p *AdminPanel) handleAjaxIndexes(ctx *saiTypes.RequestCtx) {
 	ctx.Response.SetBodyString(sb.String())
 }
 
+// indexOptionBadges shows the options beyond unique and sparse.
+func indexOptionBadges(idx types.IndexInfo) string {
+	badge := func(text, title string) string {
+		return `<span title="` + template.HTMLEscapeString(title) + `" class="inline-flex items-center rounded px-2 py-0.5 mr-1 mb-1 font-medium bg-slate-100 text-slate-600">` + template.HTMLEscapeString(text) + `</span>`
+	}
+	var b strings.Builder
+	if idx.Hidden {
+		b.WriteString(`<span class="inline-flex items-center rounded px-2 py-0.5 mr-1 mb-1 font-medium bg-amber-100 text-amber-700">скрыт</span>`)
+	}
+	if idx.ExpireAfterSeconds != nil {
+		b.WriteString(badge(fmt.Sprintf("TTL %d с", *idx.ExpireAfterSeconds), "expireAfterSeconds"))
+	}
+	if len(idx.PartialFilterExpression) > 0 {
+		filter, _ := json.Marshal(idx.PartialFilterExpression)
+		b.WriteString(badge("partial", string(filter)))
+	}
+	if idx.Collation != nil {
+		b.WriteString(badge(fmt.Sprintf("collation %s/%d", idx.Collation.Locale, idx.Collation.Strength), "collation"))
+	}
+	if idx.DefaultLanguage != "" {
+		b.WriteString(badge("язык "+idx.DefaultLanguage, "default_language"))
+	}
+	if len(idx.WildcardProjection) > 0 {
+		projection, _ := json.Marshal(idx.WildcardProjection)
+		b.WriteString(badge("projection", string(projection)))
+	}
+	return b.String()
+}
+
+// indexActions are the hide, rebuild and drop buttons of an index. The _id
+// index has none. panelID is the two-column panel reloaded after an action.
+func indexActions(collection string, idx types.IndexInfo, panelID string) string {
+	if idx.Name == "_id_" {
+		return ""
+	}
+	button := func(label, action, extra, confirm, color string) string {
+		return fmt.Sprintf(`<button data-action="%s" data-collection="%s" data-name="%s" data-hidden="%s" data-confirm="%s" data-panel="%s" onclick="_idxAction(this)" `+
+			`style="font-size:12px;color:%s;font-weight:500;border:1px solid #e2e8f0;background:none;cursor:pointer;padding:2px 8px;border-radius:4px;margin-right:4px">%s</button>`,
+			action, template.HTMLEscapeString(collection), template.HTMLEscapeString(idx.Name), extra,
+			template.HTMLEscapeString(confirm), panelID, color, label)
+	}
+	hide := button("Скрыть", "hidden", "true", "", "#475569")
+	if idx.Hidden {
+		hide = button("Показать", "hidden", "false", "", "#475569")
+	}
+	return hide +
+		button("Перестроить", "rebuild", "", "Перестроить индекс "+idx.Name+"? До конца построения запросы не смогут его использовать.", "#475569") +
+		button("Удалить", "drop", "", "Удалить индекс "+idx.Name+"?", "#e11d48")
+}
+
+// indexScript sends the index actions and, while a build is shown, reloads
+// the panel to update its progress.
+func indexScript() string {
+	return `<script>if(!window._idxInit){window._idxInit=true;` +
+		`window._idxAction=function(btn){` +
+		`if(btn.dataset.confirm&&!confirm(btn.dataset.confirm))return;` +
+		`var fd=new FormData();fd.append('collection',btn.dataset.collection);fd.append('name',btn.dataset.name);` +
+		`if(btn.dataset.hidden)fd.append('hidden',btn.dataset.hidden);` +
+		`btn.disabled=true;` +
+		`fetch(window.location.origin+'/admin/indexes/'+btn.dataset.action,{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){btn.disabled=false;if(!d.ok){alert(d.error||'Ошибка');return;}` +
+		`_loadPanel(sessionStorage.getItem('tc_'+btn.dataset.panel),btn.dataset.panel,null);})` +
+		`.catch(function(){btn.disabled=false;});};` +
+		`setInterval(function(){var u=sessionStorage.getItem('tc_idxPanel'),m=document.getElementById('addIndexModal');` +
+		`if(!u||!document.getElementById('idxBuilding')||(m&&m.style.display==='flex'))return;` +
+		`fetch(window.location.origin+u,{headers:{'X-Requested-With':'fetch'}})` +
+		`.then(function(r){return r.text();})` +
+		`.then(function(h){var p=document.getElementById('idxPanel');if(p)p.innerHTML=h;});},3000);` +
+		`}</script>`
+}
+
 func formatBytes(b int64) string {
 	switch {
 	case b >= 1<<30:
@@ -326,18 +547,6 @@ func formatBytes(b int64) string {
 	}
 }
 
-func formatIndexFields(fields map[string]int) string {
-	parts := make([]string, 0, len(fields))
-	for k, v := range fields {
-		dir := "asc"
-		if v == -1 {
-			dir = "desc"
-		}
-		parts = append(parts, fmt.Sprintf("%s:%s", k, dir))
-	}
-	return strings.Join(parts, ", ")
-}
-
 func boolBadge(v bool) string {
 	if v {
 		return `<span class="inline-flex items-center rounded px-2 py-0.5 text-xs font-medium bg-emerald-100 text-emerald-700">да</span>`
@@ -346,10 +555,5 @@ func boolBadge(v bool) string {
 }
 
 func isAdminCollection(name string) bool {
-	return strings.HasPrefix(name, "_admin_") ||
-		strings.HasPrefix(name, "system.") ||
-		strings.HasSuffix(name, "_update_archive") ||
-		strings.HasSuffix(name, "_delete_archive") ||
-		strings.HasSuffix(name, "_create_archive") ||
-		strings.HasSuffix(name, "_request_logs")
+	return types.IsServiceCollection(name)
 }
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"html/template"
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// tenantSelector renders the tenant switcher shown on tenant-scoped pages. The
+// choice is kept in a cookie, so it applies to every admin page and action.
+func (p *AdminPanel) tenantSelector(ctx *saiTypes.RequestCtx) string {
+	if !p.service.TenancyEnabled() {
+		return ""
+	}
+
+	current := types.TenantFromContext(p.handler.AdminContext(ctx))
+	tenants, _ := p.service.ListTenants(p.handler.AdminContext(ctx))
+	found := current == ""
+	for _, t := range tenants {
+		if t == current {
+			found = true
+		}
+	}
+	if !found {
+		tenants = append([]string{current}, tenants...)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div style="display:inline-flex;align-items:center;gap:6px;margin-right:8px">`)
+	b.WriteString(`<span style="font-size:13px;color:#64748b">Тенант:</span>`)
+	b.WriteString(`<select onchange="_selectTenant(this.value)" class="h-9 rounded-xl border border-slate-300 bg-white px-3 text-sm text-slate-900 outline-none">`)
+	b.WriteString(`<option value="">— общий —</option>`)
+	for _, t := range tenants {
+		selected := ""
+		if t == current {
+			selected = " selected"
+		}
+		b.WriteString(`<option value="` + template.HTMLEscapeString(t) + `"` + selected + `>` + template.HTMLEscapeString(t) + `</option>`)
+	}
+	b.WriteString(`<option value="__new">+ другой…</option>`)
+	b.WriteString(`</select></div>`)
+	b.WriteString(tenantScript())
+	return b.String()
+}
+
+func tenantScript() string {
+	return `<script>if(!window._tenantInit){window._tenantInit=true;` +
+		`window._selectTenant=function(v){` +
+		`if(v==='__new'){v=prompt('ID тенанта');if(v===null){location.reload();return;}}` +
+		`var fd=new FormData();fd.append('tenant',v.trim());` +
+		`fetch(window.location.origin+'/admin/tenant',{method:'POST',headers:{'X-Requested-With':'fetch'},body:fd})` +
+		`.then(function(r){return r.json();})` +
+		`.then(function(d){if(d.ok){location.reload();}else{alert(d.error||'Ошибка');location.reload();}})` +
+		`.catch(function(){alert('Ошибка сети');});};` +
+		`}</script>`
+}
@@ -0,0 +1,292 @@
+// Package export writes documents as CSV, NDJSON or XLSX. Nested documents
+// become dotted columns in the tabular formats; arrays are written as JSON.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Writer writes documents one by one. Close flushes the output and must be
+// called once all rows are written.
+type Writer interface {
+	WriteRow(doc map[string]interface{}) error
+	Close() error
+}
+
+// NewWriter returns a writer for format. CSV and XLSX need columns for their
+// header; NDJSON writes whole documents, or only columns when given.
+func NewWriter(format string, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: newEncoder(w), columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("неизвестный формат %q", format)
+}
+
+// Valid reports whether format is supported.
+func Valid(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON || format == FormatXLSX
+}
+
+// NeedsColumns reports whether format writes a header, so the columns must
+// be known before the first row.
+func NeedsColumns(format string) bool {
+	return format == FormatCSV || format == FormatXLSX
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// ParseColumns splits a comma separated column list.
+func ParseColumns(raw string) []string {
+	var columns []string
+	for _, c := range strings.Split(raw, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// ColumnSet collects the dotted columns of documents. _id is left out;
+// internal_id comes first and the rest are sorted.
+type ColumnSet struct {
+	seen map[string]struct{}
+}
+
+func NewColumnSet() *ColumnSet {
+	return &ColumnSet{seen: make(map[string]struct{})}
+}
+
+func (c *ColumnSet) Add(doc map[string]interface{}) error {
+	flatten("", doc, c.seen)
+	return nil
+}
+
+func (c *ColumnSet) Columns() []string {
+	columns := make([]string, 0, len(c.seen))
+	for k := range c.seen {
+		if k != "_id" && k != "internal_id" {
+			columns = append(columns, k)
+		}
+	}
+	sort.Strings(columns)
+	if _, ok := c.seen["internal_id"]; ok {
+		columns = append([]string{"internal_id"}, columns...)
+	}
+	return columns
+}
+
+// flatten records the dotted path of every leaf. Arrays are leaves.
+func flatten(prefix string, v interface{}, seen map[string]struct{}) {
+	doc, ok := asMap(v)
+	if !ok || len(doc) == 0 {
+		if prefix != "" {
+			seen[prefix] = struct{}{}
+		}
+		return
+	}
+	for k, child := range doc {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flatten(k, child, seen)
+	}
+}
+
+// Lookup returns the value at a dotted path. A key that itself contains
+// dots is matched before the path is walked.
+func Lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := doc[path]; ok {
+		return v, true
+	}
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil, false
+	}
+	child, ok := asMap(doc[head])
+	if !ok {
+		return nil, false
+	}
+	return Lookup(child, rest)
+}
+
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t, true
+	case primitive.M:
+		return t, true
+	case primitive.D:
+		return t.Map(), true
+	}
+	return nil, false
+}
+
+// Normalize turns BSON values into plain JSON-friendly values: documents
+// become maps, ObjectIDs hex strings and dates time.Time.
+func Normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}, primitive.M, primitive.D:
+		doc, _ := asMap(t)
+		out := make(map[string]interface{}, len(doc))
+		for k, child := range doc {
+			out[k] = Normalize(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = Normalize(child)
+		}
+		return out
+	case primitive.A:
+		return Normalize([]interface{}(t))
+	case primitive.ObjectID:
+		return t.Hex()
+	case primitive.DateTime:
+		return t.Time().UTC()
+	case primitive.Decimal128:
+		return t.String()
+	case primitive.Regex:
+		return "/" + t.Pattern + "/" + t.Options
+	case primitive.Binary:
+		return t.Data
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return strconv.FormatFloat(t, 'f', -1, 64)
+		}
+	}
+	return v
+}
+
+// Cell formats a value for a CSV or XLSX cell. Documents and arrays are
+// written as JSON.
+func Cell(v interface{}) string {
+	switch t := Normalize(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case int:
+		return strconv.Itoa(t)
+	case int32:
+		return strconv.FormatInt(int64(t), 10)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	}
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+	return cw, cw.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(doc map[string]interface{}) error {
+	for i, column := range c.columns {
+		v, _ := Lookup(doc, column)
+		c.row[i] = Cell(v)
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func newEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc
+}
+
+// WriteRow writes the document without _id. With columns only those paths
+// are kept, nested as in the document.
+func (n *ndjsonWriter) WriteRow(doc map[string]interface{}) error {
+	if len(n.columns) == 0 {
+		out := Normalize(doc).(map[string]interface{})
+		delete(out, "_id")
+		return n.enc.Encode(out)
+	}
+	out := make(map[string]interface{}, len(n.columns))
+	for _, column := range n.columns {
+		if v, ok := Lookup(doc, column); ok {
+			setPath(out, column, Normalize(v))
+		}
+	}
+	return n.enc.Encode(out)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+func setPath(doc map[string]interface{}, path string, v interface{}) {
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		doc[path] = v
+		return
+	}
+	child, ok := doc[head].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		doc[head] = child
+	}
+	setPath(child, rest, v)
+}
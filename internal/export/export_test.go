@@ -0,0 +1,223 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testDocs = []map[string]interface{}{
+	{
+		"_id":         primitive.NewObjectID(),
+		"internal_id": "a1",
+		"name":        "Alice, \"A\"",
+		"age":         int32(30),
+		"profile":     map[string]interface{}{"city": "Riga", "geo": primitive.D{{Key: "lat", Value: 56.9}}},
+		"tags":        primitive.A{"x", "y"},
+	},
+	{
+		"internal_id": "b2",
+		"name":        "<Bob & Co>",
+		"active":      true,
+		"profile":     map[string]interface{}{},
+		"dotted.key":  "flat",
+	},
+}
+
+func TestColumnSet(t *testing.T) {
+	set := NewColumnSet()
+	for _, doc := range testDocs {
+		if err := set.Add(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"internal_id", "active", "age", "dotted.key", "name", "profile", "profile.city", "profile.geo.lat", "tags"}
+	if got := set.Columns(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Columns = %v, want %v", got, want)
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	got := ParseColumns(" a, b.c ,,d ")
+	if want := []string{"a", "b.c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseColumns = %v, want %v", got, want)
+	}
+	if got := ParseColumns(""); got != nil {
+		t.Fatalf("ParseColumns(\"\") = %v", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	cases := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"name", "Alice, \"A\"", true},
+		{"profile.city", "Riga", true},
+		{"profile.geo.lat", 56.9, true},
+		{"profile.missing", nil, false},
+		{"name.first", nil, false},
+	}
+	for _, tc := range cases {
+		got, found := Lookup(testDocs[0], tc.path)
+		if found != tc.found || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Lookup(%q) = %#v, %v; want %#v, %v", tc.path, got, found, tc.want, tc.found)
+		}
+	}
+	if got, _ := Lookup(testDocs[1], "dotted.key"); got != "flat" {
+		t.Errorf("dotted key = %#v", got)
+	}
+}
+
+func TestCell(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	dec, _ := primitive.ParseDecimal128("12.50")
+	cases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, ""},
+		{"string", "text", "text"},
+		{"bool", true, "true"},
+		{"int32", int32(-7), "-7"},
+		{"int64", int64(9007199254740993), "9007199254740993"},
+		{"float", 2.5, "2.5"},
+		{"large float", 1e21, "1000000000000000000000"},
+		{"NaN", math.NaN(), "NaN"},
+		{"ObjectID", oid, "65a1b2c3d4e5f60718293a4b"},
+		{"time", at, "2026-01-02T03:04:05Z"},
+		{"DateTime", primitive.NewDateTimeFromTime(at), "2026-01-02T03:04:05Z"},
+		{"Decimal128", dec, "12.50"},
+		{"regex", primitive.Regex{Pattern: "^a", Options: "i"}, "/^a/i"},
+		{"array", primitive.A{"x", int32(1), oid}, `["x",1,"65a1b2c3d4e5f60718293a4b"]`},
+		{"document", primitive.D{{Key: "a", Value: 1}}, `{"a":1}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Cell(tc.value); got != tc.want {
+				t.Fatalf("Cell = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func writeAll(t *testing.T, format string, columns []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range testDocs {
+		if err := w.WriteRow(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	got := string(writeAll(t, FormatCSV, []string{"internal_id", "name", "profile.city", "tags", "active"}))
+	want := "internal_id,name,profile.city,tags,active\n" +
+		"a1,\"Alice, \"\"A\"\"\",Riga,\"[\"\"x\"\",\"\"y\"\"]\",\n" +
+		"b2,<Bob & Co>,,,true\n"
+	if got != want {
+		t.Fatalf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	got := string(writeAll(t, FormatNDJSON, []string{"internal_id", "profile.city"}))
+	want := `{"internal_id":"a1","profile":{"city":"Riga"}}` + "\n" + `{"internal_id":"b2"}` + "\n"
+	if got != want {
+		t.Fatalf("NDJSON with columns =\n%s\nwant\n%s", got, want)
+	}
+
+	full := string(writeAll(t, FormatNDJSON, nil))
+	lines := strings.Split(strings.TrimSpace(full), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("NDJSON has %d lines", len(lines))
+	}
+	if strings.Contains(full, `"_id"`) {
+		t.Fatal("NDJSON includes _id")
+	}
+	if !strings.Contains(lines[1], `"name":"<Bob & Co>"`) {
+		t.Fatalf("HTML characters are escaped: %s", lines[1])
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	raw := writeAll(t, FormatXLSX, []string{"internal_id", "name", "age", "active"})
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(body)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		body, ok := parts[name]
+		if !ok {
+			t.Fatalf("missing part %s", name)
+		}
+		dec := xml.NewDecoder(strings.NewReader(body))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed XML: %v", name, err)
+			}
+		}
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">internal_id</t></is></c>`,
+		`<c r="C2"><v>30</v></c>`,
+		`<c r="D3" t="b"><v>1</v></c>`,
+		`&lt;Bob &amp; Co&gt;`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s", want)
+		}
+	}
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if Valid("pdf") || !Valid(FormatXLSX) {
+		t.Fatal("Valid is wrong")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	cases := map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for i, want := range cases {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxXLSXRows is the number of data rows a worksheet holds below the
+	// header.
+	MaxXLSXRows = 1048575
+	// maxXLSXCell is the longest text Excel accepts in a cell.
+	maxXLSXCell = 32767
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="Data" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles has a default style and a bold one for the header.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// xlsxWriter streams a single worksheet with inline strings, so rows are
+// never held in memory.
+type xlsxWriter struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	columns []string
+	refs    []string
+	row     int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	x := &xlsxWriter{zip: zw, sheet: bufio.NewWriter(sheet), columns: columns, refs: make([]string, len(columns))}
+	for i := range columns {
+		x.refs[i] = columnName(i)
+	}
+	x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	x.startRow()
+	for i, column := range columns {
+		x.stringCell(i, column, 1)
+	}
+	x.sheet.WriteString(`</row>`)
+	return x, nil
+}
+
+func (x *xlsxWriter) WriteRow(doc map[string]interface{}) error {
+	if x.row > MaxXLSXRows {
+		return fmt.Errorf("в XLSX помещается не больше %d строк", MaxXLSXRows)
+	}
+	x.startRow()
+	for i, column := range x.columns {
+		v, _ := Lookup(doc, column)
+		switch t := Normalize(v).(type) {
+		case nil:
+		case bool:
+			b := "0"
+			if t {
+				b = "1"
+			}
+			fmt.Fprintf(x.sheet, `<c r="%s%d" t="b"><v>%s</v></c>`, x.refs[i], x.row, b)
+		case int, int32, int64, float32, float64:
+			fmt.Fprintf(x.sheet, `<c r="%s%d"><v>%s</v></c>`, x.refs[i], x.row, Cell(t))
+		default:
+			x.stringCell(i, Cell(t), 0)
+		}
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) startRow() {
+	x.row++
+	x.sheet.WriteString(`<row r="` + strconv.Itoa(x.row) + `">`)
+}
+
+// stringCell writes an inline string. Text longer than Excel allows is cut.
+func (x *xlsxWriter) stringCell(i int, text string, style int) {
+	if len(text) > maxXLSXCell && utf8.RuneCountInString(text) > maxXLSXCell {
+		text = string([]rune(text)[:maxXLSXCell])
+	}
+	fmt.Fprintf(x.sheet, `<c r="%s%d" t="inlineStr"`, x.refs[i], x.row)
+	if style > 0 {
+		fmt.Fprintf(x.sheet, ` s="%d"`, style)
+	}
+	x.sheet.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(x.sheet, []byte(text))
+	x.sheet.WriteString(`</t></is></c>`)
+}
+
+func (x *xlsxWriter) Close() error {
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// columnName turns a zero-based index into a column letter: 0 is A, 26 is AA.
+func columnName(i int) string {
+	var b strings.Builder
+	for i >= 0 {
+		b.WriteByte(byte('A' + i%26))
+		i = i/26 - 1
+	}
+	name := []byte(b.String())
+	for l, r := 0, len(name)-1; l < r; l, r = l+1, r-1 {
+		name[l], name[r] = name[r], name[l]
+	}
+	return string(name)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func (h *Handler) CreateCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, true)
+	if err == nil {
+		_, err = h.service.CreateCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, "Коллекция "+req.Collection+" создана", types.CollectionResponse{}, err)
+}
+
+func (h *Handler) RenameCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, false)
+	var resp types.CollectionResponse
+	if err == nil {
+		resp, err = h.service.RenameCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, "Коллекция переименована в "+req.To, resp, err)
+}
+
+func (h *Handler) CloneCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, false)
+	var resp types.CollectionResponse
+	if err == nil {
+		resp, err = h.service.CloneCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, fmt.Sprintf("Создана копия %s, документов: %d", req.To, resp.Documents), resp, err)
+}
+
+func (h *Handler) TruncateCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, false)
+	var resp types.CollectionResponse
+	if err == nil {
+		resp, err = h.service.TruncateCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, fmt.Sprintf("Удалено документов: %d", resp.Documents), resp, err)
+}
+
+func (h *Handler) ConvertCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, true)
+	var resp types.CollectionResponse
+	if err == nil {
+		resp, err = h.service.ConvertCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, "Коллекция преобразована", resp, err)
+}
+
+func (h *Handler) DropCollectionFromForm(ctx *saiTypes.RequestCtx) {
+	req, err := collectionForm(ctx, false)
+	var resp types.CollectionResponse
+	if err == nil {
+		resp, err = h.service.DropCollection(h.AdminContext(ctx), req)
+	}
+	writeCollectionResult(ctx, "Коллекция "+req.Collection+" удалена", resp, err)
+}
+
+// collectionForm reads the collection modals: collection, to, confirm and,
+// with options, the type and its settings.
+func collectionForm(ctx *saiTypes.RequestCtx, options bool) (types.CollectionRequest, error) {
+	req := types.CollectionRequest{
+		Collection: strings.TrimSpace(string(ctx.FormValue("collection"))),
+		To:         strings.TrimSpace(string(ctx.FormValue("to"))),
+		Confirm:    strings.TrimSpace(string(ctx.FormValue("confirm"))),
+	}
+	if req.Collection == "" {
+		return req, fmt.Errorf("коллекция не указана")
+	}
+	if !options {
+		return req, nil
+	}
+	switch kind := string(ctx.FormValue("type")); kind {
+	case types.CollectionTypeCapped:
+		size, err := formInt(ctx, "size")
+		if err != nil {
+			return req, err
+		}
+		max, err := formInt(ctx, "max")
+		if err != nil {
+			return req, err
+		}
+		req.Options = types.CollectionOptions{Capped: true, Size: size, Max: max}
+	case types.CollectionTypeTimeSeries:
+		req.Options.TimeSeries = &types.TimeSeriesOptions{
+			TimeField:   strings.TrimSpace(string(ctx.FormValue("time_field"))),
+			MetaField:   strings.TrimSpace(string(ctx.FormValue("meta_field"))),
+			Granularity: string(ctx.FormValue("granularity")),
+		}
+	case types.CollectionTypeClustered:
+		req.Options.Clustered = true
+	case "", types.CollectionTypeRegular:
+	default:
+		return req, fmt.Errorf("неизвестный тип коллекции %q", kind)
+	}
+	return req, nil
+}
+
+func formInt(ctx *saiTypes.RequestCtx, name string) (int64, error) {
+	raw := strings.TrimSpace(string(ctx.FormValue(name)))
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение %s: %q", name, raw)
+	}
+	return v, nil
+}
+
+// writeCollectionResult adds the snapshot, the companion collections and
+// any warnings to the message of a successful operation.
+func writeCollectionResult(ctx *saiTypes.RequestCtx, message string, resp types.CollectionResponse, err error) {
+	if err != nil {
+		if errors.Is(err, service.ErrConfirmationMismatch) {
+			err = fmt.Errorf("для подтверждения введите имя коллекции")
+		}
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if resp.Snapshot != "" {
+		message += ". Снимок: " + resp.Snapshot
+	}
+	if len(resp.Companions) > 0 {
+		message += ". Вместе с ней: " + strings.Join(resp.Companions, ", ")
+	}
+	if len(resp.Warnings) > 0 {
+		message += ". Предупреждения: " + strings.Join(resp.Warnings, "; ")
+	}
+	admin.WriteActionJSON(ctx, message, nil)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saiset-co/sai-service/admin"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SaveDocument stores a document from the editor in the collection browser.
+// Without internal_id the document is inserted, with copy=1 also without its
+// _id. Otherwise it replaces the stored one as long as its ch_time has not
+// changed since it was opened.
+func (h *Handler) SaveDocument(ctx *saiTypes.RequestCtx) {
+	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
+	internalID := strings.TrimSpace(string(ctx.FormValue("internal_id")))
+	if collection == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("коллекция не указана"))
+		return
+	}
+	doc, err := ParseDocumentJSON(string(ctx.FormValue("document")))
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("неверный документ: %v", err))
+		return
+	}
+
+	adminCtx := h.AdminContext(ctx)
+	if internalID == "" {
+		message := "Документ создан: "
+		if string(ctx.FormValue("copy")) == "1" {
+			delete(doc, "_id")
+			message = "Копия создана: "
+		}
+		id, err := h.service.InsertDocument(adminCtx, collection, doc)
+		if err != nil {
+			admin.WriteActionJSON(ctx, "", documentError(err))
+			return
+		}
+		h.logDocumentEdit(ctx, collection, "insert", id, doc)
+		admin.WriteActionJSON(ctx, message+id, nil)
+		return
+	}
+
+	chTime, err := parseChTime(string(ctx.FormValue("ch_time")))
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if err := h.service.ReplaceDocument(adminCtx, collection, internalID, chTime, doc); err != nil {
+		admin.WriteActionJSON(ctx, "", documentError(err))
+		return
+	}
+	h.logDocumentEdit(ctx, collection, "replace", internalID, doc)
+	admin.WriteActionJSON(ctx, "Документ сохранён", nil)
+}
+
+// DeleteDocument deletes a document opened in the editor, unless it has
+// changed since. Soft-delete collections record the admin user as deleted_by.
+func (h *Handler) DeleteDocument(ctx *saiTypes.RequestCtx) {
+	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
+	internalID := strings.TrimSpace(string(ctx.FormValue("internal_id")))
+	if collection == "" || internalID == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и internal_id обязательны"))
+		return
+	}
+	chTime, err := parseChTime(string(ctx.FormValue("ch_time")))
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if err := h.service.DeleteDocument(h.AdminContext(ctx), collection, internalID, chTime, h.adminUser(ctx)); err != nil {
+		admin.WriteActionJSON(ctx, "", documentError(err))
+		return
+	}
+	h.logDocumentEdit(ctx, collection, "delete", internalID, nil)
+	admin.WriteActionJSON(ctx, "Документ удалён", nil)
+}
+
+func documentError(err error) error {
+	if errors.Is(err, service.ErrDocumentChanged) {
+		return fmt.Errorf("документ изменён или удалён после открытия, обновите список и повторите")
+	}
+	if strings.Contains(err.Error(), "Document failed validation") {
+		return fmt.Errorf("документ не прошёл проверку схемы коллекции: %v", err)
+	}
+	return err
+}
+
+// parseChTime reads the ch_time the editor was opened with. It comes as
+// Extended JSON, so it is compared with the stored value in its own type.
+func parseChTime(raw string) (interface{}, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var wrapper struct {
+		Value interface{} `bson:"v"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+raw+`}`), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("неверный ch_time: %v", err)
+	}
+	return wrapper.Value, nil
+}
+
+// adminUser names the admin making the request: the user the auth provider
+// set, or else the basic auth user name.
+func (h *Handler) adminUser(ctx *saiTypes.RequestCtx) string {
+	if user := h.getAuthenticatedUser(ctx); user != "" {
+		return user
+	}
+	encoded, ok := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Basic ")
+	if !ok {
+		return ""
+	}
+	credentials, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(credentials), ":")
+	return user
+}
+
+// logDocumentEdit records a change made in the document editor in the
+// collection's request log, in the tenant selected in the panel. The body
+// has the shape of an API request, so the usual masking applies to it.
+func (h *Handler) logDocumentEdit(ctx *saiTypes.RequestCtx, collection, action, internalID string, doc map[string]interface{}) {
+	adminCtx := h.AdminContext(ctx)
+	now := time.Now()
+	entry := map[string]interface{}{
+		"method":       string(ctx.Method()),
+		"path":         string(ctx.Path()),
+		"request_time": now.Format(time.RFC3339),
+		"request_unix": now.Unix(),
+		"auth_type":    "admin",
+	}
+	body := map[string]interface{}{
+		"collection": collection,
+		"action":     action,
+		"filter":     map[string]interface{}{"internal_id": internalID},
+	}
+	if doc != nil {
+		body["data"] = doc
+	}
+	logBody, truncated := h.service.RequestLogBody(body)
+	entry["body"] = logBody
+	if truncated {
+		entry["body_truncated"] = true
+	}
+	if user := h.adminUser(ctx); user != "" {
+		entry["user"] = user
+	}
+	if ip := h.getRemoteIP(ctx); ip != "" {
+		entry["ip"] = ip
+	}
+	if tenant := types.TenantFromContext(adminCtx); tenant != "" {
+		entry["tenant"] = tenant
+	}
+	h.service.LogRequest(adminCtx, collection, entry)
+}
+
+// DocumentJSON renders a document for the editor as relaxed Extended JSON
+// with sorted keys, internal_id first. Int64 values are written as
+// $numberLong, so that a small Int64 does not come back as Int32.
+func DocumentJSON(doc map[string]interface{}) (string, error) {
+	raw, err := bson.MarshalExtJSON(editorValue(doc), false, false)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func editorValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if (keys[i] == "internal_id") != (keys[j] == "internal_id") {
+				return keys[i] == "internal_id"
+			}
+			return keys[i] < keys[j]
+		})
+		d := make(bson.D, 0, len(keys))
+		for _, k := range keys {
+			d = append(d, bson.E{Key: k, Value: editorValue(t[k])})
+		}
+		return d
+	case primitive.M:
+		return editorValue(map[string]interface{}(t))
+	case primitive.D:
+		d := make(bson.D, len(t))
+		for i, e := range t {
+			d[i] = bson.E{Key: e.Key, Value: editorValue(e.Value)}
+		}
+		return d
+	case []interface{}:
+		a := make(bson.A, len(t))
+		for i, child := range t {
+			a[i] = editorValue(child)
+		}
+		return a
+	case primitive.A:
+		return editorValue([]interface{}(t))
+	case int64:
+		return bson.D{{Key: "$numberLong", Value: strconv.FormatInt(t, 10)}}
+	}
+	return v
+}
+
+// ParseDocumentJSON reads a document written in Extended JSON, relaxed or
+// canonical. Embedded documents and arrays become plain maps and slices.
+// The collection browser reads its filters with it as well.
+func ParseDocumentJSON(raw string) (map[string]interface{}, error) {
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(raw), false, &doc); err != nil {
+		return nil, err
+	}
+	return plainValue(doc).(map[string]interface{}), nil
+}
+
+func plainValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case primitive.D:
+		m := make(map[string]interface{}, len(t))
+		for _, e := range t {
+			m[e.Key] = plainValue(e.Value)
+		}
+		return m
+	case primitive.M:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			m[k] = plainValue(child)
+		}
+		return m
+	case primitive.A:
+		a := make([]interface{}, len(t))
+		for i, child := range t {
+			a[i] = plainValue(child)
+		}
+		return a
+	}
+	return v
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -9,7 +10,10 @@ import (
 
 	"github.com/saiset-co/sai-service/admin"
 	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/internal/shell"
 	"github.com/saiset-co/sai-storage/types"
+	"github.com/valyala/fasthttp"
 )
 
 func (h *Handler) CreateIndex(ctx *saiTypes.RequestCtx) {
@@ -18,141 +22,26 @@ func (h *Handler) CreateIndex(ctx *saiTypes.RequestCtx) {
 		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
-	if req.Collection == "" || len(req.Keys) == 0 {
+	if req.Collection == "" || (len(req.Keys) == 0 && len(req.OrderedKeys) == 0) {
 		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection and keys are required"))
 		return
 	}
-	if err := h.service.GetRepo().CreateIndex(context.Background(), req); err != nil {
-		admin.WriteActionJSON(ctx, "", err)
-		return
-	}
-	admin.WriteActionJSON(ctx, "Индекс успешно создан", nil)
+	h.writeIndexBuild(ctx, h.service.CreateIndex(h.AdminContext(ctx), req), "Индекс успешно создан")
 }
 
 func (h *Handler) RestoreUpdate(ctx *saiTypes.RequestCtx) {
-	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
-	opID := strings.TrimSpace(string(ctx.FormValue("archive_operation_id")))
-	if collection == "" || opID == "" {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и archive_operation_id обязательны"))
-		return
-	}
-
-	archiveCollection := fmt.Sprintf("%s_update_archive", collection)
-
-	check, _, _ := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID, "restored_at": map[string]interface{}{"$gt": 0}},
-		Limit:      1,
-	})
-	if len(check) > 0 {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("операция уже была восстановлена"))
-		return
-	}
-
-	docs, _, err := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
-	})
-	if err != nil {
-		admin.WriteActionJSON(ctx, "", err)
-		return
-	}
-
-	restored := 0
-	for _, doc := range docs {
-		internalID, ok := doc["internal_id"]
-		if !ok {
-			continue
-		}
-		filter := map[string]interface{}{"internal_id": internalID}
-		if upsertInsert, _ := doc["upsert_insert"].(bool); upsertInsert {
-			h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-				Collection: collection,
-				Filter:     filter,
-			})
-			restored++
-			continue
-		}
-		data := cleanArchiveFields(doc)
-		h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-			Collection: collection,
-			Filter:     filter,
-		})
-		if _, err := h.service.GetRepo().CreateDocuments(context.Background(), types.CreateDocumentsRequest{
-			Collection: collection,
-			Data:       []interface{}{data},
-		}); err == nil {
-			restored++
-		}
-	}
-
-	h.service.GetRepo().UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
-		Data:       map[string]interface{}{"$set": map[string]interface{}{"restored_at": time.Now().UnixNano()}},
-	})
-
-	admin.WriteActionJSON(ctx, fmt.Sprintf("Восстановлено документов: %d", restored), nil)
+	h.restoreFromForm(ctx, "update", "Восстановлено документов: %d")
 }
 
 func (h *Handler) RestoreDelete(ctx *saiTypes.RequestCtx) {
-	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
-	opID := strings.TrimSpace(string(ctx.FormValue("archive_operation_id")))
-	if collection == "" || opID == "" {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и archive_operation_id обязательны"))
-		return
-	}
-
-	archiveCollection := fmt.Sprintf("%s_delete_archive", collection)
-
-	check, _, _ := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID, "restored_at": map[string]interface{}{"$gt": 0}},
-		Limit:      1,
-	})
-	if len(check) > 0 {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("операция уже была восстановлена"))
-		return
-	}
-
-	docs, _, err := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
-	})
-	if err != nil {
-		admin.WriteActionJSON(ctx, "", err)
-		return
-	}
-
-	restored := 0
-	for _, doc := range docs {
-		internalID, ok := doc["internal_id"]
-		if !ok {
-			continue
-		}
-		data := cleanArchiveFields(doc)
-		h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-			Collection: collection,
-			Filter:     map[string]interface{}{"internal_id": internalID},
-		})
-		if _, err := h.service.GetRepo().CreateDocuments(context.Background(), types.CreateDocumentsRequest{
-			Collection: collection,
-			Data:       []interface{}{data},
-		}); err == nil {
-			restored++
-		}
-	}
-
-	h.service.GetRepo().UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
-		Data:       map[string]interface{}{"$set": map[string]interface{}{"restored_at": time.Now().UnixNano()}},
-	})
-
-	admin.WriteActionJSON(ctx, fmt.Sprintf("Восстановлено документов: %d", restored), nil)
+	h.restoreFromForm(ctx, "delete", "Восстановлено документов: %d")
 }
 
 func (h *Handler) RestoreCreate(ctx *saiTypes.RequestCtx) {
+	h.restoreFromForm(ctx, "create", "Удалено документов: %d")
+}
+
+func (h *Handler) restoreFromForm(ctx *saiTypes.RequestCtx, archive, message string) {
 	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
 	opID := strings.TrimSpace(string(ctx.FormValue("archive_operation_id")))
 	if collection == "" || opID == "" {
@@ -160,49 +49,16 @@ func (h *Handler) RestoreCreate(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
-	archiveCollection := fmt.Sprintf("%s_create_archive", collection)
-
-	check, _, _ := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID, "restored_at": map[string]interface{}{"$gt": 0}},
-		Limit:      1,
-	})
-	if len(check) > 0 {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("операция уже была отменена"))
-		return
-	}
-
-	docs, _, err := h.service.GetRepo().ReadDocuments(context.Background(), types.ReadDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
+	result, err := h.service.RestoreOperation(h.AdminContext(ctx), types.RestoreRequest{
+		Collection:         collection,
+		ArchiveOperationID: opID,
+		Archive:            archive,
 	})
 	if err != nil {
 		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
-
-	deleted := 0
-	for _, doc := range docs {
-		internalID, ok := doc["internal_id"]
-		if !ok {
-			continue
-		}
-		n, err := h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
-			Collection: collection,
-			Filter:     map[string]interface{}{"internal_id": internalID},
-		})
-		if err == nil && n > 0 {
-			deleted++
-		}
-	}
-
-	h.service.GetRepo().UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
-		Collection: archiveCollection,
-		Filter:     map[string]interface{}{"archive_operation_id": opID},
-		Data:       map[string]interface{}{"$set": map[string]interface{}{"restored_at": time.Now().UnixNano()}},
-	})
-
-	admin.WriteActionJSON(ctx, fmt.Sprintf("Удалено документов: %d", deleted), nil)
+	admin.WriteActionJSON(ctx, fmt.Sprintf(message, result.Restored+result.Deleted), nil)
 }
 
 func (h *Handler) SetSlowQueryThreshold(ctx *saiTypes.RequestCtx) {
@@ -260,26 +116,14 @@ func (h *Handler) SaveCustomQuery(ctx *saiTypes.RequestCtx) {
 	admin.WriteActionJSON(ctx, "Запрос сохранён", nil)
 }
 
+// parseMongoShellQuery validates a saved query and returns its collection
+// and method as written.
 func parseMongoShellQuery(q string) (collection, operation string, err error) {
-	if !strings.HasPrefix(q, "db.") {
-		return "", "", fmt.Errorf("запрос должен начинаться с db.")
-	}
-	rest := q[3:]
-	dotIdx := strings.Index(rest, ".")
-	if dotIdx < 0 {
-		return "", "", fmt.Errorf("не найдено имя коллекции")
-	}
-	collection = rest[:dotIdx]
-	rest = rest[dotIdx+1:]
-	parenIdx := strings.Index(rest, "(")
-	if parenIdx < 0 {
-		return "", "", fmt.Errorf("не найдена открывающая скобка")
-	}
-	operation = rest[:parenIdx]
-	if collection == "" || operation == "" {
-		return "", "", fmt.Errorf("неверный формат: db.collection.operation(...)")
+	query, err := shell.Parse(q)
+	if err != nil {
+		return "", "", errors.New(shell.Russian(err))
 	}
-	return collection, operation, nil
+	return query.Collection, query.Method, nil
 }
 
 func (h *Handler) UpdateCustomQuery(ctx *saiTypes.RequestCtx) {
@@ -321,6 +165,10 @@ func (h *Handler) UpdateCustomQuery(ctx *saiTypes.RequestCtx) {
 		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
+	if err := h.service.ReloadQuerySchedules(); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
 	admin.WriteActionJSON(ctx, "Запрос обновлён", nil)
 }
 
@@ -338,11 +186,92 @@ func (h *Handler) DeleteCustomQuery(ctx *saiTypes.RequestCtx) {
 		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
+	_, err = h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Filter:     map[string]interface{}{"query_id": id},
+	})
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if err := h.service.ReloadQuerySchedules(); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
 	admin.WriteActionJSON(ctx, "Запрос удалён", nil)
 }
 
+// ScheduleCustomQuery sets or, with an empty cron, removes the schedule of a
+// saved query. The query runs in the tenant selected in the admin panel.
+func (h *Handler) ScheduleCustomQuery(ctx *saiTypes.RequestCtx) {
+	id := strings.TrimSpace(string(ctx.FormValue("id")))
+	if id == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("id обязателен"))
+		return
+	}
+	schedule := types.QuerySchedule{
+		Cron:    string(ctx.FormValue("cron")),
+		Params:  formParams(ctx),
+		Tenant:  types.TenantFromContext(h.AdminContext(ctx)),
+		Alert:   string(ctx.FormValue("alert")),
+		Webhook: string(ctx.FormValue("webhook")),
+	}
+	if err := h.service.SetQuerySchedule(id, schedule); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if strings.TrimSpace(schedule.Cron) == "" {
+		admin.WriteActionJSON(ctx, "Расписание удалено", nil)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Расписание сохранено", nil)
+}
+
+// RunScheduledQueryNow runs a scheduled query immediately and records the
+// run in its history.
+func (h *Handler) RunScheduledQueryNow(ctx *saiTypes.RequestCtx) {
+	id := strings.TrimSpace(string(ctx.FormValue("id")))
+	if id == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("id обязателен"))
+		return
+	}
+	run, err := h.service.RunScheduledQuery(id)
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if run.Error != "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("запрос завершился ошибкой: %s", run.Error))
+		return
+	}
+	message := fmt.Sprintf("Строк: %d, %d мс", run.Count, run.DurationMs)
+	if run.Alert != "" {
+		message += ". Оповещение: " + run.Alert
+	}
+	admin.WriteActionJSON(ctx, message, nil)
+}
+
+// formParams collects the param_<name> fields of an admin form.
+func formParams(ctx *saiTypes.RequestCtx) map[string]string {
+	params := make(map[string]string)
+	if form, err := ctx.MultipartForm(); err == nil {
+		for key, values := range form.Value {
+			if name, ok := strings.CutPrefix(key, "param_"); ok && len(values) > 0 {
+				params[name] = values[0]
+			}
+		}
+		return params
+	}
+	ctx.PostArgs().VisitAll(func(key, value []byte) {
+		if name, ok := strings.CutPrefix(string(key), "param_"); ok {
+			params[name] = string(value)
+		}
+	})
+	return params
+}
+
 func (h *Handler) ClearQueryStats(ctx *saiTypes.RequestCtx) {
-	if _, err := h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
+	if _, err := h.service.GetRepo().DeleteDocuments(h.AdminContext(ctx), types.DeleteDocumentsRequest{
 		Collection: "_admin_query_stats",
 		Filter:     map[string]interface{}{},
 	}); err != nil {
@@ -353,7 +282,7 @@ func (h *Handler) ClearQueryStats(ctx *saiTypes.RequestCtx) {
 }
 
 func (h *Handler) ClearSlowQueries(ctx *saiTypes.RequestCtx) {
-	if _, err := h.service.GetRepo().DeleteDocuments(context.Background(), types.DeleteDocumentsRequest{
+	if _, err := h.service.GetRepo().DeleteDocuments(h.AdminContext(ctx), types.DeleteDocumentsRequest{
 		Collection: "_admin_slow_queries",
 		Filter:     map[string]interface{}{},
 	}); err != nil {
@@ -363,42 +292,158 @@ func (h *Handler) ClearSlowQueries(ctx *saiTypes.RequestCtx) {
 	admin.WriteActionJSON(ctx, "Долгие запросы очищены", nil)
 }
 
+// CreateIndexFromForm creates an index from the Indexes page. keys_raw
+// lists field:direction pairs in index order, where the direction may also
+// be an index type such as text, 2dsphere or hashed.
 func (h *Handler) CreateIndexFromForm(ctx *saiTypes.RequestCtx) {
 	collection := string(ctx.FormValue("collection"))
-	keysRaw := string(ctx.FormValue("keys_raw"))
-	unique := string(ctx.FormValue("unique")) == "true"
-	sparse := string(ctx.FormValue("sparse")) == "true"
-	name := string(ctx.FormValue("name"))
+	ordered, keys, err := parseIndexKeys(string(ctx.FormValue("keys_raw")))
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	if collection == "" || len(keys) == 0 {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и keys обязательны"))
+		return
+	}
 
+	req := types.CreateIndexRequest{
+		Collection:      collection,
+		Keys:            keys,
+		OrderedKeys:     ordered,
+		Unique:          string(ctx.FormValue("unique")) == "true",
+		Sparse:          string(ctx.FormValue("sparse")) == "true",
+		Hidden:          string(ctx.FormValue("hidden")) == "true",
+		Name:            strings.TrimSpace(string(ctx.FormValue("name"))),
+		DefaultLanguage: strings.TrimSpace(string(ctx.FormValue("default_language"))),
+	}
+	if raw := strings.TrimSpace(string(ctx.FormValue("expire_after_seconds"))); raw != "" {
+		ttl, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || ttl < 0 {
+			admin.WriteActionJSON(ctx, "", fmt.Errorf("TTL должен быть неотрицательным числом секунд"))
+			return
+		}
+		ttl32 := int32(ttl)
+		req.ExpireAfterSeconds = &ttl32
+	}
+	if raw := strings.TrimSpace(string(ctx.FormValue("partial_filter"))); raw != "" {
+		if err := ctx.Unmarshal([]byte(raw), &req.PartialFilterExpression); err != nil {
+			admin.WriteActionJSON(ctx, "", fmt.Errorf("неверный JSON частичного фильтра: %v", err))
+			return
+		}
+	}
+	if locale := strings.TrimSpace(string(ctx.FormValue("collation_locale"))); locale != "" {
+		strength, _ := strconv.Atoi(string(ctx.FormValue("collation_strength")))
+		req.Collation = &types.IndexCollation{
+			Locale:          locale,
+			Strength:        strength,
+			NumericOrdering: string(ctx.FormValue("collation_numeric")) == "true",
+		}
+	}
+	if raw := strings.TrimSpace(string(ctx.FormValue("weights"))); raw != "" {
+		req.Weights = make(map[string]int)
+		for _, part := range splitComma(raw) {
+			kv := splitColon(part)
+			weight := 1
+			if len(kv) == 2 {
+				if weight, err = strconv.Atoi(strings.TrimSpace(kv[1])); err != nil || weight < 1 {
+					admin.WriteActionJSON(ctx, "", fmt.Errorf("вес поля %s должен быть целым числом от 1", kv[0]))
+					return
+				}
+			}
+			req.Weights[strings.TrimSpace(kv[0])] = weight
+		}
+	}
+
+	h.writeIndexBuild(ctx, h.service.CreateIndex(h.AdminContext(ctx), req), "Индекс успешно создан")
+}
+
+// writeIndexBuild reports the result of an index build. A build still
+// running is not an error.
+func (h *Handler) writeIndexBuild(ctx *saiTypes.RequestCtx, err error, message string) {
+	if errors.Is(err, service.ErrIndexBuildRunning) {
+		admin.WriteActionJSON(ctx, "Индекс строится в фоне, прогресс виден в списке индексов", nil)
+		return
+	}
+	admin.WriteActionJSON(ctx, message, err)
+}
+
+// indexKeyTypes are the index types a key may have instead of a direction.
+var indexKeyTypes = map[string]bool{"text": true, "2dsphere": true, "2d": true, "hashed": true}
+
+// parseIndexKeys reads "field:1, other:-1, body:text" in order. A field
+// without a direction is ascending.
+func parseIndexKeys(raw string) ([]types.IndexKey, map[string]int, error) {
 	keys := make(map[string]int)
-	for _, part := range splitComma(keysRaw) {
+	var ordered []types.IndexKey
+	for _, part := range splitComma(raw) {
 		kv := splitColon(part)
+		key := types.IndexKey{Field: strings.TrimSpace(kv[0]), Direction: 1}
 		if len(kv) == 2 {
-			dir := 1
-			if kv[1] == "-1" {
-				dir = -1
+			switch value := strings.TrimSpace(kv[1]); {
+			case value == "1":
+			case value == "-1":
+				key.Direction = -1
+			case indexKeyTypes[value]:
+				key.Direction, key.Type = 0, value
+			default:
+				return nil, nil, fmt.Errorf("неизвестный тип ключа %q у поля %s", value, key.Field)
 			}
-			keys[kv[0]] = dir
 		}
+		if _, dup := keys[key.Field]; dup || key.Field == "" {
+			continue
+		}
+		keys[key.Field] = key.Direction
+		ordered = append(ordered, key)
 	}
+	return ordered, keys, nil
+}
 
-	if collection == "" || len(keys) == 0 {
-		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и keys обязательны"))
+func (h *Handler) DropIndex(ctx *saiTypes.RequestCtx) {
+	collection, name, ok := indexForm(ctx)
+	if !ok {
+		return
+	}
+	if err := h.service.DropIndex(h.AdminContext(ctx), collection, name); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
+	admin.WriteActionJSON(ctx, "Индекс удалён", nil)
+}
 
-	req := types.CreateIndexRequest{
-		Collection: collection,
-		Keys:       keys,
-		Unique:     unique,
-		Sparse:     sparse,
-		Name:       name,
+func (h *Handler) SetIndexHidden(ctx *saiTypes.RequestCtx) {
+	collection, name, ok := indexForm(ctx)
+	if !ok {
+		return
 	}
-	if err := h.service.GetRepo().CreateIndex(context.Background(), req); err != nil {
+	hidden := string(ctx.FormValue("hidden")) == "true"
+	if err := h.service.SetIndexHidden(h.AdminContext(ctx), collection, name, hidden); err != nil {
 		admin.WriteActionJSON(ctx, "", err)
 		return
 	}
-	admin.WriteActionJSON(ctx, "Индекс успешно создан", nil)
+	if hidden {
+		admin.WriteActionJSON(ctx, "Индекс скрыт от планировщика", nil)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Индекс снова используется", nil)
+}
+
+func (h *Handler) RebuildIndex(ctx *saiTypes.RequestCtx) {
+	collection, name, ok := indexForm(ctx)
+	if !ok {
+		return
+	}
+	h.writeIndexBuild(ctx, h.service.RebuildIndex(h.AdminContext(ctx), collection, name), "Индекс перестроен")
+}
+
+func indexForm(ctx *saiTypes.RequestCtx) (string, string, bool) {
+	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
+	name := strings.TrimSpace(string(ctx.FormValue("name")))
+	if collection == "" || name == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection и name обязательны"))
+		return "", "", false
+	}
+	return collection, name, true
 }
 
 func splitComma(s string) []string {
@@ -415,22 +460,206 @@ func splitColon(s string) []string {
 	return strings.SplitN(strings.TrimSpace(s), ":", 2)
 }
 
-func cleanArchiveFields(doc map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{}, len(doc))
-	skip := map[string]bool{
-		"archive_operation_id": true,
-		"archive_time":         true,
-		"source_collection":    true,
-		"archive_filter":       true,
-		"archive_update":       true,
-		"upsert_insert":        true,
-		"restored_at":          true,
-		"_id":                  true,
-	}
-	for k, v := range doc {
-		if !skip[k] {
-			result[k] = v
+func (h *Handler) SaveAccessRole(ctx *saiTypes.RequestCtx) {
+	name := strings.TrimSpace(string(ctx.FormValue("name")))
+	description := strings.TrimSpace(string(ctx.FormValue("description")))
+	rulesRaw := strings.TrimSpace(string(ctx.FormValue("rules")))
+
+	if name == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("имя роли обязательно"))
+		return
+	}
+
+	role := types.AccessRole{Name: name, Description: description}
+	if rulesRaw != "" {
+		if err := ctx.Unmarshal([]byte(rulesRaw), &role.Rules); err != nil {
+			admin.WriteActionJSON(ctx, "", fmt.Errorf("неверный JSON правил: %v", err))
+			return
 		}
 	}
-	return result
+
+	if err := h.service.SaveAccessRole(context.Background(), role); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Роль сохранена", nil)
+}
+
+func (h *Handler) DeleteAccessRole(ctx *saiTypes.RequestCtx) {
+	name := strings.TrimSpace(string(ctx.FormValue("name")))
+	if name == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("имя роли обязательно"))
+		return
+	}
+	if err := h.service.DeleteAccessRole(context.Background(), name); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Роль удалена", nil)
+}
+
+func (h *Handler) CreateAPIKey(ctx *saiTypes.RequestCtx) {
+	name := strings.TrimSpace(string(ctx.FormValue("name")))
+	role := strings.TrimSpace(string(ctx.FormValue("role")))
+	user := strings.TrimSpace(string(ctx.FormValue("user")))
+	tenant := strings.TrimSpace(string(ctx.FormValue("tenant")))
+
+	if name == "" || role == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("имя и роль обязательны"))
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(context.Background(), types.APIKey{Name: name, Role: role, User: user, Tenant: tenant})
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, key, nil)
+}
+
+func (h *Handler) DeleteAPIKey(ctx *saiTypes.RequestCtx) {
+	id := strings.TrimSpace(string(ctx.FormValue("id")))
+	if id == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("id обязателен"))
+		return
+	}
+	if err := h.service.DeleteAPIKey(context.Background(), id); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Ключ отозван", nil)
+}
+
+const adminTenantCookie = "sai_admin_tenant"
+
+// AdminContext returns the context admin pages and actions run in: scoped to
+// the tenant selected in the panel, or the shared namespace if none is.
+func (h *Handler) AdminContext(ctx *saiTypes.RequestCtx) context.Context {
+	if !h.service.TenancyEnabled() {
+		return context.Background()
+	}
+	tenant := string(ctx.Request.Header.Cookie(adminTenantCookie))
+	if !types.ValidTenantID(tenant) {
+		return context.Background()
+	}
+	return types.WithTenant(context.Background(), tenant)
+}
+
+func (h *Handler) SelectTenant(ctx *saiTypes.RequestCtx) {
+	tenant := strings.TrimSpace(string(ctx.FormValue("tenant")))
+	if tenant != "" && !types.ValidTenantID(tenant) {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("недопустимый тенант %q", tenant))
+		return
+	}
+
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(adminTenantCookie)
+	cookie.SetValue(tenant)
+	cookie.SetPath("/admin")
+	cookie.SetHTTPOnly(true)
+	cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	if tenant == "" {
+		cookie.SetMaxAge(-1)
+	}
+	ctx.Response.Header.SetCookie(cookie)
+
+	admin.WriteActionJSON(ctx, "Тенант выбран", nil)
+}
+
+func (h *Handler) ReloadEncryptionKeys(ctx *saiTypes.RequestCtx) {
+	if err := h.service.ReloadEncryptionKeys(); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Ключи перечитаны", nil)
+}
+
+func (h *Handler) ReencryptCollection(ctx *saiTypes.RequestCtx) {
+	collection := strings.TrimSpace(string(ctx.FormValue("collection")))
+	if collection == "" {
+		admin.WriteActionJSON(ctx, "", fmt.Errorf("collection обязателен"))
+		return
+	}
+	n, err := h.service.ReencryptCollection(h.AdminContext(ctx), collection)
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, fmt.Sprintf("Перешифровано документов: %d", n), nil)
+}
+
+func (h *Handler) RunRetention(ctx *saiTypes.RequestCtx) {
+	if err := h.service.RunRetention(); err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, "Очистка запущена", nil)
+}
+
+func (h *Handler) ApplyIndexRecommendations(ctx *saiTypes.RequestCtx) {
+	created, err := h.service.ApplyIndexRecommendations(h.AdminContext(ctx), string(ctx.FormValue("collection")))
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, fmt.Sprintf("Создано индексов: %d", len(created)), nil)
+}
+
+// RollbackRequestFromForm reads a rollback selection from form or query
+// values. internal_ids is a comma or whitespace separated list; from and to
+// take unix nanoseconds, RFC 3339 or a datetime-local value in server time.
+func (h *Handler) RollbackRequestFromForm(ctx *saiTypes.RequestCtx) (types.RollbackRequest, error) {
+	req := types.RollbackRequest{
+		Collection:  strings.TrimSpace(string(ctx.FormValue("collection"))),
+		OperationID: strings.TrimSpace(string(ctx.FormValue("operation_id"))),
+		InternalIDs: strings.Fields(strings.ReplaceAll(string(ctx.FormValue("internal_ids")), ",", " ")),
+		Force:       string(ctx.FormValue("force")) == "true",
+	}
+	if req.Collection == "" {
+		return req, fmt.Errorf("collection обязателен")
+	}
+	for _, field := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &req.From}, {"to", &req.To}} {
+		raw := strings.TrimSpace(string(ctx.FormValue(field.name)))
+		if raw == "" {
+			continue
+		}
+		t, err := parseFormTime(raw)
+		if err != nil {
+			return req, fmt.Errorf("неверное значение %s: %s", field.name, raw)
+		}
+		*field.dst = t
+	}
+	if req.OperationID == "" && req.From == 0 {
+		return req, fmt.Errorf("укажите operation_id или начало периода")
+	}
+	return req, nil
+}
+
+func parseFormTime(raw string) (int64, error) {
+	if t, err := parseAsOf(raw); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", raw, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano(), nil
+}
+
+func (h *Handler) ApplyRollback(ctx *saiTypes.RequestCtx) {
+	req, err := h.RollbackRequestFromForm(ctx)
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	result, err := h.service.ApplyRollback(h.AdminContext(ctx), req)
+	if err != nil {
+		admin.WriteActionJSON(ctx, "", err)
+		return
+	}
+	admin.WriteActionJSON(ctx, fmt.Sprintf("Откат выполнен: восстановлено %d, удалено %d. Операция %s", result.Restored, result.Deleted, result.OperationID), nil)
 }
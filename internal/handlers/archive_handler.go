@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// ArchiveOperations lists archived operations of a collection.
+func (h *Handler) ArchiveOperations(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpRead)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	req := types.ArchiveOperationsRequest{
+		Collection: string(ctx.QueryArgs().Peek("collection")),
+		Archive:    string(ctx.QueryArgs().Peek("archive")),
+		Search:     string(ctx.QueryArgs().Peek("search")),
+		Skip:       ctx.QueryArgs().GetUintOrZero("skip"),
+		Limit:      ctx.QueryArgs().GetUintOrZero("limit"),
+	}
+
+	if req.Collection == "" || req.Archive == "" {
+		h.logRequest(ctx, req.Collection, req)
+		ctx.Error(saiTypes.NewError("collection and archive parameters are required"), fasthttp.StatusBadRequest)
+		return
+	}
+	if !h.authorizeArchive(ctx, req.Collection, []string{service.OpRead}, req) {
+		return
+	}
+
+	h.logRequest(ctx, req.Collection, req)
+
+	response, err := h.service.ArchiveOperations(ctx, req)
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
+
+// RestoreArchive undoes one archived operation, or previews it with dry_run.
+func (h *Handler) RestoreArchive(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpUpdate)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	var req types.RestoreRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		h.logRequest(ctx, "", map[string]interface{}{
+			"error":    err.Error(),
+			"raw_body": string(ctx.PostBody()),
+		})
+		ctx.Error(saiTypes.WrapError(err, "Invalid JSON in request body"), fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !h.authorizeArchive(ctx, req.Collection, []string{service.OpCreate, service.OpUpdate, service.OpDelete}, req) {
+		return
+	}
+
+	h.logRequest(ctx, req.Collection, req)
+
+	response, err := h.service.RestoreOperation(ctx, req)
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
+
+// authorizeArchive requires unrestricted access to collection for every
+// operation: archive entries cannot be checked against a scope filter.
+func (h *Handler) authorizeArchive(ctx *saiTypes.RequestCtx, collection string, operations []string, body interface{}) bool {
+	for _, operation := range operations {
+		if !h.checkCollection(ctx, collection, operation, body) {
+			return false
+		}
+		scope, ok := h.authorize(ctx, collection, operation, body)
+		if !ok {
+			return false
+		}
+		if scope != nil {
+			h.logRequest(ctx, "", body)
+			ctx.Error(saiTypes.NewErrorf("collection %q is restricted and its archives are not available", collection), fasthttp.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
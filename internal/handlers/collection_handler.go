@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+type collectionOperation func(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error)
+
+func (h *Handler) CreateCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.CreateCollection)
+}
+
+func (h *Handler) RenameCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.RenameCollection)
+}
+
+func (h *Handler) DropCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.DropCollection)
+}
+
+func (h *Handler) TruncateCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.TruncateCollection)
+}
+
+func (h *Handler) CloneCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.CloneCollection)
+}
+
+func (h *Handler) ConvertCollection(ctx *saiTypes.RequestCtx) {
+	h.runCollectionOperation(ctx, h.service.ConvertCollection)
+}
+
+// runCollectionOperation reads a CollectionRequest and runs op on it. The
+// public endpoints are only served with access control on, and the caller
+// needs unrestricted manage access to the collection and, for rename and
+// clone, to the new name. Without access control collections are managed
+// from the admin panel.
+func (h *Handler) runCollectionOperation(ctx *saiTypes.RequestCtx, op collectionOperation) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpManage)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	var req types.CollectionRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		h.logRequest(ctx, "", map[string]interface{}{
+			"error":    err.Error(),
+			"raw_body": string(ctx.PostBody()),
+		})
+		ctx.Error(saiTypes.WrapError(err, "Invalid JSON in request body"), fasthttp.StatusBadRequest)
+		return
+	}
+	if !h.service.AccessControlEnabled() {
+		h.logRequest(ctx, "", req)
+		ctx.Error(saiTypes.NewError("collection management requires access control"), fasthttp.StatusForbidden)
+		return
+	}
+
+	collections := []string{req.Collection}
+	if req.To != "" {
+		collections = append(collections, req.To)
+	}
+	for _, collection := range collections {
+		if !h.checkCollection(ctx, collection, service.OpManage, req) {
+			return
+		}
+		scope, ok := h.authorize(ctx, collection, service.OpManage, req)
+		if !ok {
+			return
+		}
+		if scope != nil {
+			h.logRequest(ctx, "", req)
+			ctx.Error(saiTypes.NewErrorf("collection %q is restricted and cannot be managed", collection), fasthttp.StatusForbidden)
+			return
+		}
+	}
+
+	h.logRequest(ctx, req.Collection, req)
+
+	response, err := op(ctx, req)
+	if err != nil {
+		status := fasthttp.StatusInternalServerError
+		if errors.Is(err, service.ErrConfirmationMismatch) {
+			status = fasthttp.StatusBadRequest
+		}
+		ctx.Error(err, status)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+var explainOperations = map[string]string{
+	"":          service.OpRead,
+	"find":      service.OpRead,
+	"aggregate": service.OpAggregate,
+	"update":    service.OpUpdate,
+	"delete":    service.OpDelete,
+}
+
+// Explain returns the query plan of a find, aggregate, update or delete
+// without running it. The caller needs the permission of the explained
+// operation.
+func (h *Handler) Explain(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpRead)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	var req types.ExplainRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		h.logRequest(ctx, "", map[string]interface{}{
+			"error":    err.Error(),
+			"raw_body": string(ctx.PostBody()),
+		})
+		ctx.Error(saiTypes.WrapError(err, "Invalid JSON in request body"), fasthttp.StatusBadRequest)
+		return
+	}
+
+	operation, known := explainOperations[req.Operation]
+	if !known {
+		h.logRequest(ctx, "", req)
+		ctx.Error(saiTypes.NewErrorf("operation %q cannot be explained", req.Operation), fasthttp.StatusBadRequest)
+		return
+	}
+	setRequestOperation(ctx, operation)
+	if !h.checkCollection(ctx, req.Collection, operation, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, operation, req)
+	if !ok {
+		return
+	}
+	if req.Operation == "aggregate" && !h.checkPipeline(ctx, types.AggregateDocumentsRequest{Collection: req.Collection, Pipeline: req.Pipeline}) {
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+	req.Pipeline = service.ScopePipeline(req.Pipeline, scope)
+
+	h.logRequest(ctx, req.Collection, req)
+
+	response, err := h.service.Explain(ctx, req)
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +26,10 @@ func NewHandler(service *service.StorageService) *Handler {
 
 func (h *Handler) CreateDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpCreate)
+	if !h.resolveTenant(ctx) {
+		return
+	}
 	var req types.CreateDocumentsRequest
 	if err := ctx.ReadJSON(&req); err != nil {
 		h.logRequest(ctx, "", map[string]interface{}{
@@ -35,6 +40,19 @@ func (h *Handler) CreateDocuments(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	if !h.checkCollection(ctx, req.Collection, service.OpCreate, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpCreate, req)
+	if !ok {
+		return
+	}
+	if err := service.ScopeDocuments(req.Data, scope); err != nil {
+		h.logRequest(ctx, "", req)
+		ctx.Error(err, fasthttp.StatusForbidden)
+		return
+	}
+
 	h.logRequest(ctx, req.Collection, req)
 
 	response, err := h.service.CreateDocuments(ctx, req)
@@ -48,6 +66,10 @@ func (h *Handler) CreateDocuments(ctx *saiTypes.RequestCtx) {
 
 func (h *Handler) ReadDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpRead)
+	if !h.resolveTenant(ctx) {
+		return
+	}
 	req := types.ReadDocumentsRequest{
 		Collection: string(ctx.QueryArgs().Peek("collection")),
 		Limit:      ctx.QueryArgs().GetUintOrZero("limit"),
@@ -67,6 +89,19 @@ func (h *Handler) ReadDocuments(ctx *saiTypes.RequestCtx) {
 		}
 	}
 
+	if raw := string(ctx.QueryArgs().Peek("as_of")); raw != "" && req.AsOf == 0 {
+		asOf, err := parseAsOf(raw)
+		if err != nil {
+			h.logRequest(ctx, req.Collection, req)
+			ctx.Error(err, fasthttp.StatusBadRequest)
+			return
+		}
+		req.AsOf = asOf
+	}
+	if ctx.QueryArgs().GetBool("include_deleted") {
+		req.IncludeDeleted = true
+	}
+
 	// Collection is required
 	if req.Collection == "" {
 		h.logRequest(ctx, req.Collection, req)
@@ -74,6 +109,15 @@ func (h *Handler) ReadDocuments(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	if !h.checkCollection(ctx, req.Collection, service.OpRead, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpRead, req)
+	if !ok {
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+
 	h.logRequest(ctx, req.Collection, req)
 
 	response, err := h.service.ReadDocuments(ctx, req)
@@ -85,8 +129,47 @@ func (h *Handler) ReadDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SuccessJSON(response)
 }
 
+// DocumentHistory lists the archived versions of one document.
+func (h *Handler) DocumentHistory(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpRead)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	collection, _ := ctx.UserValue("collection").(string)
+	internalID, _ := ctx.UserValue("internal_id").(string)
+	body := map[string]interface{}{"collection": collection, "internal_id": internalID}
+
+	if collection == "" || internalID == "" {
+		h.logRequest(ctx, collection, body)
+		ctx.Error(saiTypes.NewError("collection and internal_id are required"), fasthttp.StatusBadRequest)
+		return
+	}
+	if !h.checkCollection(ctx, collection, service.OpRead, body) {
+		return
+	}
+	scope, ok := h.authorize(ctx, collection, service.OpRead, body)
+	if !ok {
+		return
+	}
+
+	h.logRequest(ctx, collection, body)
+
+	response, err := h.service.DocumentHistory(ctx, collection, internalID, scope)
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
+
 func (h *Handler) AggregateDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpAggregate)
+	if !h.resolveTenant(ctx) {
+		return
+	}
 	req := types.AggregateDocumentsRequest{
 		Collection: string(ctx.QueryArgs().Peek("collection")),
 		Limit:      ctx.QueryArgs().GetUintOrZero("limit"),
@@ -113,6 +196,19 @@ func (h *Handler) AggregateDocuments(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	if !h.checkCollection(ctx, req.Collection, service.OpAggregate, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpAggregate, req)
+	if !ok {
+		return
+	}
+	if !h.checkPipeline(ctx, req) {
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+	req.Pipeline = service.ScopePipeline(req.Pipeline, scope)
+
 	h.logRequest(ctx, req.Collection, req)
 
 	response, err := h.service.AggregateDocuments(ctx, req)
@@ -126,6 +222,10 @@ func (h *Handler) AggregateDocuments(ctx *saiTypes.RequestCtx) {
 
 func (h *Handler) UpdateDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpUpdate)
+	if !h.resolveTenant(ctx) {
+		return
+	}
 	var req types.UpdateDocumentsRequest
 	if err := ctx.ReadJSON(&req); err != nil {
 		h.logRequest(ctx, "", map[string]interface{}{
@@ -136,6 +236,20 @@ func (h *Handler) UpdateDocuments(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	if !h.checkCollection(ctx, req.Collection, service.OpUpdate, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpUpdate, req)
+	if !ok {
+		return
+	}
+	if err := service.CheckScopedUpdate(req.Data, scope); err != nil {
+		h.logRequest(ctx, "", req)
+		ctx.Error(err, fasthttp.StatusForbidden)
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+
 	h.logRequest(ctx, req.Collection, req)
 
 	response, err := h.service.UpdateDocuments(ctx, req)
@@ -149,6 +263,10 @@ func (h *Handler) UpdateDocuments(ctx *saiTypes.RequestCtx) {
 
 func (h *Handler) DeleteDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpDelete)
+	if !h.resolveTenant(ctx) {
+		return
+	}
 	var req types.DeleteDocumentsRequest
 	if err := ctx.ReadJSON(&req); err != nil {
 		h.logRequest(ctx, "", map[string]interface{}{
@@ -159,6 +277,16 @@ func (h *Handler) DeleteDocuments(ctx *saiTypes.RequestCtx) {
 		return
 	}
 
+	if !h.checkCollection(ctx, req.Collection, service.OpDelete, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpDelete, req)
+	if !ok {
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+	req.DeletedBy = h.getAuthenticatedUser(ctx)
+
 	h.logRequest(ctx, req.Collection, req)
 
 	response, err := h.service.DeleteDocuments(ctx, req)
@@ -170,7 +298,172 @@ func (h *Handler) DeleteDocuments(ctx *saiTypes.RequestCtx) {
 	ctx.SuccessJSON(response)
 }
 
+// UndeleteDocuments restores soft-deleted documents of a collection.
+func (h *Handler) UndeleteDocuments(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpUpdate)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	var req types.UndeleteDocumentsRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		h.logRequest(ctx, "", map[string]interface{}{
+			"error":    err.Error(),
+			"raw_body": string(ctx.PostBody()),
+		})
+		ctx.Error(saiTypes.WrapError(err, "Invalid JSON in request body"), fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !h.checkCollection(ctx, req.Collection, service.OpUpdate, req) {
+		return
+	}
+	scope, ok := h.authorize(ctx, req.Collection, service.OpUpdate, req)
+	if !ok {
+		return
+	}
+	req.Filter = service.ScopeFilter(req.Filter, scope)
+
+	h.logRequest(ctx, req.Collection, req)
+
+	response, err := h.service.UndeleteDocuments(ctx, req)
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(response)
+}
+
+// checkCollection rejects invalid and reserved collection names. Rejected
+// requests are logged under "unknown" so they never create new collections.
+func (h *Handler) checkCollection(ctx *saiTypes.RequestCtx, collection, operation string, body interface{}) bool {
+	if err := service.ValidateCollectionName(collection); err != nil {
+		h.logRequest(ctx, "", body)
+		ctx.Error(err, fasthttp.StatusBadRequest)
+		return false
+	}
+	if err := h.service.CheckCollectionAccess(collection, operation); err != nil {
+		h.logRequest(ctx, "", body)
+		ctx.Error(err, fasthttp.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorize resolves the caller's access key and checks the role bound to it.
+// The returned scope is the mandatory filter to apply, nil if unrestricted.
+func (h *Handler) authorize(ctx *saiTypes.RequestCtx, collection, operation string, body interface{}) (map[string]interface{}, bool) {
+	if !h.service.AccessControlEnabled() {
+		return nil, true
+	}
+
+	principal, err := h.principal(ctx)
+	if err != nil {
+		h.logRequest(ctx, "", body)
+		ctx.Error(err, fasthttp.StatusUnauthorized)
+		return nil, false
+	}
+
+	scope, err := h.service.Authorize(principal, collection, operation)
+	if err != nil {
+		h.logRequest(ctx, "", body)
+		ctx.Error(err, fasthttp.StatusForbidden)
+		return nil, false
+	}
+	return scope, true
+}
+
+func (h *Handler) principal(ctx *saiTypes.RequestCtx) (*types.Principal, error) {
+	if principal, ok := ctx.UserValue("access_principal").(*types.Principal); ok && principal != nil {
+		return principal, nil
+	}
+	key := string(ctx.Request.Header.Peek(h.service.AccessKeyHeader()))
+	principal, err := h.service.ResolvePrincipal(key)
+	if err != nil {
+		return nil, err
+	}
+	ctx.SetUserValue("access_principal", principal)
+	return principal, nil
+}
+
+// resolveTenant derives the tenant from the configured source and stores it on
+// the request, where the repository picks it up to select the namespace.
+func (h *Handler) resolveTenant(ctx *saiTypes.RequestCtx) bool {
+	if !h.service.TenancyEnabled() {
+		return true
+	}
+
+	var raw string
+	switch h.service.TenantSource() {
+	case types.TenantSourceUser:
+		raw = string(ctx.Request.Header.Peek("X-Forwarded-User-ID"))
+	case types.TenantSourceAccessKey:
+		principal, err := h.principal(ctx)
+		if err != nil {
+			h.logRequest(ctx, "", nil)
+			ctx.Error(err, fasthttp.StatusUnauthorized)
+			return false
+		}
+		raw = principal.Tenant
+	default:
+		raw = string(ctx.Request.Header.Peek(h.service.TenantHeader()))
+	}
+
+	tenant, err := h.service.ResolveTenant(raw)
+	if err != nil {
+		h.logRequest(ctx, "", nil)
+		ctx.Error(err, fasthttp.StatusBadRequest)
+		return false
+	}
+	if tenant != "" {
+		ctx.SetUserValue(types.TenantContextKey, tenant)
+	}
+	return true
+}
+
+// checkPipeline applies the collection policy and access rules to every
+// collection an aggregation joins with or writes into. Joined collections must
+// be unrestricted for the caller since their scope cannot be enforced inside
+// the join.
+func (h *Handler) checkPipeline(ctx *saiTypes.RequestCtx, req types.AggregateDocumentsRequest) bool {
+	reads, writes := service.PipelineCollections(req.Pipeline)
+	for _, collection := range reads {
+		if !h.checkCollection(ctx, collection, service.OpRead, req) {
+			return false
+		}
+		scope, ok := h.authorize(ctx, collection, service.OpRead, req)
+		if !ok {
+			return false
+		}
+		if scope != nil {
+			h.logRequest(ctx, "", req)
+			ctx.Error(saiTypes.NewErrorf("collection %q is restricted and cannot be joined", collection), fasthttp.StatusForbidden)
+			return false
+		}
+	}
+	for _, collection := range writes {
+		for _, operation := range []string{service.OpCreate, service.OpUpdate, service.OpDelete} {
+			if !h.checkCollection(ctx, collection, operation, req) {
+				return false
+			}
+			if scope, ok := h.authorize(ctx, collection, operation, req); !ok {
+				return false
+			} else if scope != nil {
+				h.logRequest(ctx, "", req)
+				ctx.Error(saiTypes.NewErrorf("collection %q is restricted and cannot be written by a pipeline", collection), fasthttp.StatusForbidden)
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (h *Handler) logRequest(ctx *saiTypes.RequestCtx, collection string, body interface{}) {
+	if !h.service.SampleRequestLog(collection, requestOperation(ctx)) {
+		return
+	}
+
 	now := time.Now()
 	requestInfo := map[string]interface{}{
 		"method":       string(ctx.Method()),
@@ -180,11 +473,21 @@ func (h *Handler) logRequest(ctx *saiTypes.RequestCtx, collection string, body i
 	}
 
 	if body != nil {
-		if b, err := ctx.Marshal(body); err == nil {
-			requestInfo["body"] = string(b)
+		logBody, truncated := h.service.RequestLogBody(body)
+		requestInfo["body"] = logBody
+		if truncated {
+			requestInfo["body_truncated"] = true
 		}
 	}
 
+	if h.service.LogRequestHeaders() {
+		headers := make(map[string]string)
+		ctx.Request.Header.VisitAll(func(key, value []byte) {
+			headers[string(key)] = h.service.RedactHeader(string(key), string(value))
+		})
+		requestInfo["headers"] = headers
+	}
+
 	if v := ctx.UserValue("operation_id"); v != nil {
 		if s, ok := v.(string); ok && s != "" {
 			requestInfo["operation_id"] = s
@@ -210,9 +513,42 @@ func (h *Handler) logRequest(ctx *saiTypes.RequestCtx, collection string, body i
 		requestInfo["user_id"] = userID
 	}
 
+	if principal, ok := ctx.UserValue("access_principal").(*types.Principal); ok && principal != nil {
+		requestInfo["access_key"] = principal.Name
+		requestInfo["access_role"] = principal.Role
+	}
+
+	if tenant := types.TenantFromContext(ctx); tenant != "" {
+		requestInfo["tenant"] = tenant
+	}
+
 	h.service.LogRequest(ctx, collection, requestInfo)
 }
 
+// parseAsOf accepts unix nanoseconds (the unit of archive_time) or RFC 3339.
+func parseAsOf(raw string) (int64, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil && n > 0 {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return 0, saiTypes.NewError("as_of must be unix nanoseconds or an RFC 3339 time")
+	}
+	return t.UnixNano(), nil
+}
+
+// setRequestOperation names the operation a request is sampled under in the
+// request log. Handlers set it first thing and narrow it once the body says
+// what runs, as explain and saved queries do.
+func setRequestOperation(ctx *saiTypes.RequestCtx, operation string) {
+	ctx.SetUserValue("request_operation", operation)
+}
+
+func requestOperation(ctx *saiTypes.RequestCtx) string {
+	operation, _ := ctx.UserValue("request_operation").(string)
+	return operation
+}
+
 func (h *Handler) getAuthenticatedUser(ctx *saiTypes.RequestCtx) string {
 	if v := ctx.UserValue("authenticated_user"); v != nil {
 		if s, ok := v.(string); ok && s != "" {
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/service"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// savedQueryOperations lists the permissions each shell operation needs.
+var savedQueryOperations = map[string][]string{
+	shell.OpFind:             {service.OpRead},
+	shell.OpFindOne:          {service.OpRead},
+	shell.OpCount:            {service.OpRead},
+	shell.OpDistinct:         {service.OpRead},
+	shell.OpAggregate:        {service.OpAggregate},
+	shell.OpInsertOne:        {service.OpCreate},
+	shell.OpInsertMany:       {service.OpCreate},
+	shell.OpUpdateOne:        {service.OpUpdate},
+	shell.OpUpdateMany:       {service.OpUpdate},
+	shell.OpReplaceOne:       {service.OpUpdate},
+	shell.OpFindOneAndUpdate: {service.OpRead, service.OpUpdate},
+	shell.OpDeleteOne:        {service.OpDelete},
+	shell.OpDeleteMany:       {service.OpDelete},
+}
+
+// RunSavedQuery runs a query saved in the admin panel by id. Params fill
+// its placeholders. The caller needs the permissions of the query's
+// operation on its collection, and access scopes apply as they do to the
+// equivalent document endpoints.
+func (h *Handler) RunSavedQuery(ctx *saiTypes.RequestCtx) {
+	ctx.SetUserValue("operation_id", uuid.New().String())
+	setRequestOperation(ctx, service.OpRead)
+	if !h.resolveTenant(ctx) {
+		return
+	}
+	var req types.RunSavedQueryRequest
+	if err := ctx.ReadJSON(&req); err != nil {
+		h.logRequest(ctx, "", map[string]interface{}{
+			"error":    err.Error(),
+			"raw_body": string(ctx.PostBody()),
+		})
+		ctx.Error(saiTypes.WrapError(err, "Invalid JSON in request body"), fasthttp.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		h.logRequest(ctx, "", req)
+		ctx.Error(saiTypes.NewError("id is required"), fasthttp.StatusBadRequest)
+		return
+	}
+
+	queryRaw, err := h.service.SavedQuery(req.ID)
+	if err != nil {
+		h.logRequest(ctx, "", req)
+		ctx.Error(err, fasthttp.StatusNotFound)
+		return
+	}
+	values := make(map[string]string, len(req.Params))
+	for name, v := range req.Params {
+		switch value := v.(type) {
+		case string:
+			values[name] = value
+		case float64:
+			values[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		case json.Number:
+			values[name] = value.String()
+		case bool:
+			values[name] = strconv.FormatBool(value)
+		default:
+			h.logRequest(ctx, "", req)
+			ctx.Error(saiTypes.NewErrorf("param %q must be a string, number or boolean", name), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+	q, err := shell.Bind(queryRaw, values)
+	if err != nil {
+		h.logRequest(ctx, "", req)
+		ctx.Error(saiTypes.WrapError(err, "invalid saved query"), fasthttp.StatusBadRequest)
+		return
+	}
+
+	// An operation without listed permissions would skip every check below,
+	// so it is refused rather than run unchecked.
+	operations, known := savedQueryOperations[q.Operation]
+	if !known || len(operations) == 0 {
+		h.logRequest(ctx, q.Collection, req)
+		ctx.Error(saiTypes.NewErrorf("operation %s is not allowed in saved queries", q.Method), fasthttp.StatusBadRequest)
+		return
+	}
+	setRequestOperation(ctx, operations[len(operations)-1])
+	for _, operation := range operations {
+		if !h.checkCollection(ctx, q.Collection, operation, req) {
+			return
+		}
+		scope, ok := h.authorize(ctx, q.Collection, operation, req)
+		if !ok {
+			return
+		}
+		if err := applyQueryScope(q, scope); err != nil {
+			h.logRequest(ctx, "", req)
+			ctx.Error(err, fasthttp.StatusForbidden)
+			return
+		}
+	}
+	if q.Operation == shell.OpAggregate && !h.checkPipeline(ctx, types.AggregateDocumentsRequest{Collection: q.Collection, Pipeline: q.Pipeline}) {
+		return
+	}
+
+	h.logRequest(ctx, q.Collection, req)
+
+	result, err := h.service.RunQuery(ctx, q, req.DryRun, h.getAuthenticatedUser(ctx))
+	if err != nil {
+		ctx.Error(err, fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SuccessJSON(types.RunSavedQueryResponse{Data: result})
+}
+
+// applyQueryScope restricts a parsed query to the caller's access scope.
+// A replacement document gets the scope fields stamped on, since replaceOne
+// would otherwise unset them.
+func applyQueryScope(q *shell.Query, scope map[string]interface{}) error {
+	if len(scope) == 0 {
+		return nil
+	}
+	q.Filter = service.ScopeFilter(q.Filter, scope)
+	q.Pipeline = service.ScopePipeline(q.Pipeline, scope)
+	switch q.Operation {
+	case shell.OpInsertOne, shell.OpInsertMany:
+		return service.ScopeDocuments(q.Documents, scope)
+	case shell.OpReplaceOne:
+		return service.ScopeDocuments([]interface{}{q.Update}, scope)
+	case shell.OpUpdateOne, shell.OpUpdateMany, shell.OpFindOneAndUpdate:
+		return service.CheckScopedUpdate(q.Update, scope)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,45 +17,28 @@ import (
 	"github.com/saiset-co/sai-storage/types"
 )
 
-var serviceCollectionSuffixes = []string{
-	"_update_archive",
-	"_delete_archive",
-	"_create_archive",
-	"_request_logs",
-}
-
-var serviceCollectionPrefixes = []string{
-	"_admin_",
-	"system.",
-}
-
-func isServiceCollection(name string) bool {
-	for _, prefix := range serviceCollectionPrefixes {
-		if strings.HasPrefix(name, prefix) {
-			return true
-		}
-	}
-	for _, suffix := range serviceCollectionSuffixes {
-		if strings.HasSuffix(name, suffix) {
-			return true
-		}
-	}
-	return false
-}
-
 func (r *Repository) GetAdminCollectionStats(ctx context.Context) ([]types.CollectionStats, error) {
-	names, err := r.client.database.ListCollectionNames(ctx, bson.D{})
+	names, err := r.listCollectionNames(ctx)
 	if err != nil {
 		return nil, saiTypes.WrapError(err, "failed to list collections")
 	}
 
 	userNames := make([]string, 0, len(names))
 	for _, name := range names {
-		if !isServiceCollection(name) {
+		if !types.IsServiceCollection(name) {
 			userNames = append(userNames, name)
 		}
 	}
 
+	kinds := make(map[string]string, len(userNames))
+	if specs, err := r.database(ctx).ListCollectionSpecifications(ctx, bson.D{}); err == nil {
+		for _, spec := range specs {
+			if opts, err := collectionOptions(spec); err == nil {
+				kinds[spec.Name] = opts.Type()
+			}
+		}
+	}
+
 	result := make([]types.CollectionStats, len(userNames))
 	g, gctx := errgroup.WithContext(ctx)
 
@@ -62,12 +46,12 @@ func (r *Repository) GetAdminCollectionStats(ctx context.Context) ([]types.Colle
 		i, name := i, name
 		g.Go(func() error {
 			var raw bson.M
-			cmd := bson.D{{Key: "collStats", Value: name}}
-			if err := r.client.database.RunCommand(gctx, cmd).Decode(&raw); err != nil {
+			cmd := bson.D{{Key: "collStats", Value: r.collectionName(ctx, name)}}
+			if err := r.database(ctx).RunCommand(gctx, cmd).Decode(&raw); err != nil {
 				result[i] = types.CollectionStats{Name: name}
 				return nil
 			}
-			stats := types.CollectionStats{Name: name}
+			stats := types.CollectionStats{Name: name, Type: kinds[r.collectionName(ctx, name)]}
 			if v, ok := raw["count"]; ok {
 				stats.Count = toInt64(v)
 			}
@@ -92,18 +76,30 @@ func (r *Repository) GetAdminCollectionStats(ctx context.Context) ([]types.Colle
 }
 
 func (r *Repository) ListCollectionNames(ctx context.Context) ([]string, error) {
-	return r.client.database.ListCollectionNames(ctx, bson.D{})
+	return r.listCollectionNames(ctx)
 }
 
 func (r *Repository) ListIndexes(ctx context.Context, collection string) ([]types.IndexInfo, error) {
-	col := r.client.GetCollection(collection)
+	col := r.collection(ctx, collection)
 	cursor, err := col.Indexes().List(ctx)
 	if err != nil {
 		return nil, saiTypes.WrapError(err, "failed to list indexes")
 	}
 	defer cursor.Close(ctx)
 
-	var rawIndexes []bson.M
+	var rawIndexes []struct {
+		Name                    string                `bson:"name"`
+		Unique                  bool                  `bson:"unique"`
+		Sparse                  bool                  `bson:"sparse"`
+		Hidden                  bool                  `bson:"hidden"`
+		Key                     bson.D                `bson:"key"`
+		ExpireAfterSeconds      interface{}           `bson:"expireAfterSeconds"`
+		PartialFilterExpression bson.M                `bson:"partialFilterExpression"`
+		Collation               *types.IndexCollation `bson:"collation"`
+		Weights                 bson.M                `bson:"weights"`
+		DefaultLanguage         string                `bson:"default_language"`
+		WildcardProjection      bson.M                `bson:"wildcardProjection"`
+	}
 	if err := cursor.All(ctx, &rawIndexes); err != nil {
 		return nil, saiTypes.WrapError(err, "failed to decode indexes")
 	}
@@ -111,54 +107,293 @@ func (r *Repository) ListIndexes(ctx context.Context, collection string) ([]type
 	result := make([]types.IndexInfo, 0, len(rawIndexes))
 	for _, raw := range rawIndexes {
 		info := types.IndexInfo{
-			Fields: make(map[string]int),
+			Name:                    raw.Name,
+			Unique:                  raw.Unique,
+			Sparse:                  raw.Sparse,
+			Hidden:                  raw.Hidden,
+			Fields:                  make(map[string]int, len(raw.Key)),
+			OrderedKeys:             make([]types.IndexKey, 0, len(raw.Key)),
+			PartialFilterExpression: raw.PartialFilterExpression,
+			Collation:               raw.Collation,
+			Weights:                 intMap(raw.Weights),
+			DefaultLanguage:         raw.DefaultLanguage,
+			WildcardProjection:      intMap(raw.WildcardProjection),
 		}
-		if v, ok := raw["name"].(string); ok {
-			info.Name = v
+		if raw.ExpireAfterSeconds != nil {
+			ttl := int32(toInt64(raw.ExpireAfterSeconds))
+			info.ExpireAfterSeconds = &ttl
 		}
-		if v, ok := raw["unique"].(bool); ok {
-			info.Unique = v
-		}
-		if v, ok := raw["sparse"].(bool); ok {
-			info.Sparse = v
-		}
-		if key, ok := raw["key"].(bson.M); ok {
-			for field, dir := range key {
-				info.Fields[field] = int(toInt64(dir))
+		for _, key := range raw.Key {
+			indexKey := types.IndexKey{Field: key.Key, Direction: int(toInt64(key.Value))}
+			if t, ok := key.Value.(string); ok {
+				indexKey.Type = t
 			}
+			info.Fields[key.Key] = indexKey.Direction
+			info.OrderedKeys = append(info.OrderedKeys, indexKey)
 		}
 		result = append(result, info)
 	}
 	return result, nil
 }
 
+func intMap(m bson.M) map[string]int {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = int(toInt64(v))
+	}
+	return out
+}
+
+// CollectionValidator returns the validator the collection was created or
+// modified with, or nil if it has none.
+func (r *Repository) CollectionValidator(ctx context.Context, collection string) (map[string]interface{}, error) {
+	specs, err := r.database(ctx).ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: r.collectionName(ctx, collection)}})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read collection options")
+	}
+	if len(specs) == 0 || specs[0].Options == nil {
+		return nil, nil
+	}
+	var opts struct {
+		Validator map[string]interface{} `bson:"validator"`
+	}
+	if err := bson.Unmarshal(specs[0].Options, &opts); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to decode collection options")
+	}
+	return opts.Validator, nil
+}
+
 func (r *Repository) CreateIndex(ctx context.Context, req types.CreateIndexRequest) error {
-	col := r.client.GetCollection(req.Collection)
+	col := r.collection(ctx, req.Collection)
 
 	keys := make(bson.D, 0, len(req.Keys))
-	for field, dir := range req.Keys {
-		keys = append(keys, bson.E{Key: field, Value: dir})
+	if len(req.OrderedKeys) > 0 {
+		for _, key := range req.OrderedKeys {
+			if key.Type != "" {
+				keys = append(keys, bson.E{Key: key.Field, Value: key.Type})
+				continue
+			}
+			keys = append(keys, bson.E{Key: key.Field, Value: key.Direction})
+		}
+	} else {
+		fields := make([]string, 0, len(req.Keys))
+		for field := range req.Keys {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			keys = append(keys, bson.E{Key: field, Value: req.Keys[field]})
+		}
 	}
 
-	model := mongo.IndexModel{
-		Keys: keys,
-		Options: options.Index().
-			SetUnique(req.Unique).
-			SetSparse(req.Sparse),
-	}
+	opts := options.Index().
+		SetUnique(req.Unique).
+		SetSparse(req.Sparse)
 	if req.Name != "" {
-		model.Options.SetName(req.Name)
+		opts.SetName(req.Name)
+	}
+	if req.Hidden {
+		opts.SetHidden(true)
+	}
+	if req.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*req.ExpireAfterSeconds)
+	}
+	if len(req.PartialFilterExpression) > 0 {
+		opts.SetPartialFilterExpression(req.PartialFilterExpression)
+	}
+	if c := req.Collation; c != nil {
+		opts.SetCollation(&options.Collation{
+			Locale:          c.Locale,
+			CaseLevel:       c.CaseLevel,
+			CaseFirst:       c.CaseFirst,
+			Strength:        c.Strength,
+			NumericOrdering: c.NumericOrdering,
+			Alternate:       c.Alternate,
+			MaxVariable:     c.MaxVariable,
+			Backwards:       c.Backwards,
+		})
+	}
+	if len(req.Weights) > 0 {
+		opts.SetWeights(req.Weights)
+	}
+	if req.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(req.DefaultLanguage)
+	}
+	if len(req.WildcardProjection) > 0 {
+		opts.SetWildcardProjection(req.WildcardProjection)
 	}
 
-	_, err := col.Indexes().CreateOne(ctx, model)
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
 	if err != nil {
 		return saiTypes.WrapError(err, "failed to create index")
 	}
 	return nil
 }
 
+func (r *Repository) DropIndex(ctx context.Context, collection, name string) error {
+	if _, err := r.collection(ctx, collection).Indexes().DropOne(ctx, name); err != nil {
+		return saiTypes.WrapError(err, "failed to drop index")
+	}
+	return nil
+}
+
+// SetIndexHidden hides an index from the query planner, or shows it again.
+// A hidden index is still maintained, so unhiding it is immediate.
+func (r *Repository) SetIndexHidden(ctx context.Context, collection, name string, hidden bool) error {
+	err := r.database(ctx).RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: r.collectionName(ctx, collection)},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: name},
+			{Key: "hidden", Value: hidden},
+		}},
+	}).Err()
+	if err != nil {
+		return saiTypes.WrapError(err, "failed to change index visibility")
+	}
+	return nil
+}
+
+// IndexBuilds lists the index builds running on collection. currentOp
+// needs the inprog privilege on the admin database.
+func (r *Repository) IndexBuilds(ctx context.Context, collection string) ([]types.IndexBuild, error) {
+	ns := r.database(ctx).Name() + "." + r.collectionName(ctx, collection)
+	var result struct {
+		InProg []struct {
+			Command struct {
+				Indexes []struct {
+					Name string `bson:"name"`
+				} `bson:"indexes"`
+			} `bson:"command"`
+			Msg      string `bson:"msg"`
+			Progress struct {
+				Done  interface{} `bson:"done"`
+				Total interface{} `bson:"total"`
+			} `bson:"progress"`
+			SecsRunning interface{} `bson:"secs_running"`
+		} `bson:"inprog"`
+	}
+	err := r.client.client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "currentOp", Value: true},
+		{Key: "ns", Value: ns},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "command.createIndexes", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.D{{Key: "msg", Value: bson.D{{Key: "$regex", Value: "^Index Build"}}}},
+		}},
+	}).Decode(&result)
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read index builds")
+	}
+
+	builds := make([]types.IndexBuild, 0, len(result.InProg))
+	for _, op := range result.InProg {
+		build := types.IndexBuild{
+			Collection: collection,
+			Phase:      op.Msg,
+			Done:       toInt64(op.Progress.Done),
+			Total:      toInt64(op.Progress.Total),
+			Seconds:    toInt64(op.SecsRunning),
+		}
+		for _, index := range op.Command.Indexes {
+			build.Indexes = append(build.Indexes, index.Name)
+		}
+		builds = append(builds, build)
+	}
+	return builds, nil
+}
+
+// IndexUsage reads $indexStats and the index sizes of collStats. On a
+// replica set or sharded cluster the counters of all members are added up,
+// counting from the earliest start.
+func (r *Repository) IndexUsage(ctx context.Context, collection string) ([]types.IndexUsage, error) {
+	col := r.collection(ctx, collection)
+	cursor, err := col.Aggregate(ctx, mongo.Pipeline{{{Key: "$indexStats", Value: bson.D{}}}})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read index stats")
+	}
+	var stats []struct {
+		Name     string `bson:"name"`
+		Accesses struct {
+			Ops   interface{} `bson:"ops"`
+			Since time.Time   `bson:"since"`
+		} `bson:"accesses"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to decode index stats")
+	}
+
+	var raw bson.M
+	cmd := bson.D{{Key: "collStats", Value: r.collectionName(ctx, collection)}}
+	if err := r.database(ctx).RunCommand(ctx, cmd).Decode(&raw); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read collection stats")
+	}
+	sizes, _ := raw["indexSizes"].(bson.M)
+
+	byName := make(map[string]*types.IndexUsage, len(stats))
+	var result []types.IndexUsage
+	for _, s := range stats {
+		usage, ok := byName[s.Name]
+		if !ok {
+			result = append(result, types.IndexUsage{Name: s.Name, Since: s.Accesses.Since, Size: toInt64(sizes[s.Name])})
+			usage = &result[len(result)-1]
+			byName[s.Name] = usage
+		} else if s.Accesses.Since.Before(usage.Since) {
+			usage.Since = s.Accesses.Since
+		}
+		usage.Ops += toInt64(s.Accesses.Ops)
+	}
+	return result, nil
+}
+
+const retentionTTLIndex = "retention_ttl"
+
+// EnsureTTLIndex creates the retention TTL index on field or updates its
+// expiry in place when the policy changed.
+func (r *Repository) EnsureTTLIndex(ctx context.Context, collection, field string, expireAfterSeconds int32) error {
+	col := r.collection(ctx, collection)
+
+	cursor, err := col.Indexes().List(ctx)
+	if err != nil {
+		return saiTypes.WrapError(err, "failed to list indexes")
+	}
+	var indexes []bson.M
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return saiTypes.WrapError(err, "failed to decode indexes")
+	}
+	for _, idx := range indexes {
+		if idx["name"] != retentionTTLIndex {
+			continue
+		}
+		if toInt64(idx["expireAfterSeconds"]) == int64(expireAfterSeconds) {
+			return nil
+		}
+		err := r.database(ctx).RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: r.collectionName(ctx, collection)},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: retentionTTLIndex},
+				{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+			}},
+		}).Err()
+		if err != nil {
+			return saiTypes.WrapError(err, "failed to update ttl index")
+		}
+		return nil
+	}
+
+	_, err = col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(retentionTTLIndex).SetExpireAfterSeconds(expireAfterSeconds),
+	})
+	if err != nil {
+		return saiTypes.WrapError(err, "failed to create ttl index")
+	}
+	return nil
+}
+
 func (r *Repository) GetSlowQueries(ctx context.Context, limit int) ([]types.SlowQuery, error) {
-	col := r.client.database.Collection("_admin_slow_queries")
+	col := r.collection(ctx, "_admin_slow_queries")
 
 	opts := options.Find().
 		SetSort(bson.D{{Key: "ts", Value: -1}}).
@@ -185,6 +420,21 @@ func (r *Repository) GetSlowQueries(ctx context.Context, limit int) ([]types.Slo
 			sq.Op = v
 		}
 		sq.DurationMs = toInt64(entry["duration_ms"])
+		sq.KeysExamined = toInt64(entry["keys_examined"])
+		sq.DocsExamined = toInt64(entry["docs_examined"])
+		if v, ok := entry["plan_summary"].(string); ok {
+			sq.PlanSummary = v
+		}
+		if v, ok := entry["operation_id"].(string); ok {
+			sq.OperationID = v
+		}
+		if stages, ok := entry["plan_stages"].(bson.A); ok {
+			for _, st := range stages {
+				if s, ok := st.(string); ok {
+					sq.PlanStages = append(sq.PlanStages, s)
+				}
+			}
+		}
 		sq.Timestamp = time.Unix(0, toInt64(entry["ts"]))
 		if fk, ok := entry["filter_keys"].(bson.A); ok {
 			for _, k := range fk {
@@ -199,7 +449,7 @@ func (r *Repository) GetSlowQueries(ctx context.Context, limit int) ([]types.Slo
 }
 
 func (r *Repository) GetArchiveGroups(ctx context.Context, collection, search string, skip, limit int) ([]types.ArchiveGroup, int64, error) {
-	col := r.client.database.Collection(collection)
+	col := r.collection(ctx, collection)
 
 	matchFilter := bson.D{
 		{Key: "archive_operation_id", Value: bson.D{
@@ -269,21 +519,28 @@ func (r *Repository) GetArchiveGroups(ctx context.Context, collection, search st
 	return result, total, nil
 }
 
-func (r *Repository) LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string) error {
-	col := r.client.database.Collection("_admin_slow_queries")
+func (r *Repository) LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string, plan *types.QueryPlan) error {
+	col := r.collection(ctx, "_admin_slow_queries")
 	doc := bson.M{
-		"collection":         collection,
-		"operation":          operation,
-		"duration_ms":        durationMs,
-		"docs_count":         docsCount,
-		"filter_keys":        filterKeys,
-		"sort_keys":          sortKeys,
-		"filter_fingerprint": slowQueryFingerprint(filterKeys),
-		"ts":                 time.Now().UnixNano(),
+		"collection":             collection,
+		"operation":              operation,
+		"duration_ms":            durationMs,
+		"docs_count":             docsCount,
+		"filter_keys":            filterKeys,
+		"sort_keys":              sortKeys,
+		"filter_fingerprint":     slowQueryFingerprint(filterKeys),
+		"ts":                     time.Now().UnixNano(),
+		types.RetentionTimeField: time.Now(),
 	}
 	if operationID != "" {
 		doc["operation_id"] = operationID
 	}
+	if plan != nil {
+		doc["plan_summary"] = plan.PlanSummary
+		doc["keys_examined"] = plan.KeysExamined
+		doc["docs_examined"] = plan.DocsExamined
+		doc["plan_stages"] = plan.Stages
+	}
 	_, err := col.InsertOne(ctx, doc)
 	return err
 }
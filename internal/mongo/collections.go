@@ -0,0 +1,193 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// copyBatchSize is how many documents CopyCollection inserts at once.
+const copyBatchSize = 1000
+
+func (r *Repository) CreateCollection(ctx context.Context, collection string, opts types.CollectionOptions) error {
+	create := options.CreateCollection()
+	switch {
+	case opts.Capped:
+		create.SetCapped(true).SetSizeInBytes(opts.Size)
+		if opts.Max > 0 {
+			create.SetMaxDocuments(opts.Max)
+		}
+	case opts.TimeSeries != nil:
+		ts := options.TimeSeries().SetTimeField(opts.TimeSeries.TimeField)
+		if opts.TimeSeries.MetaField != "" {
+			ts.SetMetaField(opts.TimeSeries.MetaField)
+		}
+		if opts.TimeSeries.Granularity != "" {
+			ts.SetGranularity(opts.TimeSeries.Granularity)
+		}
+		create.SetTimeSeriesOptions(ts)
+	case opts.Clustered:
+		create.SetClusteredIndex(bson.D{
+			{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}},
+			{Key: "unique", Value: true},
+		})
+	}
+	if opts.ExpireAfterSeconds > 0 {
+		create.SetExpireAfterSeconds(opts.ExpireAfterSeconds)
+	}
+	if err := r.database(ctx).CreateCollection(ctx, r.collectionName(ctx, collection), create); err != nil {
+		return saiTypes.WrapError(err, "failed to create collection")
+	}
+	return nil
+}
+
+// CollectionOptions reads the options a collection was created with.
+func (r *Repository) CollectionOptions(ctx context.Context, collection string) (types.CollectionOptions, error) {
+	specs, err := r.database(ctx).ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: r.collectionName(ctx, collection)}})
+	if err != nil {
+		return types.CollectionOptions{}, saiTypes.WrapError(err, "failed to read collection options")
+	}
+	if len(specs) == 0 {
+		return types.CollectionOptions{}, saiTypes.NewErrorf("collection %q not found", collection)
+	}
+	return collectionOptions(specs[0])
+}
+
+func collectionOptions(spec *mongo.CollectionSpecification) (types.CollectionOptions, error) {
+	var opts types.CollectionOptions
+	if spec.Options == nil {
+		return opts, nil
+	}
+	var raw struct {
+		Capped     bool        `bson:"capped"`
+		Size       interface{} `bson:"size"`
+		Max        interface{} `bson:"max"`
+		TimeSeries *struct {
+			TimeField   string `bson:"timeField"`
+			MetaField   string `bson:"metaField"`
+			Granularity string `bson:"granularity"`
+		} `bson:"timeseries"`
+		ClusteredIndex     interface{} `bson:"clusteredIndex"`
+		ExpireAfterSeconds interface{} `bson:"expireAfterSeconds"`
+	}
+	if err := bson.Unmarshal(spec.Options, &raw); err != nil {
+		return opts, saiTypes.WrapError(err, "failed to decode collection options")
+	}
+	switch {
+	case raw.TimeSeries != nil:
+		opts.TimeSeries = &types.TimeSeriesOptions{
+			TimeField:   raw.TimeSeries.TimeField,
+			MetaField:   raw.TimeSeries.MetaField,
+			Granularity: raw.TimeSeries.Granularity,
+		}
+	case raw.Capped:
+		opts.Capped = true
+		opts.Size = toInt64(raw.Size)
+		opts.Max = toInt64(raw.Max)
+	case raw.ClusteredIndex != nil:
+		opts.Clustered = true
+	}
+	opts.ExpireAfterSeconds = toInt64(raw.ExpireAfterSeconds)
+	return opts, nil
+}
+
+// SetCollectionExpiry changes expireAfterSeconds of a time-series or
+// clustered collection; 0 turns expiry off.
+func (r *Repository) SetCollectionExpiry(ctx context.Context, collection string, seconds int64) error {
+	var expire interface{} = seconds
+	if seconds <= 0 {
+		expire = "off"
+	}
+	cmd := bson.D{
+		{Key: "collMod", Value: r.collectionName(ctx, collection)},
+		{Key: "expireAfterSeconds", Value: expire},
+	}
+	if err := r.database(ctx).RunCommand(ctx, cmd).Err(); err != nil {
+		return saiTypes.WrapError(err, "failed to change collection expiry")
+	}
+	return nil
+}
+
+// RenameCollection renames within the tenant's database; it fails if to
+// already exists.
+func (r *Repository) RenameCollection(ctx context.Context, from, to string) error {
+	db := r.database(ctx)
+	cmd := bson.D{
+		{Key: "renameCollection", Value: db.Name() + "." + r.collectionName(ctx, from)},
+		{Key: "to", Value: db.Name() + "." + r.collectionName(ctx, to)},
+	}
+	if err := r.client.client.Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+		return saiTypes.WrapError(err, "failed to rename collection")
+	}
+	return nil
+}
+
+func (r *Repository) DropCollection(ctx context.Context, collection string) error {
+	if err := r.collection(ctx, collection).Drop(ctx); err != nil {
+		return saiTypes.WrapError(err, "failed to drop collection")
+	}
+	return nil
+}
+
+// TruncateCollection deletes every document and keeps the collection with
+// its options and indexes.
+func (r *Repository) TruncateCollection(ctx context.Context, collection string) (int64, error) {
+	result, err := r.collection(ctx, collection).DeleteMany(ctx, bson.D{})
+	if err != nil {
+		return 0, saiTypes.WrapError(err, "failed to truncate collection")
+	}
+	return result.DeletedCount, nil
+}
+
+// CopyCollection inserts every document of from into to, unchanged and in
+// batches. to must exist with the options it should have.
+func (r *Repository) CopyCollection(ctx context.Context, from, to string) (int64, error) {
+	cursor, err := r.collection(ctx, from).Find(ctx, bson.D{}, options.Find().SetBatchSize(copyBatchSize))
+	if err != nil {
+		return 0, saiTypes.WrapError(err, "failed to read collection")
+	}
+	defer cursor.Close(ctx)
+
+	target := r.collection(ctx, to)
+	batch := make([]interface{}, 0, copyBatchSize)
+	var copied int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := target.InsertMany(ctx, batch); err != nil {
+			return saiTypes.WrapError(validationDetails(err), "failed to copy documents")
+		}
+		copied += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	for cursor.Next(ctx) {
+		batch = append(batch, bson.Raw(append([]byte(nil), cursor.Current...)))
+		if len(batch) == copyBatchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return copied, saiTypes.WrapError(err, "failed to read collection")
+	}
+	return copied, flush()
+}
+
+func (r *Repository) ConvertToCapped(ctx context.Context, collection string, size int64) error {
+	cmd := bson.D{
+		{Key: "convertToCapped", Value: r.collectionName(ctx, collection)},
+		{Key: "size", Value: size},
+	}
+	if err := r.database(ctx).RunCommand(ctx, cmd).Err(); err != nil {
+		return saiTypes.WrapError(err, "failed to convert collection to capped")
+	}
+	return nil
+}
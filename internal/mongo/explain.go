@@ -0,0 +1,132 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// Explain runs Mongo's explain with executionStats verbosity. The query is
+// executed by the planner but nothing is returned or written.
+func (r *Repository) Explain(ctx context.Context, request types.ExplainRequest) (types.QueryPlan, error) {
+	name := r.collectionName(ctx, request.Collection)
+	filter := request.Filter
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+
+	var command bson.D
+	if request.Operation == "aggregate" {
+		if len(request.Pipeline) == 0 {
+			return types.QueryPlan{}, saiTypes.NewError("pipeline is required for aggregate explain")
+		}
+		pipeline := make([]interface{}, 0, len(request.Pipeline))
+		for _, stage := range request.Pipeline {
+			pipeline = append(pipeline, stage)
+		}
+		pipeline, err := r.tenantPipeline(ctx, pipeline)
+		if err != nil {
+			return types.QueryPlan{}, err
+		}
+		command = bson.D{{Key: "aggregate", Value: name}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.D{}}}
+	} else {
+		command = bson.D{{Key: "find", Value: name}, {Key: "filter", Value: filter}}
+		if len(request.Sort) > 0 {
+			command = append(command, bson.E{Key: "sort", Value: request.Sort})
+		}
+		if request.Skip > 0 {
+			command = append(command, bson.E{Key: "skip", Value: int64(request.Skip)})
+		}
+		if request.Limit > 0 {
+			command = append(command, bson.E{Key: "limit", Value: int64(request.Limit)})
+		}
+	}
+
+	var raw bson.M
+	err := r.database(ctx).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "executionStats"},
+	}).Decode(&raw)
+	if err != nil {
+		return types.QueryPlan{}, saiTypes.WrapError(err, "failed to explain query")
+	}
+	return parseExplain(raw), nil
+}
+
+// parseExplain reduces explain output to a QueryPlan. It handles find
+// output, aggregate output with a leading $cursor stage, and the slot-based
+// engine which nests the plan under queryPlan.
+func parseExplain(raw bson.M) types.QueryPlan {
+	planner, _ := raw["queryPlanner"].(bson.M)
+	stats, _ := raw["executionStats"].(bson.M)
+	if planner == nil {
+		if stages, ok := raw["stages"].(bson.A); ok && len(stages) > 0 {
+			if first, ok := stages[0].(bson.M); ok {
+				if cursor, ok := first["$cursor"].(bson.M); ok {
+					planner, _ = cursor["queryPlanner"].(bson.M)
+					stats, _ = cursor["executionStats"].(bson.M)
+				}
+			}
+		}
+	}
+
+	var plan types.QueryPlan
+	if planner != nil {
+		winning, _ := planner["winningPlan"].(bson.M)
+		if inner, ok := winning["queryPlan"].(bson.M); ok {
+			winning = inner
+		}
+		if winning != nil {
+			plan.WinningPlan = winning
+			walkPlan(winning, &plan)
+		}
+	}
+	if stats != nil {
+		plan.KeysExamined = toInt64(stats["totalKeysExamined"])
+		plan.DocsExamined = toInt64(stats["totalDocsExamined"])
+		plan.Returned = toInt64(stats["nReturned"])
+		plan.ExecutionTimeMs = toInt64(stats["executionTimeMillis"])
+	}
+	plan.PlanSummary = planSummary(plan)
+	return plan
+}
+
+func walkPlan(stage bson.M, plan *types.QueryPlan) {
+	if name, ok := stage["stage"].(string); ok {
+		plan.Stages = append(plan.Stages, name)
+	}
+	if index, ok := stage["indexName"].(string); ok {
+		plan.Indexes = append(plan.Indexes, index)
+	}
+	if input, ok := stage["inputStage"].(bson.M); ok {
+		walkPlan(input, plan)
+	}
+	if inputs, ok := stage["inputStages"].(bson.A); ok {
+		for _, item := range inputs {
+			if input, ok := item.(bson.M); ok {
+				walkPlan(input, plan)
+			}
+		}
+	}
+}
+
+// planSummary mimics the planSummary field of Mongo's slow query log:
+// "IXSCAN idx_a, idx_b", "COLLSCAN" or the innermost stage name.
+func planSummary(plan types.QueryPlan) string {
+	if len(plan.Indexes) > 0 {
+		return "IXSCAN " + strings.Join(plan.Indexes, ", ")
+	}
+	for _, stage := range plan.Stages {
+		if stage == "COLLSCAN" {
+			return stage
+		}
+	}
+	if len(plan.Stages) > 0 {
+		return plan.Stages[len(plan.Stages)-1]
+	}
+	return ""
+}
@@ -3,21 +3,30 @@ package mongo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/saiset-co/sai-service/sai"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	saiTypes "github.com/saiset-co/sai-service/types"
 	"github.com/saiset-co/sai-storage/types"
 )
 
+// documentValidationFailure is the server error code of a write rejected by
+// the collection validator.
+const documentValidationFailure = 121
+
 type Repository struct {
-	client *Client
+	client  *Client
+	tenancy types.TenancyConfig
 }
 
 func NewRepository() (types.StorageRepository, error) {
@@ -27,6 +36,9 @@ func NewRepository() (types.StorageRepository, error) {
 		return nil, err
 	}
 
+	var tenancy types.TenancyConfig
+	_ = sai.Config().GetAs("storage.features.tenancy", &tenancy)
+
 	client, err := NewClient(mongoConfig)
 	if err != nil {
 		return nil, err
@@ -35,7 +47,8 @@ func NewRepository() (types.StorageRepository, error) {
 	uuid.EnableRandPool()
 
 	return &Repository{
-		client: client,
+		client:  client,
+		tenancy: tenancy,
 	}, nil
 }
 
@@ -44,7 +57,7 @@ func (r *Repository) CreateDocuments(ctx context.Context, request types.CreateDo
 		return []string{}, nil
 	}
 
-	coll := r.client.GetCollection(request.Collection)
+	coll := r.collection(ctx, request.Collection)
 
 	var counter int64
 
@@ -65,7 +78,7 @@ func (r *Repository) CreateDocuments(ctx context.Context, request types.CreateDo
 
 	result, err := coll.InsertMany(ctx, request.Data)
 	if err != nil {
-		return nil, saiTypes.WrapError(err, "failed to insert documents")
+		return nil, saiTypes.WrapError(validationDetails(err), "failed to insert documents")
 	}
 
 	ids := make([]string, len(result.InsertedIDs))
@@ -84,31 +97,9 @@ func (r *Repository) CreateDocuments(ctx context.Context, request types.CreateDo
 }
 
 func (r *Repository) ReadDocuments(ctx context.Context, request types.ReadDocumentsRequest) ([]map[string]interface{}, int64, error) {
-	coll := r.client.GetCollection(request.Collection)
-
-	findOptions := options.Find()
-
-	if len(request.Sort) > 0 {
-		findOptions.SetSort(request.Sort)
-	}
+	coll := r.collection(ctx, request.Collection)
 
-	if request.Limit > 0 {
-		findOptions.SetLimit(int64(request.Limit))
-	}
-
-	if request.Skip > 0 {
-		findOptions.SetSkip(int64(request.Skip))
-	}
-
-	if len(request.Fields) > 0 {
-		projection := make(map[string]int)
-		for _, field := range request.Fields {
-			projection[field] = 1
-		}
-		findOptions.SetProjection(projection)
-	}
-
-	cursor, err := coll.Find(ctx, request.Filter, findOptions)
+	cursor, err := coll.Find(ctx, request.Filter, readOptions(request))
 	if err != nil {
 		return nil, 0, saiTypes.WrapError(err, "failed to find documents")
 	}
@@ -133,17 +124,73 @@ func (r *Repository) ReadDocuments(ctx context.Context, request types.ReadDocume
 	return results, total, nil
 }
 
+func (r *Repository) ForEachDocument(ctx context.Context, request types.ReadDocumentsRequest, batchSize int, fn func(map[string]interface{}) error) error {
+	findOptions := readOptions(request)
+	if batchSize > 0 {
+		findOptions.SetBatchSize(int32(batchSize))
+	}
+	cursor, err := r.collection(ctx, request.Collection).Find(ctx, request.Filter, findOptions)
+	if err != nil {
+		return saiTypes.WrapError(err, "failed to find documents")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc map[string]interface{}
+		if err := cursor.Decode(&doc); err != nil {
+			return saiTypes.WrapError(err, "failed to decode document")
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return saiTypes.WrapError(err, "failed to read documents")
+	}
+	return nil
+}
+
+// readOptions turns the sort, paging and fields of a find into options.
+func readOptions(request types.ReadDocumentsRequest) *options.FindOptions {
+	findOptions := options.Find()
+
+	if len(request.Sort) > 0 {
+		findOptions.SetSort(request.Sort)
+	}
+
+	if request.Limit > 0 {
+		findOptions.SetLimit(int64(request.Limit))
+	}
+
+	if request.Skip > 0 {
+		findOptions.SetSkip(int64(request.Skip))
+	}
+
+	if len(request.Fields) > 0 {
+		projection := make(map[string]int)
+		for _, field := range request.Fields {
+			projection[field] = 1
+		}
+		findOptions.SetProjection(projection)
+	}
+	return findOptions
+}
+
 func (r *Repository) AggregateDocuments(ctx context.Context, request types.AggregateDocumentsRequest) ([]map[string]interface{}, int64, error) {
 	if len(request.Pipeline) == 0 {
 		return nil, 0, saiTypes.NewError("pipeline is required for mongo aggregate")
 	}
 
-	coll := r.client.GetCollection(request.Collection)
+	coll := r.collection(ctx, request.Collection)
 
 	pipeline := make([]interface{}, 0, len(request.Pipeline)+2)
 	for _, stage := range request.Pipeline {
 		pipeline = append(pipeline, stage)
 	}
+	pipeline, err := r.tenantPipeline(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	if request.Skip > 0 {
 		pipeline = append(pipeline, bson.M{"$skip": request.Skip})
@@ -170,6 +217,10 @@ func (r *Repository) AggregateDocuments(ctx context.Context, request types.Aggre
 		for _, stage := range request.Pipeline {
 			countPipeline = append(countPipeline, stage)
 		}
+		countPipeline, err = r.tenantPipeline(ctx, countPipeline)
+		if err != nil {
+			return nil, 0, err
+		}
 		countPipeline = append(countPipeline, bson.M{"$count": "total"})
 		countCursor, err := coll.Aggregate(ctx, countPipeline)
 		if err != nil {
@@ -201,7 +252,7 @@ func (r *Repository) AggregateDocuments(ctx context.Context, request types.Aggre
 }
 
 func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDocumentsRequest) (int64, error) {
-	coll := r.client.GetCollection(request.Collection)
+	coll := r.collection(ctx, request.Collection)
 	_options := &options.UpdateOptions{}
 
 	if request.Upsert {
@@ -215,50 +266,120 @@ func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDo
 		return 0, saiTypes.NewError("update data must be a map")
 	}
 
+	chTime := time.Now().UnixNano() + atomic.AddInt64(&counter, 1)
 	if setOp, exists := data["$set"]; exists {
 		if setMap, ok := setOp.(map[string]interface{}); ok {
 			delete(setMap, "internal_id")
-			setMap["ch_time"] = time.Now().UnixNano() + atomic.AddInt64(&counter, 1)
-			if request.Upsert {
-				if setMap["internal_id"] == nil || setMap["internal_id"] == "" {
-					setMap["internal_id"] = uuid.New().String()
-				}
-				if setMap["cr_time"] == nil {
-					setMap["cr_time"] = setMap["ch_time"]
-				}
-			}
+			setMap["ch_time"] = chTime
 		}
+	} else if hasUpdateOperators(data) {
+		data["$set"] = map[string]interface{}{"ch_time": chTime}
 	} else {
 		setMap := data
 		delete(setMap, "internal_id")
-		setMap["ch_time"] = time.Now().UnixNano() + atomic.AddInt64(&counter, 1)
-		if request.Upsert {
-			if setMap["internal_id"] == nil || setMap["internal_id"] == "" {
-				setMap["internal_id"] = uuid.New().String()
-			}
-			if setMap["cr_time"] == nil {
-				setMap["cr_time"] = setMap["ch_time"]
-			}
-		}
+		setMap["ch_time"] = chTime
 		data = map[string]interface{}{"$set": setMap}
 	}
 
-	if setOnInsert, exists := data["$setOnInsert"]; exists {
-		if setOnInsertMap, ok := setOnInsert.(map[string]interface{}); ok {
-			delete(setOnInsertMap, "internal_id")
+	setOnInsertMap, _ := data["$setOnInsert"].(map[string]interface{})
+	if setOnInsertMap != nil {
+		delete(setOnInsertMap, "internal_id")
+	}
+
+	// Identity and creation time only apply to a document the upsert inserts;
+	// putting them in $set would rewrite them on every matched document.
+	if request.Upsert {
+		if setOnInsertMap == nil {
+			setOnInsertMap = map[string]interface{}{}
+			data["$setOnInsert"] = setOnInsertMap
+		}
+		internalID := request.UpsertID
+		if internalID == "" {
+			internalID = uuid.New().String()
+		}
+		setOnInsertMap["internal_id"] = internalID
+		setMap, _ := data["$set"].(map[string]interface{})
+		if _, ok := setMap["cr_time"]; !ok {
+			if _, ok := setOnInsertMap["cr_time"]; !ok {
+				setOnInsertMap["cr_time"] = chTime
+			}
 		}
 	}
 
 	result, err := coll.UpdateMany(ctx, request.Filter, data, _options)
 	if err != nil {
-		return 0, saiTypes.WrapError(err, "mongo failed to update documents")
+		return 0, saiTypes.WrapError(validationDetails(err), "mongo failed to update documents")
 	}
 
 	return result.ModifiedCount, nil
 }
 
+// BulkUpsert applies all operations in one unordered bulk write. Metadata is
+// only added when an operation inserts a new document.
+func (r *Repository) BulkUpsert(ctx context.Context, collection string, operations []types.UpsertOperation) error {
+	if len(operations) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	models := make([]mongo.WriteModel, 0, len(operations))
+	for i, op := range operations {
+		update := make(map[string]interface{}, len(op.Update)+1)
+		for k, v := range op.Update {
+			update[k] = v
+		}
+
+		setMap := map[string]interface{}{}
+		if existing, ok := update["$set"].(map[string]interface{}); ok {
+			for k, v := range existing {
+				setMap[k] = v
+			}
+		}
+		setMap["ch_time"] = now + int64(i)
+		update["$set"] = setMap
+
+		setOnInsert := map[string]interface{}{}
+		if existing, ok := update["$setOnInsert"].(map[string]interface{}); ok {
+			for k, v := range existing {
+				setOnInsert[k] = v
+			}
+		}
+		setOnInsert["internal_id"] = uuid.New().String()
+		setOnInsert["cr_time"] = now + int64(i)
+		update["$setOnInsert"] = setOnInsert
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(op.Filter).SetUpdate(update).SetUpsert(true))
+	}
+
+	_, err := r.collection(ctx, collection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return saiTypes.WrapError(err, "mongo failed to bulk upsert documents")
+	}
+	return nil
+}
+
+// BulkPatch updates the documents matching each filter in one unordered
+// bulk write, exactly as given: no metadata is added and nothing is
+// inserted. It completes and marks service records such as archive entries.
+func (r *Repository) BulkPatch(ctx context.Context, collection string, operations []types.UpsertOperation) error {
+	if len(operations) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(operations))
+	for _, op := range operations {
+		models = append(models, mongo.NewUpdateManyModel().SetFilter(op.Filter).SetUpdate(op.Update))
+	}
+
+	_, err := r.collection(ctx, collection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return saiTypes.WrapError(err, "mongo failed to bulk patch documents")
+	}
+	return nil
+}
+
 func (r *Repository) DeleteDocuments(ctx context.Context, request types.DeleteDocumentsRequest) (int64, error) {
-	coll := r.client.GetCollection(request.Collection)
+	coll := r.collection(ctx, request.Collection)
 
 	result, err := coll.DeleteMany(ctx, request.Filter)
 	if err != nil {
@@ -272,6 +393,15 @@ func (r *Repository) Close(ctx context.Context) error {
 	return r.client.Close(ctx)
 }
 
+func hasUpdateOperators(data map[string]interface{}) bool {
+	for key := range data {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
 func normalizeDocumentMap(data interface{}) (map[string]interface{}, error) {
 	if data == nil {
 		return nil, saiTypes.NewError("data must be a map")
@@ -302,7 +432,27 @@ func normalizeNestedMap(data map[string]interface{}) map[string]interface{} {
 	return normalized
 }
 
+// normalizeNestedValue turns a value into plain maps and slices. BSON values
+// are kept as they are, so ObjectIDs, dates, Int64 and Decimal128 are stored
+// with their type; anything else goes through JSON.
 func normalizeNestedValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, float64, int32, int64, time.Time,
+		primitive.ObjectID, primitive.DateTime, primitive.Decimal128, primitive.Timestamp,
+		primitive.Binary, primitive.Regex, primitive.MinKey, primitive.MaxKey:
+		return v
+	case map[string]interface{}:
+		return normalizeNestedMap(v)
+	case primitive.M:
+		return normalizeNestedMap(v)
+	case primitive.D:
+		return normalizeNestedMap(v.Map())
+	case []interface{}:
+		return normalizeNestedSlice(v)
+	case primitive.A:
+		return normalizeNestedSlice(v)
+	}
+
 	raw, err := json.Marshal(value)
 	if err != nil {
 		return value
@@ -315,3 +465,36 @@ func normalizeNestedValue(value interface{}) interface{} {
 
 	return normalized
 }
+
+func normalizeNestedSlice(values []interface{}) []interface{} {
+	normalized := make([]interface{}, len(values))
+	for i, value := range values {
+		normalized[i] = normalizeNestedValue(value)
+	}
+	return normalized
+}
+
+// validationDetails adds the reason MongoDB gives when a document fails the
+// collection validator to err.
+func validationDetails(err error) error {
+	var writeErrors mongo.WriteErrors
+	var we mongo.WriteException
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &we) {
+		writeErrors = we.WriteErrors
+	} else if errors.As(err, &bwe) {
+		for _, e := range bwe.WriteErrors {
+			writeErrors = append(writeErrors, e.WriteError)
+		}
+	}
+	var details []string
+	for _, e := range writeErrors {
+		if e.Code == documentValidationFailure && e.Details != nil {
+			details = append(details, e.Details.String())
+		}
+	}
+	if len(details) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, strings.Join(details, "; "))
+}
@@ -0,0 +1,246 @@
+package mongo
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// database returns the database holding the tenant's collections: a dedicated
+// "<database>_<tenant>" database in database mode, the shared one otherwise.
+func (r *Repository) database(ctx context.Context) *mongo.Database {
+	if tenant := types.TenantFromContext(ctx); tenant != "" && r.tenancy.Mode == types.TenancyModeDatabase {
+		return r.client.client.Database(r.tenantDatabaseName(tenant))
+	}
+	return r.client.database
+}
+
+func (r *Repository) tenantDatabaseName(tenant string) string {
+	return r.client.config.Database + "_" + tenant
+}
+
+// collectionName maps a logical collection name to its physical name.
+func (r *Repository) collectionName(ctx context.Context, name string) string {
+	if r.tenancy.Mode == types.TenancyModeDatabase {
+		return name
+	}
+	return types.TenantCollection(types.TenantFromContext(ctx), name)
+}
+
+func (r *Repository) collection(ctx context.Context, name string) *mongo.Collection {
+	return r.database(ctx).Collection(r.collectionName(ctx, name))
+}
+
+// listCollectionNames returns the logical names of the collections visible to
+// the tenant in ctx. Without a tenant in prefix mode, collections belonging to
+// tenants are hidden from the shared namespace.
+func (r *Repository) listCollectionNames(ctx context.Context) ([]string, error) {
+	tenant := types.TenantFromContext(ctx)
+	if !r.tenancy.Enabled || r.tenancy.Mode == types.TenancyModeDatabase {
+		return r.database(ctx).ListCollectionNames(ctx, bson.D{})
+	}
+
+	filter := bson.D{}
+	if tenant != "" {
+		prefix := types.TenantCollection(tenant, "")
+		filter = bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^" + regexp.QuoteMeta(prefix)}}}}
+	}
+	names, err := r.client.database.ListCollectionNames(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		owner, logical, ok := types.SplitTenantCollection(name)
+		if tenant == "" && !ok {
+			result = append(result, name)
+		} else if tenant != "" && ok && owner == tenant {
+			result = append(result, logical)
+		}
+	}
+	return result, nil
+}
+
+func (r *Repository) ListTenants(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+
+	if r.tenancy.Mode == types.TenancyModeDatabase {
+		prefix := r.client.config.Database + "_"
+		names, err := r.client.client.ListDatabaseNames(ctx, bson.D{
+			{Key: "name", Value: bson.D{{Key: "$regex", Value: "^" + regexp.QuoteMeta(prefix)}}},
+		})
+		if err != nil {
+			return nil, saiTypes.WrapError(err, "failed to list tenant databases")
+		}
+		for _, name := range names {
+			if tenant := strings.TrimPrefix(name, prefix); types.ValidTenantID(tenant) {
+				seen[tenant] = struct{}{}
+			}
+		}
+	} else {
+		names, err := r.client.database.ListCollectionNames(ctx, bson.D{})
+		if err != nil {
+			return nil, saiTypes.WrapError(err, "failed to list collections")
+		}
+		for _, name := range names {
+			if tenant, _, ok := types.SplitTenantCollection(name); ok {
+				seen[tenant] = struct{}{}
+			}
+		}
+	}
+
+	tenants := make([]string, 0, len(seen))
+	for tenant := range seen {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// tenantPipeline rewrites the collections referenced by $lookup, $graphLookup,
+// $unionWith, $out and $merge to the tenant's physical names. Stages naming
+// a database are rejected so a pipeline cannot leave its namespace.
+func (r *Repository) tenantPipeline(ctx context.Context, pipeline []interface{}) ([]interface{}, error) {
+	if !r.tenancy.Enabled {
+		return pipeline, nil
+	}
+
+	out := make([]interface{}, 0, len(pipeline))
+	for _, stage := range pipeline {
+		doc, ok := stage.(bson.D)
+		if !ok {
+			out = append(out, stage)
+			continue
+		}
+		rewritten, err := r.tenantStage(ctx, doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rewritten)
+	}
+	return out, nil
+}
+
+func (r *Repository) tenantStage(ctx context.Context, stage bson.D) (bson.D, error) {
+	result := make(bson.D, 0, len(stage))
+	for _, elem := range stage {
+		value := elem.Value
+		var err error
+		switch elem.Key {
+		case "$lookup", "$graphLookup":
+			value, err = r.tenantStageDoc(ctx, value, "from")
+		case "$unionWith":
+			if name, ok := value.(string); ok {
+				value = r.collectionName(ctx, name)
+			} else {
+				value, err = r.tenantStageDoc(ctx, value, "coll")
+			}
+		case "$out":
+			if name, ok := value.(string); ok {
+				value = r.collectionName(ctx, name)
+			} else {
+				value, err = r.tenantStageDoc(ctx, value, "coll")
+			}
+		case "$merge":
+			value, err = r.tenantMerge(ctx, value)
+		case "$facet":
+			value, err = r.tenantFacet(ctx, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, bson.E{Key: elem.Key, Value: value})
+	}
+	return result, nil
+}
+
+// tenantStageDoc rewrites the collection field of a stage document and any
+// nested "pipeline" it carries.
+func (r *Repository) tenantStageDoc(ctx context.Context, value interface{}, field string) (interface{}, error) {
+	doc, ok := value.(bson.D)
+	if !ok {
+		return value, nil
+	}
+	result := make(bson.D, 0, len(doc))
+	for _, elem := range doc {
+		switch elem.Key {
+		case "db":
+			return nil, saiTypes.NewError("pipeline stages naming a database are not allowed when tenancy is enabled")
+		case field:
+			switch v := elem.Value.(type) {
+			case string:
+				elem.Value = r.collectionName(ctx, v)
+			case bson.D:
+				rewritten, err := r.tenantStageDoc(ctx, v, "coll")
+				if err != nil {
+					return nil, err
+				}
+				elem.Value = rewritten
+			}
+		case "pipeline":
+			if sub, ok := elem.Value.(bson.A); ok {
+				rewritten, err := r.tenantPipeline(ctx, []interface{}(sub))
+				if err != nil {
+					return nil, err
+				}
+				elem.Value = bson.A(rewritten)
+			}
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+func (r *Repository) tenantMerge(ctx context.Context, value interface{}) (interface{}, error) {
+	if name, ok := value.(string); ok {
+		return r.collectionName(ctx, name), nil
+	}
+	doc, ok := value.(bson.D)
+	if !ok {
+		return value, nil
+	}
+	result := make(bson.D, 0, len(doc))
+	for _, elem := range doc {
+		if elem.Key == "into" {
+			switch into := elem.Value.(type) {
+			case string:
+				elem.Value = r.collectionName(ctx, into)
+			case bson.D:
+				rewritten, err := r.tenantStageDoc(ctx, into, "coll")
+				if err != nil {
+					return nil, err
+				}
+				elem.Value = rewritten
+			}
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+func (r *Repository) tenantFacet(ctx context.Context, value interface{}) (interface{}, error) {
+	doc, ok := value.(bson.D)
+	if !ok {
+		return value, nil
+	}
+	result := make(bson.D, 0, len(doc))
+	for _, elem := range doc {
+		if sub, ok := elem.Value.(bson.A); ok {
+			rewritten, err := r.tenantPipeline(ctx, []interface{}(sub))
+			if err != nil {
+				return nil, err
+			}
+			elem.Value = bson.A(rewritten)
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 
+	saiTypes "github.com/saiset-co/sai-service/types"
 	"github.com/saiset-co/sai-storage/types"
 )
 
@@ -14,22 +15,86 @@ func (r *Repository) ListCollectionNames(ctx context.Context) ([]string, error)
 	return nil, nil
 }
 
+func (r *Repository) CreateCollection(ctx context.Context, collection string, opts types.CollectionOptions) error {
+	return saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) CollectionOptions(ctx context.Context, collection string) (types.CollectionOptions, error) {
+	return types.CollectionOptions{}, nil
+}
+
+func (r *Repository) SetCollectionExpiry(ctx context.Context, collection string, seconds int64) error {
+	return saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) RenameCollection(ctx context.Context, from, to string) error {
+	return saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) DropCollection(ctx context.Context, collection string) error {
+	return saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) TruncateCollection(ctx context.Context, collection string) (int64, error) {
+	return 0, saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) CopyCollection(ctx context.Context, from, to string) (int64, error) {
+	return 0, saiTypes.NewError("collection management is not supported by redis")
+}
+
+func (r *Repository) ConvertToCapped(ctx context.Context, collection string, size int64) error {
+	return saiTypes.NewError("collection management is not supported by redis")
+}
+
 func (r *Repository) ListIndexes(ctx context.Context, collection string) ([]types.IndexInfo, error) {
 	return nil, nil
 }
 
+func (r *Repository) CollectionValidator(ctx context.Context, collection string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
 func (r *Repository) CreateIndex(ctx context.Context, req types.CreateIndexRequest) error {
 	return nil
 }
 
+func (r *Repository) DropIndex(ctx context.Context, collection, name string) error {
+	return saiTypes.NewError("dropping indexes is not supported by redis")
+}
+
+func (r *Repository) SetIndexHidden(ctx context.Context, collection, name string, hidden bool) error {
+	return saiTypes.NewError("hidden indexes are not supported by redis")
+}
+
+func (r *Repository) IndexBuilds(ctx context.Context, collection string) ([]types.IndexBuild, error) {
+	return nil, nil
+}
+
+func (r *Repository) IndexUsage(ctx context.Context, collection string) ([]types.IndexUsage, error) {
+	return nil, nil
+}
+
+func (r *Repository) EnsureTTLIndex(ctx context.Context, collection, field string, expireAfterSeconds int32) error {
+	return saiTypes.NewError("ttl indexes are not supported by redis")
+}
+
 func (r *Repository) GetSlowQueries(ctx context.Context, limit int) ([]types.SlowQuery, error) {
 	return nil, nil
 }
 
-func (r *Repository) LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string) error {
+func (r *Repository) LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string, plan *types.QueryPlan) error {
 	return nil
 }
 
+func (r *Repository) Explain(ctx context.Context, request types.ExplainRequest) (types.QueryPlan, error) {
+	return types.QueryPlan{}, saiTypes.NewError("explain is not supported by redis")
+}
+
 func (r *Repository) GetArchiveGroups(ctx context.Context, collection, search string, skip, limit int) ([]types.ArchiveGroup, int64, error) {
 	return nil, 0, nil
 }
+
+func (r *Repository) ListTenants(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
@@ -72,7 +72,7 @@ func (r *Repository) CreateDocuments(ctx context.Context, request types.CreateDo
 		}
 
 		// Store document with key: collection:internal_id
-		key := r.documentKey(request.Collection, internalID)
+		key := r.documentKey(ctx, request.Collection, internalID)
 
 		// Check if TTL is specified in data
 		var ttl time.Duration
@@ -101,7 +101,7 @@ func (r *Repository) CreateDocuments(ctx context.Context, request types.CreateDo
 
 func (r *Repository) ReadDocuments(ctx context.Context, request types.ReadDocumentsRequest) ([]map[string]interface{}, int64, error) {
 	// Get all documents in collection
-	pattern := r.documentPattern(request.Collection)
+	pattern := r.documentPattern(ctx, request.Collection)
 	keys, err := r.client.Keys(ctx, pattern)
 	if err != nil {
 		return nil, 0, saiTypes.WrapError(err, "failed to get collection keys")
@@ -168,6 +168,21 @@ func (r *Repository) ReadDocuments(ctx context.Context, request types.ReadDocume
 	return results, int64(len(results)), nil
 }
 
+// ForEachDocument reads the matching documents at once, as ReadDocuments
+// does: redis has no cursor over a filtered, sorted collection.
+func (r *Repository) ForEachDocument(ctx context.Context, request types.ReadDocumentsRequest, batchSize int, fn func(map[string]interface{}) error) error {
+	docs, _, err := r.ReadDocuments(ctx, request)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *Repository) AggregateDocuments(ctx context.Context, request types.AggregateDocumentsRequest) ([]map[string]interface{}, int64, error) {
 	// Read all docs with filter for aggregation
 	readRequest := types.ReadDocumentsRequest{
@@ -292,7 +307,9 @@ func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDo
 		}
 
 		// Set internal_id if not already present
-		if newDoc["internal_id"] == nil || newDoc["internal_id"].(string) == "" {
+		if request.UpsertID != "" {
+			newDoc["internal_id"] = request.UpsertID
+		} else if newDoc["internal_id"] == nil || newDoc["internal_id"].(string) == "" {
 			newDoc["internal_id"] = uuid.New().String()
 		}
 		newDoc["cr_time"] = now
@@ -304,7 +321,7 @@ func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDo
 			return 0, saiTypes.WrapError(err, "failed to marshal upserted document")
 		}
 
-		key := r.documentKey(request.Collection, newDoc["internal_id"].(string))
+		key := r.documentKey(ctx, request.Collection, newDoc["internal_id"].(string))
 		err = r.client.Set(ctx, key, jsonData, 0)
 		if err != nil {
 			return 0, err
@@ -334,7 +351,7 @@ func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDo
 			continue
 		}
 
-		key := r.documentKey(request.Collection, doc["internal_id"].(string))
+		key := r.documentKey(ctx, request.Collection, doc["internal_id"].(string))
 		err = r.client.Set(ctx, key, jsonData, 0)
 		if err != nil {
 			continue
@@ -346,6 +363,45 @@ func (r *Repository) UpdateDocuments(ctx context.Context, request types.UpdateDo
 	return updatedCount, nil
 }
 
+func (r *Repository) BulkUpsert(ctx context.Context, collection string, operations []types.UpsertOperation) error {
+	for _, op := range operations {
+		if _, err := r.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+			Collection: collection,
+			Filter:     op.Filter,
+			Data:       op.Update,
+			Upsert:     true,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) BulkPatch(ctx context.Context, collection string, operations []types.UpsertOperation) error {
+	for _, op := range operations {
+		docs, _, err := r.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: collection,
+			Filter:     op.Filter,
+		})
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := r.applyUpdateOperations(doc, op.Update); err != nil {
+				return err
+			}
+			jsonData, err := json.Marshal(doc)
+			if err != nil {
+				return saiTypes.WrapError(err, "failed to marshal patched document")
+			}
+			if err := r.client.Set(ctx, r.documentKey(ctx, collection, doc["internal_id"].(string)), jsonData, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (r *Repository) DeleteDocuments(ctx context.Context, request types.DeleteDocumentsRequest) (int64, error) {
 	// Get documents to delete
 	readRequest := types.ReadDocumentsRequest{
@@ -366,7 +422,7 @@ func (r *Repository) DeleteDocuments(ctx context.Context, request types.DeleteDo
 			continue
 		}
 
-		key := r.documentKey(request.Collection, internalID)
+		key := r.documentKey(ctx, request.Collection, internalID)
 		err := r.client.Del(ctx, key)
 		if err != nil {
 			continue
@@ -390,25 +446,31 @@ func (r *Repository) Close(ctx context.Context) error {
 
 // Helper methods
 
-func (r *Repository) documentKey(collection, id string) string {
-	return fmt.Sprintf("doc:%s:%s", collection, id)
+// namespace prefixes the collection with the request's tenant; Redis supports
+// only the prefix tenancy mode.
+func (r *Repository) namespace(ctx context.Context, collection string) string {
+	return types.TenantCollection(types.TenantFromContext(ctx), collection)
+}
+
+func (r *Repository) documentKey(ctx context.Context, collection, id string) string {
+	return fmt.Sprintf("doc:%s:%s", r.namespace(ctx, collection), id)
 }
 
-func (r *Repository) documentPattern(collection string) string {
-	return fmt.Sprintf("doc:%s:*", collection)
+func (r *Repository) documentPattern(ctx context.Context, collection string) string {
+	return fmt.Sprintf("doc:%s:*", r.namespace(ctx, collection))
 }
 
-func (r *Repository) collectionIndexKey(collection string) string {
-	return fmt.Sprintf("idx:%s", collection)
+func (r *Repository) collectionIndexKey(ctx context.Context, collection string) string {
+	return fmt.Sprintf("idx:%s", r.namespace(ctx, collection))
 }
 
 func (r *Repository) addToCollectionIndex(ctx context.Context, collection, id string) error {
-	indexKey := r.collectionIndexKey(collection)
+	indexKey := r.collectionIndexKey(ctx, collection)
 	return r.client.HSet(ctx, indexKey, id, time.Now().Unix())
 }
 
 func (r *Repository) removeFromCollectionIndex(ctx context.Context, collection, id string) error {
-	indexKey := r.collectionIndexKey(collection)
+	indexKey := r.collectionIndexKey(ctx, collection)
 	return r.client.HDel(ctx, indexKey, id)
 }
 
@@ -431,19 +493,19 @@ func (r *Repository) matchesField(doc map[string]interface{}, key string, filter
 			// Last key, compare value
 			docValue, exists := current[k]
 			if !exists {
-				return false
+				return matchesMissing(filterValue)
 			}
 			return r.compareValues(docValue, filterValue)
 		} else {
 			// Navigate deeper
 			next, exists := current[k]
 			if !exists {
-				return false
+				return matchesMissing(filterValue)
 			}
 			if nextMap, ok := next.(map[string]interface{}); ok {
 				current = nextMap
 			} else {
-				return false
+				return matchesMissing(filterValue)
 			}
 		}
 	}
@@ -451,6 +513,20 @@ func (r *Repository) matchesField(doc map[string]interface{}, key string, filter
 	return false
 }
 
+// matchesMissing reports whether a filter condition holds for a field the
+// document does not have: only {"$exists": false} and $ne do.
+func matchesMissing(filterValue interface{}) bool {
+	cond, ok := filterValue.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if exists, ok := cond["$exists"].(bool); ok {
+		return !exists
+	}
+	_, ne := cond["$ne"]
+	return ne
+}
+
 func (r *Repository) compareValues(docValue, filterValue interface{}) bool {
 	// Handle different comparison types
 	switch filter := filterValue.(type) {
@@ -458,6 +534,9 @@ func (r *Repository) compareValues(docValue, filterValue interface{}) bool {
 		// MongoDB-style operators
 		for op, value := range filter {
 			switch op {
+			case "$exists":
+				exists, _ := value.(bool)
+				return exists
 			case "$eq":
 				return docValue == value
 			case "$ne":
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	accessRolesCollection = "_admin_acl_roles"
+	apiKeysCollection     = "_admin_api_keys"
+	accessCacheTTL        = 30 * time.Second
+	defaultAccessHeader   = "X-Access-Key"
+	userPlaceholder       = "$user"
+)
+
+var accessOperations = map[string]bool{
+	OpRead:      true,
+	OpCreate:    true,
+	OpUpdate:    true,
+	OpDelete:    true,
+	OpAggregate: true,
+	OpManage:    true,
+	"*":         true,
+}
+
+type accessCache struct {
+	mu       sync.RWMutex
+	roles    map[string]types.AccessRole
+	keys     map[string]types.APIKey
+	loadedAt time.Time
+}
+
+func (s *StorageService) AccessControlEnabled() bool {
+	return s.accessConfig.Enabled
+}
+
+func (s *StorageService) AccessKeyHeader() string {
+	if s.accessConfig.KeyHeader == "" {
+		return defaultAccessHeader
+	}
+	return s.accessConfig.KeyHeader
+}
+
+// ResolvePrincipal maps a raw access key to the principal it was issued for.
+// Requests without a key fall back to the configured default role, if any.
+func (s *StorageService) ResolvePrincipal(key string) (*types.Principal, error) {
+	if key == "" {
+		if s.accessConfig.DefaultRole == "" {
+			return nil, saiTypes.NewError("access key is required")
+		}
+		return &types.Principal{Name: "default", Role: s.accessConfig.DefaultRole}, nil
+	}
+
+	if err := s.loadAccess(); err != nil {
+		return nil, err
+	}
+
+	s.acl.mu.RLock()
+	apiKey, ok := s.acl.keys[hashAPIKey(key)]
+	s.acl.mu.RUnlock()
+	if !ok || apiKey.Disabled {
+		return nil, saiTypes.NewError("invalid access key")
+	}
+
+	user := apiKey.User
+	if user == "" {
+		user = apiKey.Name
+	}
+	return &types.Principal{Name: apiKey.Name, User: user, Role: apiKey.Role, Tenant: apiKey.Tenant}, nil
+}
+
+// Authorize checks the principal's role for the collection and operation and
+// returns the mandatory filter that must be applied to the request, or nil when
+// access is unrestricted.
+func (s *StorageService) Authorize(principal *types.Principal, collection, operation string) (map[string]interface{}, error) {
+	if err := s.loadAccess(); err != nil {
+		return nil, err
+	}
+
+	s.acl.mu.RLock()
+	role, ok := s.acl.roles[principal.Role]
+	s.acl.mu.RUnlock()
+	if !ok {
+		return nil, saiTypes.NewErrorf("role %q is not defined", principal.Role)
+	}
+
+	matched, unrestricted := false, false
+	filters := make([]interface{}, 0, len(role.Rules))
+	for _, rule := range role.Rules {
+		if !ruleMatches(rule, collection, operation) {
+			continue
+		}
+		matched = true
+		if len(rule.Filter) == 0 {
+			unrestricted = true
+			continue
+		}
+		filters = append(filters, substituteUser(rule.Filter, principal.User))
+	}
+
+	switch {
+	case !matched:
+		return nil, saiTypes.NewErrorf("%s on collection %q is not allowed", operation, collection)
+	case unrestricted:
+		return nil, nil
+	case len(filters) == 1:
+		return filters[0].(map[string]interface{}), nil
+	}
+	return map[string]interface{}{"$or": filters}, nil
+}
+
+func ruleMatches(rule types.AccessRule, collection, operation string) bool {
+	opAllowed := false
+	for _, op := range rule.Operations {
+		if (op == "*" && operation != OpManage) || op == operation {
+			opAllowed = true
+			break
+		}
+	}
+	if !opAllowed {
+		return false
+	}
+	for _, pattern := range rule.Collections {
+		if ok, _ := path.Match(pattern, collection); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func substituteUser(v interface{}, user string) interface{} {
+	switch t := v.(type) {
+	case string:
+		if t == userPlaceholder {
+			return user
+		}
+		return t
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = substituteUser(val, user)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = substituteUser(val, user)
+		}
+		return out
+	}
+	return v
+}
+
+// ScopeFilter ANDs the mandatory access filter into a request filter.
+func ScopeFilter(filter, scope map[string]interface{}) map[string]interface{} {
+	if len(scope) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		return scope
+	}
+	return map[string]interface{}{"$and": []interface{}{filter, scope}}
+}
+
+func ScopePipeline(pipeline types.OrderedPipeline, scope map[string]interface{}) types.OrderedPipeline {
+	if len(scope) == 0 || len(pipeline) == 0 {
+		return pipeline
+	}
+	scoped := make(types.OrderedPipeline, 0, len(pipeline)+1)
+	scoped = append(scoped, bson.D{{Key: "$match", Value: scope}})
+	return append(scoped, pipeline...)
+}
+
+// ScopeDocuments stamps the equality fields of the access filter onto new
+// documents and rejects documents that try to set them to something else.
+func ScopeDocuments(data []interface{}, scope map[string]interface{}) error {
+	fields := scopeEqualityFields(scope)
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, item := range data {
+		doc, ok := item.(map[string]interface{})
+		if !ok {
+			return saiTypes.NewError("documents must be objects")
+		}
+		for k, v := range fields {
+			if existing, exists := doc[k]; exists && existing != v {
+				return saiTypes.NewErrorf("field %q is restricted by access policy", k)
+			}
+			doc[k] = v
+		}
+	}
+	return nil
+}
+
+// CheckScopedUpdate rejects updates that would move documents out of the
+// caller's scope by changing one of the restricted fields.
+func CheckScopedUpdate(data interface{}, scope map[string]interface{}) error {
+	fields := scopeEqualityFields(scope)
+	if len(fields) == 0 {
+		return nil
+	}
+	update, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	targets := []map[string]interface{}{update}
+	for op, v := range update {
+		if strings.HasPrefix(op, "$") {
+			if m, ok := v.(map[string]interface{}); ok {
+				targets = append(targets, m)
+			}
+		}
+	}
+	for _, target := range targets {
+		for k, want := range fields {
+			if v, exists := target[k]; exists && v != want {
+				return saiTypes.NewErrorf("field %q is restricted by access policy", k)
+			}
+		}
+	}
+	if renames, ok := update["$rename"].(map[string]interface{}); ok {
+		for from, to := range renames {
+			if _, restricted := fields[from]; restricted {
+				return saiTypes.NewErrorf("field %q is restricted by access policy", from)
+			}
+			if s, ok := to.(string); ok {
+				if _, restricted := fields[s]; restricted {
+					return saiTypes.NewErrorf("field %q is restricted by access policy", s)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func scopeEqualityFields(scope map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for k, v := range scope {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// PipelineCollections returns the collections an aggregation pipeline reads
+// from ($lookup, $graphLookup, $unionWith) and writes to ($out, $merge).
+func PipelineCollections(pipeline types.OrderedPipeline) (reads, writes []string) {
+	for _, stage := range pipeline {
+		collectStageCollections(stage, &reads, &writes)
+	}
+	return reads, writes
+}
+
+func collectStageCollections(stage bson.D, reads, writes *[]string) {
+	for _, elem := range stage {
+		switch elem.Key {
+		case "$lookup", "$graphLookup":
+			if doc, ok := elem.Value.(bson.D); ok {
+				if from, ok := lookupString(doc, "from"); ok {
+					*reads = append(*reads, from)
+				}
+				if sub, ok := lookupValue(doc, "pipeline").(bson.A); ok {
+					collectSubPipeline(sub, reads, writes)
+				}
+			}
+		case "$unionWith":
+			switch v := elem.Value.(type) {
+			case string:
+				*reads = append(*reads, v)
+			case bson.D:
+				if coll, ok := lookupString(v, "coll"); ok {
+					*reads = append(*reads, coll)
+				}
+				if sub, ok := lookupValue(v, "pipeline").(bson.A); ok {
+					collectSubPipeline(sub, reads, writes)
+				}
+			}
+		case "$facet":
+			if doc, ok := elem.Value.(bson.D); ok {
+				for _, facet := range doc {
+					if sub, ok := facet.Value.(bson.A); ok {
+						collectSubPipeline(sub, reads, writes)
+					}
+				}
+			}
+		case "$out":
+			switch v := elem.Value.(type) {
+			case string:
+				*writes = append(*writes, v)
+			case bson.D:
+				if coll, ok := lookupString(v, "coll"); ok {
+					*writes = append(*writes, coll)
+				}
+			}
+		case "$merge":
+			switch v := elem.Value.(type) {
+			case string:
+				*writes = append(*writes, v)
+			case bson.D:
+				switch into := lookupValue(v, "into").(type) {
+				case string:
+					*writes = append(*writes, into)
+				case bson.D:
+					if coll, ok := lookupString(into, "coll"); ok {
+						*writes = append(*writes, coll)
+					}
+				}
+			}
+		}
+	}
+}
+
+func collectSubPipeline(sub bson.A, reads, writes *[]string) {
+	for _, item := range sub {
+		if stage, ok := item.(bson.D); ok {
+			collectStageCollections(stage, reads, writes)
+		}
+	}
+}
+
+func lookupValue(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func lookupString(doc bson.D, key string) (string, bool) {
+	s, ok := lookupValue(doc, key).(string)
+	return s, ok && s != ""
+}
+
+func (s *StorageService) loadAccess() error {
+	s.acl.mu.RLock()
+	fresh := time.Since(s.acl.loadedAt) < accessCacheTTL
+	s.acl.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	roles, err := s.ListAccessRoles(context.Background())
+	if err != nil {
+		return err
+	}
+	keys, err := s.ListAPIKeys(context.Background())
+	if err != nil {
+		return err
+	}
+
+	roleMap := make(map[string]types.AccessRole, len(roles))
+	for _, r := range roles {
+		roleMap[r.Name] = r
+	}
+	keyMap := make(map[string]types.APIKey, len(keys))
+	for _, k := range keys {
+		keyMap[k.KeyHash] = k
+	}
+
+	s.acl.mu.Lock()
+	s.acl.roles = roleMap
+	s.acl.keys = keyMap
+	s.acl.loadedAt = time.Now()
+	s.acl.mu.Unlock()
+	return nil
+}
+
+func (s *StorageService) invalidateAccess() {
+	s.acl.mu.Lock()
+	s.acl.loadedAt = time.Time{}
+	s.acl.mu.Unlock()
+}
+
+func (s *StorageService) ListAccessRoles(ctx context.Context) ([]types.AccessRole, error) {
+	docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: accessRolesCollection,
+		Sort:       map[string]int{"name": 1},
+	})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read access roles")
+	}
+	roles := make([]types.AccessRole, 0, len(docs))
+	for _, doc := range docs {
+		var role types.AccessRole
+		if err := decodeDocument(doc, &role); err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (s *StorageService) SaveAccessRole(ctx context.Context, role types.AccessRole) error {
+	if role.Name == "" {
+		return saiTypes.NewError("role name is required")
+	}
+	for i, rule := range role.Rules {
+		if len(rule.Collections) == 0 || len(rule.Operations) == 0 {
+			return saiTypes.NewErrorf("rule %d: collections and operations are required", i+1)
+		}
+		for _, pattern := range rule.Collections {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return saiTypes.NewErrorf("rule %d: invalid collection pattern %q", i+1, pattern)
+			}
+		}
+		for _, op := range rule.Operations {
+			if !accessOperations[op] {
+				return saiTypes.NewErrorf("rule %d: unknown operation %q", i+1, op)
+			}
+		}
+	}
+
+	_, err := s.repo.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+		Collection: accessRolesCollection,
+		Filter:     map[string]interface{}{"name": role.Name},
+		Data: map[string]interface{}{
+			"name":        role.Name,
+			"description": role.Description,
+			"rules":       role.Rules,
+		},
+		Upsert: true,
+	})
+	if err != nil {
+		return saiTypes.WrapError(err, "failed to save access role")
+	}
+	s.invalidateAccess()
+	return nil
+}
+
+func (s *StorageService) DeleteAccessRole(ctx context.Context, name string) error {
+	if _, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+		Collection: accessRolesCollection,
+		Filter:     map[string]interface{}{"name": name},
+	}); err != nil {
+		return saiTypes.WrapError(err, "failed to delete access role")
+	}
+	s.invalidateAccess()
+	return nil
+}
+
+func (s *StorageService) ListAPIKeys(ctx context.Context) ([]types.APIKey, error) {
+	docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: apiKeysCollection,
+		Sort:       map[string]int{"cr_time": -1},
+	})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read api keys")
+	}
+	keys := make([]types.APIKey, 0, len(docs))
+	for _, doc := range docs {
+		var key types.APIKey
+		if err := decodeDocument(doc, &key); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// CreateAPIKey issues a new key bound to a role. Only the hash is stored, so the
+// returned plaintext key is shown to the admin exactly once.
+func (s *StorageService) CreateAPIKey(ctx context.Context, spec types.APIKey) (string, error) {
+	if spec.Name == "" || spec.Role == "" {
+		return "", saiTypes.NewError("name and role are required")
+	}
+	if spec.Tenant != "" && !types.ValidTenantID(spec.Tenant) {
+		return "", saiTypes.NewErrorf("invalid tenant %q", spec.Tenant)
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", saiTypes.WrapError(err, "failed to generate api key")
+	}
+	key := "sk_" + hex.EncodeToString(raw)
+
+	_, err := s.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{
+		Collection: apiKeysCollection,
+		Data: []interface{}{map[string]interface{}{
+			"name":       spec.Name,
+			"role":       spec.Role,
+			"user":       spec.User,
+			"tenant":     spec.Tenant,
+			"key_hash":   hashAPIKey(key),
+			"key_prefix": key[:11],
+			"disabled":   false,
+		}},
+	})
+	if err != nil {
+		return "", saiTypes.WrapError(err, "failed to store api key")
+	}
+	s.invalidateAccess()
+	return key, nil
+}
+
+func (s *StorageService) DeleteAPIKey(ctx context.Context, id string) error {
+	if _, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+		Collection: apiKeysCollection,
+		Filter:     map[string]interface{}{"internal_id": id},
+	}); err != nil {
+		return saiTypes.WrapError(err, "failed to delete api key")
+	}
+	s.invalidateAccess()
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func decodeDocument(doc map[string]interface{}, out interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
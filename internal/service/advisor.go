@@ -0,0 +1,587 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAdvisorInterval = 24 * time.Hour
+	defaultAdvisorMinCalls = 10
+	advisorStatsLimit      = 5000
+)
+
+// rangeOperators make a filter field a range field for the ESR rule.
+var rangeOperators = map[string]bool{
+	"$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$ne": true, "$nin": true, "$regex": true, "$exists": true, "$not": true,
+}
+
+// rangeKeys returns the filter fields of query compared with a range
+// operator. Every other filter field counts as an equality.
+func rangeKeys(query *types.ExplainRequest) []string {
+	keys := []string{}
+	if query == nil || len(query.Filter) == 0 {
+		return keys
+	}
+	set := make(map[string]struct{})
+	collectRangeKeys(query.Filter, set)
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func collectRangeKeys(filter map[string]interface{}, set map[string]struct{}) {
+	for k, v := range filter {
+		if strings.HasPrefix(k, "$") {
+			items, _ := toSlice(v)
+			for _, item := range items {
+				if sub, ok := toMap(item); ok {
+					collectRangeKeys(sub, set)
+				}
+			}
+			continue
+		}
+		cond, ok := toMap(v)
+		if !ok || !hasOperatorKeys(cond) {
+			continue
+		}
+		for op := range cond {
+			if rangeOperators[op] {
+				set[k] = struct{}{}
+			}
+		}
+	}
+}
+
+type advisorJob struct {
+	mu       sync.Mutex
+	interval time.Duration
+	lastRun  time.Time
+	created  []string
+	lastErr  string
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// AdviseIndexes analyses the collected query stats and slow queries of the
+// tenant in ctx and proposes a minimal set of compound indexes. Shapes
+// already served by an existing index are counted as covered.
+func (s *StorageService) AdviseIndexes(ctx context.Context) (types.IndexAdvice, error) {
+	shapes, err := s.workloadShapes(ctx)
+	if err != nil {
+		return types.IndexAdvice{}, err
+	}
+	minCalls := s.indexAdvisor.MinCalls
+	if minCalls <= 0 {
+		minCalls = defaultAdvisorMinCalls
+	}
+
+	advice := types.IndexAdvice{
+		GeneratedAt:     time.Now(),
+		Recommendations: []types.IndexRecommendation{},
+		Redundant:       []types.RedundantIndex{},
+	}
+	collections := make([]string, 0, len(shapes))
+	for name := range shapes {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		indexes, err := s.repo.ListIndexes(ctx, collection)
+		if err != nil {
+			return types.IndexAdvice{}, saiTypes.WrapError(err, "failed to list indexes of "+collection)
+		}
+		collShapes := shapes[collection]
+		advice.Shapes += len(collShapes)
+
+		recs, covered := recommendIndexes(collShapes, indexes)
+		advice.Covered += covered
+		for _, rec := range recs {
+			if rec.Calls+rec.SlowCalls >= minCalls {
+				advice.Recommendations = append(advice.Recommendations, rec)
+			}
+		}
+		advice.Redundant = append(advice.Redundant, redundantIndexes(collection, indexes)...)
+	}
+
+	sort.SliceStable(advice.Recommendations, func(i, j int) bool {
+		a, b := advice.Recommendations[i], advice.Recommendations[j]
+		if a.SlowCalls != b.SlowCalls {
+			return a.SlowCalls > b.SlowCalls
+		}
+		return a.Calls > b.Calls
+	})
+	return advice, nil
+}
+
+// ApplyIndexRecommendations creates the recommended indexes of collection,
+// or of every collection when it is empty, and returns their names.
+func (s *StorageService) ApplyIndexRecommendations(ctx context.Context, collection string) ([]string, error) {
+	advice, err := s.AdviseIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var created []string
+	for _, rec := range advice.Recommendations {
+		if collection != "" && rec.Collection != collection {
+			continue
+		}
+		if err := s.repo.CreateIndex(ctx, types.CreateIndexRequest{
+			Collection:  rec.Collection,
+			OrderedKeys: rec.Keys,
+			Name:        rec.Name,
+		}); err != nil {
+			return created, saiTypes.WrapError(err, "failed to create index "+rec.Name)
+		}
+		created = append(created, rec.Collection+"."+rec.Name)
+	}
+	return created, nil
+}
+
+// workloadShapes merges query stats and slow queries into shapes, grouped
+// by collection. Creates and aggregates are left out: their keys say
+// nothing about a usable index.
+func (s *StorageService) workloadShapes(ctx context.Context) (map[string][]*types.QueryShape, error) {
+	stats, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: "_admin_query_stats",
+		Sort:       map[string]int{"count": -1},
+		Limit:      advisorStatsLimit,
+	})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read query stats")
+	}
+
+	shapes := make(map[string][]*types.QueryShape)
+	bySignature := make(map[string]*types.QueryShape)
+	byFingerprint := make(map[string]*types.QueryShape)
+	add := func(doc map[string]interface{}, calls, slow int64) {
+		collection, _ := doc["collection"].(string)
+		operation, _ := doc["operation"].(string)
+		if collectionClass(collection) != collectionClassUser || operation == "create" || operation == "aggregate" {
+			return
+		}
+		filterKeys := stringList(doc["filter_keys"])
+		fingerprint := collection + "|" + filterFingerprint(filterKeys)
+		if slow > 0 && calls == 0 {
+			if shape, ok := byFingerprint[fingerprint]; ok {
+				shape.SlowCalls += slow
+				return
+			}
+		}
+		shape := newQueryShape(collection, operation, filterKeys, stringList(doc["range_keys"]), sortSpec(doc["sort_keys"]))
+		if len(shape.Equality)+len(shape.Sort)+len(shape.Range) == 0 {
+			return
+		}
+		signature := shapeSignature(shape)
+		if existing, ok := bySignature[signature]; ok {
+			existing.Calls += calls
+			existing.SlowCalls += slow
+			return
+		}
+		shape.Calls, shape.SlowCalls = calls, slow
+		bySignature[signature] = shape
+		byFingerprint[fingerprint] = shape
+		shapes[collection] = append(shapes[collection], shape)
+	}
+
+	for _, doc := range stats {
+		count, _ := toNumber(doc["count"])
+		add(doc, int64(count), 0)
+	}
+
+	slow, _, err := s.repo.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+		Collection: "_admin_slow_queries",
+		Pipeline: types.OrderedPipeline{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{{Key: "collection", Value: "$collection"}, {Key: "filter_fingerprint", Value: "$filter_fingerprint"}}},
+				{Key: "collection", Value: bson.D{{Key: "$first", Value: "$collection"}}},
+				{Key: "operation", Value: bson.D{{Key: "$first", Value: "$operation"}}},
+				{Key: "filter_keys", Value: bson.D{{Key: "$first", Value: "$filter_keys"}}},
+				{Key: "sort_keys", Value: bson.D{{Key: "$first", Value: "$sort_keys"}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+		},
+	})
+	if err != nil {
+		sai.Logger().Debug("Index advisor skipped slow queries", zap.Error(err))
+	}
+	for _, doc := range slow {
+		count, _ := toNumber(doc["count"])
+		add(doc, 0, int64(count))
+	}
+	return shapes, nil
+}
+
+// newQueryShape splits filter keys per the ESR rule. A field that is both
+// filtered and sorted on is an equality when compared by equality and a sort
+// key when compared by range: the sort position serves the range too.
+func newQueryShape(collection, operation string, filterKeys, rangeKeys []string, sortKeys []types.IndexKey) *types.QueryShape {
+	shape := &types.QueryShape{Collection: collection, Operation: operation}
+	ranges := make(map[string]bool, len(rangeKeys))
+	for _, k := range rangeKeys {
+		ranges[k] = true
+	}
+	equality := make(map[string]bool)
+	for _, k := range filterKeys {
+		if !ranges[k] {
+			equality[k] = true
+			shape.Equality = append(shape.Equality, k)
+		}
+	}
+	sorted := make(map[string]bool)
+	for _, key := range sortKeys {
+		if !equality[key.Field] {
+			sorted[key.Field] = true
+			shape.Sort = append(shape.Sort, key)
+		}
+	}
+	for _, k := range rangeKeys {
+		if !sorted[k] {
+			shape.Range = append(shape.Range, k)
+		}
+	}
+	return shape
+}
+
+func shapeSignature(shape *types.QueryShape) string {
+	var sb strings.Builder
+	sb.WriteString(shape.Collection + "|" + strings.Join(shape.Equality, ",") + "|")
+	for _, key := range shape.Sort {
+		sb.WriteString(fmt.Sprintf("%s:%d,", key.Field, key.Direction))
+	}
+	sb.WriteString("|" + strings.Join(shape.Range, ","))
+	return sb.String()
+}
+
+// recommendIndexes picks indexes for the shapes not served by an existing
+// index. Longer candidates are placed first so shorter shapes can reuse
+// their prefix, and equality fields are ordered by how much of the workload
+// filters on them so shared fields lead.
+func recommendIndexes(shapes []*types.QueryShape, indexes []types.IndexInfo) ([]types.IndexRecommendation, int) {
+	weight := make(map[string]int64)
+	for _, shape := range shapes {
+		for _, field := range shape.Equality {
+			weight[field] += shape.Calls + shape.SlowCalls
+		}
+	}
+	candidates := make([][]types.IndexKey, len(shapes))
+	order := make([]int, len(shapes))
+	for i, shape := range shapes {
+		candidates[i] = esrKeys(shape, weight)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ca, cb := candidates[order[a]], candidates[order[b]]
+		if len(ca) != len(cb) {
+			return len(ca) > len(cb)
+		}
+		return shapes[order[a]].Calls+shapes[order[a]].SlowCalls > shapes[order[b]].Calls+shapes[order[b]].SlowCalls
+	})
+
+	var recs []types.IndexRecommendation
+	covered := 0
+	for _, i := range order {
+		shape := shapes[i]
+		servedByIndex := false
+		for _, index := range indexes {
+			if generalIndex(index) && indexServes(index.OrderedKeys, shape) {
+				servedByIndex = true
+				break
+			}
+		}
+		if servedByIndex {
+			covered++
+			continue
+		}
+		merged := false
+		for r := range recs {
+			if indexServes(recs[r].Keys, shape) {
+				recs[r].Calls += shape.Calls
+				recs[r].SlowCalls += shape.SlowCalls
+				recs[r].Shapes = append(recs[r].Shapes, *shape)
+				merged = true
+				break
+			}
+		}
+		if merged {
+			continue
+		}
+		recs = append(recs, types.IndexRecommendation{
+			Collection: shape.Collection,
+			Name:       indexName(candidates[i]),
+			Keys:       candidates[i],
+			Calls:      shape.Calls,
+			SlowCalls:  shape.SlowCalls,
+			Shapes:     []types.QueryShape{*shape},
+		})
+	}
+	return recs, covered
+}
+
+// esrKeys orders the keys of shape as equality, sort, range.
+func esrKeys(shape *types.QueryShape, weight map[string]int64) []types.IndexKey {
+	equality := append([]string{}, shape.Equality...)
+	sort.SliceStable(equality, func(i, j int) bool {
+		if weight[equality[i]] != weight[equality[j]] {
+			return weight[equality[i]] > weight[equality[j]]
+		}
+		return equality[i] < equality[j]
+	})
+	keys := make([]types.IndexKey, 0, len(equality)+len(shape.Sort)+len(shape.Range))
+	for _, field := range equality {
+		keys = append(keys, types.IndexKey{Field: field, Direction: 1})
+	}
+	keys = append(keys, shape.Sort...)
+	for _, field := range shape.Range {
+		keys = append(keys, types.IndexKey{Field: field, Direction: 1})
+	}
+	return keys
+}
+
+// indexServes reports whether an index with keys can answer shape without a
+// collection scan or in-memory sort: its prefix holds the equality fields in
+// any order, then the sort keys in order (all directions equal or all
+// reversed), then the range fields in any order.
+func indexServes(keys []types.IndexKey, shape *types.QueryShape) bool {
+	if len(keys) < len(shape.Equality)+len(shape.Sort)+len(shape.Range) {
+		return false
+	}
+	pos := 0
+	if !prefixHolds(keys[pos:pos+len(shape.Equality)], shape.Equality) {
+		return false
+	}
+	pos += len(shape.Equality)
+
+	sign := 0
+	for j, key := range shape.Sort {
+		k := keys[pos+j]
+		if k.Type != "" || k.Field != key.Field {
+			return false
+		}
+		d := k.Direction * key.Direction
+		if sign == 0 {
+			sign = d
+		} else if d != sign {
+			return false
+		}
+	}
+	pos += len(shape.Sort)
+	return prefixHolds(keys[pos:pos+len(shape.Range)], shape.Range)
+}
+
+func prefixHolds(keys []types.IndexKey, fields []string) bool {
+	want := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		want[f] = true
+	}
+	for _, k := range keys {
+		if k.Type != "" || !want[k.Field] {
+			return false
+		}
+		delete(want, k.Field)
+	}
+	return len(want) == 0
+}
+
+// redundantIndexes flags indexes whose keys repeat, or are a prefix of,
+// another index. Unique, special, TTL and the _id index are never flagged,
+// and only an index serving every query can cover another.
+func redundantIndexes(collection string, indexes []types.IndexInfo) []types.RedundantIndex {
+	var out []types.RedundantIndex
+	for i, a := range indexes {
+		if a.Name == "_id_" || a.Unique || a.ExpireAfterSeconds != nil || len(a.OrderedKeys) == 0 || hasSpecialKey(a.OrderedKeys) {
+			continue
+		}
+		for j, b := range indexes {
+			if i == j || !generalIndex(b) || hasSpecialKey(b.OrderedKeys) || !isKeyPrefix(a.OrderedKeys, b.OrderedKeys) {
+				continue
+			}
+			reason := "prefix"
+			if len(a.OrderedKeys) == len(b.OrderedKeys) {
+				if a.Name < b.Name && !b.Unique {
+					continue
+				}
+				reason = "duplicate"
+			}
+			out = append(out, types.RedundantIndex{
+				Collection: collection,
+				Name:       a.Name,
+				Keys:       a.OrderedKeys,
+				CoveredBy:  b.Name,
+				Reason:     reason,
+			})
+			break
+		}
+	}
+	return out
+}
+
+func isKeyPrefix(prefix, keys []types.IndexKey) bool {
+	if len(prefix) > len(keys) {
+		return false
+	}
+	sign := 0
+	for i, k := range prefix {
+		if k.Field != keys[i].Field {
+			return false
+		}
+		d := k.Direction * keys[i].Direction
+		if sign == 0 {
+			sign = d
+		} else if d != sign {
+			return false
+		}
+	}
+	return true
+}
+
+// generalIndex reports whether the planner can use an index for any query
+// on its keys: it is not hidden, sparse or partial and uses the default
+// collation.
+func generalIndex(index types.IndexInfo) bool {
+	return !index.Hidden && !index.Sparse && len(index.PartialFilterExpression) == 0 && index.Collation == nil
+}
+
+func hasSpecialKey(keys []types.IndexKey) bool {
+	for _, k := range keys {
+		if k.Type != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// indexName builds Mongo's default index name, e.g. "status_1_cr_time_-1".
+func indexName(keys []types.IndexKey) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Field, fmt.Sprint(k.Direction))
+	}
+	return strings.Join(parts, "_")
+}
+
+// sortSpec turns stored sort keys into index keys in field name order; the
+// order of a sort map is not recorded.
+func sortSpec(v interface{}) []types.IndexKey {
+	m, ok := toMap(v)
+	if !ok {
+		return nil
+	}
+	keys := make([]types.IndexKey, 0, len(m))
+	for field, dir := range m {
+		d, _ := toNumber(dir)
+		direction := 1
+		if d < 0 {
+			direction = -1
+		}
+		keys = append(keys, types.IndexKey{Field: field, Direction: direction})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Field < keys[j].Field })
+	return keys
+}
+
+func stringList(v interface{}) []string {
+	items, _ := toSlice(v)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (s *StorageService) startIndexAdvisor() {
+	if !s.indexAdvisor.AutoApply {
+		return
+	}
+	interval := time.Duration(s.indexAdvisor.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultAdvisorInterval
+	}
+	s.advisorJob = &advisorJob{interval: interval, stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.advisorJob.stop:
+				return
+			case <-ticker.C:
+				s.applyAdvisorEverywhere(context.Background())
+			}
+		}
+	}()
+}
+
+func (s *StorageService) stopIndexAdvisor() {
+	if s.advisorJob != nil {
+		s.advisorJob.stopOnce.Do(func() { close(s.advisorJob.stop) })
+	}
+}
+
+// applyAdvisorEverywhere applies the recommendations of every tenant.
+// Redundant indexes are only reported, never dropped.
+func (s *StorageService) applyAdvisorEverywhere(ctx context.Context) {
+	namespaces := []string{""}
+	if s.tenancy.Enabled {
+		tenants, err := s.repo.ListTenants(ctx)
+		if err != nil {
+			sai.Logger().Warn("Index advisor failed to list tenants", zap.Error(err))
+		}
+		namespaces = append(namespaces, tenants...)
+	}
+
+	var created []string
+	var lastErr string
+	for _, tenant := range namespaces {
+		names, err := s.ApplyIndexRecommendations(types.WithTenant(ctx, tenant), "")
+		for _, name := range names {
+			if tenant != "" {
+				name = tenant + ":" + name
+			}
+			created = append(created, name)
+		}
+		if err != nil {
+			lastErr = err.Error()
+			sai.Logger().Warn("Index advisor failed to apply recommendations", zap.String("tenant", tenant), zap.Error(err))
+		}
+	}
+	if len(created) > 0 {
+		sai.Logger().Info("Index advisor created indexes", zap.Strings("indexes", created))
+	}
+
+	job := s.advisorJob
+	job.mu.Lock()
+	job.lastRun = time.Now()
+	job.created = created
+	job.lastErr = lastErr
+	job.mu.Unlock()
+}
+
+func (s *StorageService) IndexAdvisorStatus() types.IndexAdvisorStatus {
+	status := types.IndexAdvisorStatus{AutoApply: s.indexAdvisor.AutoApply}
+	if job := s.advisorJob; job != nil {
+		job.mu.Lock()
+		status.Interval = job.interval
+		status.LastRun = job.lastRun
+		status.Created = append(status.Created, job.created...)
+		status.LastError = job.lastErr
+		job.mu.Unlock()
+	}
+	return status
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+)
+
+// applyUpdate returns doc with update applied in memory, the way the
+// repositories would apply it. A document without operators is treated as
+// $set. Supported operators: $set, $setOnInsert (only when inserting), $unset,
+// $inc, $mul, $min, $max, $rename, $currentDate, $push, $addToSet, $pull, $pop.
+func applyUpdate(doc map[string]interface{}, update map[string]interface{}, inserting bool) (map[string]interface{}, error) {
+	out := copyDocument(doc)
+	if !hasOperatorKeys(update) {
+		update = map[string]interface{}{"$set": update}
+	}
+
+	for op, arg := range update {
+		fields, ok := toMap(arg)
+		if !ok {
+			return nil, saiTypes.NewErrorf("%s expects an object", op)
+		}
+		for path, value := range fields {
+			current, exists := lookupPath(out, path)
+			switch op {
+			case "$set":
+				setPath(out, path, value)
+			case "$setOnInsert":
+				if inserting {
+					setPath(out, path, value)
+				}
+			case "$unset":
+				unsetPath(out, path)
+			case "$inc", "$mul":
+				delta, ok := toNumber(value)
+				if !ok {
+					return nil, saiTypes.NewErrorf("%s expects a number for %s", op, path)
+				}
+				base, _ := toNumber(current)
+				if op == "$mul" {
+					setPath(out, path, base*delta)
+				} else {
+					setPath(out, path, base+delta)
+				}
+			case "$min", "$max":
+				c, comparable := compareValues(value, current)
+				if !exists || (comparable && ((op == "$min" && c < 0) || (op == "$max" && c > 0))) {
+					setPath(out, path, value)
+				}
+			case "$rename":
+				target, ok := value.(string)
+				if !ok {
+					return nil, saiTypes.NewErrorf("$rename expects a string for %s", path)
+				}
+				if exists {
+					unsetPath(out, path)
+					setPath(out, target, current)
+				}
+			case "$currentDate":
+				setPath(out, path, time.Now())
+			case "$push", "$addToSet":
+				list, _ := toSlice(current)
+				items := []interface{}{value}
+				if m, ok := toMap(value); ok {
+					if each, ok := toSlice(m["$each"]); ok {
+						items = each
+					}
+				}
+				list = append([]interface{}{}, list...)
+				for _, item := range items {
+					if op == "$addToSet" && containsValue(list, item) {
+						continue
+					}
+					list = append(list, item)
+				}
+				setPath(out, path, list)
+			case "$pull":
+				list, ok := toSlice(current)
+				if !ok {
+					continue
+				}
+				kept := make([]interface{}, 0, len(list))
+				for _, item := range list {
+					matched, err := matchCondition(item, true, value)
+					if err != nil {
+						return nil, err
+					}
+					if !matched {
+						kept = append(kept, item)
+					}
+				}
+				setPath(out, path, kept)
+			case "$pop":
+				list, ok := toSlice(current)
+				if !ok || len(list) == 0 {
+					continue
+				}
+				if n, _ := toNumber(value); n < 0 {
+					setPath(out, path, append([]interface{}{}, list[1:]...))
+				} else {
+					setPath(out, path, append([]interface{}{}, list[:len(list)-1]...))
+				}
+			default:
+				return nil, saiTypes.NewErrorf("operator %s is not supported in dry_run", op)
+			}
+		}
+	}
+	return out, nil
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if valueEquals(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDocument deep-copies nested maps so dotted writes never touch doc.
+func copyDocument(doc map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if m, ok := toMap(v); ok {
+			out[k] = copyDocument(m)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func setPath(doc map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+func unsetPath(doc map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
@@ -0,0 +1,422 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+// ErrConfirmationMismatch is returned when a destructive operation does not
+// repeat the collection name in Confirm.
+var ErrConfirmationMismatch = saiTypes.NewError("confirm must repeat the collection name")
+
+var timeSeriesGranularities = map[string]bool{"": true, "seconds": true, "minutes": true, "hours": true}
+
+// CreateCollection creates an empty collection with the given options.
+func (s *StorageService) CreateCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	resp := types.CollectionResponse{Collection: request.Collection}
+	if err := checkNewCollectionName(request.Collection); err != nil {
+		return resp, err
+	}
+	if err := validateCollectionOptions(request.Options); err != nil {
+		return resp, err
+	}
+	existing, err := s.existingCollections(ctx)
+	if err != nil {
+		return resp, err
+	}
+	if existing[request.Collection] {
+		return resp, saiTypes.NewErrorf("collection %q already exists", request.Collection)
+	}
+	if err := s.repo.CreateCollection(ctx, request.Collection, request.Options); err != nil {
+		return resp, err
+	}
+	sai.Logger().Info("Collection created", zap.String("collection", request.Collection), zap.String("type", request.Options.Type()))
+	return resp, nil
+}
+
+// RenameCollection renames a collection together with its request log and
+// archives, so its history stays attached to it.
+func (s *StorageService) RenameCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	from, to := request.Collection, request.To
+	resp := types.CollectionResponse{Collection: to}
+	if err := checkLifecycleName(from); err != nil {
+		return resp, err
+	}
+	if err := checkNewCollectionName(to); err != nil {
+		return resp, err
+	}
+	if from == to {
+		return resp, saiTypes.NewError("the new name must differ from the current one")
+	}
+	if err := s.checkEncryptedMove(from, to); err != nil {
+		return resp, err
+	}
+	existing, err := s.existingCollections(ctx)
+	if err != nil {
+		return resp, err
+	}
+	if !existing[from] {
+		return resp, saiTypes.NewErrorf("collection %q not found", from)
+	}
+	if existing[to] {
+		return resp, saiTypes.NewErrorf("collection %q already exists", to)
+	}
+	companions := companionsOf(from, existing)
+	for _, suffix := range companions {
+		if existing[to+suffix] {
+			return resp, saiTypes.NewErrorf("collection %q already exists", to+suffix)
+		}
+	}
+
+	if err := s.repo.RenameCollection(ctx, from, to); err != nil {
+		return resp, err
+	}
+	for _, suffix := range companions {
+		s.forgetArchiveIndexes(ctx, from+suffix)
+		if err := s.repo.RenameCollection(ctx, from+suffix, to+suffix); err != nil {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("%s: %v", from+suffix, err))
+			continue
+		}
+		resp.Companions = append(resp.Companions, to+suffix)
+	}
+	sai.Logger().Info("Collection renamed", zap.String("collection", from), zap.String("to", to), zap.Strings("companions", resp.Companions))
+	return resp, nil
+}
+
+// DropCollection snapshots a collection, then drops it. Its request log and
+// archives are kept: they are the audit trail of the collection and
+// attach to it again if the snapshot is renamed back.
+func (s *StorageService) DropCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	resp := types.CollectionResponse{Collection: request.Collection}
+	if _, err := s.checkDestructive(ctx, request); err != nil {
+		return resp, err
+	}
+	var err error
+	if resp.Snapshot, resp.Warnings, err = s.snapshot(ctx, request.Collection); err != nil {
+		return resp, err
+	}
+	if err := s.repo.DropCollection(ctx, request.Collection); err != nil {
+		return resp, err
+	}
+	sai.Logger().Info("Collection dropped", zap.String("collection", request.Collection), zap.String("snapshot", resp.Snapshot))
+	return resp, nil
+}
+
+// TruncateCollection snapshots a collection, then deletes all its documents.
+// Options, indexes, the request log and archives are kept; the deleted
+// documents are not archived one by one, the snapshot holds them.
+func (s *StorageService) TruncateCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	resp := types.CollectionResponse{Collection: request.Collection}
+	if _, err := s.checkDestructive(ctx, request); err != nil {
+		return resp, err
+	}
+	var err error
+	if resp.Snapshot, resp.Warnings, err = s.snapshot(ctx, request.Collection); err != nil {
+		return resp, err
+	}
+	if resp.Documents, err = s.repo.TruncateCollection(ctx, request.Collection); err != nil {
+		return resp, err
+	}
+	sai.Logger().Info("Collection truncated", zap.String("collection", request.Collection), zap.String("snapshot", resp.Snapshot), zap.Int64("deleted", resp.Documents))
+	return resp, nil
+}
+
+// CloneCollection copies a collection with its options and indexes to a new
+// name. Its request log and archives are not copied.
+func (s *StorageService) CloneCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	resp := types.CollectionResponse{Collection: request.To}
+	if err := checkLifecycleName(request.Collection); err != nil {
+		return resp, err
+	}
+	if err := checkNewCollectionName(request.To); err != nil {
+		return resp, err
+	}
+	if err := s.checkEncryptedMove(request.Collection, request.To); err != nil {
+		return resp, err
+	}
+	existing, err := s.existingCollections(ctx)
+	if err != nil {
+		return resp, err
+	}
+	if !existing[request.Collection] {
+		return resp, saiTypes.NewErrorf("collection %q not found", request.Collection)
+	}
+	if existing[request.To] {
+		return resp, saiTypes.NewErrorf("collection %q already exists", request.To)
+	}
+	opts, err := s.repo.CollectionOptions(ctx, request.Collection)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Documents, resp.Warnings, err = s.copyCollection(ctx, request.Collection, request.To, opts); err != nil {
+		return resp, err
+	}
+	sai.Logger().Info("Collection cloned", zap.String("collection", request.Collection), zap.String("to", request.To), zap.Int64("documents", resp.Documents), zap.Strings("warnings", resp.Warnings))
+	return resp, nil
+}
+
+// ConvertCollection changes a collection to capped, time-series, clustered
+// or regular after taking a snapshot. A regular collection becomes capped
+// in place; every other change copies the documents into a new collection
+// with the target options, which then replaces the original. Indexes are
+// created again; those the new type does not support are reported in
+// Warnings.
+func (s *StorageService) ConvertCollection(ctx context.Context, request types.CollectionRequest) (types.CollectionResponse, error) {
+	collection := request.Collection
+	resp := types.CollectionResponse{Collection: collection}
+	if _, err := s.checkDestructive(ctx, request); err != nil {
+		return resp, err
+	}
+	if err := validateCollectionOptions(request.Options); err != nil {
+		return resp, err
+	}
+	current, err := s.repo.CollectionOptions(ctx, collection)
+	if err != nil {
+		return resp, err
+	}
+	if current.Type() == types.CollectionTypeRegular && request.Options.Type() == types.CollectionTypeRegular {
+		return resp, saiTypes.NewErrorf("collection %q is already regular", collection)
+	}
+	indexes, err := s.repo.ListIndexes(ctx, collection)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Snapshot, resp.Warnings, err = s.snapshot(ctx, collection); err != nil {
+		return resp, err
+	}
+
+	if current.Type() == types.CollectionTypeRegular && request.Options.Capped && request.Options.Max == 0 {
+		// convertToCapped keeps only the _id index.
+		if err := s.repo.ConvertToCapped(ctx, collection, request.Options.Size); err != nil {
+			return resp, err
+		}
+		resp.Warnings = append(resp.Warnings, s.createIndexes(ctx, collection, indexes)...)
+		sai.Logger().Info("Collection converted", zap.String("collection", collection), zap.String("type", types.CollectionTypeCapped), zap.String("snapshot", resp.Snapshot), zap.Strings("warnings", resp.Warnings))
+		return resp, nil
+	}
+
+	temp := collection + "_convert_" + uniqueSuffix()
+	if err := ValidateCollectionName(temp); err != nil {
+		return resp, saiTypes.WrapError(err, "collection name is too long to convert")
+	}
+	if err := s.repo.CreateCollection(ctx, temp, request.Options); err != nil {
+		return resp, err
+	}
+	if resp.Documents, err = s.repo.CopyCollection(ctx, collection, temp); err != nil {
+		if dropErr := s.repo.DropCollection(ctx, temp); dropErr != nil {
+			sai.Logger().Warn("Failed to drop conversion copy", zap.String("collection", temp), zap.Error(dropErr))
+		}
+		return resp, err
+	}
+	resp.Warnings = append(resp.Warnings, s.createIndexes(ctx, temp, indexes)...)
+	if err := s.repo.DropCollection(ctx, collection); err != nil {
+		return resp, err
+	}
+	if err := s.repo.RenameCollection(ctx, temp, collection); err != nil {
+		return resp, saiTypes.WrapError(err, fmt.Sprintf("collection was dropped, the converted documents are in %q", temp))
+	}
+	sai.Logger().Info("Collection converted", zap.String("collection", collection), zap.String("type", request.Options.Type()), zap.String("snapshot", resp.Snapshot), zap.Strings("warnings", resp.Warnings))
+	return resp, nil
+}
+
+// checkDestructive checks a drop, truncate or convert request and returns
+// the collections that exist.
+func (s *StorageService) checkDestructive(ctx context.Context, request types.CollectionRequest) (map[string]bool, error) {
+	if err := checkLifecycleName(request.Collection); err != nil {
+		return nil, err
+	}
+	if request.Confirm != request.Collection {
+		return nil, ErrConfirmationMismatch
+	}
+	existing, err := s.existingCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !existing[request.Collection] {
+		return nil, saiTypes.NewErrorf("collection %q not found", request.Collection)
+	}
+	return existing, nil
+}
+
+// snapshot copies a collection before a destructive operation and returns
+// the name of the copy. Empty collections and snapshots themselves are not
+// copied.
+func (s *StorageService) snapshot(ctx context.Context, collection string) (string, []string, error) {
+	if types.IsSnapshotCollection(collection) {
+		return "", nil, nil
+	}
+	name := types.SnapshotCollectionPrefix + collection + "_" + uniqueSuffix()
+	if err := ValidateCollectionName(name); err != nil {
+		return "", nil, saiTypes.WrapError(err, "collection name is too long for a snapshot")
+	}
+	opts, err := s.repo.CollectionOptions(ctx, collection)
+	if err != nil {
+		return "", nil, err
+	}
+	copied, warnings, err := s.copyCollection(ctx, collection, name, opts)
+	if err != nil {
+		return "", nil, saiTypes.WrapError(err, "failed to snapshot collection")
+	}
+	if copied == 0 {
+		if err := s.repo.DropCollection(ctx, name); err != nil {
+			sai.Logger().Warn("Failed to drop empty snapshot", zap.String("collection", name), zap.Error(err))
+		}
+		return "", nil, nil
+	}
+	return name, warnings, nil
+}
+
+// copyCollection creates to with opts and copies the documents and indexes
+// of from into it. A failed copy is dropped again.
+func (s *StorageService) copyCollection(ctx context.Context, from, to string, opts types.CollectionOptions) (int64, []string, error) {
+	indexes, err := s.repo.ListIndexes(ctx, from)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.repo.CreateCollection(ctx, to, opts); err != nil {
+		return 0, nil, err
+	}
+	copied, err := s.repo.CopyCollection(ctx, from, to)
+	if err != nil {
+		if dropErr := s.repo.DropCollection(ctx, to); dropErr != nil {
+			sai.Logger().Warn("Failed to drop partial copy", zap.String("collection", to), zap.Error(dropErr))
+		}
+		return 0, nil, err
+	}
+	return copied, s.createIndexes(ctx, to, indexes), nil
+}
+
+// createIndexes creates indexes on collection with the keys and options
+// they have elsewhere and returns the failures.
+func (s *StorageService) createIndexes(ctx context.Context, collection string, indexes []types.IndexInfo) []string {
+	var failed []string
+	for _, index := range indexes {
+		if index.Name == idIndexName {
+			continue
+		}
+		if err := s.repo.CreateIndex(ctx, index.CreateIndexRequest(collection)); err != nil {
+			failed = append(failed, fmt.Sprintf("index %s: %v", index.Name, err))
+		}
+	}
+	return failed
+}
+
+func (s *StorageService) existingCollections(ctx context.Context) (map[string]bool, error) {
+	names, err := s.repo.ListCollectionNames(ctx)
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to list collections")
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+	return existing, nil
+}
+
+// forgetArchiveIndexes lets writeArchive create the archive indexes again
+// once a collection with that name is written to.
+func (s *StorageService) forgetArchiveIndexes(ctx context.Context, collection string) {
+	s.indexedArchives.Delete(types.TenantCollection(types.TenantFromContext(ctx), collection))
+}
+
+func companionsOf(collection string, existing map[string]bool) []string {
+	var suffixes []string
+	for _, suffix := range types.AuditCollectionSuffixes {
+		if existing[collection+suffix] {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes
+}
+
+// checkEncryptedMove refuses to rename or clone a collection with encrypted
+// fields to another name: its ciphertexts are bound to the collection name
+// and would not decrypt there. A snapshot may be renamed back to the
+// collection it was taken from.
+func (s *StorageService) checkEncryptedMove(from, to string) error {
+	owner := snapshotOrigin(from)
+	if to == owner || s.encryptedFields(owner) == nil {
+		return nil
+	}
+	return saiTypes.NewErrorf("encrypted values of %q are bound to the collection name and cannot be moved to %q", owner, to)
+}
+
+// snapshotOrigin returns the collection a snapshot was taken from, or name
+// itself for any other collection.
+func snapshotOrigin(name string) string {
+	if !types.IsSnapshotCollection(name) {
+		return name
+	}
+	origin := strings.TrimPrefix(name, types.SnapshotCollectionPrefix)
+	if len(origin) <= uniqueSuffixLen {
+		return name
+	}
+	return origin[:len(origin)-uniqueSuffixLen]
+}
+
+// uniqueSuffixLen is the length of "_" + uniqueSuffix().
+const uniqueSuffixLen = len("_20060102_150405_") + 8
+
+// uniqueSuffix names a copy by time and a random part, so two operations
+// in the same second do not collide.
+func uniqueSuffix() string {
+	return time.Now().Format("20060102_150405") + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+}
+
+// checkLifecycleName admits user collections and snapshots: the service's
+// own collections follow the one they belong to.
+func checkLifecycleName(name string) error {
+	if err := ValidateCollectionName(name); err != nil {
+		return err
+	}
+	if collectionClass(name) != collectionClassUser && !types.IsSnapshotCollection(name) {
+		return saiTypes.NewErrorf("collection %q is reserved", name)
+	}
+	return nil
+}
+
+// checkNewCollectionName admits user collections only, so snapshots are
+// never created by hand.
+func checkNewCollectionName(name string) error {
+	if err := ValidateCollectionName(name); err != nil {
+		return err
+	}
+	if collectionClass(name) != collectionClassUser {
+		return saiTypes.NewErrorf("collection %q is reserved", name)
+	}
+	return nil
+}
+
+func validateCollectionOptions(opts types.CollectionOptions) error {
+	set := 0
+	for _, on := range []bool{opts.Capped, opts.TimeSeries != nil, opts.Clustered} {
+		if on {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		return saiTypes.NewError("only one of capped, timeseries and clustered can be set")
+	case opts.Capped && opts.Size <= 0:
+		return saiTypes.NewError("a capped collection needs a size in bytes")
+	case !opts.Capped && (opts.Size != 0 || opts.Max != 0):
+		return saiTypes.NewError("size and max only apply to capped collections")
+	case opts.TimeSeries != nil && opts.TimeSeries.TimeField == "":
+		return saiTypes.NewError("a time-series collection needs a time field")
+	case opts.TimeSeries != nil && !timeSeriesGranularities[opts.TimeSeries.Granularity]:
+		return saiTypes.NewErrorf("unknown granularity %q, use seconds, minutes or hours", opts.TimeSeries.Granularity)
+	case opts.ExpireAfterSeconds < 0:
+		return saiTypes.NewError("expire_after_seconds cannot be negative")
+	case opts.ExpireAfterSeconds > 0 && opts.TimeSeries == nil && !opts.Clustered:
+		return saiTypes.NewError("expire_after_seconds only applies to time-series and clustered collections")
+	}
+	return nil
+}
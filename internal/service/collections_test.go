@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func TestSnapshotOrigin(t *testing.T) {
+	cases := map[string]string{
+		"users": "users",
+		types.SnapshotCollectionPrefix + "users_" + uniqueSuffix():     "users",
+		types.SnapshotCollectionPrefix + "logs.2024_" + uniqueSuffix(): "logs.2024",
+		types.SnapshotCollectionPrefix + "a_b_c_" + uniqueSuffix():     "a_b_c",
+		types.SnapshotCollectionPrefix + "short":                       types.SnapshotCollectionPrefix + "short",
+	}
+	for name, want := range cases {
+		if got := snapshotOrigin(name); got != want {
+			t.Errorf("snapshotOrigin(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCheckEncryptedMove(t *testing.T) {
+	s := testEncryptionService(t)
+	snapshot := types.SnapshotCollectionPrefix + "users_" + uniqueSuffix()
+	cases := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"users", "people", false},
+		{snapshot, "people", false},
+		{snapshot, "users", true},
+		{"orders", "orders_2026", true},
+		{types.SnapshotCollectionPrefix + "orders_" + uniqueSuffix(), "archive", true},
+	}
+	for _, tc := range cases {
+		if err := s.checkEncryptedMove(tc.from, tc.to); (err == nil) != tc.ok {
+			t.Errorf("checkEncryptedMove(%q, %q) = %v, want ok=%v", tc.from, tc.to, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// diffIgnoredFields change on every write and would drown the real changes.
+var diffIgnoredFields = map[string]bool{"_id": true, "ch_time": true}
+
+// documentDiff lists the changed paths between two states of a document.
+// Nested objects are walked; arrays and scalars are compared as a whole.
+func documentDiff(before, after map[string]interface{}) []types.FieldChange {
+	a := map[string]interface{}{}
+	b := map[string]interface{}{}
+	flattenDocument("", before, a)
+	flattenDocument("", after, b)
+
+	var changes []types.FieldChange
+	for path, oldValue := range a {
+		newValue, ok := b[path]
+		switch {
+		case !ok:
+			changes = append(changes, types.FieldChange{Path: path, Op: "removed", Old: oldValue})
+		case !reflect.DeepEqual(normalizeComparable(oldValue), normalizeComparable(newValue)):
+			changes = append(changes, types.FieldChange{Path: path, Op: "changed", Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, types.FieldChange{Path: path, Op: "added", New: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func flattenDocument(prefix string, doc map[string]interface{}, out map[string]interface{}) {
+	for k, v := range doc {
+		if prefix == "" && diffIgnoredFields[k] {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if nested, ok := toMap(v); ok && len(nested) > 0 {
+			flattenDocument(path, nested, out)
+			continue
+		}
+		out[path] = v
+	}
+}
+
+// archiveDiff converts a diff to plain maps so both backends store the same
+// field names.
+func archiveDiff(changes []types.FieldChange) []interface{} {
+	out := make([]interface{}, 0, len(changes))
+	for _, c := range changes {
+		entry := map[string]interface{}{"path": c.Path, "op": c.Op}
+		if c.Op != "added" {
+			entry["old"] = c.Old
+		}
+		if c.Op != "removed" {
+			entry["new"] = c.New
+		}
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func TestDocumentDiff(t *testing.T) {
+	cases := []struct {
+		name   string
+		before map[string]interface{}
+		after  map[string]interface{}
+		want   []types.FieldChange
+	}{
+		{
+			name:   "no changes",
+			before: map[string]interface{}{"a": 1, "b": "x"},
+			after:  map[string]interface{}{"a": 1, "b": "x"},
+			want:   nil,
+		},
+		{
+			name:   "numbers compare by value",
+			before: map[string]interface{}{"a": int32(1)},
+			after:  map[string]interface{}{"a": float64(1)},
+			want:   nil,
+		},
+		{
+			name:   "added, changed and removed",
+			before: map[string]interface{}{"a": 1, "b": "x"},
+			after:  map[string]interface{}{"a": 2, "c": true},
+			want: []types.FieldChange{
+				{Path: "a", Op: "changed", Old: 1, New: 2},
+				{Path: "b", Op: "removed", Old: "x"},
+				{Path: "c", Op: "added", New: true},
+			},
+		},
+		{
+			name:   "nested objects are walked",
+			before: map[string]interface{}{"profile": map[string]interface{}{"city": "Riga", "zip": "1"}},
+			after:  map[string]interface{}{"profile": map[string]interface{}{"city": "Tallinn", "zip": "1"}},
+			want: []types.FieldChange{
+				{Path: "profile.city", Op: "changed", Old: "Riga", New: "Tallinn"},
+			},
+		},
+		{
+			name:   "arrays compare as a whole",
+			before: map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			after:  map[string]interface{}{"tags": []interface{}{"a", "c"}},
+			want: []types.FieldChange{
+				{Path: "tags", Op: "changed", Old: []interface{}{"a", "b"}, New: []interface{}{"a", "c"}},
+			},
+		},
+		{
+			name:   "ignored fields",
+			before: map[string]interface{}{"_id": "1", "ch_time": 100, "a": 1},
+			after:  map[string]interface{}{"_id": "2", "ch_time": 200, "a": 1},
+			want:   nil,
+		},
+		{
+			name:   "ignored names only at the top level",
+			before: map[string]interface{}{"meta": map[string]interface{}{"ch_time": 1}},
+			after:  map[string]interface{}{"meta": map[string]interface{}{"ch_time": 2}},
+			want: []types.FieldChange{
+				{Path: "meta.ch_time", Op: "changed", Old: 1, New: 2},
+			},
+		},
+		{
+			name:   "insert from nothing",
+			before: nil,
+			after:  map[string]interface{}{"a": 1},
+			want: []types.FieldChange{
+				{Path: "a", Op: "added", New: 1},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := documentDiff(tc.before, tc.after)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("documentDiff =\n%#v\nwant\n%#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestArchiveDiff(t *testing.T) {
+	got := archiveDiff([]types.FieldChange{
+		{Path: "a", Op: "changed", Old: 1, New: 2},
+		{Path: "b", Op: "removed", Old: "x"},
+		{Path: "c", Op: "added", New: nil},
+	})
+	want := []interface{}{
+		map[string]interface{}{"path": "a", "op": "changed", "old": 1, "new": 2},
+		map[string]interface{}{"path": "b", "op": "removed", "old": "x"},
+		map[string]interface{}{"path": "c", "op": "added", "new": nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("archiveDiff =\n%#v\nwant\n%#v", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// DistinctValues returns the distinct values of field among documents
+// matching filter. The request carries both a pipeline for Mongo and a
+// group_by for Redis; each repository ignores the form it does not use.
+func (s *StorageService) DistinctValues(ctx context.Context, collection, field string, filter map[string]interface{}) ([]interface{}, error) {
+	match := bson.D{}
+	for key, value := range filter {
+		match = append(match, bson.E{Key: key, Value: value})
+	}
+	resp, err := s.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+		Collection: collection,
+		Filter:     filter,
+		GroupBy:    []string{field},
+		Pipeline: types.OrderedPipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$" + field}}}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(resp.Data))
+	for _, doc := range resp.Data {
+		value, ok := doc["_id"]
+		if !ok {
+			value = doc[field]
+		}
+		values = append(values, value)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		a, aNum := toNumber(values[i])
+		b, bNum := toNumber(values[j])
+		if aNum && bNum {
+			return a < b
+		}
+		return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+	})
+	return values, nil
+}
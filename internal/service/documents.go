@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// ErrDocumentChanged is returned when a document edited in the admin panel
+// was changed or deleted after it was read.
+var ErrDocumentChanged = saiTypes.NewError("document was changed after it was read")
+
+// InsertDocument creates doc as a new document and returns its internal_id.
+// internal_id, cr_time and ch_time are assigned anew, so a copy of an
+// existing document can be passed.
+func (s *StorageService) InsertDocument(ctx context.Context, collection string, doc map[string]interface{}) (string, error) {
+	data := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != "internal_id" && k != "cr_time" && k != "ch_time" {
+			data[k] = v
+		}
+	}
+	id := uuid.New().String()
+	data["internal_id"] = id
+	if _, err := s.CreateDocuments(ctx, types.CreateDocumentsRequest{
+		Collection: collection,
+		Data:       []interface{}{data},
+	}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ReplaceDocument replaces the document with internalID by doc, keeping its
+// _id, internal_id and cr_time. chTime is the ch_time the document had when
+// it was read; if it has changed since, ErrDocumentChanged is returned and
+// nothing is written.
+func (s *StorageService) ReplaceDocument(ctx context.Context, collection, internalID string, chTime interface{}, doc map[string]interface{}) error {
+	filter := map[string]interface{}{"internal_id": internalID, "ch_time": chTime}
+	found, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: collection,
+		Filter:     filter,
+		Limit:      1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(found.Data) == 0 {
+		return ErrDocumentChanged
+	}
+	resp, err := s.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+		Collection: collection,
+		Filter:     filter,
+		Data:       replacementUpdate(found.Data[0], doc),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Updated == 0 {
+		return ErrDocumentChanged
+	}
+	return nil
+}
+
+// DeleteDocument deletes the document with internalID if its ch_time is
+// still chTime. deletedBy is recorded on soft-deleted documents.
+func (s *StorageService) DeleteDocument(ctx context.Context, collection, internalID string, chTime interface{}, deletedBy string) error {
+	resp, err := s.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+		Collection: collection,
+		Filter:     map[string]interface{}{"internal_id": internalID, "ch_time": chTime},
+		DeletedBy:  deletedBy,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return ErrDocumentChanged
+	}
+	return nil
+}
+
+// CollectionSchema returns the validator of a collection, or nil if it has
+// none. Writes are checked against it by the database.
+func (s *StorageService) CollectionSchema(ctx context.Context, collection string) (map[string]interface{}, error) {
+	return s.repo.CollectionValidator(ctx, collection)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+const dryRunSampleSize = 20
+
+// dryRunMatches counts the documents filter matches and returns the first few.
+func (s *StorageService) dryRunMatches(ctx context.Context, collection string, filter map[string]interface{}) ([]map[string]interface{}, int64, error) {
+	docs, total, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: collection,
+		Filter:     filter,
+		Limit:      dryRunSampleSize,
+		Count:      1,
+	})
+	if err != nil {
+		return nil, 0, saiTypes.WrapError(err, "failed to read matching documents")
+	}
+	return docs, total, nil
+}
+
+// dryRunUpdate previews an update without writing or archiving. Post-images
+// are computed in memory; an upsert that matches nothing previews the
+// document it would insert.
+func (s *StorageService) dryRunUpdate(ctx context.Context, request types.UpdateDocumentsRequest) (types.UpdateDocumentsResponse, error) {
+	update, err := toDocumentMap(request.Data)
+	if err != nil {
+		return types.UpdateDocumentsResponse{}, saiTypes.NewError("update data must be a map")
+	}
+
+	docs, matched, err := s.dryRunMatches(ctx, request.Collection, request.Filter)
+	if err != nil {
+		return types.UpdateDocumentsResponse{}, err
+	}
+
+	postImages := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		post, err := applyUpdate(doc, update, false)
+		if err != nil {
+			return types.UpdateDocumentsResponse{}, err
+		}
+		postImages = append(postImages, post)
+	}
+	if matched == 0 && request.Upsert {
+		seed := make(map[string]interface{})
+		for k, v := range scopeEqualityFields(request.Filter) {
+			setPath(seed, k, v)
+		}
+		post, err := applyUpdate(seed, update, true)
+		if err != nil {
+			return types.UpdateDocumentsResponse{}, err
+		}
+		postImages = append(postImages, post)
+	}
+
+	s.decryptDocuments(request.Collection, docs)
+	s.decryptDocuments(request.Collection, postImages)
+	return types.UpdateDocumentsResponse{
+		Data:       []string{},
+		DryRun:     true,
+		Matched:    matched,
+		Sample:     docs,
+		PostImages: postImages,
+	}, nil
+}
+
+func (s *StorageService) dryRunDelete(ctx context.Context, request types.DeleteDocumentsRequest) (types.DeleteDocumentsResponse, error) {
+	docs, matched, err := s.dryRunMatches(ctx, request.Collection, request.Filter)
+	if err != nil {
+		return types.DeleteDocumentsResponse{}, err
+	}
+	s.decryptDocuments(request.Collection, docs)
+	return types.DeleteDocumentsResponse{
+		Data:    []string{},
+		DryRun:  true,
+		Matched: matched,
+		Sample:  docs,
+	}, nil
+}
@@ -0,0 +1,649 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maskedValue         = "[encrypted]"
+	reencryptBatchSize  = 500
+	omittedRawBodyValue = "[omitted: field encryption is enabled]"
+)
+
+func (s *StorageService) EncryptionEnabled() bool {
+	return s.encryption.Enabled
+}
+
+// encryptedFields maps every encrypted path of the collection to whether it
+// uses deterministic mode. It returns nil when nothing is encrypted.
+func (s *StorageService) encryptedFields(collection string) map[string]bool {
+	if !s.encryption.Enabled {
+		return nil
+	}
+	cfg, ok := s.encryption.Collections[collection]
+	if !ok {
+		return nil
+	}
+	fields := make(map[string]bool, len(cfg.Deterministic)+len(cfg.Randomized))
+	for _, f := range cfg.Randomized {
+		fields[f] = false
+	}
+	for _, f := range cfg.Deterministic {
+		fields[f] = true
+	}
+	return fields
+}
+
+func (s *StorageService) ReloadEncryptionKeys() error {
+	return s.keys.load(s.encryption.KeyFile)
+}
+
+func (s *StorageService) EncryptionStatus() types.EncryptionStatus {
+	active, ids, loadErr := s.keys.status()
+	status := types.EncryptionStatus{
+		Enabled:     s.encryption.Enabled,
+		KeyFile:     s.encryption.KeyFile,
+		ActiveKey:   active,
+		KeyIDs:      ids,
+		Collections: s.encryption.Collections,
+	}
+	if loadErr != nil {
+		status.LoadError = loadErr.Error()
+	}
+	return status
+}
+
+func encryptionScope(collection, field string) string {
+	return collection + "." + field
+}
+
+// touchesField reports whether path addresses the encrypted field, something
+// inside it, or a document that contains it.
+func touchesField(path, field string) bool {
+	return path == field || strings.HasPrefix(field, path+".") || strings.HasPrefix(path, field+".")
+}
+
+func (s *StorageService) encryptDocuments(collection string, data []interface{}) ([]interface{}, error) {
+	fields := s.encryptedFields(collection)
+	if fields == nil {
+		return data, nil
+	}
+	out := make([]interface{}, 0, len(data))
+	for _, item := range data {
+		doc, err := toDocumentMap(item)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.encryptPaths(collection, fields, doc, ""); err != nil {
+			return nil, err
+		}
+		out = append(out, doc)
+	}
+	return out, nil
+}
+
+// encryptPaths encrypts the encrypted fields found in doc, where doc sits at
+// prefix inside the stored document. Keys may be dotted paths.
+func (s *StorageService) encryptPaths(collection string, fields map[string]bool, doc map[string]interface{}, prefix string) error {
+	for key, value := range doc {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if deterministic, ok := fields[path]; ok {
+			sealed, err := s.keys.encrypt(value, encryptionScope(collection, path), deterministic)
+			if err != nil {
+				return err
+			}
+			doc[key] = sealed
+			continue
+		}
+		for field := range fields {
+			if strings.HasPrefix(path, field+".") {
+				return saiTypes.NewErrorf("cannot write %q inside encrypted field %q", path, field)
+			}
+			if strings.HasPrefix(field, path+".") {
+				if sub, ok := value.(map[string]interface{}); ok {
+					if err := s.encryptPaths(collection, fields, sub, path); err != nil {
+						return err
+					}
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// encryptUpdate encrypts values written by $set/$setOnInsert (or a plain
+// replacement document) and rejects other operators on encrypted fields.
+func (s *StorageService) encryptUpdate(collection string, data interface{}) (interface{}, error) {
+	fields := s.encryptedFields(collection)
+	if fields == nil {
+		return data, nil
+	}
+	doc, err := toDocumentMap(data)
+	if err != nil {
+		return nil, saiTypes.NewError("update data must be a map")
+	}
+
+	hasOperators := false
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			hasOperators = true
+			break
+		}
+	}
+	if !hasOperators {
+		return doc, s.encryptPaths(collection, fields, doc, "")
+	}
+
+	for op, value := range doc {
+		sub, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch op {
+		case "$set", "$setOnInsert":
+			if err := s.encryptPaths(collection, fields, sub, ""); err != nil {
+				return nil, err
+			}
+		case "$unset":
+		default:
+			for path := range sub {
+				for field := range fields {
+					if touchesField(path, field) {
+						return nil, saiTypes.NewErrorf("%s is not supported on encrypted field %q", op, field)
+					}
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// encryptFilter rewrites equality conditions on deterministic fields to match
+// their ciphertexts under every key in the ring. Randomized fields can only be
+// tested with $exists.
+func (s *StorageService) encryptFilter(collection string, filter map[string]interface{}) (map[string]interface{}, error) {
+	fields := s.encryptedFields(collection)
+	if fields == nil || len(filter) == 0 {
+		return filter, nil
+	}
+	return s.rewriteFilter(collection, fields, filter)
+}
+
+func (s *StorageService) rewriteFilter(collection string, fields map[string]bool, filter map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(filter))
+	for key, value := range filter {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			items, ok := value.([]interface{})
+			if !ok {
+				out[key] = value
+				continue
+			}
+			rewritten := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					rewritten = append(rewritten, item)
+					continue
+				}
+				r, err := s.rewriteFilter(collection, fields, sub)
+				if err != nil {
+					return nil, err
+				}
+				rewritten = append(rewritten, r)
+			}
+			out[key] = rewritten
+		case strings.HasPrefix(key, "$"):
+			out[key] = value
+		default:
+			deterministic, encrypted := fields[key]
+			if !encrypted {
+				for field := range fields {
+					if touchesField(key, field) {
+						return nil, saiTypes.NewErrorf("cannot filter on %q: field %q is encrypted", key, field)
+					}
+				}
+				out[key] = value
+				continue
+			}
+			cond, err := s.rewriteCondition(collection, key, deterministic, value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = cond
+		}
+	}
+	return out, nil
+}
+
+func (s *StorageService) rewriteCondition(collection, field string, deterministic bool, value interface{}) (interface{}, error) {
+	scope := encryptionScope(collection, field)
+	ops, isOps := value.(map[string]interface{})
+	if isOps {
+		for op := range ops {
+			if !strings.HasPrefix(op, "$") {
+				isOps = false
+				break
+			}
+		}
+	}
+
+	if !deterministic {
+		if isOps && len(ops) == 1 && ops["$exists"] != nil {
+			return value, nil
+		}
+		return nil, saiTypes.NewErrorf("field %q is encrypted in randomized mode and can only be filtered with $exists", field)
+	}
+
+	if !isOps {
+		candidates, err := s.keys.equalityCandidates(value, scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) == 1 {
+			return candidates[0], nil
+		}
+		return map[string]interface{}{"$in": candidates}, nil
+	}
+
+	out := make(map[string]interface{}, len(ops))
+	for op, arg := range ops {
+		switch op {
+		case "$exists":
+			out[op] = arg
+		case "$eq", "$ne":
+			candidates, err := s.keys.equalityCandidates(arg, scope)
+			if err != nil {
+				return nil, err
+			}
+			target := "$in"
+			if op == "$ne" {
+				target = "$nin"
+			}
+			out[target] = append(toInterfaceSlice(out[target]), candidates...)
+		case "$in", "$nin":
+			items, ok := arg.([]interface{})
+			if !ok {
+				return nil, saiTypes.NewErrorf("%s on encrypted field %q requires an array", op, field)
+			}
+			all := toInterfaceSlice(out[op])
+			for _, item := range items {
+				candidates, err := s.keys.equalityCandidates(item, scope)
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, candidates...)
+			}
+			out[op] = all
+		default:
+			return nil, saiTypes.NewErrorf("%s is not supported on encrypted field %q", op, field)
+		}
+	}
+	return out, nil
+}
+
+// encryptPipeline rewrites the $match stages of an aggregation the same way as
+// a filter.
+func (s *StorageService) encryptPipeline(collection string, pipeline types.OrderedPipeline) (types.OrderedPipeline, error) {
+	fields := s.encryptedFields(collection)
+	if fields == nil {
+		return pipeline, nil
+	}
+	out := make(types.OrderedPipeline, 0, len(pipeline))
+	for _, stage := range pipeline {
+		rewritten := make(bson.D, 0, len(stage))
+		for _, elem := range stage {
+			if elem.Key == "$match" {
+				match, err := bsonToMap(elem.Value)
+				if err != nil {
+					return nil, err
+				}
+				r, err := s.rewriteFilter(collection, fields, match)
+				if err != nil {
+					return nil, err
+				}
+				doc, err := mapToBson(r)
+				if err != nil {
+					return nil, err
+				}
+				elem = bson.E{Key: elem.Key, Value: doc}
+			}
+			rewritten = append(rewritten, elem)
+		}
+		out = append(out, rewritten)
+	}
+	return out, nil
+}
+
+// decryptDocuments replaces every ciphertext found in docs with its plaintext.
+// A ciphertext opens only at the path it was written to, so values moved to
+// another field (by a client or an aggregation stage) are left encrypted, as
+// are values that cannot be opened.
+func (s *StorageService) decryptDocuments(collection string, docs []map[string]interface{}) {
+	if !s.encryption.Enabled {
+		return
+	}
+	for _, doc := range docs {
+		for k, v := range doc {
+			doc[k] = s.decryptValue(collection, k, v)
+		}
+	}
+}
+
+func (s *StorageService) decryptValue(collection, path string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if plain, _, ok := s.keys.decrypt(t, encryptionScope(collection, path)); ok {
+			return plain
+		}
+		return t
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = s.decryptValue(collection, path+"."+k, item)
+		}
+		return t
+	case bson.M:
+		for k, item := range t {
+			t[k] = s.decryptValue(collection, path+"."+k, item)
+		}
+		return t
+	case bson.D:
+		for i := range t {
+			t[i].Value = s.decryptValue(collection, path+"."+t[i].Key, t[i].Value)
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = s.decryptValue(collection, path, t[i])
+		}
+		return t
+	case bson.A:
+		for i := range t {
+			t[i] = s.decryptValue(collection, path, t[i])
+		}
+		return t
+	}
+	return v
+}
+
+// MaskEncrypted returns a copy of a request body that is safe to log: values
+// of encrypted fields are masked and unparsed raw bodies are dropped.
+func (s *StorageService) MaskEncrypted(body interface{}) interface{} {
+	if !s.encryption.Enabled || body == nil {
+		return body
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return body
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return body
+	}
+
+	if _, ok := m["raw_body"]; ok {
+		m["raw_body"] = omittedRawBodyValue
+	}
+	collection, _ := m["collection"].(string)
+	fields := s.encryptedFields(collection)
+	if fields == nil {
+		return m
+	}
+	for _, key := range []string{"data", "filter", "pipeline"} {
+		if v, ok := m[key]; ok {
+			m[key] = maskFields(v, fields, "")
+		}
+	}
+	return m
+}
+
+func maskFields(v interface{}, fields map[string]bool, prefix string) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		for i := range t {
+			t[i] = maskFields(t[i], fields, prefix)
+		}
+		return t
+	case map[string]interface{}:
+		for key, value := range t {
+			if strings.HasPrefix(key, "$") {
+				t[key] = maskFields(value, fields, prefix)
+				continue
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			for field := range fields {
+				if path == field || strings.HasPrefix(path, field+".") {
+					t[key] = maskedValue
+					break
+				}
+				if strings.HasPrefix(field, path+".") {
+					t[key] = maskFields(value, fields, path)
+					break
+				}
+			}
+		}
+		return t
+	}
+	return v
+}
+
+// ReencryptCollection rewrites the encrypted fields of every document under
+// the active key. It completes a key rotation and also encrypts values stored
+// before a field was configured for encryption.
+func (s *StorageService) ReencryptCollection(ctx context.Context, collection string) (int64, error) {
+	fields := s.encryptedFields(collection)
+	if fields == nil {
+		return 0, saiTypes.NewErrorf("collection %q has no encrypted fields", collection)
+	}
+	active, _, err := s.keys.activeKey()
+	if err != nil {
+		return 0, err
+	}
+
+	paths := make([]string, 0, len(fields))
+	for f := range fields {
+		paths = append(paths, f)
+	}
+	sort.Strings(paths)
+
+	var updated int64
+	for skip := 0; ; skip += reencryptBatchSize {
+		docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: collection,
+			Sort:       map[string]int{"internal_id": 1},
+			Skip:       skip,
+			Limit:      reencryptBatchSize,
+		})
+		if err != nil {
+			return updated, saiTypes.WrapError(err, "failed to read documents for re-encryption")
+		}
+
+		for _, doc := range docs {
+			id, _ := doc["internal_id"].(string)
+			if id == "" {
+				continue
+			}
+			set := make(map[string]interface{})
+			for _, path := range paths {
+				value, found := lookupPath(doc, path)
+				if !found {
+					continue
+				}
+				if str, ok := value.(string); ok {
+					if keyID, _, isEnc := parseEncrypted(str); isEnc {
+						if keyID == active {
+							continue
+						}
+						plain, _, ok := s.keys.decrypt(str, encryptionScope(collection, path))
+						if !ok {
+							return updated, saiTypes.NewErrorf("cannot decrypt %q of document %s with key %q", path, id, keyID)
+						}
+						value = plain
+					}
+				}
+				sealed, err := s.keys.encrypt(normalizeValue(value), encryptionScope(collection, path), fields[path])
+				if err != nil {
+					return updated, err
+				}
+				set[path] = sealed
+			}
+			if len(set) == 0 {
+				continue
+			}
+			if _, err := s.repo.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+				Collection: collection,
+				Filter:     map[string]interface{}{"internal_id": id},
+				Data:       map[string]interface{}{"$set": set},
+			}); err != nil {
+				return updated, saiTypes.WrapError(err, "failed to re-encrypt document")
+			}
+			updated++
+		}
+
+		if len(docs) < reencryptBatchSize {
+			return updated, nil
+		}
+	}
+}
+
+func lookupPath(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		switch t := current.(type) {
+		case map[string]interface{}:
+			v, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case bson.M:
+			v, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case bson.D:
+			found := false
+			for _, e := range t {
+				if e.Key == part {
+					current, found = e.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// normalizeValue converts driver types to their JSON form so deterministic
+// ciphertexts match those produced from API input.
+func normalizeValue(v interface{}) interface{} {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// toDocumentMap copies a document into plain maps and slices that can be
+// rewritten in place. Values keep their types, so dates, ObjectIDs, int64 and
+// decimals are written as they came; other documents, such as structs, are
+// read through BSON.
+func toDocumentMap(v interface{}) (map[string]interface{}, error) {
+	if doc, ok := plainDocument(v).(map[string]interface{}); ok {
+		return doc, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, saiTypes.NewError("document must be a map")
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to decode document")
+	}
+	return plainDocument(doc).(map[string]interface{}), nil
+}
+
+func plainDocument(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			out[k] = plainDocument(child)
+		}
+		return out
+	case bson.M:
+		return plainDocument(map[string]interface{}(t))
+	case bson.D:
+		out := make(map[string]interface{}, len(t))
+		for _, e := range t {
+			out[e.Key] = plainDocument(e.Value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = plainDocument(child)
+		}
+		return out
+	case bson.A:
+		return plainDocument([]interface{}(t))
+	}
+	return v
+}
+
+// bsonToMap and mapToBson round-trip a stage through relaxed extended JSON so
+// it can be rewritten like an API filter without losing dates or ObjectIDs.
+func bsonToMap(v interface{}) (map[string]interface{}, error) {
+	raw, err := bson.MarshalExtJSON(v, false, false)
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to encode $match stage")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to decode $match stage")
+	}
+	return m, nil
+}
+
+func mapToBson(m map[string]interface{}) (bson.D, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to encode $match stage")
+	}
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+		return nil, saiTypes.WrapError(err, "failed to decode $match stage")
+	}
+	return doc, nil
+}
+
+func toInterfaceSlice(v interface{}) []interface{} {
+	if s, ok := v.([]interface{}); ok {
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func testEncryptionService(t *testing.T) *StorageService {
+	t.Helper()
+	s := &StorageService{encryption: types.EncryptionConfig{
+		Enabled: true,
+		KeyFile: writeTestKeyFile(t, "k1", "k1"),
+		Collections: map[string]types.EncryptedFieldsConfig{
+			"users": {Deterministic: []string{"email"}, Randomized: []string{"passport", "profile.phone"}},
+		},
+	}}
+	if err := s.ReloadEncryptionKeys(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEncryptDocumentsEncryptsEveryValue(t *testing.T) {
+	s := testEncryptionService(t)
+	other, err := s.keys.encrypt("stolen", "users.passport", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		path  string
+		value interface{}
+	}{
+		{"plain", "email", "alice@example.com"},
+		{"ciphertext-looking", "email", "enc:v1:k1:AAAA"},
+		{"ciphertext from another field", "email", other},
+		{"nested", "profile.phone", "+371 2000 0000"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := map[string]interface{}{}
+			setPath(doc, tc.path, tc.value)
+			out, err := s.encryptDocuments("users", []interface{}{doc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := out[0].(map[string]interface{})
+			got, _ := lookupPath(stored, tc.path)
+			if got == tc.value {
+				t.Fatalf("%s was stored unencrypted", tc.path)
+			}
+			if str, _ := got.(string); !strings.HasPrefix(str, encryptedValuePrefix) {
+				t.Fatalf("%s stored as %#v", tc.path, got)
+			}
+
+			s.decryptDocuments("users", []map[string]interface{}{stored})
+			if got, _ := lookupPath(stored, tc.path); got != tc.value {
+				t.Fatalf("read back %#v, want %#v", got, tc.value)
+			}
+		})
+	}
+}
+
+func TestDecryptDocumentsBindsPath(t *testing.T) {
+	s := testEncryptionService(t)
+	passport, _ := s.keys.encrypt("LV123", "users.passport", false)
+	phone, _ := s.keys.encrypt("+371", "users.profile.phone", false)
+
+	doc := map[string]interface{}{
+		"passport": passport,
+		"email":    passport,
+		"profile":  map[string]interface{}{"phone": phone},
+		"copies":   []interface{}{map[string]interface{}{"passport": passport}},
+	}
+	s.decryptDocuments("users", []map[string]interface{}{doc})
+
+	if doc["passport"] != "LV123" {
+		t.Errorf("passport = %#v", doc["passport"])
+	}
+	if doc["email"] != passport {
+		t.Errorf("ciphertext moved to email was decrypted: %#v", doc["email"])
+	}
+	if got, _ := lookupPath(doc, "profile.phone"); got != "+371" {
+		t.Errorf("profile.phone = %#v", got)
+	}
+	if got := doc["copies"].([]interface{})[0].(map[string]interface{})["passport"]; got != passport {
+		t.Errorf("ciphertext moved to copies.passport was decrypted: %#v", got)
+	}
+
+	moved := map[string]interface{}{"passport": passport}
+	s.decryptDocuments("orders", []map[string]interface{}{moved})
+	if moved["passport"] != passport {
+		t.Errorf("ciphertext moved to another collection was decrypted")
+	}
+}
+
+func TestEncryptDocumentsKeepsValueTypes(t *testing.T) {
+	s := testEncryptionService(t)
+	at := primitive.NewDateTimeFromTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	oid := primitive.NewObjectID()
+	dec, _ := primitive.ParseDecimal128("12.50")
+	profile := bson.D{{Key: "phone", Value: "+371"}, {Key: "since", Value: at}}
+	input := map[string]interface{}{
+		"email":   "alice@example.com",
+		"at":      at,
+		"ref":     oid,
+		"count":   int64(9007199254740993),
+		"price":   dec,
+		"tags":    bson.A{"a", int32(1)},
+		"profile": profile,
+	}
+
+	out, err := s.encryptDocuments("users", []interface{}{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := out[0].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"at":    at,
+		"ref":   oid,
+		"count": int64(9007199254740993),
+		"price": dec,
+		"tags":  []interface{}{"a", int32(1)},
+	} {
+		if !reflect.DeepEqual(doc[key], want) {
+			t.Errorf("%s = %#v (%T), want %#v (%T)", key, doc[key], doc[key], want, want)
+		}
+	}
+	if got, _ := lookupPath(doc, "profile.since"); got != at {
+		t.Errorf("profile.since = %#v", got)
+	}
+	if got, _ := lookupPath(doc, "profile.phone"); got == "+371" {
+		t.Error("profile.phone was not encrypted")
+	}
+	if input["email"] != "alice@example.com" || profile[0].Value != "+371" {
+		t.Error("the caller's document was modified")
+	}
+}
+
+func TestToDocumentMap(t *testing.T) {
+	type record struct {
+		Name string    `bson:"name"`
+		At   time.Time `bson:"at"`
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc, err := toDocumentMap(record{Name: "x", At: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["name"] != "x" || doc["at"] != primitive.NewDateTimeFromTime(at) {
+		t.Fatalf("struct document = %#v", doc)
+	}
+	for _, v := range []interface{}{nil, "text", []interface{}{1}} {
+		if _, err := toDocumentMap(v); err == nil {
+			t.Errorf("toDocumentMap(%#v) accepted a non-document", v)
+		}
+	}
+}
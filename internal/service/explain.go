@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+// Explain returns the plan the database would use for a query, with the
+// same encryption and soft-delete rewriting a real read gets.
+func (s *StorageService) Explain(ctx context.Context, request types.ExplainRequest) (types.ExplainResponse, error) {
+	if err := s.validator.Struct(request); err != nil {
+		return types.ExplainResponse{}, saiTypes.WrapError(err, "validation failed")
+	}
+	if request.Operation == "" {
+		request.Operation = "find"
+	}
+
+	filter, err := s.encryptFilter(request.Collection, request.Filter)
+	if err != nil {
+		return types.ExplainResponse{}, err
+	}
+	request.Filter = filter
+	pipeline, err := s.encryptPipeline(request.Collection, request.Pipeline)
+	if err != nil {
+		return types.ExplainResponse{}, err
+	}
+	request.Pipeline = pipeline
+
+	switch request.Operation {
+	case "find":
+		request.Filter = s.hideDeletedRead(types.ReadDocumentsRequest{Collection: request.Collection, Filter: request.Filter}).Filter
+	case "aggregate":
+		request.Pipeline = s.hideDeletedAggregate(types.AggregateDocumentsRequest{Collection: request.Collection, Pipeline: request.Pipeline}).Pipeline
+	}
+
+	plan, err := s.repo.Explain(ctx, request)
+	if err != nil {
+		return types.ExplainResponse{}, err
+	}
+	return types.ExplainResponse{Data: plan}, nil
+}
+
+const (
+	slowQueryQueueSize = 256
+	// planCaptureInterval is how long a captured plan is reused for slow
+	// queries of the same shape before it is explained again.
+	planCaptureInterval = 10 * time.Minute
+	// planCaptureGap spaces explains apart, so a burst of new shapes does
+	// not turn into a burst of explains.
+	planCaptureGap = time.Second
+	maxPlanShapes  = 1000
+)
+
+type slowQueryEntry struct {
+	ctx         context.Context
+	collection  string
+	operation   string
+	durationMs  int64
+	docsCount   int64
+	fKeys       []string
+	sortKeys    map[string]int
+	operationID string
+	query       *types.ExplainRequest
+}
+
+type capturedPlan struct {
+	plan *types.QueryPlan
+	at   time.Time
+}
+
+// slowQueryLog writes slow queries from a single goroutine. Each query shape
+// is explained at most once per planCaptureInterval and the plan is reused
+// in between, because explain re-runs the query. Entries are dropped when
+// the queue is full.
+type slowQueryLog struct {
+	entries     chan slowQueryEntry
+	plans       map[string]capturedPlan
+	lastCapture time.Time
+	dropped     atomic.Int64
+	stop        chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func (s *StorageService) startSlowQueryLog() {
+	s.slowLog = &slowQueryLog{
+		entries: make(chan slowQueryEntry, slowQueryQueueSize),
+		plans:   make(map[string]capturedPlan),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.slowQueryLoop()
+}
+
+func (s *StorageService) stopSlowQueryLog() {
+	if l := s.slowLog; l != nil {
+		l.closeOnce.Do(func() { close(l.stop) })
+		<-l.done
+	}
+}
+
+func (s *StorageService) logSlowQuery(entry slowQueryEntry) {
+	select {
+	case s.slowLog.entries <- entry:
+	default:
+		s.slowLog.dropped.Add(1)
+	}
+}
+
+func (s *StorageService) slowQueryLoop() {
+	l := s.slowLog
+	defer close(l.done)
+	for {
+		select {
+		case entry := <-l.entries:
+			s.writeSlowQuery(entry)
+		case <-l.stop:
+			for len(l.entries) > 0 {
+				s.writeSlowQuery(<-l.entries)
+			}
+			if dropped := l.dropped.Load(); dropped > 0 {
+				sai.Logger().Warn("Slow queries dropped, queue was full", zap.Int64("dropped", dropped))
+			}
+			return
+		}
+	}
+}
+
+func (s *StorageService) writeSlowQuery(e slowQueryEntry) {
+	plan := s.slowQueryPlan(e)
+	if err := s.repo.LogSlowQuery(e.ctx, e.collection, e.operation, e.durationMs, e.docsCount, e.fKeys, e.sortKeys, e.operationID, plan); err != nil {
+		sai.Logger().Debug("Failed to log slow query", zap.String("collection", e.collection), zap.Error(err))
+	}
+}
+
+// slowQueryPlan returns the plan of the entry's shape, explaining it only if
+// the cached plan is stale and no explain ran within planCaptureGap.
+func (s *StorageService) slowQueryPlan(e slowQueryEntry) *types.QueryPlan {
+	if e.query == nil {
+		return nil
+	}
+	l := s.slowLog
+	shape := fmt.Sprintf("%s|%s|%s|%v|%v", types.TenantFromContext(e.ctx), e.collection, e.operation, e.fKeys, e.sortKeys)
+	now := time.Now()
+	cached, ok := l.plans[shape]
+	if (ok && now.Sub(cached.at) < planCaptureInterval) || now.Sub(l.lastCapture) < planCaptureGap {
+		return cached.plan
+	}
+
+	l.lastCapture = now
+	plan := s.capturePlan(e.ctx, e.query)
+	if len(l.plans) >= maxPlanShapes {
+		for key, p := range l.plans {
+			if now.Sub(p.at) >= planCaptureInterval {
+				delete(l.plans, key)
+			}
+		}
+	}
+	if len(l.plans) < maxPlanShapes {
+		l.plans[shape] = capturedPlan{plan: plan, at: now}
+	}
+	return plan
+}
+
+// capturePlan explains a slow query for the slow query log. The full plan
+// tree is dropped; the summary, stages and examined counts are kept.
+// Updates and deletes are explained as a find with their filter.
+func (s *StorageService) capturePlan(ctx context.Context, query *types.ExplainRequest) *types.QueryPlan {
+	plan, err := s.repo.Explain(ctx, *query)
+	if err != nil {
+		sai.Logger().Debug("Failed to capture slow query plan", zap.String("collection", query.Collection), zap.Error(err))
+		return nil
+	}
+	plan.WinningPlan = nil
+	return &plan
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultExportMaxRows   = 100000
+	defaultExportBatchSize = 1000
+)
+
+// ExportLimit bounds a requested row count by the configured cap. Zero or
+// less asks for the cap itself.
+func (s *StorageService) ExportLimit(requested int) int {
+	max := s.export.MaxRows
+	if max <= 0 {
+		max = defaultExportMaxRows
+	}
+	if requested <= 0 || requested > max {
+		return max
+	}
+	return requested
+}
+
+// ForEachQueryRow passes the rows of a read query to fn, at most limit of
+// them, and returns how many were passed. A find is read in batches, so the
+// whole result is never held in memory; its own .limit() and .skip() apply.
+// countDocuments yields a single {count} row and distinct one row per value.
+func (s *StorageService) ForEachQueryRow(ctx context.Context, q *shell.Query, limit int, fn func(map[string]interface{}) error) (int, error) {
+	switch q.Operation {
+	case shell.OpFind, shell.OpFindOne:
+		return s.forEachFoundRow(ctx, q, limit, fn)
+	case shell.OpAggregate:
+		pipeline := make(types.OrderedPipeline, 0, len(q.Pipeline)+1)
+		pipeline = append(pipeline, q.Pipeline...)
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: int64(limit)}})
+		resp, err := s.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+			Collection: q.Collection,
+			Pipeline:   pipeline,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for i, doc := range resp.Data {
+			if err := fn(doc); err != nil {
+				return i, err
+			}
+		}
+		return len(resp.Data), nil
+	case shell.OpCount:
+		result, err := s.RunQuery(ctx, q, false, "")
+		if err != nil {
+			return 0, err
+		}
+		return 1, fn(map[string]interface{}{"count": result.Total})
+	case shell.OpDistinct:
+		values, err := s.DistinctValues(ctx, q.Collection, q.Field, q.Filter)
+		if err != nil {
+			return 0, err
+		}
+		if len(values) > limit {
+			values = values[:limit]
+		}
+		for i, v := range values {
+			if err := fn(map[string]interface{}{q.Field: v}); err != nil {
+				return i, err
+			}
+		}
+		return len(values), nil
+	}
+	return 0, saiTypes.NewErrorf("%s cannot be exported, only read queries can", q.Method)
+}
+
+// forEachFoundRow reads a find from a single cursor, a batch at a time, so
+// a long export costs one query rather than one per page.
+func (s *StorageService) forEachFoundRow(ctx context.Context, q *shell.Query, limit int, fn func(map[string]interface{}) error) (int, error) {
+	if q.Operation == shell.OpFindOne {
+		limit = 1
+	}
+	if q.Limit > 0 && q.Limit < limit {
+		limit = q.Limit
+	}
+	batch := s.export.BatchSize
+	if batch <= 0 {
+		batch = defaultExportBatchSize
+	}
+
+	filter, err := s.encryptFilter(q.Collection, q.Filter)
+	if err != nil {
+		return 0, err
+	}
+	request := s.hideDeletedRead(types.ReadDocumentsRequest{
+		Collection: q.Collection,
+		Filter:     filter,
+		Sort:       q.Sort,
+		Fields:     q.Fields,
+		Skip:       q.Skip,
+		Limit:      limit,
+	})
+
+	t := time.Now()
+	n := 0
+	var fnErr error
+	err = s.repo.ForEachDocument(ctx, request, batch, func(doc map[string]interface{}) error {
+		s.decryptDocuments(request.Collection, []map[string]interface{}{doc})
+		if fnErr = fn(doc); fnErr != nil {
+			return fnErr
+		}
+		n++
+		return nil
+	})
+	if fnErr != nil {
+		return n, fnErr
+	}
+	if err != nil {
+		s.failedOp(ctx, request.Collection, "find", time.Since(t))
+		return n, saiTypes.WrapError(err, "failed to get documents")
+	}
+	s.afterOp(ctx, request.Collection, "find", time.Since(t), int64(n), filterKeys(request.Filter), request.Sort, &types.ExplainRequest{
+		Collection: request.Collection,
+		Operation:  "find",
+		Filter:     request.Filter,
+		Sort:       request.Sort,
+		Limit:      request.Limit,
+		Skip:       request.Skip,
+	})
+	return n, nil
+}
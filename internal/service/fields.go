@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultFieldSample = 200
+	maxFieldDepth      = 4
+)
+
+// SampleFields infers the fields of a collection from a random sample of n
+// documents. Embedded documents, also inside arrays, are walked up to
+// maxFieldDepth levels. Fields are sorted by path.
+func (s *StorageService) SampleFields(ctx context.Context, collection string, n int) ([]types.FieldInfo, error) {
+	if n <= 0 {
+		n = defaultFieldSample
+	}
+	resp, err := s.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+		Collection: collection,
+		Pipeline:   types.OrderedPipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]*types.FieldInfo)
+	typeSets := make(map[string]map[string]struct{})
+	for _, doc := range resp.Data {
+		seen := make(map[string]struct{})
+		walkFields(doc, "", 0, func(path, typ string) {
+			f, ok := fields[path]
+			if !ok {
+				f = &types.FieldInfo{Path: path}
+				fields[path] = f
+				typeSets[path] = make(map[string]struct{})
+			}
+			if _, ok := typeSets[path][typ]; !ok {
+				typeSets[path][typ] = struct{}{}
+				f.Types = append(f.Types, typ)
+			}
+			if _, ok := seen[path]; !ok {
+				seen[path] = struct{}{}
+				f.Count++
+			}
+		})
+	}
+
+	out := make([]types.FieldInfo, 0, len(fields))
+	for _, f := range fields {
+		sort.Strings(f.Types)
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+func walkFields(doc map[string]interface{}, prefix string, depth int, visit func(path, typ string)) {
+	for k, v := range doc {
+		if k == "_id" && prefix == "" {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		visit(path, valueType(v))
+		if depth >= maxFieldDepth {
+			continue
+		}
+		if sub, ok := documentValue(v); ok {
+			walkFields(sub, path, depth+1, visit)
+			continue
+		}
+		if items, ok := arrayValue(v); ok {
+			for _, item := range items {
+				if sub, ok := documentValue(item); ok {
+					walkFields(sub, path, depth+1, visit)
+				}
+			}
+		}
+	}
+}
+
+// valueType names the type of a decoded value the way the admin panel
+// shows it.
+func valueType(v interface{}) string {
+	if _, ok := documentValue(v); ok {
+		return "object"
+	}
+	if _, ok := arrayValue(v); ok {
+		return "array"
+	}
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int32, int64, float64, primitive.Decimal128:
+		return "number"
+	case time.Time, primitive.DateTime, primitive.Timestamp:
+		return "date"
+	case primitive.ObjectID:
+		return "objectId"
+	}
+	return "other"
+}
+
+func documentValue(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t, true
+	case primitive.M:
+		return t, true
+	case primitive.D:
+		return t.Map(), true
+	}
+	return nil, false
+}
+
+func arrayValue(v interface{}) ([]interface{}, bool) {
+	switch t := v.(type) {
+	case []interface{}:
+		return t, true
+	case primitive.A:
+		return t, true
+	}
+	return nil, false
+}
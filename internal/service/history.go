@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+var archiveSuffixes = []string{"create_archive", "update_archive", "delete_archive"}
+
+var archiveMetaFields = []string{
+	"_id", "archive_operation_id", "archive_time", "source_collection",
+	"archive_filter", "archive_update", "upsert_insert", "restored_at",
+	"archive_post_image", "archive_diff", types.RetentionTimeField,
+}
+
+// archiveEvent is one archived operation on a single document. For creates
+// and upsert inserts doc is the state after the operation, for updates and
+// deletes it is the state before. post is the stored post-image of an update,
+// nil for archives written before post-images were recorded.
+type archiveEvent struct {
+	kind         string
+	upsertInsert bool
+	operationID  string
+	time         int64
+	doc          map[string]interface{}
+	post         map[string]interface{}
+}
+
+func (e archiveEvent) inserted() bool {
+	return e.kind == "create" || e.upsertInsert
+}
+
+var archiveKindOrder = map[string]int{"create": 0, "update": 1, "delete": 2}
+
+// maxAsOfChanges caps the archive entries an as_of read looks at in each
+// archive; a moment further back fails instead of reading without bound.
+const maxAsOfChanges = 50000
+
+// maxAsOfDocuments caps the live documents an as_of read merges with the
+// rebuilt ones when the request has no limit or asks for a count.
+const maxAsOfDocuments = 50000
+
+// asOfBatchSize is the number of documents whose pre-images are read per
+// query.
+const asOfBatchSize = 1000
+
+// firstChange is the first archived operation on a document after a moment.
+type firstChange struct {
+	kind     string
+	time     int64
+	inserted bool
+}
+
+// firstChangesAfter finds, for every document changed after asOf, its first
+// change. Only internal_id, time and the upsert flag are read.
+func (s *StorageService) firstChangesAfter(ctx context.Context, collection string, asOf int64) (map[string]firstChange, error) {
+	firsts := make(map[string]firstChange)
+	for _, suffix := range archiveSuffixes {
+		docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: collection + "_" + suffix,
+			Filter:     map[string]interface{}{"archive_time": map[string]interface{}{"$gt": asOf}},
+			Fields:     []string{"internal_id", "archive_time", "upsert_insert"},
+			Sort:       map[string]int{"archive_time": 1},
+			Limit:      maxAsOfChanges + 1,
+		})
+		if err != nil {
+			return nil, saiTypes.WrapError(err, "failed to read "+suffix)
+		}
+		if len(docs) > maxAsOfChanges {
+			return nil, saiTypes.NewErrorf("more than %d changes in %s since as_of, choose a later moment", maxAsOfChanges, suffix)
+		}
+		kind := suffix[:len(suffix)-len("_archive")]
+		for _, doc := range docs {
+			id, _ := doc["internal_id"].(string)
+			if id == "" {
+				continue
+			}
+			t, _ := toNumber(doc["archive_time"])
+			upsertInsert, _ := doc["upsert_insert"].(bool)
+			change := firstChange{kind: kind, time: int64(t), inserted: kind == "create" || upsertInsert}
+			if prev, ok := firsts[id]; ok && (prev.time < change.time || (prev.time == change.time && archiveKindOrder[prev.kind] <= archiveKindOrder[kind])) {
+				continue
+			}
+			firsts[id] = change
+		}
+	}
+	return firsts, nil
+}
+
+// preImagesOf reads the pre-images of the first changes that are updates or
+// deletes and match filter. The filter is applied by the database, so every
+// operator it supports works here too.
+func (s *StorageService) preImagesOf(ctx context.Context, collection string, asOf int64, firsts map[string]firstChange, filter map[string]interface{}) ([]map[string]interface{}, error) {
+	byKind := make(map[string][]interface{})
+	for id, change := range firsts {
+		if !change.inserted {
+			byKind[change.kind] = append(byKind[change.kind], id)
+		}
+	}
+
+	var docs []map[string]interface{}
+	used := make(map[string]bool)
+	for _, kind := range []string{"update", "delete"} {
+		ids := byKind[kind]
+		sort.Slice(ids, func(i, j int) bool { return ids[i].(string) < ids[j].(string) })
+		for start := 0; start < len(ids); start += asOfBatchSize {
+			end := start + asOfBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			query := map[string]interface{}{
+				"internal_id":  map[string]interface{}{"$in": ids[start:end]},
+				"archive_time": map[string]interface{}{"$gt": asOf},
+			}
+			if len(filter) > 0 {
+				query = map[string]interface{}{"$and": []interface{}{filter, query}}
+			}
+			events, err := s.archiveEventsIn(ctx, collection, kind+"_archive", query)
+			if err != nil {
+				return nil, err
+			}
+			for _, ev := range events {
+				id, _ := ev.doc["internal_id"].(string)
+				if first := firsts[id]; used[id] || first.time != ev.time || first.kind != ev.kind {
+					continue
+				}
+				used[id] = true
+				docs = append(docs, ev.doc)
+			}
+		}
+	}
+	return docs, nil
+}
+
+// archiveEvents reads matching entries from all three archives of collection,
+// oldest first.
+func (s *StorageService) archiveEvents(ctx context.Context, collection string, filter map[string]interface{}) ([]archiveEvent, error) {
+	var events []archiveEvent
+	for _, suffix := range archiveSuffixes {
+		found, err := s.archiveEventsIn(ctx, collection, suffix, filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return archiveKindOrder[events[i].kind] < archiveKindOrder[events[j].kind]
+	})
+	return events, nil
+}
+
+// archiveEventsIn reads matching entries from one archive, oldest first.
+func (s *StorageService) archiveEventsIn(ctx context.Context, collection, suffix string, filter map[string]interface{}) ([]archiveEvent, error) {
+	docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: collection + "_" + suffix,
+		Filter:     filter,
+		Sort:       map[string]int{"archive_time": 1},
+	})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read "+suffix)
+	}
+	kind := suffix[:len(suffix)-len("_archive")]
+	events := make([]archiveEvent, 0, len(docs))
+	for _, doc := range docs {
+		upsertInsert, _ := doc["upsert_insert"].(bool)
+		operationID, _ := doc["archive_operation_id"].(string)
+		t, _ := toNumber(doc["archive_time"])
+		event := archiveEvent{
+			kind:         kind,
+			upsertInsert: upsertInsert,
+			operationID:  operationID,
+			time:         int64(t),
+			doc:          stripArchiveFields(doc),
+		}
+		if post, ok := toMap(doc["archive_post_image"]); ok && !upsertInsert {
+			event.post = stripArchiveFields(post)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func stripArchiveFields(doc map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		out[k] = v
+	}
+	for _, k := range archiveMetaFields {
+		delete(out, k)
+	}
+	return out
+}
+
+// DocumentHistory merges the archives of one document into an ordered list of
+// versions. The state after an update is its stored post-image, or else the
+// next archived pre-image or, for the latest version, the live document. Versions whose
+// state, or for a delete the state it removed, falls outside scope are
+// omitted.
+func (s *StorageService) DocumentHistory(ctx context.Context, collection, internalID string, scope map[string]interface{}) (types.DocumentHistoryResponse, error) {
+	if !s.archiveChanges {
+		return types.DocumentHistoryResponse{}, saiTypes.NewError("document history requires archive_changes")
+	}
+
+	events, err := s.archiveEvents(ctx, collection, map[string]interface{}{"internal_id": internalID})
+	if err != nil {
+		return types.DocumentHistoryResponse{}, err
+	}
+	live, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: collection,
+		Filter:     map[string]interface{}{"internal_id": internalID},
+		Limit:      1,
+	})
+	if err != nil {
+		return types.DocumentHistoryResponse{}, saiTypes.WrapError(err, "failed to read document")
+	}
+
+	var versions []types.DocumentVersion
+	for _, ev := range events {
+		if ev.inserted() {
+			versions = append(versions, types.DocumentVersion{Operation: "create", OperationID: ev.operationID, Time: ev.time, Document: ev.doc})
+			continue
+		}
+
+		// The pre-image is the state the previous version led to.
+		switch {
+		case len(versions) == 0:
+			versions = append(versions, types.DocumentVersion{Operation: "initial", Document: ev.doc})
+		case versions[len(versions)-1].Deleted:
+			versions = append(versions, types.DocumentVersion{Operation: "restore", Time: ev.time, Document: ev.doc})
+		case versions[len(versions)-1].Document == nil:
+			versions[len(versions)-1].Document = ev.doc
+		}
+
+		version := types.DocumentVersion{Operation: ev.kind, OperationID: ev.operationID, Time: ev.time, Document: ev.post}
+		if ev.kind == "delete" {
+			version.Deleted = true
+		}
+		versions = append(versions, version)
+	}
+
+	if len(live) > 0 {
+		current := stripArchiveFields(live[0])
+		switch {
+		case len(versions) == 0:
+			versions = append(versions, types.DocumentVersion{Operation: "initial", Document: current})
+		case versions[len(versions)-1].Deleted:
+			versions = append(versions, types.DocumentVersion{Operation: "restore", Document: current})
+		case versions[len(versions)-1].Document == nil:
+			versions[len(versions)-1].Document = current
+		}
+	}
+
+	result := make([]types.DocumentVersion, 0, len(versions))
+	var previous map[string]interface{}
+	for _, v := range versions {
+		// A version without a state, such as a delete, is judged by the
+		// state it was applied to; with no state at all it is dropped.
+		state := v.Document
+		if state == nil {
+			state = previous
+		} else {
+			previous = v.Document
+		}
+		if len(scope) > 0 {
+			if state == nil {
+				continue
+			}
+			ok, err := matchFilter(state, scope)
+			if err != nil {
+				return types.DocumentHistoryResponse{}, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		v.Version = len(result) + 1
+		result = append(result, v)
+	}
+	for _, v := range result {
+		if v.Document != nil {
+			s.decryptDocuments(collection, []map[string]interface{}{v.Document})
+		}
+	}
+
+	return types.DocumentHistoryResponse{Data: result, Total: len(result)}, nil
+}
+
+// readAsOf answers a read as the collection looked at request.AsOf. Documents
+// changed after that moment are replaced by the pre-image of their first later
+// change; untouched documents are read live. Filtering, sorting and paging of
+// rebuilt documents happen in memory.
+func (s *StorageService) readAsOf(ctx context.Context, request types.ReadDocumentsRequest) ([]map[string]interface{}, int64, error) {
+	if !s.archiveChanges {
+		return nil, 0, saiTypes.NewError("as_of reads require archive_changes")
+	}
+
+	firsts, err := s.firstChangesAfter(ctx, request.Collection, request.AsOf)
+	if err != nil {
+		return nil, 0, err
+	}
+	docs, err := s.preImagesOf(ctx, request.Collection, request.AsOf, firsts, request.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	changed := make(map[string]bool, len(firsts))
+	for id := range firsts {
+		changed[id] = true
+	}
+
+	liveReq := types.ReadDocumentsRequest{
+		Collection: request.Collection,
+		Filter:     request.Filter,
+		Sort:       request.Sort,
+	}
+	if request.Limit > 0 && request.Count == 0 {
+		liveReq.Limit = request.Skip + request.Limit + len(changed)
+	}
+	if liveReq.Limit == 0 || liveReq.Limit > maxAsOfDocuments {
+		liveReq.Limit = maxAsOfDocuments + 1
+	}
+	live, _, err := s.repo.ReadDocuments(ctx, liveReq)
+	if err != nil {
+		return nil, 0, saiTypes.WrapError(err, "failed to get documents")
+	}
+	if len(live) > maxAsOfDocuments {
+		return nil, 0, saiTypes.NewErrorf("as_of reads are limited to %d documents, narrow the filter or set a limit", maxAsOfDocuments)
+	}
+	for _, doc := range live {
+		if id, _ := doc["internal_id"].(string); !changed[id] {
+			docs = append(docs, doc)
+		}
+	}
+
+	sortDocuments(docs, request.Sort)
+	total := int64(len(docs))
+	if request.Skip > 0 {
+		if request.Skip >= len(docs) {
+			docs = nil
+		} else {
+			docs = docs[request.Skip:]
+		}
+	}
+	if request.Limit > 0 && len(docs) > request.Limit {
+		docs = docs[:request.Limit]
+	}
+	if len(request.Fields) > 0 {
+		for i, doc := range docs {
+			projected := make(map[string]interface{}, len(request.Fields)+1)
+			if id, ok := doc["_id"]; ok {
+				projected["_id"] = id
+			}
+			for _, field := range request.Fields {
+				if v, ok := doc[field]; ok {
+					projected[field] = v
+				}
+			}
+			docs[i] = projected
+		}
+	}
+	return docs, total, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// defaultUnusedIndexDays is how long an index must go without operations
+// before the usage report calls it unused.
+const defaultUnusedIndexDays = 30
+
+// IndexUsageReport lists the indexes of a collection with their $indexStats
+// counters and sizes, the query shapes recorded in _admin_query_stats and
+// _admin_slow_queries that each of them serves, and whether it is a drop
+// candidate: unused for unusedDays or shadowed by a longer index with the
+// same prefix. An index counted for less than unusedDays, e.g. after a
+// restart, is never reported as unused.
+func (s *StorageService) IndexUsageReport(ctx context.Context, collection string, unusedDays int) (types.IndexUsageReport, error) {
+	if unusedDays <= 0 {
+		unusedDays = defaultUnusedIndexDays
+	}
+	now := time.Now()
+	report := types.IndexUsageReport{Collection: collection, UnusedDays: unusedDays, GeneratedAt: now}
+
+	indexes, err := s.repo.ListIndexes(ctx, collection)
+	if err != nil {
+		return report, err
+	}
+	usage, err := s.repo.IndexUsage(ctx, collection)
+	if err != nil {
+		return report, err
+	}
+	byName := make(map[string]types.IndexUsage, len(usage))
+	for _, u := range usage {
+		byName[u.Name] = u
+	}
+	shadowed := make(map[string]types.RedundantIndex)
+	for _, r := range redundantIndexes(collection, indexes) {
+		shadowed[r.Name] = r
+	}
+	workload, err := s.workloadShapes(ctx)
+	if err != nil {
+		return report, err
+	}
+	shapes := workload[collection]
+
+	cutoff := now.AddDate(0, 0, -unusedDays)
+	for _, index := range indexes {
+		entry := types.IndexUsageEntry{Index: index, Usage: byName[index.Name]}
+		entry.Usage.Name = index.Name
+		entry.Unused = index.Name != idIndexName && entry.Usage.Ops == 0 &&
+			!entry.Usage.Since.IsZero() && entry.Usage.Since.Before(cutoff)
+		if r, ok := shadowed[index.Name]; ok {
+			entry.ShadowedBy, entry.ShadowReason = r.CoveredBy, r.Reason
+		}
+		for _, shape := range shapes {
+			switch {
+			case generalIndex(index) && indexServes(index.OrderedKeys, shape):
+				entry.Shapes = append(entry.Shapes, *shape)
+			case !index.Hidden && leadsShape(index.OrderedKeys, shape):
+				entry.PartialShapes = append(entry.PartialShapes, *shape)
+			}
+		}
+		report.Indexes = append(report.Indexes, entry)
+	}
+	return report, nil
+}
+
+// leadsShape reports whether the first key of an index is a field shape
+// filters or sorts on, so a query of that shape can use the index for part
+// of its work.
+func leadsShape(keys []types.IndexKey, shape *types.QueryShape) bool {
+	if len(keys) == 0 || keys[0].Type != "" {
+		return false
+	}
+	field := keys[0].Field
+	for _, f := range shape.Equality {
+		if f == field {
+			return true
+		}
+	}
+	for _, k := range shape.Sort {
+		if k.Field == field {
+			return true
+		}
+	}
+	for _, f := range shape.Range {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
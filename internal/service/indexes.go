@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+// idIndexName is the index MongoDB keeps on _id. It cannot be dropped or
+// hidden.
+const idIndexName = "_id_"
+
+// indexBuildWait is how long an admin index action waits for the build
+// before leaving it to run in the background.
+const indexBuildWait = 2 * time.Second
+
+// ErrIndexBuildRunning is returned when an index build has not finished
+// within indexBuildWait. It goes on, and its progress is in IndexBuilds.
+var ErrIndexBuildRunning = saiTypes.NewError("index build continues in the background")
+
+// CreateIndex builds an index for the admin panel. A long build is not tied
+// to the request: ErrIndexBuildRunning is returned and a later failure is
+// logged.
+func (s *StorageService) CreateIndex(ctx context.Context, req types.CreateIndexRequest) error {
+	return s.runIndexBuild(ctx, req)
+}
+
+func (s *StorageService) runIndexBuild(ctx context.Context, req types.CreateIndexRequest) error {
+	done := make(chan error, 1)
+	go func() {
+		err := s.repo.CreateIndex(detachedContext(ctx), req)
+		done <- err
+		if err != nil {
+			sai.Logger().Warn("Index build failed", zap.String("collection", req.Collection), zap.String("index", req.Name), zap.Error(err))
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(indexBuildWait):
+		return ErrIndexBuildRunning
+	}
+}
+
+func (s *StorageService) DropIndex(ctx context.Context, collection, name string) error {
+	if name == idIndexName {
+		return saiTypes.NewError("the _id index cannot be dropped")
+	}
+	return s.repo.DropIndex(ctx, collection, name)
+}
+
+// SetIndexHidden hides an index from the query planner or shows it again,
+// which is a way to test dropping it without rebuilding it afterwards.
+func (s *StorageService) SetIndexHidden(ctx context.Context, collection, name string, hidden bool) error {
+	if name == idIndexName {
+		return saiTypes.NewError("the _id index cannot be hidden")
+	}
+	return s.repo.SetIndexHidden(ctx, collection, name, hidden)
+}
+
+// RebuildIndex drops an index and creates it again with the same keys and
+// options. Queries cannot use it until the new build finishes; as with
+// CreateIndex, a long build goes on in the background.
+func (s *StorageService) RebuildIndex(ctx context.Context, collection, name string) error {
+	if name == idIndexName {
+		return saiTypes.NewError("the _id index cannot be rebuilt")
+	}
+	indexes, err := s.repo.ListIndexes(ctx, collection)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index.Name != name {
+			continue
+		}
+		req := index.CreateIndexRequest(collection)
+		if err := s.repo.DropIndex(ctx, collection, name); err != nil {
+			return err
+		}
+		err := s.runIndexBuild(ctx, req)
+		if err != nil && err != ErrIndexBuildRunning {
+			return saiTypes.WrapError(err, "index was dropped but could not be created again")
+		}
+		return err
+	}
+	return saiTypes.NewErrorf("index %q not found", name)
+}
+
+func (s *StorageService) IndexBuilds(ctx context.Context, collection string) ([]types.IndexBuild, error) {
+	return s.repo.IndexBuilds(ctx, collection)
+}
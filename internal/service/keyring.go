@@ -0,0 +1,218 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// Encrypted values are stored as "enc:v1:<key id>:<base64(nonce|ciphertext)>".
+// The key id lets values written under a rotated-out key still be decrypted.
+// The collection and field path are authenticated as GCM additional data, so a
+// ciphertext only opens in the field it was written to.
+const encryptedValuePrefix = "enc:v1:"
+
+type encryptionKey struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+type keyRing struct {
+	mu      sync.RWMutex
+	active  string
+	keys    map[string]*encryptionKey
+	loadErr error
+}
+
+// load replaces the ring with the keys from the keyfile. Each key is 32 bytes,
+// base64-encoded; separate cipher and MAC keys are derived from it.
+func (k *keyRing) load(file string) error {
+	keys, active, err := readKeyFile(file)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.loadErr = err
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	k.active = active
+	return nil
+}
+
+func readKeyFile(file string) (map[string]*encryptionKey, string, error) {
+	if file == "" {
+		return nil, "", saiTypes.NewError("encryption key_file is not configured")
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", saiTypes.WrapError(err, "failed to read encryption key file")
+	}
+	var kf types.EncryptionKeyFile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, "", saiTypes.WrapError(err, "invalid encryption key file")
+	}
+	if _, ok := kf.Keys[kf.Active]; !ok {
+		return nil, "", saiTypes.NewErrorf("active encryption key %q is not in the key file", kf.Active)
+	}
+
+	keys := make(map[string]*encryptionKey, len(kf.Keys))
+	for id, encoded := range kf.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, "", saiTypes.NewErrorf("invalid encryption key id %q", id)
+		}
+		master, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(master) != 32 {
+			return nil, "", saiTypes.NewErrorf("encryption key %q must be 32 base64-encoded bytes", id)
+		}
+		block, err := aes.NewCipher(deriveKey(master, "enc"))
+		if err != nil {
+			return nil, "", saiTypes.WrapError(err, "failed to init cipher")
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, "", saiTypes.WrapError(err, "failed to init cipher")
+		}
+		keys[id] = &encryptionKey{aead: aead, macKey: deriveKey(master, "mac")}
+	}
+	return keys, kf.Active, nil
+}
+
+func deriveKey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func (k *keyRing) status() (active string, ids []string, loadErr error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return k.active, ids, k.loadErr
+}
+
+func (k *keyRing) activeKey() (string, *encryptionKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.keys == nil {
+		if k.loadErr != nil {
+			return "", nil, k.loadErr
+		}
+		return "", nil, saiTypes.NewError("encryption keys are not loaded")
+	}
+	return k.active, k.keys[k.active], nil
+}
+
+// encrypt seals value under the active key. Deterministic values use a nonce
+// derived from the plaintext and its field, so equal inputs give equal outputs.
+func (k *keyRing) encrypt(value interface{}, scope string, deterministic bool) (string, error) {
+	id, key, err := k.activeKey()
+	if err != nil {
+		return "", err
+	}
+	return sealValue(id, key, value, scope, deterministic)
+}
+
+// equalityCandidates returns the deterministic ciphertexts of value under every
+// key in the ring, so filters keep matching values written before a rotation.
+func (k *keyRing) equalityCandidates(value interface{}, scope string) ([]interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.keys == nil {
+		return nil, saiTypes.NewError("encryption keys are not loaded")
+	}
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		sealed, err := sealValue(id, k.keys[id], value, scope, true)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sealed)
+	}
+	return out, nil
+}
+
+func sealValue(id string, key *encryptionKey, value interface{}, scope string, deterministic bool) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", saiTypes.WrapError(err, "failed to encode value for encryption")
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, key.macKey)
+		mac.Write([]byte(scope))
+		mac.Write([]byte{0})
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", saiTypes.WrapError(err, "failed to generate nonce")
+	}
+
+	sealed := key.aead.Seal(nonce, nonce, plaintext, []byte(scope))
+	return encryptedValuePrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value produced by encrypt for the same scope. ok is false for
+// values that are not ciphertexts, were sealed for another field or cannot be
+// opened with the current ring.
+func (k *keyRing) decrypt(s string, scope string) (value interface{}, keyID string, ok bool) {
+	keyID, payload, isEnc := parseEncrypted(s)
+	if !isEnc {
+		return nil, "", false
+	}
+
+	k.mu.RLock()
+	key := k.keys[keyID]
+	k.mu.RUnlock()
+	if key == nil {
+		return nil, keyID, false
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return nil, keyID, false
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(scope))
+	if err != nil {
+		return nil, keyID, false
+	}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, keyID, false
+	}
+	return value, keyID, true
+}
+
+// parseEncrypted splits a stored ciphertext into its key id and payload.
+func parseEncrypted(s string) (keyID string, payload string, ok bool) {
+	if !strings.HasPrefix(s, encryptedValuePrefix) {
+		return "", "", false
+	}
+	rest := s[len(encryptedValuePrefix):]
+	sep := strings.IndexByte(rest, ':')
+	if sep <= 0 {
+		return "", "", false
+	}
+	return rest[:sep], rest[sep+1:], true
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testKeyRing(t *testing.T, active string, ids ...string) *keyRing {
+	t.Helper()
+	k := &keyRing{}
+	if err := k.load(writeTestKeyFile(t, active, ids...)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return k
+}
+
+func writeTestKeyFile(t *testing.T, active string, ids ...string) string {
+	t.Helper()
+	keys := make(map[string]string, len(ids))
+	for i, id := range ids {
+		master := make([]byte, 32)
+		for j := range master {
+			master[j] = byte(i*31 + j)
+		}
+		keys[id] = base64.StdEncoding.EncodeToString(master)
+	}
+	raw, err := json.Marshal(map[string]interface{}{"active": active, "keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(file, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestKeyRingRoundTrip(t *testing.T) {
+	k := testKeyRing(t, "k1", "k1")
+	cases := []struct {
+		name          string
+		value         interface{}
+		deterministic bool
+	}{
+		{"string", "alice@example.com", true},
+		{"number", float64(42), true},
+		{"object", map[string]interface{}{"city": "Riga", "zip": "LV-1010"}, false},
+		{"array", []interface{}{"a", float64(1), true}, false},
+		{"ciphertext-looking string", "enc:v1:k1:AAAA", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sealed, err := k.encrypt(tc.value, "users.field", tc.deterministic)
+			if err != nil {
+				t.Fatalf("encrypt: %v", err)
+			}
+			if !strings.HasPrefix(sealed, encryptedValuePrefix+"k1:") {
+				t.Fatalf("sealed value %q has no key prefix", sealed)
+			}
+			plain, keyID, ok := k.decrypt(sealed, "users.field")
+			if !ok || keyID != "k1" {
+				t.Fatalf("decrypt: ok=%v keyID=%q", ok, keyID)
+			}
+			if !reflect.DeepEqual(plain, tc.value) {
+				t.Fatalf("got %#v, want %#v", plain, tc.value)
+			}
+		})
+	}
+}
+
+func TestKeyRingDeterminism(t *testing.T) {
+	k := testKeyRing(t, "k1", "k1")
+	a, _ := k.encrypt("x", "users.email", true)
+	b, _ := k.encrypt("x", "users.email", true)
+	if a != b {
+		t.Fatalf("deterministic encryption differs: %q vs %q", a, b)
+	}
+	c, _ := k.encrypt("x", "users.login", true)
+	if a == c {
+		t.Fatal("deterministic ciphertext is shared between fields")
+	}
+	r1, _ := k.encrypt("x", "users.email", false)
+	r2, _ := k.encrypt("x", "users.email", false)
+	if r1 == r2 {
+		t.Fatal("randomized encryption repeated a ciphertext")
+	}
+}
+
+func TestKeyRingScopeBinding(t *testing.T) {
+	k := testKeyRing(t, "k1", "k1")
+	sealed, err := k.encrypt("secret", "users.passport", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		scope string
+		ok    bool
+	}{
+		{"users.passport", true},
+		{"users.email", false},
+		{"orders.passport", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if _, _, ok := k.decrypt(sealed, tc.scope); ok != tc.ok {
+			t.Errorf("decrypt under %q: ok=%v, want %v", tc.scope, ok, tc.ok)
+		}
+	}
+}
+
+func TestKeyRingRejectsMalformed(t *testing.T) {
+	k := testKeyRing(t, "k1", "k1")
+	sealed, _ := k.encrypt("secret", "users.passport", false)
+	for _, s := range []string{
+		"plain",
+		"enc:v1:",
+		"enc:v1::abc",
+		"enc:v1:k1:!!!",
+		"enc:v1:k1:AAAA",
+		"enc:v1:missing:" + sealed[len(encryptedValuePrefix+"k1:"):],
+		sealed[:len(sealed)-2] + "AA",
+	} {
+		if _, _, ok := k.decrypt(s, "users.passport"); ok {
+			t.Errorf("decrypt(%q) succeeded", s)
+		}
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	old := testKeyRing(t, "k1", "k1", "k2")
+	sealed, err := old.encrypt("alice", "users.email", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyRing(t, "k2", "k1", "k2")
+	plain, keyID, ok := rotated.decrypt(sealed, "users.email")
+	if !ok || keyID != "k1" || plain != "alice" {
+		t.Fatalf("old value after rotation: %v %q %v", plain, keyID, ok)
+	}
+	fresh, _ := rotated.encrypt("alice", "users.email", true)
+	if !strings.HasPrefix(fresh, encryptedValuePrefix+"k2:") {
+		t.Fatalf("new value %q is not under the active key", fresh)
+	}
+
+	candidates, err := rotated.equalityCandidates("alice", "users.email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{sealed, fresh} {
+		found := false
+		for _, c := range candidates {
+			if c == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("equality candidates miss %q", want)
+		}
+	}
+
+	removed := testKeyRing(t, "k2", "k2")
+	if _, keyID, ok := removed.decrypt(sealed, "users.email"); ok || keyID != "k1" {
+		t.Fatalf("value under a removed key: keyID=%q ok=%v", keyID, ok)
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matchFilter evaluates a query filter against a document in memory. It is
+// used where documents are rebuilt from archives and cannot be queried in the
+// database. Supported operators: $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $regex, $and, $or, $nor.
+func matchFilter(doc map[string]interface{}, filter map[string]interface{}) (bool, error) {
+	for key, cond := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			subs, ok := toSlice(cond)
+			if !ok {
+				return false, saiTypes.NewErrorf("%s expects an array", key)
+			}
+			matched := 0
+			for _, sub := range subs {
+				subFilter, ok := sub.(map[string]interface{})
+				if !ok {
+					return false, saiTypes.NewErrorf("%s expects an array of filters", key)
+				}
+				ok, err := matchFilter(doc, subFilter)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					matched++
+				}
+			}
+			switch {
+			case key == "$and" && matched != len(subs):
+				return false, nil
+			case key == "$or" && matched == 0:
+				return false, nil
+			case key == "$nor" && matched > 0:
+				return false, nil
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, saiTypes.NewErrorf("operator %s is not supported here", key)
+			}
+			value, exists := lookupPath(doc, key)
+			ok, err := matchCondition(value, exists, cond)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchCondition(value interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(map[string]interface{})
+	if !ok || !hasOperatorKeys(ops) {
+		return exists && valueEquals(value, cond), nil
+	}
+
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = exists && valueEquals(value, arg)
+		case "$ne":
+			ok = !exists || !valueEquals(value, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			if !exists {
+				return false, nil
+			}
+			c, comparable := compareValues(value, arg)
+			ok = comparable && ((op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0))
+		case "$in", "$nin":
+			list, isList := toSlice(arg)
+			if !isList {
+				return false, saiTypes.NewErrorf("%s expects an array", op)
+			}
+			found := false
+			for _, item := range list {
+				if exists && valueEquals(value, item) {
+					found = true
+					break
+				}
+			}
+			ok = found == (op == "$in")
+		case "$exists":
+			want, _ := arg.(bool)
+			ok = exists == want
+		case "$regex":
+			pattern, isString := arg.(string)
+			if !isString {
+				return false, saiTypes.NewError("$regex expects a string")
+			}
+			if opts, _ := ops["$options"].(string); strings.Contains(opts, "i") {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return false, saiTypes.WrapError(err, "invalid $regex")
+			}
+			s, isString := value.(string)
+			ok = exists && isString && re.MatchString(s)
+		case "$options":
+			ok = true
+		default:
+			return false, saiTypes.NewErrorf("operator %s is not supported here", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func hasOperatorKeys(m map[string]interface{}) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// valueEquals follows Mongo semantics loosely: numbers compare by value and an
+// array field matches when any element is equal.
+func valueEquals(value, target interface{}) bool {
+	if c, ok := compareValues(value, target); ok {
+		return c == 0
+	}
+	if list, ok := toSlice(value); ok {
+		if _, targetIsList := toSlice(target); !targetIsList {
+			for _, item := range list {
+				if valueEquals(item, target) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return reflect.DeepEqual(normalizeComparable(value), normalizeComparable(target))
+}
+
+// compareValues orders two values of the same kind: numbers, strings,
+// booleans, dates or ObjectIDs. Values of different kinds are not
+// comparable, as in Mongo range queries.
+func compareValues(a, b interface{}) (int, bool) {
+	ta, aIsTime := toTime(a)
+	tb, bIsTime := toTime(b)
+	if aIsTime || bIsTime {
+		if !aIsTime || !bIsTime {
+			return 0, false
+		}
+		return ta.Compare(tb), true
+	}
+	if oa, ok := a.(primitive.ObjectID); ok {
+		if ob, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(oa[:], ob[:]), true
+		}
+		return 0, false
+	}
+	if fa, ok := toNumber(a); ok {
+		if fb, ok := toNumber(b); ok {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			return strings.Compare(sa, sb), true
+		}
+	}
+	if ba, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ba == bb:
+				return 0, true
+			case !ba:
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// toTime reads the date types a document or filter may hold.
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case primitive.DateTime:
+		return t.Time(), true
+	case primitive.Timestamp:
+		return time.Unix(int64(t.T), 0), true
+	}
+	return time.Time{}, false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if list, ok := v.([]interface{}); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+func normalizeComparable(v interface{}) interface{} {
+	if f, ok := toNumber(v); ok {
+		return f
+	}
+	if list, ok := toSlice(v); ok {
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			out[i] = normalizeComparable(item)
+		}
+		return out
+	}
+	if m, ok := toMap(v); ok {
+		out := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			out[k] = normalizeComparable(item)
+		}
+		return out
+	}
+	return v
+}
+
+// sortDocuments orders documents by the given sort spec, missing values first.
+func sortDocuments(docs []map[string]interface{}, spec map[string]int) {
+	if len(spec) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			a, aok := lookupPath(docs[i], key)
+			b, bok := lookupPath(docs[j], key)
+			var c int
+			switch {
+			case !aok && !bok:
+				continue
+			case !aok:
+				c = -1
+			case !bok:
+				c = 1
+			default:
+				var ok bool
+				if c, ok = compareValues(a, b); !ok {
+					c = strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+				}
+			}
+			if c == 0 {
+				continue
+			}
+			if spec[key] < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatchFilter(t *testing.T) {
+	jan := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	oid1 := primitive.NewObjectIDFromTimestamp(jan)
+	oid2 := primitive.NewObjectIDFromTimestamp(jan.Add(time.Hour))
+
+	doc := map[string]interface{}{
+		"name":    "Alice",
+		"age":     int32(30),
+		"score":   float64(4.5),
+		"active":  true,
+		"tags":    []interface{}{"a", "b"},
+		"profile": map[string]interface{}{"city": "Riga"},
+		"created": primitive.NewDateTimeFromTime(jan),
+		"ref":     oid1,
+	}
+
+	cases := []struct {
+		name   string
+		filter map[string]interface{}
+		want   bool
+	}{
+		{"empty filter", map[string]interface{}{}, true},
+		{"implicit eq", map[string]interface{}{"name": "Alice"}, true},
+		{"implicit eq miss", map[string]interface{}{"name": "Bob"}, false},
+		{"numbers of different types", map[string]interface{}{"age": float64(30)}, true},
+		{"dotted path", map[string]interface{}{"profile.city": "Riga"}, true},
+		{"array element", map[string]interface{}{"tags": "b"}, true},
+		{"whole array", map[string]interface{}{"tags": []interface{}{"a", "b"}}, true},
+		{"$eq", map[string]interface{}{"age": map[string]interface{}{"$eq": 30}}, true},
+		{"$ne", map[string]interface{}{"age": map[string]interface{}{"$ne": 30}}, false},
+		{"$ne missing field", map[string]interface{}{"missing": map[string]interface{}{"$ne": 1}}, true},
+		{"$gt", map[string]interface{}{"age": map[string]interface{}{"$gt": 29}}, true},
+		{"$gte", map[string]interface{}{"age": map[string]interface{}{"$gte": 30}}, true},
+		{"$lt", map[string]interface{}{"score": map[string]interface{}{"$lt": 4.5}}, false},
+		{"$lte", map[string]interface{}{"score": map[string]interface{}{"$lte": 4.5}}, true},
+		{"range on missing field", map[string]interface{}{"missing": map[string]interface{}{"$gt": 0}}, false},
+		{"range across kinds", map[string]interface{}{"name": map[string]interface{}{"$gt": 1}}, false},
+		{"string range", map[string]interface{}{"name": map[string]interface{}{"$gte": "A", "$lt": "B"}}, true},
+		{"$in", map[string]interface{}{"name": map[string]interface{}{"$in": []interface{}{"Bob", "Alice"}}}, true},
+		{"$nin", map[string]interface{}{"name": map[string]interface{}{"$nin": []interface{}{"Bob", "Alice"}}}, false},
+		{"$exists true", map[string]interface{}{"profile.city": map[string]interface{}{"$exists": true}}, true},
+		{"$exists false", map[string]interface{}{"missing": map[string]interface{}{"$exists": false}}, true},
+		{"$regex", map[string]interface{}{"name": map[string]interface{}{"$regex": "^al", "$options": "i"}}, true},
+		{"$regex case", map[string]interface{}{"name": map[string]interface{}{"$regex": "^al"}}, false},
+		{"$and", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"name": "Alice"},
+			map[string]interface{}{"active": true},
+		}}, true},
+		{"$or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"name": "Bob"},
+			map[string]interface{}{"age": 30},
+		}}, true},
+		{"$nor", map[string]interface{}{"$nor": []interface{}{
+			map[string]interface{}{"name": "Bob"},
+			map[string]interface{}{"age": 30},
+		}}, false},
+		{"date $gt DateTime", map[string]interface{}{"created": map[string]interface{}{"$gt": primitive.NewDateTimeFromTime(jan.Add(-time.Second))}}, true},
+		{"date $lt time.Time", map[string]interface{}{"created": map[string]interface{}{"$lt": jan}}, false},
+		{"date $lte time.Time", map[string]interface{}{"created": map[string]interface{}{"$lte": jan}}, true},
+		{"date eq across types", map[string]interface{}{"created": jan}, true},
+		{"date against number", map[string]interface{}{"created": map[string]interface{}{"$gt": 0}}, false},
+		{"date against string", map[string]interface{}{"created": map[string]interface{}{"$gt": "2020-01-01"}}, false},
+		{"ObjectID eq", map[string]interface{}{"ref": oid1}, true},
+		{"ObjectID $lt", map[string]interface{}{"ref": map[string]interface{}{"$lt": oid2}}, true},
+		{"ObjectID $gt", map[string]interface{}{"ref": map[string]interface{}{"$gt": oid2}}, false},
+		{"ObjectID $in", map[string]interface{}{"ref": map[string]interface{}{"$in": []interface{}{oid2, oid1}}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := matchFilter(doc, tc.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("matchFilter = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchFilterErrors(t *testing.T) {
+	doc := map[string]interface{}{"name": "Alice"}
+	cases := []struct {
+		name   string
+		filter map[string]interface{}
+	}{
+		{"unknown top-level operator", map[string]interface{}{"$where": "true"}},
+		{"unknown field operator", map[string]interface{}{"name": map[string]interface{}{"$elemMatch": map[string]interface{}{}}}},
+		{"$and not an array", map[string]interface{}{"$and": map[string]interface{}{"name": "Alice"}}},
+		{"$or of non-filters", map[string]interface{}{"$or": []interface{}{"name"}}},
+		{"$in not an array", map[string]interface{}{"name": map[string]interface{}{"$in": "Alice"}}},
+		{"$regex not a string", map[string]interface{}{"name": map[string]interface{}{"$regex": 1}}},
+		{"invalid $regex", map[string]interface{}{"name": map[string]interface{}{"$regex": "("}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := matchFilter(doc, tc.filter); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestSortDocuments(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	docs := []map[string]interface{}{
+		{"id": "b", "at": primitive.NewDateTimeFromTime(jan.Add(2 * time.Hour))},
+		{"id": "c"},
+		{"id": "a", "at": jan},
+		{"id": "d", "at": primitive.NewDateTimeFromTime(jan.Add(time.Hour))},
+	}
+	sortDocuments(docs, map[string]int{"at": 1})
+	got := ""
+	for _, d := range docs {
+		got += d["id"].(string)
+	}
+	if got != "cadb" {
+		t.Fatalf("ascending order = %q, want %q", got, "cadb")
+	}
+
+	sortDocuments(docs, map[string]int{"at": -1})
+	got = ""
+	for _, d := range docs {
+		got += d["id"].(string)
+	}
+	if got != "bdac" {
+		t.Fatalf("descending order = %q, want %q", got, "bdac")
+	}
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	"github.com/saiset-co/sai-storage/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMetricsRetentionDays = 30
+	metricsFlushInterval        = 10 * time.Second
+)
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram buckets; a last bucket holds everything slower. Bounds grow by
+// half, so percentiles estimated from the histogram are close enough for
+// charts and can be summed over collections and minutes.
+var latencyBounds = func() []float64 {
+	var bounds []float64
+	for v := 0.1; v < 60000; v *= 1.5 {
+		bounds = append(bounds, v)
+	}
+	return bounds
+}()
+
+type metricKey struct {
+	tenant     string
+	collection string
+	operation  string
+	minute     int64
+}
+
+type metricBucket struct {
+	count  int64
+	errors int64
+	docs   int64
+	sumMs  float64
+	maxMs  float64
+	hist   []int64
+}
+
+// metricsCollector sums operations per minute in memory. Finished minutes
+// go to the async writer on a timer, the current one on shutdown.
+type metricsCollector struct {
+	mu       sync.Mutex
+	buckets  map[metricKey]*metricBucket
+	ready    sync.Map
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (s *StorageService) MetricsEnabled() bool {
+	return s.metricsJob != nil
+}
+
+func (s *StorageService) startMetrics() {
+	if !s.metrics.Enabled {
+		return
+	}
+	s.metricsJob = &metricsCollector{
+		buckets: make(map[metricKey]*metricBucket),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.metricsLoop()
+}
+
+func (s *StorageService) metricsLoop() {
+	job := s.metricsJob
+	defer close(job.done)
+
+	ticker := time.NewTicker(metricsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flushMetrics(false)
+		case <-job.stop:
+			s.flushMetrics(true)
+			return
+		}
+	}
+}
+
+// stopMetrics hands the remaining minutes to the writer, so it must run
+// before the writer is closed.
+func (s *StorageService) stopMetrics() {
+	if job := s.metricsJob; job != nil {
+		job.stopOnce.Do(func() { close(job.stop) })
+		<-job.done
+	}
+}
+
+// recordMetric counts one operation. Admin collections are not counted.
+func (s *StorageService) recordMetric(ctx context.Context, collection, operation string, elapsed time.Duration, docsCount int64, failed bool) {
+	job := s.metricsJob
+	if job == nil || isAdminCollection(collection) {
+		return
+	}
+	ms := float64(elapsed) / float64(time.Millisecond)
+	key := metricKey{
+		tenant:     types.TenantFromContext(ctx),
+		collection: collection,
+		operation:  operation,
+		minute:     time.Now().Truncate(time.Minute).Unix(),
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	b, ok := job.buckets[key]
+	if !ok {
+		b = &metricBucket{hist: make([]int64, len(latencyBounds)+1)}
+		job.buckets[key] = b
+	}
+	b.count++
+	if failed {
+		b.errors++
+	}
+	b.docs += docsCount
+	b.sumMs += ms
+	if ms > b.maxMs {
+		b.maxMs = ms
+	}
+	b.hist[sort.SearchFloat64s(latencyBounds, ms)]++
+}
+
+// failedOp records an operation the database rejected.
+func (s *StorageService) failedOp(ctx context.Context, collection, operation string, elapsed time.Duration) {
+	s.recordMetric(ctx, collection, operation, elapsed, 0, true)
+}
+
+func (s *StorageService) flushMetrics(all bool) {
+	job := s.metricsJob
+	current := time.Now().Truncate(time.Minute).Unix()
+
+	job.mu.Lock()
+	flushed := make(map[metricKey]*metricBucket)
+	for key, b := range job.buckets {
+		if all || key.minute < current {
+			flushed[key] = b
+			delete(job.buckets, key)
+		}
+	}
+	job.mu.Unlock()
+
+	for key, b := range flushed {
+		ctx := types.WithTenant(context.Background(), key.tenant)
+		s.ensureMetricsCollection(ctx)
+
+		hist := make([]interface{}, len(b.hist))
+		for i, n := range b.hist {
+			hist[i] = n
+		}
+		read, written := b.docs, int64(0)
+		if isWriteOperation(key.operation) {
+			read, written = 0, b.docs
+		}
+		s.writer.enqueue(writeEntry{
+			tenant:     key.tenant,
+			collection: types.MetricsCollection,
+			document: map[string]interface{}{
+				"ts":      time.Unix(key.minute, 0).UTC(),
+				"meta":    map[string]interface{}{"collection": key.collection, "operation": key.operation},
+				"count":   b.count,
+				"errors":  b.errors,
+				"read":    read,
+				"written": written,
+				"sum_ms":  b.sumMs,
+				"max_ms":  b.maxMs,
+				"p50_ms":  histogramPercentile(b.hist, b.maxMs, 0.50),
+				"p95_ms":  histogramPercentile(b.hist, b.maxMs, 0.95),
+				"p99_ms":  histogramPercentile(b.hist, b.maxMs, 0.99),
+				"hist":    hist,
+			},
+		})
+	}
+}
+
+func isWriteOperation(operation string) bool {
+	return operation == "create" || operation == "update" || operation == "delete"
+}
+
+func (s *StorageService) metricsRetention() int64 {
+	days := s.metrics.RetentionDays
+	if days <= 0 {
+		days = defaultMetricsRetentionDays
+	}
+	return int64(days) * 24 * 60 * 60
+}
+
+// ensureMetricsCollection creates the time-series collection of the tenant
+// in ctx before its first rollup is written, or brings its expiry in line
+// with the configured retention. It runs once per tenant.
+func (s *StorageService) ensureMetricsCollection(ctx context.Context) {
+	tenant := types.TenantFromContext(ctx)
+	if _, done := s.metricsJob.ready.LoadOrStore(tenant, true); done {
+		return
+	}
+	expire := s.metricsRetention()
+	opts, err := s.repo.CollectionOptions(ctx, types.MetricsCollection)
+	switch {
+	case err != nil:
+		err = s.repo.CreateCollection(ctx, types.MetricsCollection, types.CollectionOptions{
+			TimeSeries: &types.TimeSeriesOptions{
+				TimeField:   "ts",
+				MetaField:   "meta",
+				Granularity: "minutes",
+			},
+			ExpireAfterSeconds: expire,
+		})
+	case opts.TimeSeries == nil:
+		sai.Logger().Warn("Metrics collection is not a time-series collection, retention does not apply",
+			zap.String("tenant", tenant), zap.String("collection", types.MetricsCollection))
+	case opts.ExpireAfterSeconds != expire:
+		err = s.repo.SetCollectionExpiry(ctx, types.MetricsCollection, expire)
+	}
+	if err != nil {
+		sai.Logger().Warn("Failed to prepare metrics collection", zap.String("tenant", tenant), zap.Error(err))
+	}
+}
+
+// MetricsReport reads the rollups of the tenant in ctx for the dashboard.
+func (s *StorageService) MetricsReport(ctx context.Context, q types.MetricsQuery) (types.MetricsReport, error) {
+	if q.Step < time.Minute {
+		q.Step = time.Minute
+	}
+	q.From = q.From.Truncate(q.Step)
+	report := types.MetricsReport{Query: q}
+
+	match := bson.D{{Key: "ts", Value: bson.D{{Key: "$gte", Value: q.From}, {Key: "$lt", Value: q.To}}}}
+	if q.Collection != "" {
+		match = append(match, bson.E{Key: "meta.collection", Value: q.Collection})
+	}
+	if q.Operation != "" {
+		match = append(match, bson.E{Key: "meta.operation", Value: q.Operation})
+	}
+
+	period := bson.D{{Key: "$dateTrunc", Value: bson.D{
+		{Key: "date", Value: "$ts"},
+		{Key: "unit", Value: "minute"},
+		{Key: "binSize", Value: int64(q.Step / time.Minute)},
+	}}}
+	byPeriod, err := s.aggregateMetrics(ctx, match, period)
+	if err != nil {
+		return report, err
+	}
+	points := make(map[int64]types.MetricsPoint, len(byPeriod))
+	var hist []int64
+	for _, g := range byPeriod {
+		var t time.Time
+		switch v := g.key.(type) {
+		case primitive.DateTime:
+			t = v.Time()
+		case time.Time:
+			t = v
+		}
+		g.point.Time = t
+		points[t.Unix()] = g.point
+		hist = addHistogram(hist, g.hist)
+		report.Total = addMetricsPoint(report.Total, g.point)
+	}
+	report.Total.P50Ms = histogramPercentile(hist, report.Total.MaxMs, 0.50)
+	report.Total.P95Ms = histogramPercentile(hist, report.Total.MaxMs, 0.95)
+	report.Total.P99Ms = histogramPercentile(hist, report.Total.MaxMs, 0.99)
+	for t := q.From; t.Before(q.To); t = t.Add(q.Step) {
+		p, ok := points[t.Unix()]
+		if !ok {
+			p = types.MetricsPoint{Time: t}
+		}
+		report.Points = append(report.Points, p)
+	}
+
+	bySeries, err := s.aggregateMetrics(ctx, match, bson.D{{Key: "c", Value: "$meta.collection"}, {Key: "o", Value: "$meta.operation"}})
+	if err != nil {
+		return report, err
+	}
+	for _, g := range bySeries {
+		key, _ := documentValue(g.key)
+		row := types.MetricsRow{MetricsPoint: g.point}
+		row.Collection, _ = key["c"].(string)
+		row.Operation, _ = key["o"].(string)
+		report.Rows = append(report.Rows, row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Count > report.Rows[j].Count })
+	return report, nil
+}
+
+type metricGroup struct {
+	key   interface{}
+	point types.MetricsPoint
+	hist  []int64
+}
+
+// aggregateMetrics sums the rollups matching match per group key. The
+// histograms are summed per bucket by unwinding them; the other counters
+// are taken from the first bucket only, so they are counted once.
+func (s *StorageService) aggregateMetrics(ctx context.Context, match bson.D, key interface{}) ([]metricGroup, error) {
+	once := func(field string) bson.D {
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$i", 0}}}, "$" + field, 0,
+		}}}}}
+	}
+	sum := func(field string) bson.D {
+		return bson.D{{Key: "$sum", Value: "$" + field}}
+	}
+	counters := []string{"count", "errors", "read", "written", "sum_ms"}
+
+	perBucket := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "k", Value: key}, {Key: "i", Value: "$i"}}},
+		{Key: "n", Value: sum("hist")},
+		{Key: "max_ms", Value: bson.D{{Key: "$max", Value: "$max_ms"}}},
+	}
+	perGroup := bson.D{
+		{Key: "_id", Value: "$_id.k"},
+		{Key: "hist", Value: bson.D{{Key: "$push", Value: bson.D{{Key: "i", Value: "$_id.i"}, {Key: "n", Value: "$n"}}}}},
+		{Key: "max_ms", Value: bson.D{{Key: "$max", Value: "$max_ms"}}},
+	}
+	for _, c := range counters {
+		perBucket = append(perBucket, bson.E{Key: c, Value: once(c)})
+		perGroup = append(perGroup, bson.E{Key: c, Value: sum(c)})
+	}
+
+	docs, _, err := s.repo.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+		Collection: types.MetricsCollection,
+		Pipeline: types.OrderedPipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$hist"}, {Key: "includeArrayIndex", Value: "i"}}}},
+			{{Key: "$group", Value: perBucket}},
+			{{Key: "$group", Value: perGroup}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]metricGroup, 0, len(docs))
+	for _, doc := range docs {
+		g := metricGroup{key: doc["_id"], hist: make([]int64, len(latencyBounds)+1)}
+		items, _ := arrayValue(doc["hist"])
+		for _, item := range items {
+			m, _ := documentValue(item)
+			if i := int(metricNumber(m["i"])); i >= 0 && i < len(g.hist) {
+				g.hist[i] = int64(metricNumber(m["n"]))
+			}
+		}
+		g.point = types.MetricsPoint{
+			Count:   int64(metricNumber(doc["count"])),
+			Errors:  int64(metricNumber(doc["errors"])),
+			Read:    int64(metricNumber(doc["read"])),
+			Written: int64(metricNumber(doc["written"])),
+			MaxMs:   metricNumber(doc["max_ms"]),
+		}
+		if g.point.Count > 0 {
+			g.point.AvgMs = metricNumber(doc["sum_ms"]) / float64(g.point.Count)
+		}
+		g.point.P50Ms = histogramPercentile(g.hist, g.point.MaxMs, 0.50)
+		g.point.P95Ms = histogramPercentile(g.hist, g.point.MaxMs, 0.95)
+		g.point.P99Ms = histogramPercentile(g.hist, g.point.MaxMs, 0.99)
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// histogramPercentile estimates the q-th latency percentile by linear
+// interpolation inside the bucket that holds it. maxMs caps the estimate
+// and stands in for the bound of the last bucket.
+func histogramPercentile(hist []int64, maxMs, q float64) float64 {
+	var total int64
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range hist {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBounds[i-1]
+		}
+		upper := maxMs
+		if i < len(latencyBounds) && latencyBounds[i] < maxMs {
+			upper = latencyBounds[i]
+		}
+		v := lower + (upper-lower)*(rank-float64(seen))/float64(n)
+		if v > maxMs {
+			v = maxMs
+		}
+		return v
+	}
+	return maxMs
+}
+
+func addHistogram(total, hist []int64) []int64 {
+	if total == nil {
+		total = make([]int64, len(hist))
+	}
+	for i, n := range hist {
+		total[i] += n
+	}
+	return total
+}
+
+func addMetricsPoint(total, p types.MetricsPoint) types.MetricsPoint {
+	sumMs := total.AvgMs*float64(total.Count) + p.AvgMs*float64(p.Count)
+	total.Count += p.Count
+	total.Errors += p.Errors
+	total.Read += p.Read
+	total.Written += p.Written
+	if p.MaxMs > total.MaxMs {
+		total.MaxMs = p.MaxMs
+	}
+	if total.Count > 0 {
+		total.AvgMs = sumMs / float64(total.Count)
+	}
+	return total
+}
+
+func metricNumber(v interface{}) float64 {
+	switch t := v.(type) {
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	case int:
+		return float64(t)
+	}
+	return 0
+}
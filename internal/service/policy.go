@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+const (
+	OpRead      = "read"
+	OpCreate    = "create"
+	OpUpdate    = "update"
+	OpDelete    = "delete"
+	OpAggregate = "aggregate"
+	// OpManage creates, renames, drops, truncates, clones and converts
+	// collections. Unlike the other operations it is not granted by "*".
+	OpManage = "manage"
+)
+
+const maxCollectionNameLength = 120
+
+// Service collections are split into two classes: internal admin state that is
+// never reachable from the public API, and audit trails (request logs, archives)
+// that may optionally be exposed read-only.
+const (
+	collectionClassUser = iota
+	collectionClassAdmin
+	collectionClassAudit
+)
+
+func IsServiceCollection(name string) bool {
+	return collectionClass(name) != collectionClassUser
+}
+
+func collectionClass(name string) int {
+	switch {
+	case types.IsAdminStateCollection(name), types.IsSnapshotCollection(name):
+		return collectionClassAdmin
+	case types.IsAuditCollection(name):
+		return collectionClassAudit
+	}
+	return collectionClassUser
+}
+
+func ValidateCollectionName(name string) error {
+	switch {
+	case name == "":
+		return saiTypes.NewError("collection name is required")
+	case len(name) > maxCollectionNameLength:
+		return saiTypes.NewErrorf("collection name exceeds %d bytes", maxCollectionNameLength)
+	case strings.ContainsAny(name, "$\x00"):
+		return saiTypes.NewError("collection name must not contain '$' or null characters")
+	case strings.HasPrefix(name, "system."):
+		return saiTypes.NewError("collection name must not start with 'system.'")
+	case strings.HasPrefix(name, ".") || strings.HasSuffix(name, "."):
+		return saiTypes.NewError("collection name must not start or end with '.'")
+	}
+	return nil
+}
+
+// CheckCollectionAccess applies the public API policy to a collection. The admin
+// panel talks to the service directly and is not subject to it.
+func (s *StorageService) CheckCollectionAccess(collection, operation string) error {
+	if s.tenancy.Enabled && s.tenancy.Mode != types.TenancyModeDatabase {
+		if _, _, ok := types.SplitTenantCollection(collection); ok {
+			return saiTypes.NewErrorf("collection %q is reserved for tenant namespaces", collection)
+		}
+	}
+	switch collectionClass(collection) {
+	case collectionClassAdmin:
+		return saiTypes.NewErrorf("collection %q is reserved", collection)
+	case collectionClassAudit:
+		if !s.allowAuditReads {
+			return saiTypes.NewErrorf("collection %q is reserved", collection)
+		}
+		if operation != OpRead && operation != OpAggregate {
+			return saiTypes.NewErrorf("collection %q is read-only", collection)
+		}
+	}
+	return nil
+}
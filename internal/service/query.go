@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// SavedQueriesCollection holds the queries saved in the admin panel.
+const SavedQueriesCollection = "_admin_custom_queries"
+
+// defaultQueryLimit caps a find without .limit().
+const defaultQueryLimit = 100
+
+// SavedQuery returns the text of a saved query. Saved queries are shared by
+// all tenants.
+func (s *StorageService) SavedQuery(id string) (string, error) {
+	doc, err := s.savedQueryDoc(id)
+	if err != nil {
+		return "", err
+	}
+	return doc["query_raw"].(string), nil
+}
+
+func (s *StorageService) savedQueryDoc(id string) (map[string]interface{}, error) {
+	docs, _, err := s.repo.ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+		Collection: SavedQueriesCollection,
+		Filter:     map[string]interface{}{"internal_id": id},
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, saiTypes.NewErrorf("saved query %q not found", id)
+	}
+	if queryRaw, _ := docs[0]["query_raw"].(string); queryRaw == "" {
+		return nil, saiTypes.NewErrorf("saved query %q has no query text", id)
+	}
+	return docs[0], nil
+}
+
+// RunQuery executes a parsed shell query through the regular service
+// methods, so encryption, soft delete and archiving apply. dryRun previews
+// updates and deletes; deletedBy is recorded on soft-deleted documents.
+func (s *StorageService) RunQuery(ctx context.Context, q *shell.Query, dryRun bool, deletedBy string) (types.QueryResult, error) {
+	result := types.QueryResult{Operation: q.Operation, DryRun: dryRun}
+	if dryRun && !shell.IsWrite(q.Operation) {
+		return result, saiTypes.NewErrorf("%s cannot be previewed", q.Method)
+	}
+
+	switch q.Operation {
+	case shell.OpFind, shell.OpFindOne:
+		limit := q.Limit
+		if limit == 0 {
+			limit = defaultQueryLimit
+		}
+		resp, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: q.Collection,
+			Filter:     q.Filter,
+			Sort:       q.Sort,
+			Limit:      limit,
+			Skip:       q.Skip,
+			Fields:     q.Fields,
+			Count:      1,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Documents, result.Total = resp.Data, resp.Total
+	case shell.OpAggregate:
+		resp, err := s.AggregateDocuments(ctx, types.AggregateDocumentsRequest{
+			Collection: q.Collection,
+			Pipeline:   q.Pipeline,
+			Count:      1,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Documents, result.Total = resp.Data, resp.Total
+	case shell.OpCount:
+		resp, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: q.Collection,
+			Filter:     q.Filter,
+			Limit:      1,
+			Count:      1,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Total = resp.Total
+	case shell.OpDistinct:
+		values, err := s.DistinctValues(ctx, q.Collection, q.Field, q.Filter)
+		if err != nil {
+			return result, err
+		}
+		result.Values = values
+	case shell.OpInsertOne, shell.OpInsertMany:
+		if dryRun {
+			return result, saiTypes.NewErrorf("%s cannot be previewed", q.Method)
+		}
+		resp, err := s.CreateDocuments(ctx, types.CreateDocumentsRequest{
+			Collection: q.Collection,
+			Data:       q.Documents,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Created = int64(resp.Created)
+	case shell.OpUpdateMany:
+		resp, err := s.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+			Collection: q.Collection,
+			Filter:     q.Filter,
+			Data:       q.Update,
+			Upsert:     q.Upsert,
+			DryRun:     dryRun,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Updated, result.Matched, result.Sample = resp.Updated, resp.Matched, resp.PostImages
+	case shell.OpUpdateOne, shell.OpReplaceOne, shell.OpFindOneAndUpdate:
+		return s.runSingleDocumentUpdate(ctx, q, result)
+	case shell.OpDeleteOne:
+		return s.runSingleDocumentDelete(ctx, q, result, deletedBy)
+	case shell.OpDeleteMany:
+		resp, err := s.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+			Collection: q.Collection,
+			Filter:     q.Filter,
+			DryRun:     dryRun,
+			DeletedBy:  deletedBy,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Deleted, result.Matched, result.Sample = resp.Deleted, resp.Matched, resp.Sample
+	default:
+		return result, saiTypes.NewErrorf("operation %q is not supported", q.Method)
+	}
+	return result, nil
+}
+
+// runSingleDocumentUpdate runs updateOne, replaceOne and findOneAndUpdate.
+// The first matching document in sort order is picked and then updated by
+// its internal_id, so at most one document changes.
+func (s *StorageService) runSingleDocumentUpdate(ctx context.Context, q *shell.Query, result types.QueryResult) (types.QueryResult, error) {
+	found, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: q.Collection,
+		Filter:     q.Filter,
+		Sort:       q.Sort,
+		Limit:      1,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	req := types.UpdateDocumentsRequest{
+		Collection: q.Collection,
+		Filter:     q.Filter,
+		Data:       q.Update,
+		Upsert:     q.Upsert,
+		DryRun:     result.DryRun,
+	}
+	var current map[string]interface{}
+	if len(found.Data) > 0 {
+		current = found.Data[0]
+		if req.Filter, err = singleDocumentFilter(current); err != nil {
+			return result, err
+		}
+		req.Upsert = false
+		result.Matched = 1
+	} else if !q.Upsert {
+		return result, nil
+	}
+	if q.Operation == shell.OpReplaceOne {
+		req.Data = replacementUpdate(current, q.Update)
+	}
+
+	resp, err := s.UpdateDocuments(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	result.Updated = resp.Updated
+	if result.DryRun {
+		result.Matched, result.Sample = resp.Matched, resp.PostImages
+		return result, nil
+	}
+	if q.Operation != shell.OpFindOneAndUpdate {
+		return result, nil
+	}
+
+	doc := current
+	if q.ReturnNew {
+		after, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: q.Collection,
+			Filter:     req.Filter,
+			Sort:       q.Sort,
+			Limit:      1,
+		})
+		if err != nil {
+			return result, err
+		}
+		doc = nil
+		if len(after.Data) > 0 {
+			doc = after.Data[0]
+		}
+	}
+	if doc == nil {
+		return result, nil
+	}
+	if len(q.Fields) > 0 {
+		projected := make(map[string]interface{}, len(q.Fields))
+		for _, field := range q.Fields {
+			if v, ok := doc[field]; ok {
+				projected[field] = v
+			}
+		}
+		doc = projected
+	}
+	result.Documents = []map[string]interface{}{doc}
+	return result, nil
+}
+
+// runSingleDocumentDelete runs deleteOne the way runSingleDocumentUpdate
+// runs updateOne: only the first matching document is deleted.
+func (s *StorageService) runSingleDocumentDelete(ctx context.Context, q *shell.Query, result types.QueryResult, deletedBy string) (types.QueryResult, error) {
+	found, err := s.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: q.Collection,
+		Filter:     q.Filter,
+		Sort:       q.Sort,
+		Limit:      1,
+	})
+	if err != nil {
+		return result, err
+	}
+	if len(found.Data) == 0 {
+		return result, nil
+	}
+	filter, err := singleDocumentFilter(found.Data[0])
+	if err != nil {
+		return result, err
+	}
+
+	resp, err := s.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+		Collection: q.Collection,
+		Filter:     filter,
+		DryRun:     result.DryRun,
+		DeletedBy:  deletedBy,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Deleted, result.Matched, result.Sample = resp.Deleted, resp.Matched, resp.Sample
+	return result, nil
+}
+
+// singleDocumentFilter addresses exactly the document that was found. A
+// document without internal_id, e.g. one written outside the service, is
+// refused: {internal_id: null} would match every such document.
+func singleDocumentFilter(doc map[string]interface{}) (map[string]interface{}, error) {
+	id, _ := doc["internal_id"].(string)
+	if id == "" {
+		return nil, saiTypes.NewError("the matched document has no internal_id and cannot be changed by a single-document operation")
+	}
+	return map[string]interface{}{"internal_id": id}, nil
+}
+
+// replacementUpdate turns a replaceOne document into $set and $unset
+// against the current document. Identity and timestamps are kept.
+func replacementUpdate(current, replacement map[string]interface{}) map[string]interface{} {
+	preserved := map[string]bool{"_id": true, "internal_id": true, "cr_time": true, "ch_time": true}
+	set := make(map[string]interface{}, len(replacement))
+	for k, v := range replacement {
+		if !preserved[k] {
+			set[k] = v
+		}
+	}
+	unset := make(map[string]interface{})
+	for k := range current {
+		if _, ok := replacement[k]; !ok && !preserved[k] {
+			unset[k] = ""
+		}
+	}
+	update := map[string]interface{}{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSingleDocumentFilter(t *testing.T) {
+	cases := []struct {
+		name string
+		doc  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"internal_id", map[string]interface{}{"_id": "x", "internal_id": "a1"}, map[string]interface{}{"internal_id": "a1"}},
+		{"missing", map[string]interface{}{"_id": "x"}, nil},
+		{"empty", map[string]interface{}{"internal_id": ""}, nil},
+		{"not a string", map[string]interface{}{"internal_id": nil}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := singleDocumentFilter(tc.doc)
+			if (err != nil) != (tc.want == nil) {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("filter = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/saiset-co/sai-service/sai"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+const (
+	redactedValue            = "[redacted]"
+	omittedUnparsedBodyValue = "[omitted: body is not valid JSON]"
+)
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "X-API-Key", "X-Access-Key"}
+
+// requestLogRules is the compiled form of types.RequestLogConfig.
+type requestLogRules struct {
+	fields      map[string]bool
+	anyDepth    map[string]bool
+	patterns    []*regexp.Regexp
+	headers     map[string]bool
+	withHeaders bool
+	maxBody     int
+	sampleRates map[string]float64
+}
+
+func newRequestLogRules(cfg types.RequestLogConfig) requestLogRules {
+	rules := requestLogRules{
+		fields:      make(map[string]bool),
+		anyDepth:    make(map[string]bool),
+		headers:     make(map[string]bool),
+		withHeaders: cfg.IncludeHeaders,
+		maxBody:     cfg.MaxBodyBytes,
+		sampleRates: cfg.SampleRates,
+	}
+	for _, f := range cfg.RedactFields {
+		if strings.Contains(f, ".") {
+			rules.fields[f] = true
+		} else {
+			rules.anyDepth[strings.ToLower(f)] = true
+		}
+	}
+	for _, p := range cfg.RedactPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			sai.Logger().Error("Invalid request log redaction pattern", zap.String("pattern", p), zap.Error(err))
+			continue
+		}
+		rules.patterns = append(rules.patterns, re)
+	}
+	headers := cfg.RedactHeaders
+	if len(headers) == 0 {
+		headers = defaultRedactHeaders
+	}
+	for _, h := range headers {
+		rules.headers[strings.ToLower(h)] = true
+	}
+	return rules
+}
+
+// SampleRequestLog decides whether a request to collection is logged, using the
+// most specific configured sampling rate.
+func (s *StorageService) SampleRequestLog(collection, operation string) bool {
+	if !s.logRequests {
+		return false
+	}
+	rates := s.logRules.sampleRates
+	if len(rates) == 0 {
+		return true
+	}
+	for _, key := range []string{collection + ":" + operation, collection, "*:" + operation, "*"} {
+		if rate, ok := rates[key]; ok {
+			return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+		}
+	}
+	return true
+}
+
+func (s *StorageService) LogRequestHeaders() bool {
+	return s.logRules.withHeaders
+}
+
+func (s *StorageService) RedactHeader(name, value string) string {
+	if s.logRules.headers[strings.ToLower(name)] {
+		return redactedValue
+	}
+	return s.RedactLogText(value)
+}
+
+// RequestLogBody renders a request body for the request log: encrypted and
+// configured fields are masked, patterns are replaced and the result is cut
+// to max_body_bytes.
+func (s *StorageService) RequestLogBody(body interface{}) (string, bool) {
+	body = s.MaskEncrypted(body)
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+	if s.redactsFields() {
+		var tree interface{}
+		if err := json.Unmarshal(raw, &tree); err == nil {
+			if m, ok := tree.(map[string]interface{}); ok {
+				if text, ok := m["raw_body"].(string); ok && text != omittedRawBodyValue {
+					m["raw_body"] = s.redactRawBody(text)
+				}
+			}
+			if b, err := json.Marshal(s.redactBody(tree)); err == nil {
+				raw = b
+			}
+		}
+	}
+
+	return s.truncateLogText(s.RedactLogText(string(raw)))
+}
+
+func (s *StorageService) redactsFields() bool {
+	return len(s.logRules.fields) > 0 || len(s.logRules.anyDepth) > 0
+}
+
+// redactBody applies redact_fields to every part of a body. Each top-level
+// value, e.g. data, filter, pipeline or params, counts as a document root
+// for dotted paths.
+func (s *StorageService) redactBody(tree interface{}) interface{} {
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		return s.redactFields(tree, "")
+	}
+	for key, value := range m {
+		if key == "raw_body" {
+			continue
+		}
+		if s.logRules.anyDepth[strings.ToLower(key)] {
+			m[key] = redactedValue
+			continue
+		}
+		m[key] = s.redactFields(value, "")
+	}
+	return m
+}
+
+// redactRawBody redacts a body the handler could not decode. It is parsed
+// as plain JSON when possible; otherwise fields cannot be found in it and
+// it is dropped.
+func (s *StorageService) redactRawBody(text string) string {
+	var tree interface{}
+	if err := json.Unmarshal([]byte(text), &tree); err != nil {
+		return omittedUnparsedBodyValue
+	}
+	b, err := json.Marshal(s.redactBody(tree))
+	if err != nil {
+		return omittedUnparsedBodyValue
+	}
+	return string(b)
+}
+
+// RedactLogText applies the configured patterns to free text such as raw
+// bodies and admin queries.
+func (s *StorageService) RedactLogText(text string) string {
+	for _, re := range s.logRules.patterns {
+		text = re.ReplaceAllString(text, redactedValue)
+	}
+	return text
+}
+
+func (s *StorageService) truncateLogText(text string) (string, bool) {
+	limit := s.logRules.maxBody
+	if limit <= 0 || len(text) <= limit {
+		return text, false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + fmt.Sprintf("…[truncated %d bytes]", len(text)-cut), true
+}
+
+func (s *StorageService) redactFields(v interface{}, prefix string) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		for i := range t {
+			t[i] = s.redactFields(t[i], prefix)
+		}
+	case map[string]interface{}:
+		for key, value := range t {
+			if strings.HasPrefix(key, "$") {
+				t[key] = s.redactFields(value, prefix)
+				continue
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			name := key
+			if i := strings.LastIndexByte(key, '.'); i >= 0 {
+				name = key[i+1:]
+			}
+			if s.logRules.fields[path] || s.logRules.anyDepth[strings.ToLower(name)] {
+				t[key] = redactedValue
+				continue
+			}
+			t[key] = s.redactFields(value, path)
+		}
+	}
+	return v
+}
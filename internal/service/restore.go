@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+const (
+	defaultArchiveOperationsLimit = 50
+	maxArchiveOperationsLimit     = 500
+)
+
+// ArchiveOperations lists archived operations of a collection, newest first.
+func (s *StorageService) ArchiveOperations(ctx context.Context, request types.ArchiveOperationsRequest) (types.ArchiveOperationsResponse, error) {
+	if err := s.validator.Struct(request); err != nil {
+		return types.ArchiveOperationsResponse{}, saiTypes.WrapError(err, "validation failed")
+	}
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultArchiveOperationsLimit
+	}
+	if limit > maxArchiveOperationsLimit {
+		limit = maxArchiveOperationsLimit
+	}
+
+	groups, total, err := s.repo.GetArchiveGroups(ctx, request.Collection+"_"+request.Archive+"_archive", request.Search, request.Skip, limit)
+	if err != nil {
+		return types.ArchiveOperationsResponse{}, saiTypes.WrapError(err, "failed to read archive operations")
+	}
+	if groups == nil {
+		groups = []types.ArchiveGroup{}
+	}
+	return types.ArchiveOperationsResponse{Data: groups, Total: total}, nil
+}
+
+type restoreEntry struct {
+	archive string
+	time    int64
+	doc     map[string]interface{}
+}
+
+// RestoreOperation undoes one archived operation: documents it created are
+// deleted, documents it updated or deleted get their archived state back.
+// Entries are reversed newest first and marked with restored_at; an operation
+// is restored at most once.
+func (s *StorageService) RestoreOperation(ctx context.Context, request types.RestoreRequest) (types.RestoreResponse, error) {
+	if err := s.validator.Struct(request); err != nil {
+		return types.RestoreResponse{}, saiTypes.WrapError(err, "validation failed")
+	}
+
+	archives := []string{"create", "update", "delete"}
+	if request.Archive != "" {
+		archives = []string{request.Archive}
+	}
+	filter := map[string]interface{}{"archive_operation_id": request.ArchiveOperationID}
+	if len(request.InternalIDs) > 0 {
+		filter["internal_id"] = map[string]interface{}{"$in": request.InternalIDs}
+	}
+
+	var entries []restoreEntry
+	var touched []string
+	for _, archive := range archives {
+		docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: request.Collection + "_" + archive + "_archive",
+			Filter:     filter,
+		})
+		if err != nil {
+			return types.RestoreResponse{}, saiTypes.WrapError(err, "failed to read "+archive+" archive")
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		touched = append(touched, archive)
+		for _, doc := range docs {
+			if restoredAt, _ := toNumber(doc["restored_at"]); restoredAt > 0 {
+				return types.RestoreResponse{}, saiTypes.NewErrorf("operation %s was already restored", request.ArchiveOperationID)
+			}
+			t, _ := toNumber(doc["archive_time"])
+			entries = append(entries, restoreEntry{archive: archive, time: int64(t), doc: doc})
+		}
+	}
+	if len(entries) == 0 {
+		return types.RestoreResponse{}, saiTypes.NewErrorf("operation %s not found in archives", request.ArchiveOperationID)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].time > entries[j].time })
+
+	response := types.RestoreResponse{
+		ArchiveOperationID: request.ArchiveOperationID,
+		DryRun:             request.DryRun,
+		Documents:          make([]types.RestoredDocument, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		internalID, ok := entry.doc["internal_id"].(string)
+		if !ok {
+			continue
+		}
+		upsertInsert, _ := entry.doc["upsert_insert"].(bool)
+		action := "restore"
+		if entry.archive == "create" || upsertInsert {
+			action = "delete"
+		}
+		response.Documents = append(response.Documents, types.RestoredDocument{InternalID: internalID, Archive: entry.archive, Action: action})
+		if request.DryRun {
+			continue
+		}
+
+		docFilter := map[string]interface{}{"internal_id": internalID}
+		n, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{Collection: request.Collection, Filter: docFilter})
+		if err != nil {
+			return response, saiTypes.WrapError(err, "failed to restore document "+internalID)
+		}
+		if action == "delete" {
+			if n > 0 {
+				response.Deleted++
+			}
+			continue
+		}
+		if _, err := s.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{
+			Collection: request.Collection,
+			Data:       []interface{}{stripArchiveFields(entry.doc)},
+		}); err != nil {
+			return response, saiTypes.WrapError(err, "failed to restore document "+internalID)
+		}
+		response.Restored++
+	}
+	if request.DryRun {
+		return response, nil
+	}
+
+	for _, archive := range touched {
+		if err := s.repo.BulkPatch(ctx, request.Collection+"_"+archive+"_archive", []types.UpsertOperation{{
+			Filter: filter,
+			Update: map[string]interface{}{"$set": map[string]interface{}{"restored_at": time.Now().UnixNano()}},
+		}}); err != nil {
+			return response, saiTypes.WrapError(err, "failed to mark operation as restored")
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+const defaultRetentionInterval = time.Hour
+
+// retentionJob purges log, archive and analytics collections on a timer.
+// Max age is also pushed down to Mongo TTL indexes; the job still deletes by
+// age to cover documents written before the TTL field existed.
+type retentionJob struct {
+	mu       sync.Mutex
+	running  bool
+	lastRun  time.Time
+	nextRun  time.Time
+	results  []types.RetentionCollectionStatus
+	interval time.Duration
+	trigger  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (s *StorageService) startRetention() {
+	interval := time.Duration(s.retention.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+	s.retentionJob = &retentionJob{
+		interval: interval,
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	go s.retentionLoop()
+}
+
+func (s *StorageService) retentionLoop() {
+	job := s.retentionJob
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-job.stop:
+			return
+		case <-job.trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		s.purgeRetention(context.Background())
+
+		job.mu.Lock()
+		job.nextRun = time.Now().Add(job.interval)
+		job.mu.Unlock()
+		timer.Reset(job.interval)
+	}
+}
+
+func (s *StorageService) stopRetention() {
+	if s.retentionJob != nil {
+		s.retentionJob.stopOnce.Do(func() { close(s.retentionJob.stop) })
+	}
+}
+
+// RunRetention schedules an immediate purge instead of waiting for the timer.
+func (s *StorageService) RunRetention() error {
+	if s.retentionJob == nil {
+		return saiTypes.NewError("retention is disabled")
+	}
+	select {
+	case s.retentionJob.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *StorageService) RetentionStatus() types.RetentionStatus {
+	status := types.RetentionStatus{
+		Enabled:  s.retention.Enabled,
+		Policies: s.retention.Policies,
+	}
+	if job := s.retentionJob; job != nil {
+		job.mu.Lock()
+		status.Interval = job.interval
+		status.Running = job.running
+		status.LastRun = job.lastRun
+		status.NextRun = job.nextRun
+		status.Collections = append(status.Collections, job.results...)
+		job.mu.Unlock()
+	}
+	return status
+}
+
+func (s *StorageService) purgeRetention(ctx context.Context) {
+	job := s.retentionJob
+	job.mu.Lock()
+	job.running = true
+	job.mu.Unlock()
+
+	namespaces := []string{""}
+	if s.tenancy.Enabled {
+		tenants, err := s.repo.ListTenants(ctx)
+		if err != nil {
+			sai.Logger().Warn("Retention failed to list tenants", zap.Error(err))
+		}
+		namespaces = append(namespaces, tenants...)
+	}
+
+	var results []types.RetentionCollectionStatus
+	for _, tenant := range namespaces {
+		tenantCtx := types.WithTenant(ctx, tenant)
+		names, err := s.repo.ListCollectionNames(tenantCtx)
+		if err != nil {
+			sai.Logger().Warn("Retention failed to list collections", zap.String("tenant", tenant), zap.Error(err))
+			continue
+		}
+		for _, name := range names {
+			policy, ok := s.retentionPolicy(name)
+			if !ok {
+				continue
+			}
+			result := s.applyRetention(tenantCtx, name, policy)
+			result.Tenant = tenant
+			results = append(results, result)
+		}
+	}
+
+	job.mu.Lock()
+	job.running = false
+	job.lastRun = time.Now()
+	job.results = results
+	job.mu.Unlock()
+}
+
+// retentionPolicy returns the first policy matching name. Only audit and
+// analytics collections are eligible, never user data or admin state.
+func (s *StorageService) retentionPolicy(name string) (types.RetentionPolicy, bool) {
+	if collectionClass(name) != collectionClassAudit && name != "_admin_slow_queries" && name != "_admin_query_stats" {
+		return types.RetentionPolicy{}, false
+	}
+	for _, policy := range s.retention.Policies {
+		if matched, _ := path.Match(policy.Pattern, name); matched {
+			return policy, true
+		}
+	}
+	return types.RetentionPolicy{}, false
+}
+
+func retentionTimeField(name string) string {
+	switch name {
+	case "_admin_slow_queries":
+		return "ts"
+	case "_admin_query_stats":
+		return "last_seen"
+	}
+	return "cr_time"
+}
+
+func (s *StorageService) applyRetention(ctx context.Context, name string, policy types.RetentionPolicy) types.RetentionCollectionStatus {
+	result := types.RetentionCollectionStatus{Collection: name, Policy: policy}
+	timeField := retentionTimeField(name)
+
+	if policy.MaxAgeDays > 0 {
+		maxAge := time.Duration(policy.MaxAgeDays) * 24 * time.Hour
+		if name != "_admin_query_stats" {
+			err := s.repo.EnsureTTLIndex(ctx, name, types.RetentionTimeField, int32(maxAge/time.Second))
+			result.TTL = err == nil
+		}
+
+		deleted, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+			Collection: name,
+			Filter:     map[string]interface{}{timeField: map[string]interface{}{"$lt": time.Now().Add(-maxAge).UnixNano()}},
+		})
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Deleted += deleted
+	}
+
+	if policy.MaxDocuments > 0 {
+		boundary, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+			Collection: name,
+			Sort:       map[string]int{timeField: -1},
+			Skip:       int(policy.MaxDocuments),
+			Limit:      1,
+			Fields:     []string{timeField},
+		})
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(boundary) > 0 && boundary[0][timeField] != nil {
+			deleted, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+				Collection: name,
+				Filter:     map[string]interface{}{timeField: map[string]interface{}{"$lte": boundary[0][timeField]}},
+			})
+			if err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			result.Deleted += deleted
+		}
+	}
+
+	if result.Deleted > 0 {
+		sai.Logger().Info("Retention purged documents", zap.String("collection", name), zap.Int64("deleted", result.Deleted))
+	}
+	return result
+}
+
+// stampRetention adds the TTL field to a log or archive document.
+func (s *StorageService) stampRetention(doc map[string]interface{}) {
+	if s.retention.Enabled {
+		doc[types.RetentionTimeField] = time.Now()
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+// rollbackChain is a plan together with the archive event behind each step.
+type rollbackChain struct {
+	plan   types.RollbackPlan
+	events []archiveEvent
+	ids    []string
+}
+
+// PlanRollback lists the archive entries a rollback would reverse and the
+// documents where it would discard changes made outside the selection.
+func (s *StorageService) PlanRollback(ctx context.Context, request types.RollbackRequest) (types.RollbackPlan, error) {
+	chain, err := s.rollbackChain(ctx, request)
+	if err != nil {
+		return types.RollbackPlan{}, err
+	}
+	return chain.plan, nil
+}
+
+func (s *StorageService) rollbackChain(ctx context.Context, request types.RollbackRequest) (rollbackChain, error) {
+	if !s.archiveChanges {
+		return rollbackChain{}, saiTypes.NewError("rollback requires archive_changes")
+	}
+	if err := s.validator.Struct(request); err != nil {
+		return rollbackChain{}, saiTypes.WrapError(err, "validation failed")
+	}
+	if request.OperationID == "" && request.From <= 0 {
+		return rollbackChain{}, saiTypes.NewError("operation_id or from is required")
+	}
+
+	start := request.From
+	ids := request.InternalIDs
+	var selection []archiveEvent
+	var err error
+	if request.OperationID != "" {
+		selection, err = s.archiveEvents(ctx, request.Collection, map[string]interface{}{"archive_operation_id": request.OperationID})
+		if err != nil {
+			return rollbackChain{}, err
+		}
+		if len(selection) == 0 {
+			return rollbackChain{}, saiTypes.NewErrorf("operation %s not found in archives", request.OperationID)
+		}
+		start = selection[0].time
+	} else if len(ids) == 0 {
+		window := map[string]interface{}{"$gte": request.From}
+		if request.To > 0 {
+			window["$lte"] = request.To
+		}
+		selection, err = s.archiveEvents(ctx, request.Collection, map[string]interface{}{"archive_time": window})
+		if err != nil {
+			return rollbackChain{}, err
+		}
+	}
+	if len(ids) == 0 {
+		seen := make(map[string]bool)
+		for _, ev := range selection {
+			if id, _ := ev.doc["internal_id"].(string); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return rollbackChain{}, saiTypes.NewError("nothing to roll back")
+	}
+
+	events, err := s.archiveEvents(ctx, request.Collection, map[string]interface{}{
+		"internal_id":  map[string]interface{}{"$in": ids},
+		"archive_time": map[string]interface{}{"$gte": start},
+	})
+	if err != nil {
+		return rollbackChain{}, err
+	}
+	conflicts, err := s.rollbackConflicts(ctx, request, ids, events)
+	if err != nil {
+		return rollbackChain{}, err
+	}
+
+	chain := rollbackChain{
+		plan: types.RollbackPlan{
+			Collection: request.Collection,
+			From:       start,
+			Documents:  len(ids),
+			Steps:      make([]types.RollbackStep, 0, len(events)),
+			Conflicts:  conflicts,
+		},
+		events: make([]archiveEvent, 0, len(events)),
+		ids:    ids,
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		id, _ := ev.doc["internal_id"].(string)
+		step := types.RollbackStep{
+			OperationID: ev.operationID,
+			Operation:   ev.kind,
+			InternalID:  id,
+			Time:        ev.time,
+			Action:      "restore",
+		}
+		if ev.inserted() {
+			step.Operation = "create"
+			step.Action = "delete"
+		}
+		chain.plan.Steps = append(chain.plan.Steps, step)
+		chain.events = append(chain.events, ev)
+	}
+	return chain, nil
+}
+
+// rollbackConflicts reports, per document, the first change outside the
+// selected operation or window, and live documents that drifted from the
+// state their last archive entry describes.
+func (s *StorageService) rollbackConflicts(ctx context.Context, request types.RollbackRequest, ids []string, events []archiveEvent) ([]types.RollbackConflict, error) {
+	var conflicts []types.RollbackConflict
+	reported := make(map[string]bool)
+	last := make(map[string]archiveEvent)
+	for _, ev := range events {
+		id, _ := ev.doc["internal_id"].(string)
+		last[id] = ev
+		if reported[id] {
+			continue
+		}
+		outside := (request.OperationID != "" && ev.operationID != request.OperationID) ||
+			(request.OperationID == "" && request.To > 0 && ev.time > request.To)
+		if outside {
+			reported[id] = true
+			conflicts = append(conflicts, types.RollbackConflict{
+				InternalID:  id,
+				Reason:      "changed by a later operation",
+				OperationID: ev.operationID,
+				Time:        ev.time,
+			})
+		}
+	}
+
+	live, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: request.Collection,
+		Filter:     map[string]interface{}{"internal_id": map[string]interface{}{"$in": ids}},
+	})
+	if err != nil {
+		return nil, saiTypes.WrapError(err, "failed to read documents")
+	}
+	liveByID := make(map[string]map[string]interface{}, len(live))
+	for _, doc := range live {
+		if id, ok := doc["internal_id"].(string); ok {
+			liveByID[id] = doc
+		}
+	}
+
+	for _, id := range ids {
+		ev, ok := last[id]
+		if !ok || reported[id] {
+			continue
+		}
+		var expected map[string]interface{}
+		switch {
+		case ev.inserted():
+			expected = ev.doc
+		case ev.kind == "update":
+			if ev.post == nil {
+				continue
+			}
+			expected = ev.post
+		}
+
+		current, exists := liveByID[id]
+		reason := ""
+		switch {
+		case expected == nil && exists:
+			reason = "document exists although its last archived operation deleted it"
+		case expected != nil && !exists:
+			reason = "document is missing"
+		case expected != nil && driftedFrom(expected, current):
+			reason = "document changed outside archived operations"
+		}
+		if reason != "" {
+			conflicts = append(conflicts, types.RollbackConflict{InternalID: id, Reason: reason})
+		}
+	}
+	return conflicts, nil
+}
+
+// driftedFrom ignores cr_time, which archive copies do not preserve.
+func driftedFrom(expected, current map[string]interface{}) bool {
+	for _, change := range documentDiff(expected, stripArchiveFields(current)) {
+		if change.Path != "cr_time" {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyRollback reverses the planned steps newest first. All writes share one
+// new operation id and are archived like any other change, so a rollback can
+// itself be inspected and rolled back. Entries it reversed get restored_at.
+func (s *StorageService) ApplyRollback(ctx context.Context, request types.RollbackRequest) (types.RollbackResult, error) {
+	chain, err := s.rollbackChain(ctx, request)
+	if err != nil {
+		return types.RollbackResult{}, err
+	}
+	if len(chain.plan.Conflicts) > 0 && !request.Force {
+		return types.RollbackResult{}, saiTypes.NewErrorf("rollback has %d conflicts, set force to apply it anyway", len(chain.plan.Conflicts))
+	}
+
+	result := types.RollbackResult{Plan: chain.plan, OperationID: uuid.New().String()}
+	opCtx := withOperationID(ctx, result.OperationID)
+	startedAt := time.Now().UnixNano()
+
+	for i, step := range chain.plan.Steps {
+		restored, err := s.applyRollbackStep(opCtx, request.Collection, step, chain.events[i])
+		if err != nil {
+			return result, saiTypes.WrapError(err, "rollback stopped at operation "+step.OperationID)
+		}
+		if !restored {
+			continue
+		}
+		if step.Action == "delete" {
+			result.Deleted++
+		} else {
+			result.Restored++
+		}
+	}
+
+	for _, suffix := range archiveSuffixes {
+		err := s.repo.BulkPatch(ctx, request.Collection+"_"+suffix, []types.UpsertOperation{{
+			Filter: map[string]interface{}{
+				"internal_id":  map[string]interface{}{"$in": chain.ids},
+				"archive_time": map[string]interface{}{"$gte": chain.plan.From, "$lt": startedAt},
+			},
+			Update: map[string]interface{}{"$set": map[string]interface{}{"restored_at": time.Now().UnixNano()}},
+		}})
+		if err != nil {
+			sai.Logger().Warn("Failed to mark rolled back archive entries", zap.String("collection", request.Collection+"_"+suffix), zap.Error(err))
+		}
+	}
+
+	sai.Logger().Info("Rollback applied",
+		zap.String("collection", request.Collection),
+		zap.String("operation_id", result.OperationID),
+		zap.Int("steps", len(chain.plan.Steps)),
+		zap.Int("conflicts", len(chain.plan.Conflicts)))
+	return result, nil
+}
+
+// applyRollbackStep archives the live document and replaces it with the
+// pre-image of ev, or removes it when ev inserted it. It reports whether the
+// collection changed.
+func (s *StorageService) applyRollbackStep(ctx context.Context, collection string, step types.RollbackStep, ev archiveEvent) (bool, error) {
+	filter := map[string]interface{}{"internal_id": step.InternalID}
+	live, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{Collection: collection, Filter: filter, Limit: 1})
+	if err != nil {
+		return false, saiTypes.WrapError(err, "failed to read document")
+	}
+
+	if step.Action == "delete" {
+		if len(live) == 0 {
+			return false, nil
+		}
+		if _, err := s.writeArchive(ctx, collection, "delete_archive", live, map[string]interface{}{"archive_filter": filter}); err != nil {
+			return false, err
+		}
+		if _, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{Collection: collection, Filter: filter}); err != nil {
+			return false, saiTypes.WrapError(err, "failed to delete document")
+		}
+		return true, nil
+	}
+
+	image := make(map[string]interface{}, len(ev.doc))
+	for k, v := range ev.doc {
+		image[k] = v
+	}
+
+	if len(live) == 0 {
+		if _, err := s.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{Collection: collection, Data: []interface{}{image}}); err != nil {
+			return false, saiTypes.WrapError(err, "failed to restore document")
+		}
+		_, err := s.writeArchive(ctx, collection, "create_archive", []map[string]interface{}{image}, map[string]interface{}{"archive_filter": filter})
+		return true, err
+	}
+
+	if _, err := s.writeArchive(ctx, collection, "update_archive", live, map[string]interface{}{
+		"archive_filter":     filter,
+		"archive_update":     image,
+		"archive_post_image": image,
+		"archive_diff":       archiveDiff(documentDiff(stripArchiveFields(live[0]), image)),
+	}); err != nil {
+		return false, err
+	}
+	if _, err := s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{Collection: collection, Filter: filter}); err != nil {
+		return false, saiTypes.WrapError(err, "failed to replace document")
+	}
+	if _, err := s.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{Collection: collection, Data: []interface{}{image}}); err != nil {
+		return false, saiTypes.WrapError(err, "failed to restore document")
+	}
+	return true, nil
+}
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/internal/shell"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSnapshotLimit  = 20
+	defaultKeepRuns       = 100
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// queryScheduler runs saved queries on their cron expressions. A query
+// still running when its next tick comes is skipped, not run twice.
+type queryScheduler struct {
+	cron    *cron.Cron
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+}
+
+func (s *StorageService) startQueryScheduler() {
+	s.queryScheduler = &queryScheduler{
+		cron:    cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		entries: make(map[string]cron.EntryID),
+	}
+	s.queryScheduler.cron.Start()
+	if err := s.ReloadQuerySchedules(); err != nil {
+		sai.Logger().Warn("Failed to load query schedules", zap.Error(err))
+	}
+}
+
+// stopQueryScheduler waits for running queries until ctx is done.
+func (s *StorageService) stopQueryScheduler(ctx context.Context) {
+	if s.queryScheduler == nil {
+		return
+	}
+	select {
+	case <-s.queryScheduler.cron.Stop().Done():
+	case <-ctx.Done():
+	}
+}
+
+// ReloadQuerySchedules replaces the cron entries with the schedules stored
+// on the saved queries. Call it after a saved query changes.
+func (s *StorageService) ReloadQuerySchedules() error {
+	docs, _, err := s.repo.ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+		Collection: SavedQueriesCollection,
+		Fields:     []string{"internal_id", "schedule"},
+	})
+	if err != nil {
+		return err
+	}
+
+	sch := s.queryScheduler
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	for id, entry := range sch.entries {
+		sch.cron.Remove(entry)
+		delete(sch.entries, id)
+	}
+	for _, doc := range docs {
+		id, _ := doc["internal_id"].(string)
+		spec, _ := doc["schedule"].(string)
+		if id == "" || spec == "" {
+			continue
+		}
+		entry, err := sch.cron.AddFunc(spec, func() {
+			if _, err := s.RunScheduledQuery(id); err != nil {
+				sai.Logger().Warn("Failed to record scheduled query run", zap.String("query_id", id), zap.Error(err))
+			}
+		})
+		if err != nil {
+			sai.Logger().Warn("Invalid query schedule", zap.String("query_id", id), zap.String("schedule", spec), zap.Error(err))
+			continue
+		}
+		sch.entries[id] = entry
+	}
+	return nil
+}
+
+// NextQueryRun returns when a saved query runs next, or the zero time if it
+// is not scheduled.
+func (s *StorageService) NextQueryRun(id string) time.Time {
+	sch := s.queryScheduler
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	entry, ok := sch.entries[id]
+	if !ok {
+		return time.Time{}
+	}
+	return sch.cron.Entry(entry).Next
+}
+
+// QuerySchedule returns the schedule stored on a saved query document.
+func QuerySchedule(doc map[string]interface{}) types.QuerySchedule {
+	schedule := types.QuerySchedule{}
+	schedule.Cron, _ = doc["schedule"].(string)
+	schedule.Tenant, _ = doc["schedule_tenant"].(string)
+	schedule.Alert, _ = doc["alert_rule"].(string)
+	schedule.Webhook, _ = doc["alert_webhook"].(string)
+	if params, ok := toMap(doc["schedule_params"]); ok && len(params) > 0 {
+		schedule.Params = make(map[string]string, len(params))
+		for name, v := range params {
+			schedule.Params[name] = fmt.Sprint(v)
+		}
+	}
+	return schedule
+}
+
+// SetQuerySchedule stores the schedule of a saved query. An empty Cron
+// removes it. The query must be a read and its parameters must bind.
+func (s *StorageService) SetQuerySchedule(id string, schedule types.QuerySchedule) error {
+	doc, err := s.savedQueryDoc(id)
+	if err != nil {
+		return err
+	}
+	schedule.Cron = strings.TrimSpace(schedule.Cron)
+	if schedule.Cron == "" {
+		schedule = types.QuerySchedule{}
+	} else {
+		if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+			return saiTypes.WrapError(err, "invalid cron expression")
+		}
+		if _, err := parseQueryAlert(schedule.Alert); err != nil {
+			return err
+		}
+		if _, err := scheduledQuery(doc["query_raw"].(string), schedule.Params); err != nil {
+			return err
+		}
+	}
+
+	params := make(map[string]interface{}, len(schedule.Params))
+	for name, v := range schedule.Params {
+		params[name] = v
+	}
+	_, err = s.repo.UpdateDocuments(context.Background(), types.UpdateDocumentsRequest{
+		Collection: SavedQueriesCollection,
+		Filter:     map[string]interface{}{"internal_id": id},
+		Data: map[string]interface{}{
+			"schedule":        schedule.Cron,
+			"schedule_params": params,
+			"schedule_tenant": schedule.Tenant,
+			"alert_rule":      strings.TrimSpace(schedule.Alert),
+			"alert_webhook":   strings.TrimSpace(schedule.Webhook),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.ReloadQuerySchedules()
+}
+
+// scheduledQuery binds a saved query with the parameters of its schedule.
+// Placeholders without a value or default are an error, and only reads can
+// be scheduled.
+func scheduledQuery(queryRaw string, params map[string]string) (*shell.Query, error) {
+	if params == nil {
+		params = map[string]string{}
+	}
+	q, err := shell.Bind(queryRaw, params)
+	if err != nil {
+		return nil, err
+	}
+	if shell.IsWrite(q.Operation) {
+		return nil, saiTypes.NewErrorf("%s cannot be scheduled, only read queries can", q.Method)
+	}
+	return q, nil
+}
+
+// RunScheduledQuery runs a saved query with its schedule's parameters and
+// tenant, checks the alert rule and records the run. A failing query is
+// recorded with its error; the returned error is about recording the run.
+func (s *StorageService) RunScheduledQuery(id string) (types.QueryRun, error) {
+	doc, err := s.savedQueryDoc(id)
+	if err != nil {
+		return types.QueryRun{}, err
+	}
+	schedule := QuerySchedule(doc)
+	run := types.QueryRun{QueryID: id, Tenant: schedule.Tenant}
+	run.Name, _ = doc["name"].(string)
+	run.Collection, _ = doc["collection"].(string)
+
+	start := time.Now()
+	run.Time = start.UnixNano()
+	q, err := scheduledQuery(doc["query_raw"].(string), schedule.Params)
+	var result types.QueryResult
+	if err == nil {
+		result, err = s.RunQuery(types.WithTenant(context.Background(), schedule.Tenant), q, false, "")
+	}
+	run.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		run.Error = err.Error()
+		sai.Logger().Warn("Scheduled query failed", zap.String("query_id", id), zap.String("name", run.Name), zap.Error(err))
+	} else {
+		run.Count = queryResultCount(result)
+		run.Snapshot = s.resultSnapshot(result)
+		run.SnapshotTruncated = run.Count > int64(len(run.Snapshot))
+		s.checkQueryAlert(schedule, &run)
+	}
+	return run, s.saveQueryRun(run)
+}
+
+// queryResultCount is the row count of a run: the matching documents of a
+// find, aggregate or countDocuments, and the values of a distinct.
+func queryResultCount(result types.QueryResult) int64 {
+	switch result.Operation {
+	case shell.OpDistinct:
+		return int64(len(result.Values))
+	case shell.OpFindOne:
+		return int64(len(result.Documents))
+	}
+	return result.Total
+}
+
+// resultSnapshot keeps the first rows of a result. A negative snapshot
+// limit keeps none.
+func (s *StorageService) resultSnapshot(result types.QueryResult) []interface{} {
+	limit := s.scheduledQueries.SnapshotLimit
+	if limit == 0 {
+		limit = defaultSnapshotLimit
+	}
+	if limit < 0 {
+		return nil
+	}
+	rows := make([]interface{}, 0, len(result.Documents)+len(result.Values))
+	for _, doc := range result.Documents {
+		rows = append(rows, doc)
+	}
+	rows = append(rows, result.Values...)
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func (s *StorageService) saveQueryRun(run types.QueryRun) error {
+	ctx := context.Background()
+	doc := map[string]interface{}{
+		"query_id":    run.QueryID,
+		"name":        run.Name,
+		"collection":  run.Collection,
+		"tenant":      run.Tenant,
+		"ts":          run.Time,
+		"duration_ms": run.DurationMs,
+		"count":       run.Count,
+		"error":       run.Error,
+	}
+	if len(run.Snapshot) > 0 {
+		doc["snapshot"] = run.Snapshot
+		doc["snapshot_truncated"] = run.SnapshotTruncated
+	}
+	if run.Alert != "" {
+		doc["alert"] = run.Alert
+	}
+	if run.WebhookError != "" {
+		doc["webhook_error"] = run.WebhookError
+	}
+	if _, err := s.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Data:       []interface{}{doc},
+	}); err != nil {
+		return err
+	}
+
+	keep := s.scheduledQueries.KeepRuns
+	if keep <= 0 {
+		keep = defaultKeepRuns
+	}
+	boundary, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Filter:     map[string]interface{}{"query_id": run.QueryID},
+		Sort:       map[string]int{"ts": -1},
+		Skip:       int(keep),
+		Limit:      1,
+		Fields:     []string{"ts"},
+	})
+	if err != nil || len(boundary) == 0 {
+		return err
+	}
+	_, err = s.repo.DeleteDocuments(ctx, types.DeleteDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Filter: map[string]interface{}{
+			"query_id": run.QueryID,
+			"ts":       map[string]interface{}{"$lte": boundary[0]["ts"]},
+		},
+	})
+	return err
+}
+
+// lastQueryRunCount returns the count of the last successful run of a query.
+func (s *StorageService) lastQueryRunCount(id string) (int64, bool) {
+	docs, _, err := s.repo.ReadDocuments(context.Background(), types.ReadDocumentsRequest{
+		Collection: types.QueryRunsCollection,
+		Filter:     map[string]interface{}{"query_id": id, "error": ""},
+		Sort:       map[string]int{"ts": -1},
+		Limit:      1,
+		Fields:     []string{"count"},
+	})
+	if err != nil || len(docs) == 0 {
+		return 0, false
+	}
+	n, ok := toNumber(docs[0]["count"])
+	return int64(n), ok
+}
+
+// queryAlertRule is either a comparison of the count with a threshold or,
+// for op "changed", a relative change from the previous run in percent.
+type queryAlertRule struct {
+	op        string
+	threshold float64
+}
+
+var (
+	alertComparePattern = regexp.MustCompile(`^count\s*(>=|<=|==|!=|=|>|<)\s*(-?\d+(?:\.\d+)?)$`)
+	alertChangePattern  = regexp.MustCompile(`^count\s+changed\s+by\s+(\d+(?:\.\d+)?)\s*%$`)
+)
+
+// parseQueryAlert parses "count > 0" style comparisons and "count changed
+// by 20%". An empty rule is nil.
+func parseQueryAlert(rule string) (*queryAlertRule, error) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule == "" {
+		return nil, nil
+	}
+	if m := alertComparePattern.FindStringSubmatch(rule); m != nil {
+		op := m[1]
+		if op == "=" {
+			op = "=="
+		}
+		threshold, _ := strconv.ParseFloat(m[2], 64)
+		return &queryAlertRule{op: op, threshold: threshold}, nil
+	}
+	if m := alertChangePattern.FindStringSubmatch(rule); m != nil {
+		threshold, _ := strconv.ParseFloat(m[1], 64)
+		return &queryAlertRule{op: "changed", threshold: threshold}, nil
+	}
+	return nil, saiTypes.NewErrorf(`invalid alert rule %q, expected e.g. "count > 0" or "count changed by 20%%"`, rule)
+}
+
+// match reports whether count fires the rule and why. previous is the count
+// of the last successful run; a change rule never fires without one.
+func (r *queryAlertRule) match(count int64, previous *int64) (string, bool) {
+	c := float64(count)
+	var hit bool
+	switch r.op {
+	case "changed":
+		if previous == nil || count == *previous {
+			return "", false
+		}
+		if *previous == 0 {
+			return fmt.Sprintf("count changed from 0 to %d", count), true
+		}
+		change := math.Abs(c-float64(*previous)) / math.Abs(float64(*previous)) * 100
+		if change < r.threshold {
+			return "", false
+		}
+		return fmt.Sprintf("count changed by %.1f%% (%d -> %d)", change, *previous, count), true
+	case ">":
+		hit = c > r.threshold
+	case ">=":
+		hit = c >= r.threshold
+	case "<":
+		hit = c < r.threshold
+	case "<=":
+		hit = c <= r.threshold
+	case "==":
+		hit = c == r.threshold
+	case "!=":
+		hit = c != r.threshold
+	}
+	if !hit {
+		return "", false
+	}
+	return fmt.Sprintf("count %d %s %s", count, r.op, strconv.FormatFloat(r.threshold, 'f', -1, 64)), true
+}
+
+// checkQueryAlert fires the alert rule of a schedule: the alert goes to the
+// service log and, when configured, to the webhook.
+func (s *StorageService) checkQueryAlert(schedule types.QuerySchedule, run *types.QueryRun) {
+	rule, err := parseQueryAlert(schedule.Alert)
+	if err != nil || rule == nil {
+		return
+	}
+	var previous *int64
+	if n, ok := s.lastQueryRunCount(run.QueryID); ok {
+		previous = &n
+	}
+	message, fired := rule.match(run.Count, previous)
+	if !fired {
+		return
+	}
+	run.Alert = message
+
+	sai.Logger().Warn("Scheduled query alert",
+		zap.String("query_id", run.QueryID),
+		zap.String("name", run.Name),
+		zap.String("tenant", run.Tenant),
+		zap.String("rule", schedule.Alert),
+		zap.String("message", message),
+		zap.Int64("count", run.Count),
+	)
+
+	url := schedule.Webhook
+	if url == "" {
+		url = s.scheduledQueries.WebhookURL
+	}
+	if url == "" {
+		return
+	}
+	err = s.postQueryAlert(url, types.QueryAlert{
+		QueryID:       run.QueryID,
+		Name:          run.Name,
+		Collection:    run.Collection,
+		Tenant:        run.Tenant,
+		Rule:          schedule.Alert,
+		Message:       message,
+		Count:         run.Count,
+		PreviousCount: previous,
+		Time:          run.Time,
+	})
+	if err != nil {
+		run.WebhookError = err.Error()
+		sai.Logger().Warn("Failed to deliver query alert", zap.String("query_id", run.QueryID), zap.String("url", url), zap.Error(err))
+	}
+}
+
+func (s *StorageService) postQueryAlert(url string, alert types.QueryAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(s.scheduledQueries.WebhookTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return saiTypes.NewErrorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -25,19 +25,65 @@ type StorageService struct {
 	logRequests          bool
 	archiveChanges       bool
 	trackQueryStats      bool
+	allowAuditReads      bool
 	slowQueryThresholdMs atomic.Int64
 	indexedArchives      sync.Map
+	accessConfig         types.AccessControlConfig
+	acl                  accessCache
+	tenancy              types.TenancyConfig
+	tenantIndexes        sync.Map
+	encryption           types.EncryptionConfig
+	keys                 keyRing
+	logRules             requestLogRules
+	writer               *asyncWriter
+	retention            types.RetentionConfig
+	retentionJob         *retentionJob
+	softDelete           types.SoftDeleteConfig
+	tombstoneJob         *tombstoneJob
+	indexAdvisor         types.IndexAdvisorConfig
+	advisorJob           *advisorJob
+	scheduledQueries     types.QuerySchedulerConfig
+	queryScheduler       *queryScheduler
+	export               types.ExportConfig
+	metrics              types.MetricsConfig
+	metricsJob           *metricsCollector
+	slowLog              *slowQueryLog
 }
 
 func NewStorageService(repo types.StorageRepository, features types.StorageFeaturesConfig) *StorageService {
 	s := &StorageService{
-		repo:            repo,
-		validator:       validator.New(),
-		logRequests:     features.LogRequests,
-		archiveChanges:  features.ArchiveChanges,
-		trackQueryStats: features.TrackQueryStats,
+		repo:             repo,
+		validator:        validator.New(),
+		logRequests:      features.LogRequests,
+		archiveChanges:   features.ArchiveChanges,
+		trackQueryStats:  features.TrackQueryStats,
+		allowAuditReads:  features.AllowAuditReads,
+		accessConfig:     features.AccessControl,
+		tenancy:          features.Tenancy,
+		encryption:       features.Encryption,
+		logRules:         newRequestLogRules(features.RequestLogs),
+		writer:           newAsyncWriter(repo, features.WriteBuffer),
+		retention:        features.Retention,
+		softDelete:       features.SoftDelete,
+		indexAdvisor:     features.IndexAdvisor,
+		scheduledQueries: features.ScheduledQueries,
+		export:           features.Export,
+		metrics:          features.Metrics,
 	}
 	s.slowQueryThresholdMs.Store(int64(features.SlowQueryThresholdMs))
+	if s.encryption.Enabled {
+		if err := s.ReloadEncryptionKeys(); err != nil {
+			sai.Logger().Error("Failed to load encryption keys", zap.Error(err))
+		}
+	}
+	if s.retention.Enabled {
+		s.startRetention()
+	}
+	s.startTombstonePurge()
+	s.startIndexAdvisor()
+	s.startQueryScheduler()
+	s.startMetrics()
+	s.startSlowQueryLog()
 	return s
 }
 
@@ -79,12 +125,19 @@ func (s *StorageService) CreateDocuments(ctx context.Context, request types.Crea
 		return types.CreateDocumentsResponse{}, saiTypes.WrapError(err, "validation failed")
 	}
 
+	data, err := s.encryptDocuments(request.Collection, request.Data)
+	if err != nil {
+		return types.CreateDocumentsResponse{}, err
+	}
+	request.Data = data
+
 	t := time.Now()
 	createdIDs, err := s.repo.CreateDocuments(ctx, request)
 	if err != nil {
+		s.failedOp(ctx, request.Collection, "create", time.Since(t))
 		return types.CreateDocumentsResponse{}, saiTypes.WrapError(err, "failed to create documents")
 	}
-	s.afterOp(ctx, request.Collection, "create", time.Since(t), int64(len(createdIDs)), nil, nil)
+	s.afterOp(ctx, request.Collection, "create", time.Since(t), int64(len(createdIDs)), nil, nil, nil)
 
 	if s.archiveChanges {
 		s.archiveForCreate(ctx, request.Collection, request.Data)
@@ -101,12 +154,34 @@ func (s *StorageService) ReadDocuments(ctx context.Context, request types.ReadDo
 		return types.ReadDocumentsResponse{}, saiTypes.WrapError(err, "validation failed")
 	}
 
+	filter, err := s.encryptFilter(request.Collection, request.Filter)
+	if err != nil {
+		return types.ReadDocumentsResponse{}, err
+	}
+	request.Filter = filter
+	request = s.hideDeletedRead(request)
+
 	t := time.Now()
-	documents, total, err := s.repo.ReadDocuments(ctx, request)
+	var documents []map[string]interface{}
+	var total int64
+	if request.AsOf > 0 {
+		documents, total, err = s.readAsOf(ctx, request)
+	} else {
+		documents, total, err = s.repo.ReadDocuments(ctx, request)
+	}
 	if err != nil {
+		s.failedOp(ctx, request.Collection, "find", time.Since(t))
 		return types.ReadDocumentsResponse{}, saiTypes.WrapError(err, "failed to get documents")
 	}
-	s.afterOp(ctx, request.Collection, "find", time.Since(t), int64(len(documents)), filterKeys(request.Filter), request.Sort)
+	s.decryptDocuments(request.Collection, documents)
+	s.afterOp(ctx, request.Collection, "find", time.Since(t), int64(len(documents)), filterKeys(request.Filter), request.Sort, &types.ExplainRequest{
+		Collection: request.Collection,
+		Operation:  "find",
+		Filter:     request.Filter,
+		Sort:       request.Sort,
+		Limit:      request.Limit,
+		Skip:       request.Skip,
+	})
 
 	return types.ReadDocumentsResponse{
 		Data:  documents,
@@ -119,12 +194,30 @@ func (s *StorageService) AggregateDocuments(ctx context.Context, request types.A
 		return types.AggregateDocumentsResponse{}, saiTypes.WrapError(err, "validation failed")
 	}
 
+	filter, err := s.encryptFilter(request.Collection, request.Filter)
+	if err != nil {
+		return types.AggregateDocumentsResponse{}, err
+	}
+	request.Filter = filter
+	pipeline, err := s.encryptPipeline(request.Collection, request.Pipeline)
+	if err != nil {
+		return types.AggregateDocumentsResponse{}, err
+	}
+	request.Pipeline = pipeline
+	request = s.hideDeletedAggregate(request)
+
 	t := time.Now()
 	documents, total, err := s.repo.AggregateDocuments(ctx, request)
 	if err != nil {
+		s.failedOp(ctx, request.Collection, "aggregate", time.Since(t))
 		return types.AggregateDocumentsResponse{}, saiTypes.WrapError(err, "failed to aggregate documents")
 	}
-	s.afterOp(ctx, request.Collection, "aggregate", time.Since(t), int64(len(documents)), matchKeys(request.Pipeline), nil)
+	s.decryptDocuments(request.Collection, documents)
+	s.afterOp(ctx, request.Collection, "aggregate", time.Since(t), int64(len(documents)), matchKeys(request.Pipeline), nil, &types.ExplainRequest{
+		Collection: request.Collection,
+		Operation:  "aggregate",
+		Pipeline:   request.Pipeline,
+	})
 
 	return types.AggregateDocumentsResponse{
 		Data:  documents,
@@ -137,10 +230,29 @@ func (s *StorageService) UpdateDocuments(ctx context.Context, request types.Upda
 		return types.UpdateDocumentsResponse{}, saiTypes.WrapError(err, "validation failed")
 	}
 
-	preExisted := false
+	filter, err := s.encryptFilter(request.Collection, request.Filter)
+	if err != nil {
+		return types.UpdateDocumentsResponse{}, err
+	}
+	request.Filter = filter
+	data, err := s.encryptUpdate(request.Collection, request.Data)
+	if err != nil {
+		return types.UpdateDocumentsResponse{}, err
+	}
+	request.Data = data
+
+	if request.DryRun {
+		return s.dryRunUpdate(ctx, request)
+	}
+
+	var preImages []map[string]interface{}
+	var operationID string
 	if s.archiveChanges {
+		if request.Upsert {
+			request.UpsertID = uuid.New().String()
+		}
 		var archErr error
-		preExisted, archErr = s.archiveForUpdate(ctx, request)
+		preImages, operationID, archErr = s.archiveForUpdate(ctx, request)
 		if archErr != nil {
 			return types.UpdateDocumentsResponse{}, archErr
 		}
@@ -149,14 +261,23 @@ func (s *StorageService) UpdateDocuments(ctx context.Context, request types.Upda
 	t := time.Now()
 	updated, err := s.repo.UpdateDocuments(ctx, request)
 	if err != nil {
+		s.failedOp(ctx, request.Collection, "update", time.Since(t))
 		return types.UpdateDocumentsResponse{}, err
 	}
 
-	if s.archiveChanges && request.Upsert && !preExisted {
-		s.archiveUpsertInsert(ctx, request)
+	if s.archiveChanges {
+		if len(preImages) > 0 {
+			s.archiveUpdateResult(ctx, request.Collection, operationID, preImages)
+		} else if request.Upsert {
+			s.archiveUpsertInsert(ctx, request)
+		}
 	}
 
-	s.afterOp(ctx, request.Collection, "update", time.Since(t), updated, filterKeys(request.Filter), nil)
+	s.afterOp(ctx, request.Collection, "update", time.Since(t), updated, filterKeys(request.Filter), nil, &types.ExplainRequest{
+		Collection: request.Collection,
+		Operation:  "update",
+		Filter:     request.Filter,
+	})
 
 	return types.UpdateDocumentsResponse{
 		Data:    []string{},
@@ -168,6 +289,19 @@ func (s *StorageService) DeleteDocuments(ctx context.Context, request types.Dele
 	if err := s.validator.Struct(request); err != nil {
 		return types.DeleteDocumentsResponse{}, saiTypes.WrapError(err, "validation failed")
 	}
+	if s.IsSoftDelete(request.Collection) {
+		return s.softDeleteDocuments(ctx, request)
+	}
+
+	filter, err := s.encryptFilter(request.Collection, request.Filter)
+	if err != nil {
+		return types.DeleteDocumentsResponse{}, err
+	}
+	request.Filter = filter
+
+	if request.DryRun {
+		return s.dryRunDelete(ctx, request)
+	}
 
 	if s.archiveChanges {
 		if err := s.archiveForDelete(ctx, request); err != nil {
@@ -178,9 +312,14 @@ func (s *StorageService) DeleteDocuments(ctx context.Context, request types.Dele
 	t := time.Now()
 	deleted, err := s.repo.DeleteDocuments(ctx, request)
 	if err != nil {
+		s.failedOp(ctx, request.Collection, "delete", time.Since(t))
 		return types.DeleteDocumentsResponse{}, saiTypes.WrapError(err, "failed to delete documents")
 	}
-	s.afterOp(ctx, request.Collection, "delete", time.Since(t), deleted, filterKeys(request.Filter), nil)
+	s.afterOp(ctx, request.Collection, "delete", time.Since(t), deleted, filterKeys(request.Filter), nil, &types.ExplainRequest{
+		Collection: request.Collection,
+		Operation:  "delete",
+		Filter:     request.Filter,
+	})
 
 	return types.DeleteDocumentsResponse{
 		Data:    []string{},
@@ -188,25 +327,46 @@ func (s *StorageService) DeleteDocuments(ctx context.Context, request types.Dele
 	}, nil
 }
 
+// operationIDContextKey is a string because handlers set the operation id
+// as a fasthttp user value, which the request context returns from Value,
+// while withOperationID stores it with context.WithValue.
+const operationIDContextKey = "operation_id"
+
 func extractOperationID(ctx context.Context) string {
-	if reqCtx, ok := ctx.(*saiTypes.RequestCtx); ok {
-		if v := reqCtx.UserValue("operation_id"); v != nil {
-			if id, ok2 := v.(string); ok2 {
-				return id
-			}
-		}
-	}
-	return ""
+	id, _ := ctx.Value(operationIDContextKey).(string)
+	return id
 }
 
-func (s *StorageService) afterOp(ctx context.Context, collection, operation string, elapsed time.Duration, docsCount int64, fKeys []string, sortKeys map[string]int) {
+// withOperationID groups the archive entries of several writes under one id.
+func withOperationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, operationIDContextKey, id)
+}
+
+// afterOp records metrics, query stats and slow queries. query classifies
+// filter keys for the index advisor and is explained, at most once per
+// query shape and interval, when the operation is logged as slow; nil skips
+// both.
+func (s *StorageService) afterOp(ctx context.Context, collection, operation string, elapsed time.Duration, docsCount int64, fKeys []string, sortKeys map[string]int, query *types.ExplainRequest) {
+	s.recordMetric(ctx, collection, operation, elapsed, docsCount, false)
 	operationID := extractOperationID(ctx)
 	if s.trackQueryStats && (len(fKeys) > 0 || len(sortKeys) > 0) {
-		s.upsertQueryStat(collection, operation, fKeys, sortKeys, operationID)
+		s.ensureTenantIndexes(ctx)
+		s.upsertQueryStat(ctx, collection, operation, fKeys, sortKeys, rangeKeys(query), operationID)
 	}
 	threshold := s.slowQueryThresholdMs.Load()
 	if threshold > 0 && elapsed.Milliseconds() >= threshold && !isAdminCollection(collection) && (len(fKeys) > 0 || len(sortKeys) > 0) {
-		go s.repo.LogSlowQuery(context.Background(), collection, operation, elapsed.Milliseconds(), docsCount, fKeys, sortKeys, operationID)
+		s.ensureTenantIndexes(ctx)
+		s.logSlowQuery(slowQueryEntry{
+			ctx:         detachedContext(ctx),
+			collection:  collection,
+			operation:   operation,
+			durationMs:  elapsed.Milliseconds(),
+			docsCount:   docsCount,
+			fKeys:       fKeys,
+			sortKeys:    sortKeys,
+			operationID: operationID,
+			query:       query,
+		})
 	}
 }
 
@@ -215,10 +375,19 @@ func isAdminCollection(name string) bool {
 }
 
 func (s *StorageService) Close(ctx context.Context) error {
+	s.stopRetention()
+	s.stopTombstonePurge()
+	s.stopIndexAdvisor()
+	s.stopQueryScheduler(ctx)
+	s.stopMetrics()
+	s.stopSlowQueryLog()
+	if err := s.writer.close(ctx); err != nil {
+		sai.Logger().Warn("Failed to flush write buffer", zap.Error(err))
+	}
 	return s.repo.Close(ctx)
 }
 
-func (s *StorageService) LogRequest(_ context.Context, collection string, data map[string]interface{}) {
+func (s *StorageService) LogRequest(ctx context.Context, collection string, data map[string]interface{}) {
 	if !s.logRequests {
 		return
 	}
@@ -227,16 +396,16 @@ func (s *StorageService) LogRequest(_ context.Context, collection string, data m
 		collection = "unknown"
 	}
 
-	req := types.CreateDocumentsRequest{
-		Collection: fmt.Sprintf("%s_request_logs", collection),
-		Data:       []interface{}{data},
+	if raw, ok := data["query_raw"].(string); ok {
+		data["query_raw"], _ = s.truncateLogText(s.RedactLogText(raw))
 	}
 
-	go func() {
-		if _, err := s.repo.CreateDocuments(context.Background(), req); err != nil {
-			sai.Logger().Warn("Failed to log request", zap.Error(err))
-		}
-	}()
+	s.stampRetention(data)
+	s.writer.enqueue(writeEntry{
+		tenant:     types.TenantFromContext(ctx),
+		collection: fmt.Sprintf("%s_request_logs", collection),
+		document:   data,
+	})
 }
 
 func (s *StorageService) GetRepo() types.StorageRepository {
@@ -244,9 +413,9 @@ func (s *StorageService) GetRepo() types.StorageRepository {
 }
 
 
-func (s *StorageService) archiveForUpdate(ctx context.Context, request types.UpdateDocumentsRequest) (bool, error) {
+func (s *StorageService) archiveForUpdate(ctx context.Context, request types.UpdateDocumentsRequest) ([]map[string]interface{}, string, error) {
 	if request.Collection == "" {
-		return false, nil
+		return nil, "", nil
 	}
 
 	docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
@@ -254,31 +423,91 @@ func (s *StorageService) archiveForUpdate(ctx context.Context, request types.Upd
 		Filter:     request.Filter,
 	})
 	if err != nil {
-		return false, saiTypes.WrapError(err, "failed to read documents for update archive")
+		return nil, "", saiTypes.WrapError(err, "failed to read documents for update archive")
 	}
 
 	if len(docs) == 0 {
-		return false, nil
+		return nil, "", nil
 	}
 
-	return true, s.writeArchive(ctx, request.Collection, "update_archive", docs, map[string]interface{}{
+	operationID, err := s.writeArchive(ctx, request.Collection, "update_archive", docs, map[string]interface{}{
 		"archive_filter": request.Filter,
 		"archive_update": request.Data,
 	})
+	return docs, operationID, err
 }
 
+// archiveUpdateResult completes the update archive entries written before the
+// update with each document's post-image and field diff.
+func (s *StorageService) archiveUpdateResult(ctx context.Context, collection, operationID string, preImages []map[string]interface{}) {
+	ids := make([]interface{}, 0, len(preImages))
+	for _, doc := range preImages {
+		if id, ok := doc["internal_id"].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	postImages, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
+		Collection: collection,
+		Filter:     map[string]interface{}{"internal_id": map[string]interface{}{"$in": ids}},
+	})
+	if err != nil {
+		sai.Logger().Warn("Failed to read post-images for update archive", zap.Error(err))
+		return
+	}
+	byID := make(map[string]map[string]interface{}, len(postImages))
+	for _, doc := range postImages {
+		if id, ok := doc["internal_id"].(string); ok {
+			byID[id] = doc
+		}
+	}
+
+	ops := make([]types.UpsertOperation, 0, len(preImages))
+	for _, pre := range preImages {
+		id, _ := pre["internal_id"].(string)
+		post, ok := byID[id]
+		if !ok {
+			continue
+		}
+		postImage := make(map[string]interface{}, len(post))
+		for k, v := range post {
+			if k != "_id" {
+				postImage[k] = v
+			}
+		}
+		ops = append(ops, types.UpsertOperation{
+			Filter: map[string]interface{}{"archive_operation_id": operationID, "internal_id": id},
+			Update: map[string]interface{}{"$set": map[string]interface{}{
+				"archive_post_image": postImage,
+				"archive_diff":       archiveDiff(documentDiff(pre, post)),
+			}},
+		})
+	}
+	if err := s.repo.BulkPatch(ctx, collection+"_update_archive", ops); err != nil {
+		sai.Logger().Warn("Failed to store update diff", zap.Error(err))
+	}
+}
+
+// archiveUpsertInsert archives the document inserted by an upsert, found by
+// the internal_id the service assigned to it.
 func (s *StorageService) archiveUpsertInsert(ctx context.Context, request types.UpdateDocumentsRequest) {
 	docs, _, err := s.repo.ReadDocuments(ctx, types.ReadDocumentsRequest{
 		Collection: request.Collection,
-		Filter:     request.Filter,
+		Filter:     map[string]interface{}{"internal_id": request.UpsertID},
+		Limit:      1,
 	})
 	if err != nil || len(docs) == 0 {
 		return
 	}
 	s.writeArchive(ctx, request.Collection, "update_archive", docs, map[string]interface{}{
-		"archive_filter": request.Filter,
-		"archive_update": request.Data,
-		"upsert_insert":  true,
+		"archive_filter":     request.Filter,
+		"archive_update":     request.Data,
+		"upsert_insert":      true,
+		"archive_post_image": stripArchiveFields(docs[0]),
+		"archive_diff":       archiveDiff(documentDiff(nil, docs[0])),
 	})
 }
 
@@ -323,12 +552,13 @@ func (s *StorageService) archiveForDelete(ctx context.Context, request types.Del
 		return nil
 	}
 
-	return s.writeArchive(ctx, request.Collection, "delete_archive", docs, map[string]interface{}{
+	_, err = s.writeArchive(ctx, request.Collection, "delete_archive", docs, map[string]interface{}{
 		"archive_filter": request.Filter,
 	})
+	return err
 }
 
-func (s *StorageService) writeArchive(ctx context.Context, collection, suffix string, docs []map[string]interface{}, meta map[string]interface{}) error {
+func (s *StorageService) writeArchive(ctx context.Context, collection, suffix string, docs []map[string]interface{}, meta map[string]interface{}) (string, error) {
 	operationID := extractOperationID(ctx)
 	if operationID == "" {
 		operationID = uuid.New().String()
@@ -348,6 +578,7 @@ func (s *StorageService) writeArchive(ctx context.Context, collection, suffix st
 		for k, v := range meta {
 			copyDoc[k] = v
 		}
+		s.stampRetention(copyDoc)
 		archiveDocs = append(archiveDocs, copyDoc)
 	}
 
@@ -358,56 +589,57 @@ func (s *StorageService) writeArchive(ctx context.Context, collection, suffix st
 
 	_, err := s.repo.CreateDocuments(ctx, req)
 	if err != nil {
-		return saiTypes.WrapError(err, "failed to archive documents")
+		return "", saiTypes.WrapError(err, "failed to archive documents")
 	}
 
-	if _, exists := s.indexedArchives.LoadOrStore(req.Collection, true); !exists {
-		go s.repo.CreateIndex(context.Background(), types.CreateIndexRequest{
-			Collection: req.Collection,
-			Keys:       map[string]int{"archive_operation_id": 1, "archive_time": -1},
-			Name:       "archive_op_idx",
+	indexKey := types.TenantCollection(types.TenantFromContext(ctx), req.Collection)
+	if _, exists := s.indexedArchives.LoadOrStore(indexKey, true); !exists {
+		go s.repo.CreateIndex(detachedContext(ctx), types.CreateIndexRequest{
+			Collection:  req.Collection,
+			OrderedKeys: []types.IndexKey{{Field: "archive_operation_id", Direction: 1}, {Field: "archive_time", Direction: -1}},
+			Name:        "archive_op_idx",
+		})
+		go s.repo.CreateIndex(detachedContext(ctx), types.CreateIndexRequest{
+			Collection:  req.Collection,
+			OrderedKeys: []types.IndexKey{{Field: "internal_id", Direction: 1}, {Field: "archive_time", Direction: 1}},
+			Name:        "archive_doc_idx",
 		})
 	}
 
-	return nil
+	return operationID, nil
 }
 
-func (s *StorageService) upsertQueryStat(collection, operation string, fKeys []string, sortKeys map[string]int, operationID string) {
+func (s *StorageService) upsertQueryStat(ctx context.Context, collection, operation string, fKeys []string, sortKeys map[string]int, rKeys []string, operationID string) {
 	if fKeys == nil {
 		fKeys = []string{}
 	}
 	fingerprint := filterFingerprint(fKeys)
 	now := time.Now().UnixNano()
-
-	go func() {
-		setData := map[string]interface{}{
-			"collection":         collection,
-			"operation":          operation,
-			"filter_fingerprint": fingerprint,
-			"filter_keys":        fKeys,
-			"sort_keys":          sortKeys,
-			"last_seen":          now,
-		}
-		if operationID != "" {
-			setData["last_operation_id"] = operationID
-		}
-		req := types.UpdateDocumentsRequest{
-			Collection: "_admin_query_stats",
-			Filter: map[string]interface{}{
+	setData := map[string]interface{}{
+		"collection":         collection,
+		"operation":          operation,
+		"filter_fingerprint": fingerprint,
+		"filter_keys":        fKeys,
+		"sort_keys":          sortKeys,
+		"range_keys":         rKeys,
+		"last_seen":          now,
+	}
+	if operationID != "" {
+		setData["last_operation_id"] = operationID
+	}
+	s.writer.enqueue(writeEntry{
+		tenant:     types.TenantFromContext(ctx),
+		collection: "_admin_query_stats",
+		stat: &queryStatDelta{
+			filter: map[string]interface{}{
 				"collection":         collection,
 				"operation":          operation,
 				"filter_fingerprint": fingerprint,
 			},
-			Data: map[string]interface{}{
-				"$set": setData,
-				"$inc": map[string]interface{}{"count": 1},
-			},
-			Upsert: true,
-		}
-		if _, err := s.repo.UpdateDocuments(context.Background(), req); err != nil {
-			sai.Logger().Warn("Failed to upsert query stat", zap.Error(err))
-		}
-	}()
+			set:   setData,
+			count: 1,
+		},
+	})
 }
 
 func filterKeys(filter map[string]interface{}) []string {
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+const defaultTombstonePurgeInterval = time.Hour
+
+// tombstoneJob removes soft-deleted documents whose policy has a purge age.
+type tombstoneJob struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// softDeletePolicy returns the first policy matching name. Only user
+// collections can be soft-deleted.
+func (s *StorageService) softDeletePolicy(name string) (types.SoftDeletePolicy, bool) {
+	if collectionClass(name) != collectionClassUser {
+		return types.SoftDeletePolicy{}, false
+	}
+	for _, policy := range s.softDelete.Collections {
+		if matched, _ := path.Match(policy.Pattern, name); matched {
+			return policy, true
+		}
+	}
+	return types.SoftDeletePolicy{}, false
+}
+
+// IsSoftDelete reports whether deletes in collection only set deleted_at.
+func (s *StorageService) IsSoftDelete(collection string) bool {
+	_, ok := s.softDeletePolicy(collection)
+	return ok
+}
+
+var notDeletedCondition = map[string]interface{}{"$exists": false}
+
+// excludeDeleted adds a deleted_at condition to filter unless the caller
+// already filters on it.
+func excludeDeleted(filter map[string]interface{}) map[string]interface{} {
+	if _, ok := filter[types.SoftDeletedAtField]; ok {
+		return filter
+	}
+	out := make(map[string]interface{}, len(filter)+1)
+	for k, v := range filter {
+		out[k] = v
+	}
+	out[types.SoftDeletedAtField] = notDeletedCondition
+	return out
+}
+
+func (s *StorageService) hideDeletedRead(request types.ReadDocumentsRequest) types.ReadDocumentsRequest {
+	if !request.IncludeDeleted && s.IsSoftDelete(request.Collection) {
+		request.Filter = excludeDeleted(request.Filter)
+	}
+	return request
+}
+
+func (s *StorageService) hideDeletedAggregate(request types.AggregateDocumentsRequest) types.AggregateDocumentsRequest {
+	if request.IncludeDeleted || !s.IsSoftDelete(request.Collection) {
+		return request
+	}
+	request.Filter = excludeDeleted(request.Filter)
+	request.Pipeline = ScopePipeline(request.Pipeline, map[string]interface{}{types.SoftDeletedAtField: notDeletedCondition})
+	return request
+}
+
+// softDeleteDocuments marks matching live documents as deleted. It goes
+// through UpdateDocuments, so the change is archived like any other update.
+func (s *StorageService) softDeleteDocuments(ctx context.Context, request types.DeleteDocumentsRequest) (types.DeleteDocumentsResponse, error) {
+	set := map[string]interface{}{types.SoftDeletedAtField: time.Now().UnixNano()}
+	if request.DeletedBy != "" {
+		set[types.SoftDeletedByField] = request.DeletedBy
+	}
+	updated, err := s.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+		Collection: request.Collection,
+		Filter:     excludeDeleted(request.Filter),
+		Data:       map[string]interface{}{"$set": set},
+		DryRun:     request.DryRun,
+	})
+	if err != nil {
+		return types.DeleteDocumentsResponse{}, saiTypes.WrapError(err, "failed to delete documents")
+	}
+	return types.DeleteDocumentsResponse{
+		Data:    []string{},
+		Deleted: updated.Updated,
+		DryRun:  updated.DryRun,
+		Matched: updated.Matched,
+		Sample:  updated.Sample,
+	}, nil
+}
+
+// UndeleteDocuments clears deleted_at and deleted_by on matching tombstones.
+func (s *StorageService) UndeleteDocuments(ctx context.Context, request types.UndeleteDocumentsRequest) (types.UndeleteDocumentsResponse, error) {
+	if !s.IsSoftDelete(request.Collection) {
+		return types.UndeleteDocumentsResponse{}, saiTypes.NewErrorf("collection %q does not use soft delete", request.Collection)
+	}
+	filter := make(map[string]interface{}, len(request.Filter)+1)
+	for k, v := range request.Filter {
+		filter[k] = v
+	}
+	filter[types.SoftDeletedAtField] = map[string]interface{}{"$exists": true}
+
+	updated, err := s.UpdateDocuments(ctx, types.UpdateDocumentsRequest{
+		Collection: request.Collection,
+		Filter:     filter,
+		Data: map[string]interface{}{"$unset": map[string]interface{}{
+			types.SoftDeletedAtField: "",
+			types.SoftDeletedByField: "",
+		}},
+	})
+	if err != nil {
+		return types.UndeleteDocumentsResponse{}, saiTypes.WrapError(err, "failed to undelete documents")
+	}
+	return types.UndeleteDocumentsResponse{Data: []string{}, Restored: updated.Updated}, nil
+}
+
+func (s *StorageService) startTombstonePurge() {
+	hasPurge := false
+	for _, policy := range s.softDelete.Collections {
+		hasPurge = hasPurge || policy.PurgeAfterDays > 0
+	}
+	if !hasPurge {
+		return
+	}
+	interval := time.Duration(s.softDelete.PurgeIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultTombstonePurgeInterval
+	}
+	s.tombstoneJob = &tombstoneJob{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.tombstoneJob.stop:
+				return
+			case <-ticker.C:
+				s.purgeTombstones(context.Background())
+			}
+		}
+	}()
+}
+
+func (s *StorageService) stopTombstonePurge() {
+	if s.tombstoneJob != nil {
+		s.tombstoneJob.stopOnce.Do(func() { close(s.tombstoneJob.stop) })
+	}
+}
+
+// purgeTombstones hard-deletes documents soft-deleted longer ago than their
+// policy allows, in every tenant. Purged documents are not archived.
+func (s *StorageService) purgeTombstones(ctx context.Context) {
+	namespaces := []string{""}
+	if s.tenancy.Enabled {
+		tenants, err := s.repo.ListTenants(ctx)
+		if err != nil {
+			sai.Logger().Warn("Tombstone purge failed to list tenants", zap.Error(err))
+		}
+		namespaces = append(namespaces, tenants...)
+	}
+
+	for _, tenant := range namespaces {
+		tenantCtx := types.WithTenant(ctx, tenant)
+		names, err := s.repo.ListCollectionNames(tenantCtx)
+		if err != nil {
+			sai.Logger().Warn("Tombstone purge failed to list collections", zap.String("tenant", tenant), zap.Error(err))
+			continue
+		}
+		for _, name := range names {
+			policy, ok := s.softDeletePolicy(name)
+			if !ok || policy.PurgeAfterDays <= 0 {
+				continue
+			}
+			cutoff := time.Now().Add(-time.Duration(policy.PurgeAfterDays) * 24 * time.Hour).UnixNano()
+			deleted, err := s.repo.DeleteDocuments(tenantCtx, types.DeleteDocumentsRequest{
+				Collection: name,
+				Filter:     map[string]interface{}{types.SoftDeletedAtField: map[string]interface{}{"$lt": cutoff}},
+			})
+			if err != nil {
+				sai.Logger().Warn("Tombstone purge failed", zap.String("tenant", tenant), zap.String("collection", name), zap.Error(err))
+				continue
+			}
+			if deleted > 0 {
+				sai.Logger().Info("Tombstones purged", zap.String("tenant", tenant), zap.String("collection", name), zap.Int64("deleted", deleted))
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	saiTypes "github.com/saiset-co/sai-service/types"
+	"github.com/saiset-co/sai-storage/types"
+)
+
+const defaultTenantHeader = "X-Tenant-ID"
+
+func (s *StorageService) TenancyEnabled() bool {
+	return s.tenancy.Enabled
+}
+
+func (s *StorageService) TenantSource() string {
+	if s.tenancy.Source == "" {
+		return types.TenantSourceHeader
+	}
+	return s.tenancy.Source
+}
+
+func (s *StorageService) TenantHeader() string {
+	if s.tenancy.Header == "" {
+		return defaultTenantHeader
+	}
+	return s.tenancy.Header
+}
+
+// ResolveTenant validates the tenant taken from the request. An empty tenant
+// selects the shared namespace unless tenancy.required is set.
+func (s *StorageService) ResolveTenant(raw string) (string, error) {
+	tenant := strings.TrimSpace(raw)
+	if tenant == "" {
+		if s.tenancy.Required {
+			return "", saiTypes.NewError("tenant is required")
+		}
+		return "", nil
+	}
+	if !types.ValidTenantID(tenant) {
+		return "", saiTypes.NewErrorf("invalid tenant %q", tenant)
+	}
+	return tenant, nil
+}
+
+func (s *StorageService) ListTenants(ctx context.Context) ([]string, error) {
+	if !s.tenancy.Enabled {
+		return nil, nil
+	}
+	return s.repo.ListTenants(ctx)
+}
+
+// EnsureAdminIndexes creates the indexes the admin collections rely on in the
+// namespace of the tenant in ctx.
+func (s *StorageService) EnsureAdminIndexes(ctx context.Context) {
+	_ = s.repo.CreateIndex(ctx, types.CreateIndexRequest{
+		Collection:  "_admin_query_stats",
+		OrderedKeys: []types.IndexKey{{Field: "collection", Direction: 1}, {Field: "operation", Direction: 1}, {Field: "filter_fingerprint", Direction: 1}},
+		Unique:      true,
+		Name:        "admin_query_stats_unique",
+	})
+	_ = s.repo.CreateIndex(ctx, types.CreateIndexRequest{
+		Collection: "_admin_slow_queries",
+		Keys:       map[string]int{"ts": -1},
+		Name:       "admin_slow_queries_ts",
+	})
+	_ = s.repo.CreateIndex(ctx, types.CreateIndexRequest{
+		Collection:  types.QueryRunsCollection,
+		OrderedKeys: []types.IndexKey{{Field: "query_id", Direction: 1}, {Field: "ts", Direction: -1}},
+		Name:        "admin_query_runs_query_ts",
+	})
+}
+
+func (s *StorageService) ensureTenantIndexes(ctx context.Context) {
+	tenant := types.TenantFromContext(ctx)
+	if tenant == "" {
+		return
+	}
+	if _, exists := s.tenantIndexes.LoadOrStore(tenant, true); !exists {
+		go s.EnsureAdminIndexes(detachedContext(ctx))
+	}
+}
+
+// detachedContext keeps the tenant of a request for work that outlives it.
+func detachedContext(ctx context.Context) context.Context {
+	return types.WithTenant(context.Background(), types.TenantFromContext(ctx))
+}
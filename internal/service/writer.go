@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/saiset-co/sai-service/sai"
+	"github.com/saiset-co/sai-storage/types"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWriteBufferSize    = 10000
+	defaultWriteBatchSize     = 500
+	defaultWriteFlushInterval = time.Second
+)
+
+// writeEntry is either a document to insert or a query stat increment.
+type writeEntry struct {
+	tenant     string
+	collection string
+	document   map[string]interface{}
+	stat       *queryStatDelta
+}
+
+type queryStatDelta struct {
+	filter map[string]interface{}
+	set    map[string]interface{}
+	count  int64
+}
+
+type batchKey struct {
+	tenant     string
+	collection string
+}
+
+// asyncWriter batches request logs and query stats in a bounded buffer and
+// writes them from a single goroutine. Entries are dropped, not blocked on,
+// when the buffer is full.
+type asyncWriter struct {
+	repo      types.StorageRepository
+	entries   chan writeEntry
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Int64
+	reported  int64
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newAsyncWriter(repo types.StorageRepository, cfg types.WriteBufferConfig) *asyncWriter {
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultWriteBufferSize
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultWriteBatchSize
+	}
+	interval := time.Duration(cfg.FlushIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultWriteFlushInterval
+	}
+
+	w := &asyncWriter{
+		repo:      repo,
+		entries:   make(chan writeEntry, size),
+		batchSize: batchSize,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) enqueue(entry writeEntry) {
+	select {
+	case w.entries <- entry:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// DroppedWrites reports how many request logs and query stats were discarded
+// because the write buffer was full.
+func (s *StorageService) DroppedWrites() int64 {
+	return s.writer.dropped.Load()
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	pending := make([]writeEntry, 0, w.batchSize)
+	for {
+		select {
+		case entry := <-w.entries:
+			pending = append(pending, entry)
+			if len(pending) >= w.batchSize {
+				pending = w.flush(pending)
+			}
+		case <-ticker.C:
+			pending = w.flush(pending)
+		case <-w.stop:
+			for {
+				select {
+				case entry := <-w.entries:
+					pending = append(pending, entry)
+					if len(pending) >= w.batchSize {
+						pending = w.flush(pending)
+					}
+				default:
+					w.flush(pending)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes pending entries grouped by tenant and collection: documents
+// with one insert, stats with one bulk upsert after merging duplicates.
+func (w *asyncWriter) flush(pending []writeEntry) []writeEntry {
+	if dropped := w.dropped.Load(); dropped != w.reported {
+		sai.Logger().Warn("Write buffer full, entries dropped", zap.Int64("dropped_total", dropped), zap.Int64("dropped_since_last_flush", dropped-w.reported))
+		w.reported = dropped
+	}
+	if len(pending) == 0 {
+		return pending
+	}
+
+	docs := make(map[batchKey][]interface{})
+	stats := make(map[batchKey][]*queryStatDelta)
+	statIndex := make(map[batchKey]map[string]*queryStatDelta)
+	for _, entry := range pending {
+		key := batchKey{tenant: entry.tenant, collection: entry.collection}
+		if entry.stat == nil {
+			docs[key] = append(docs[key], entry.document)
+			continue
+		}
+		if statIndex[key] == nil {
+			statIndex[key] = make(map[string]*queryStatDelta)
+		}
+		id := statFilterID(entry.stat.filter)
+		if existing, ok := statIndex[key][id]; ok {
+			existing.count += entry.stat.count
+			for k, v := range entry.stat.set {
+				existing.set[k] = v
+			}
+			continue
+		}
+		statIndex[key][id] = entry.stat
+		stats[key] = append(stats[key], entry.stat)
+	}
+
+	for key, batch := range docs {
+		ctx := types.WithTenant(context.Background(), key.tenant)
+		if _, err := w.repo.CreateDocuments(ctx, types.CreateDocumentsRequest{Collection: key.collection, Data: batch}); err != nil {
+			sai.Logger().Warn("Failed to write log batch", zap.String("collection", key.collection), zap.Int("size", len(batch)), zap.Error(err))
+		}
+	}
+
+	for key, batch := range stats {
+		ops := make([]types.UpsertOperation, 0, len(batch))
+		for _, stat := range batch {
+			ops = append(ops, types.UpsertOperation{
+				Filter: stat.filter,
+				Update: map[string]interface{}{
+					"$set": stat.set,
+					"$inc": map[string]interface{}{"count": stat.count},
+				},
+			})
+		}
+		ctx := types.WithTenant(context.Background(), key.tenant)
+		if err := w.repo.BulkUpsert(ctx, key.collection, ops); err != nil {
+			sai.Logger().Warn("Failed to write query stats batch", zap.String("collection", key.collection), zap.Int("size", len(ops)), zap.Error(err))
+		}
+	}
+
+	return pending[:0]
+}
+
+// close stops accepting flush ticks, drains the buffer and waits for the final
+// flush or ctx, whichever comes first.
+func (w *asyncWriter) close(ctx context.Context) error {
+	w.closeOnce.Do(func() { close(w.stop) })
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func statFilterID(filter map[string]interface{}) string {
+	collection, _ := filter["collection"].(string)
+	operation, _ := filter["operation"].(string)
+	fingerprint, _ := filter["filter_fingerprint"].(string)
+	return collection + "\x00" + operation + "\x00" + fingerprint
+}
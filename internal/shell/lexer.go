@@ -0,0 +1,234 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenRegex
+	tokenPunct
+	tokenParam
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// flags holds regex options, e.g. "i" for /abc/i.
+	flags string
+	// param is the declaration of a {{name:type}} placeholder.
+	param *Param
+	pos   int
+}
+
+// SyntaxError reports where a query failed to parse. Pos is a 1-based
+// character offset into the query.
+type SyntaxError struct {
+	Pos int
+	Msg string
+	msg *message
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf(positionFormat, e.Pos, e.Msg)
+}
+
+func syntaxError(src string, pos int, format string, args ...interface{}) *SyntaxError {
+	if pos > len(src) {
+		pos = len(src)
+	}
+	msg := newMessage(format, args...)
+	return &SyntaxError{Pos: utf8.RuneCountInString(src[:pos]) + 1, Msg: msg.Error(), msg: msg}
+}
+
+// lex splits a shell statement into tokens. Comments are skipped. A slash
+// always starts a regex literal: the grammar has no division.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, syntaxError(src, i, "unterminated comment")
+			}
+			i += end + 4
+		case strings.HasPrefix(src[i:], "{{"):
+			end := strings.Index(src[i+2:], "}}")
+			if end < 0 {
+				return nil, syntaxError(src, i, "unterminated parameter")
+			}
+			param, err := parseParam(src[i+2 : i+2+end])
+			if err != nil {
+				return nil, syntaxError(src, i, "%s", err)
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: param.Name, param: param, pos: i})
+			i += end + 4
+		case r == '"' || r == '\'':
+			text, next, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = next
+		case r == '/':
+			pattern, flags, next, err := lexRegex(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenRegex, text: pattern, flags: flags, pos: i})
+			i = next
+		case r >= '0' && r <= '9' || r == '.' && startsValue(tokens) && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			for i < len(src) && isNumberByte(src, i, start) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], pos: start})
+		case isIdentStart(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdentStart(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		case strings.ContainsRune("{}[](),:.;-+", r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), pos: i})
+			i += size
+		default:
+			return nil, syntaxError(src, i, "unexpected character %q", r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// startsValue reports whether a value may follow the last token, so that
+// ".5" lexes as a number in {a: .5} but as a dot in db.logs.2024.
+func startsValue(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenPunct && strings.Contains(":,[(-+", last.text)
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isNumberByte(src string, i, start int) bool {
+	c := src[i]
+	switch {
+	case c >= '0' && c <= '9':
+		return true
+	case c == '.':
+		// A dot not followed by a digit ends the number: db.logs.2024.find().
+		return i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'
+	case c == 'e' || c == 'E':
+		return true
+	case c == '+' || c == '-':
+		return i > start && (src[i-1] == 'e' || src[i-1] == 'E')
+	}
+	return false
+}
+
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var sb strings.Builder
+	i := start + 1
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, syntaxError(src, start, "unterminated string")
+		case c == '\\':
+			if i+1 >= len(src) {
+				return "", 0, syntaxError(src, start, "unterminated string")
+			}
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(src) {
+					return "", 0, syntaxError(src, i, "invalid escape sequence")
+				}
+				var r rune
+				if _, err := fmt.Sscanf(src[i+1:i+5], "%04x", &r); err != nil {
+					return "", 0, syntaxError(src, i, "invalid escape sequence")
+				}
+				sb.WriteRune(r)
+				i += 4
+			default:
+				sb.WriteByte(src[i])
+			}
+			i++
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, syntaxError(src, start, "unterminated string")
+}
+
+func lexRegex(src string, start int) (pattern, flags string, next int, err error) {
+	i := start + 1
+	inClass := false
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '\\':
+			i += 2
+			continue
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '\n':
+			return "", "", 0, syntaxError(src, start, "unterminated regular expression")
+		case c == '/' && !inClass:
+			pattern = src[start+1 : i]
+			i++
+			flagStart := i
+			for i < len(src) && strings.IndexByte("imxsgu", src[i]) >= 0 {
+				i++
+			}
+			// g and u mean nothing to the server.
+			flags = strings.NewReplacer("g", "", "u", "").Replace(src[flagStart:i])
+			return pattern, flags, i, nil
+		}
+		i++
+	}
+	return "", "", 0, syntaxError(src, start, "unterminated regular expression")
+}
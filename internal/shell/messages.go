@@ -0,0 +1,137 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+)
+
+// positionFormat prefixes a syntax error with where it happened.
+const positionFormat = "position %d: %s"
+
+// message is an error text kept as its format and arguments, so the admin
+// panel can show it in Russian while the API returns it in English.
+type message struct {
+	format string
+	args   []interface{}
+}
+
+func newMessage(format string, args ...interface{}) *message {
+	return &message{format: format, args: args}
+}
+
+func (m *message) Error() string {
+	return fmt.Sprintf(m.format, m.args...)
+}
+
+// phrase is a message argument that is translated with the message, such
+// as the name of an argument in "%s: %s must be an object".
+type phrase string
+
+func (m *message) translate(catalog map[string]string) string {
+	format, ok := catalog[m.format]
+	if !ok {
+		format = m.format
+	}
+	args := make([]interface{}, len(m.args))
+	for i, arg := range m.args {
+		switch a := arg.(type) {
+		case phrase:
+			if text, ok := catalog[string(a)]; ok {
+				args[i] = text
+			} else {
+				args[i] = string(a)
+			}
+		case *message:
+			args[i] = a.translate(catalog)
+		default:
+			args[i] = arg
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Russian renders an error returned by Parse, Bind or Params in Russian, the
+// language of the admin panel. Other errors are returned as they are.
+func Russian(err error) string {
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.msg != nil {
+		return fmt.Sprintf(russianMessages[positionFormat], syntaxErr.Pos, syntaxErr.msg.translate(russianMessages))
+	}
+	var m *message
+	if errors.As(err, &m) {
+		return m.translate(russianMessages)
+	}
+	return err.Error()
+}
+
+// russianMessages maps the formats and phrases of this package to Russian.
+var russianMessages = map[string]string{
+	"position %d: %s":                                                  "позиция %d: %s",
+	"unterminated comment":                                             "незакрытый комментарий",
+	"unterminated parameter":                                           "незакрытый параметр",
+	"unexpected character %q":                                          "неожиданный символ %q",
+	"unterminated string":                                              "незакрытая строка",
+	"invalid escape sequence":                                          "неверная escape-последовательность",
+	"unterminated regular expression":                                  "незакрытое регулярное выражение",
+	"invalid parameter {{%s}}, expected {{name:type=value}}":           "неверный параметр {{%s}}, ожидается {{имя:тип=значение}}",
+	"unknown type of parameter %s: %s":                                 "неизвестный тип параметра %s: %s",
+	"parameter %s: expected an integer":                                "параметр %s: ожидается целое число",
+	"parameter %s: expected a number":                                  "параметр %s: ожидается число",
+	"parameter %s: expected true or false":                             "параметр %s: ожидается true или false",
+	"parameter %s: invalid date %q":                                    "параметр %s: неверная дата %q",
+	"parameter %s: invalid ObjectId %q":                                "параметр %s: неверный ObjectId %q",
+	"parameter %s is declared with different types":                    "параметр %s объявлен с разными типами",
+	"parameter %s is not set":                                          "не задан параметр %s",
+	"expected %q":                                                      "ожидалось %q",
+	"query must start with db.":                                        "запрос должен начинаться с db.",
+	"expected a quoted collection name":                                "ожидалось имя коллекции в кавычках",
+	"expected a name":                                                  "ожидалось имя",
+	"getCollection expects the collection name as a string":            "getCollection ожидает имя коллекции строкой",
+	"collection name is missing":                                       "не указано имя коллекции",
+	"expected a method name":                                           "ожидалось имя метода",
+	"unexpected characters after the query":                            "лишние символы после запроса",
+	"Infinity is not supported":                                        "Infinity не поддерживается",
+	"expected a number":                                                "ожидалось число",
+	"expected a constructor call":                                      "ожидался вызов конструктора",
+	"unknown identifier %s":                                            "неизвестный идентификатор %s",
+	"expected a value":                                                 "ожидалось значение",
+	"invalid number %s":                                                "неверное число %s",
+	"expected a key":                                                   "ожидался ключ",
+	"ObjectId expects a hex string":                                    "ObjectId ожидает hex-строку",
+	"invalid ObjectId %q":                                              "неверный ObjectId %q",
+	"invalid date %q":                                                  "неверная дата %q",
+	"%s expects a date string":                                         "%s ожидает строку с датой",
+	"%s expects one argument":                                          "%s ожидает один аргумент",
+	"invalid number %q":                                                "неверное число %q",
+	"%s expects an integer":                                            "%s ожидает целое число",
+	"NumberDecimal expects a string":                                   "NumberDecimal ожидает строку",
+	"unknown function %s":                                              "неизвестная функция %s",
+	"%s: not enough arguments":                                         "%s: не хватает аргументов",
+	"%s: too many arguments":                                           "%s: слишком много аргументов",
+	"%s: %s must be an object":                                         "%s: %s должен быть объектом",
+	"operation %s is not supported":                                    "операция %s не поддерживается",
+	"the filter":                                                       "фильтр",
+	"the projection":                                                   "проекция",
+	"distinct: the field name must be a string":                        "distinct: имя поля должно быть строкой",
+	"aggregate: too many arguments":                                    "aggregate: слишком много аргументов",
+	"aggregate: the pipeline is empty":                                 "aggregate: пустой pipeline",
+	"aggregate: a stage must be an object":                             "aggregate: стадия должна быть объектом",
+	"insertOne: the document must be an object":                        "insertOne: документ должен быть объектом",
+	"%s: no documents":                                                 "%s: нет документов",
+	"%s: a document must be an object":                                 "%s: документ должен быть объектом",
+	"%s: pipeline updates are not supported":                           "%s: update через pipeline не поддерживается",
+	"the second argument":                                              "второй аргумент",
+	"%s: the second argument is required":                              "%s: второй аргумент обязателен",
+	"replaceOne: the replacement document cannot contain operators":    "replaceOne: документ замены не может содержать операторы",
+	"findOneAndUpdate: the update must contain operators such as $set": "findOneAndUpdate: update должен содержать операторы, например $set",
+	"the options":                                                      "параметры",
+	"method %s is not supported after %s":                              "метод %s не поддерживается после %s",
+	"%s expects one object":                                            "%s ожидает один объект",
+	"%s expects an object":                                             "%s ожидает объект",
+	"%s expects a number":                                              "%s ожидает число",
+	"%s expects a non-negative integer":                                "%s ожидает неотрицательное целое число",
+	"method %s is not supported":                                       "метод %s не поддерживается",
+	"sort order of %s must be 1 or -1":                                 "сортировка по %s должна быть 1 или -1",
+	"exclusion projections are not supported: %s":                      "исключающая проекция не поддерживается: %s",
+	"unexpected end of query, %s":                                      "неожиданный конец запроса, %s",
+}
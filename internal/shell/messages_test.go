@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Every format and phrase written in this package must have a Russian text,
+// or the admin panel would show it in English.
+func TestRussianMessagesCoverSource(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := gotoken.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || file == "messages.go" {
+			continue
+		}
+		f, err := goparser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			var name string
+			switch fn := call.Fun.(type) {
+			case *ast.Ident:
+				name = fn.Name
+			case *ast.SelectorExpr:
+				name = fn.Sel.Name
+			}
+			switch name {
+			case "syntaxError", "errorAt", "fail", "newMessage", "doc":
+			default:
+				return true
+			}
+			for _, arg := range call.Args {
+				lit, ok := arg.(*ast.BasicLit)
+				if !ok || lit.Kind != gotoken.STRING {
+					continue
+				}
+				text, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := russianMessages[text]; !ok && strings.Trim(text, "%s") != "" {
+					t.Errorf("%s: no Russian text for %q", fset.Position(lit.Pos()), text)
+				}
+				break
+			}
+			return true
+		})
+	}
+}
+
+func TestRussian(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`db.t.find({a: 1}`, `позиция 17: неожиданный конец запроса, ожидалось ")"`},
+		{`db.t.find(1)`, "позиция 6: find: фильтр должен быть объектом"},
+		{`db.t.find({a: {{a:int=x}}})`, "позиция 15: параметр a: ожидается целое число"},
+	}
+	for _, tc := range cases {
+		_, err := Parse(tc.src)
+		if err == nil {
+			t.Fatalf("Parse accepted %q", tc.src)
+		}
+		if got := Russian(err); got != tc.want {
+			t.Errorf("Russian(%q) = %q, want %q", err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Parameter types accepted in {{name:type}} placeholders.
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamNumber   = "number"
+	ParamBool     = "bool"
+	ParamDate     = "date"
+	ParamObjectID = "objectid"
+)
+
+var paramTypes = map[string]bool{
+	ParamString:   true,
+	ParamInt:      true,
+	ParamNumber:   true,
+	ParamBool:     true,
+	ParamDate:     true,
+	ParamObjectID: true,
+}
+
+var paramPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?::\s*([A-Za-z]+)\s*)?(?:=(.*))?$`)
+
+// Param is a placeholder declared in a query as {{name:type}} or
+// {{name:type=default}}. The type defaults to string.
+type Param struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Default    string `json:"default,omitempty"`
+	HasDefault bool   `json:"has_default,omitempty"`
+}
+
+func parseParam(spec string) (*Param, error) {
+	m := paramPattern.FindStringSubmatch(spec)
+	if m == nil {
+		return nil, newMessage("invalid parameter {{%s}}, expected {{name:type=value}}", spec)
+	}
+	param := &Param{Name: m[1], Type: strings.ToLower(m[2])}
+	if param.Type == "" {
+		param.Type = ParamString
+	}
+	if !paramTypes[param.Type] {
+		return nil, newMessage("unknown type of parameter %s: %s", param.Name, m[2])
+	}
+	if strings.Contains(spec, "=") {
+		param.HasDefault = true
+		param.Default = unquote(strings.TrimSpace(m[3]))
+		if _, err := param.convert(param.Default); err != nil {
+			return nil, err
+		}
+	}
+	return param, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// convert turns a raw parameter value into a typed BSON value. The value is
+// never lexed, so it cannot change the structure of the query.
+func (p *Param) convert(raw string) (interface{}, error) {
+	switch p.Type {
+	case ParamInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, newMessage("parameter %s: expected an integer", p.Name)
+		}
+		return n, nil
+	case ParamNumber:
+		raw = strings.TrimSpace(raw)
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, newMessage("parameter %s: expected a number", p.Name)
+		}
+		return f, nil
+	case ParamBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, newMessage("parameter %s: expected true or false", p.Name)
+		}
+		return b, nil
+	case ParamDate:
+		raw = strings.TrimSpace(raw)
+		for _, layout := range dateLayouts {
+			if ts, err := time.Parse(layout, raw); err == nil {
+				return ts.UTC(), nil
+			}
+		}
+		return nil, newMessage("parameter %s: invalid date %q", p.Name, raw)
+	case ParamObjectID:
+		id, err := primitive.ObjectIDFromHex(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, newMessage("parameter %s: invalid ObjectId %q", p.Name, raw)
+		}
+		return id, nil
+	}
+	return raw, nil
+}
+
+// zero is the placeholder value used when a query is parsed without
+// parameter values, e.g. to validate or explain it.
+func (p *Param) zero() interface{} {
+	switch p.Type {
+	case ParamInt:
+		return int64(0)
+	case ParamNumber:
+		return float64(0)
+	case ParamBool:
+		return false
+	case ParamDate:
+		return time.Time{}
+	case ParamObjectID:
+		return primitive.NilObjectID
+	}
+	return ""
+}
+
+// Params lists the placeholders declared in a query, in order of first
+// use. A name declared twice with different types is an error.
+func Params(src string) ([]Param, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	var params []Param
+	seen := make(map[string]int)
+	for _, t := range tokens {
+		if t.kind != tokenParam {
+			continue
+		}
+		if i, ok := seen[t.param.Name]; ok {
+			if params[i].Type != t.param.Type {
+				return nil, syntaxError(src, t.pos, "parameter %s is declared with different types", t.param.Name)
+			}
+			if !params[i].HasDefault && t.param.HasDefault {
+				params[i].Default, params[i].HasDefault = t.param.Default, true
+			}
+			continue
+		}
+		seen[t.param.Name] = len(params)
+		params = append(params, *t.param)
+	}
+	return params, nil
+}
+
+// bindParam resolves a placeholder from the bound values, then from its
+// default. Without bound values it falls back to the zero value.
+func (p *parser) bindParam(t token) (interface{}, error) {
+	param := t.param
+	if declared, ok := p.params[param.Name]; ok {
+		param = &declared
+	}
+	if raw, ok := p.values[param.Name]; ok {
+		v, err := param.convert(raw)
+		if err != nil {
+			return nil, syntaxError(p.src, t.pos, "%s", err)
+		}
+		return v, nil
+	}
+	if param.HasDefault {
+		return param.convert(param.Default)
+	}
+	if p.values == nil {
+		return param.zero(), nil
+	}
+	return nil, syntaxError(p.src, t.pos, "parameter %s is not set", param.Name)
+}
@@ -0,0 +1,141 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParams(t *testing.T) {
+	src := `db.t.find({a: {{name}}, b: {{n:int=5}}, c: {{name}}, d: {{at:date}}, e: {{flag : bool = 'true'}}})`
+	got, err := Params(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Param{
+		{Name: "name", Type: ParamString},
+		{Name: "n", Type: ParamInt, Default: "5", HasDefault: true},
+		{Name: "at", Type: ParamDate},
+		{Name: "flag", Type: ParamBool, Default: "true", HasDefault: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Params =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParamsRejects(t *testing.T) {
+	for _, src := range []string{
+		`db.t.find({a: {{1bad}}})`,
+		`db.t.find({a: {{n:float}}})`,
+		`db.t.find({a: {{n:int=x}}})`,
+		`db.t.find({a: {{n:int}}, b: {{n:string}}})`,
+	} {
+		if _, err := Params(src); err == nil {
+			t.Errorf("Params accepted %q", src)
+		}
+	}
+}
+
+func TestBindTypes(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	cases := []struct {
+		name   string
+		src    string
+		values map[string]string
+		want   interface{}
+	}{
+		{"string", `db.t.find({v: {{v}}})`, map[string]string{"v": "Alice"}, "Alice"},
+		{"int", `db.t.find({v: {{v:int}}})`, map[string]string{"v": " 42 "}, int64(42)},
+		{"number int", `db.t.find({v: {{v:number}}})`, map[string]string{"v": "7"}, int64(7)},
+		{"number float", `db.t.find({v: {{v:number}}})`, map[string]string{"v": "2.5"}, 2.5},
+		{"bool", `db.t.find({v: {{v:bool}}})`, map[string]string{"v": "false"}, false},
+		{"date", `db.t.find({v: {{v:date}}})`, map[string]string{"v": "2026-01-02T03:04:05Z"}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"objectid", `db.t.find({v: {{v:objectid}}})`, map[string]string{"v": "65a1b2c3d4e5f60718293a4b"}, oid},
+		{"default", `db.t.find({v: {{v:int=3}}})`, map[string]string{}, int64(3)},
+		{"value beats default", `db.t.find({v: {{v:int=3}}})`, map[string]string{"v": "4"}, int64(4)},
+		{"zero without values", `db.t.find({v: {{v:int}}})`, nil, int64(0)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := Bind(tc.src, tc.values)
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if got := q.Filter["v"]; !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("v = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBindRejectsValues(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		values map[string]string
+	}{
+		{"missing value", `db.t.find({v: {{v}}})`, map[string]string{}},
+		{"not an int", `db.t.find({v: {{v:int}}})`, map[string]string{"v": "1; db.t.drop()"}},
+		{"not a number", `db.t.find({v: {{v:number}}})`, map[string]string{"v": "1e"}},
+		{"not a bool", `db.t.find({v: {{v:bool}}})`, map[string]string{"v": "yes please"}},
+		{"not a date", `db.t.find({v: {{v:date}}})`, map[string]string{"v": "tomorrow"}},
+		{"not an ObjectId", `db.t.find({v: {{v:objectid}}})`, map[string]string{"v": "{$ne: null}"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if q, err := Bind(tc.src, tc.values); err == nil {
+				t.Fatalf("Bind accepted %#v as %#v", tc.values, q)
+			}
+		})
+	}
+}
+
+// Values are substituted after lexing, so whatever they contain stays a
+// single string and cannot add operators, stages or statements.
+func TestBindValuesCannotChangeTheQuery(t *testing.T) {
+	payloads := []string{
+		`{$ne: null}`,
+		`x'}, {$where: 'sleep(1000)'}`,
+		`x"}).limit(0); db.users.deleteMany({`,
+		`{{other}}`,
+		`/.*/`,
+		`ObjectId("65a1b2c3d4e5f60718293a4b")`,
+		`$gt`,
+		"\x00\n\"'`",
+	}
+	src := `db.users.find({name: {{name}}, other: {{other=""}}}).limit(5)`
+	for _, payload := range payloads {
+		t.Run(payload, func(t *testing.T) {
+			q, err := Bind(src, map[string]string{"name": payload})
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			want := map[string]interface{}{"name": payload, "other": ""}
+			if !reflect.DeepEqual(q.Filter, want) {
+				t.Fatalf("filter = %#v, want %#v", q.Filter, want)
+			}
+			if q.Operation != OpFind || q.Collection != "users" || q.Limit != 5 {
+				t.Fatalf("query changed: %#v", q)
+			}
+		})
+	}
+}
+
+func TestBindPipelineValue(t *testing.T) {
+	q, err := Bind(`db.t.aggregate([{$match: {status: {{s}}}}, {$limit: {{n:int=10}}}])`, map[string]string{"s": "{$exists: true}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Pipeline) != 2 {
+		t.Fatalf("pipeline has %d stages", len(q.Pipeline))
+	}
+	match := toMap(q.Pipeline[0])["$match"].(map[string]interface{})
+	if match["status"] != "{$exists: true}" {
+		t.Fatalf("status = %#v", match["status"])
+	}
+	if limit := toMap(q.Pipeline[1])["$limit"]; limit != int64(10) {
+		t.Fatalf("$limit = %#v", limit)
+	}
+}
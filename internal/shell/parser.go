@@ -0,0 +1,368 @@
+package shell
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// call is one method invocation in a chain: find({...}) or limit(10).
+type call struct {
+	name string
+	args []interface{}
+	pos  int
+}
+
+// statement is the raw parse of db.<collection>.<method>(...).<chain>(...).
+// Objects are bson.D so key order survives into pipelines and sorts.
+type statement struct {
+	collection string
+	method     call
+	chain      []call
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+	// values are the bound placeholder values; nil when parsing without them.
+	values map[string]string
+	params map[string]Param
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == text
+}
+
+func (p *parser) expect(text string) error {
+	t := p.next()
+	if t.kind != tokenPunct || t.text != text {
+		return p.errorAt(t, "expected %q", text)
+	}
+	return nil
+}
+
+func (p *parser) errorAt(t token, format string, args ...interface{}) error {
+	if t.kind == tokenEOF {
+		return syntaxError(p.src, t.pos, "unexpected end of query, %s", newMessage(format, args...))
+	}
+	return syntaxError(p.src, t.pos, format, args...)
+}
+
+func (p *parser) statement() (statement, error) {
+	var stmt statement
+	if t := p.next(); t.kind != tokenIdent || t.text != "db" {
+		return stmt, p.errorAt(t, "query must start with db.")
+	}
+
+	// The collection is everything between db. and the first name followed
+	// by "(", so db.logs.2024.find() reads collection "logs.2024".
+	// db.getCollection("name") and db["name"] are accepted as well.
+	var parts []string
+	if p.isPunct("[") {
+		p.next()
+		t := p.next()
+		if t.kind != tokenString {
+			return stmt, p.errorAt(t, "expected a quoted collection name")
+		}
+		parts = append(parts, t.text)
+		if err := p.expect("]"); err != nil {
+			return stmt, err
+		}
+	}
+	for {
+		if err := p.expect("."); err != nil {
+			return stmt, err
+		}
+		t := p.next()
+		if t.kind != tokenIdent && t.kind != tokenNumber {
+			return stmt, p.errorAt(t, "expected a name")
+		}
+		if !p.isPunct("(") {
+			parts = append(parts, t.text)
+			continue
+		}
+		if t.text == "getCollection" && len(parts) == 0 {
+			args, err := p.args()
+			if err != nil {
+				return stmt, err
+			}
+			name, ok := singleString(args)
+			if !ok {
+				return stmt, p.errorAt(t, "getCollection expects the collection name as a string")
+			}
+			parts = append(parts, name)
+			continue
+		}
+		if len(parts) == 0 {
+			return stmt, p.errorAt(t, "collection name is missing")
+		}
+		args, err := p.args()
+		if err != nil {
+			return stmt, err
+		}
+		stmt.collection = strings.Join(parts, ".")
+		stmt.method = call{name: t.text, args: args, pos: t.pos}
+		break
+	}
+
+	for p.isPunct(".") {
+		p.next()
+		t := p.next()
+		if t.kind != tokenIdent {
+			return stmt, p.errorAt(t, "expected a method name")
+		}
+		args, err := p.args()
+		if err != nil {
+			return stmt, err
+		}
+		stmt.chain = append(stmt.chain, call{name: t.text, args: args, pos: t.pos})
+	}
+	if p.isPunct(";") {
+		p.next()
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return stmt, p.errorAt(t, "unexpected characters after the query")
+	}
+	return stmt, nil
+}
+
+// args parses a parenthesised, comma separated argument list.
+func (p *parser) args() ([]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	for !p.isPunct(")") {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenNumber:
+		return p.number(t, false)
+	case tokenRegex:
+		return primitive.Regex{Pattern: t.text, Options: t.flags}, nil
+	case tokenParam:
+		return p.bindParam(t)
+	case tokenPunct:
+		switch t.text {
+		case "{":
+			return p.object()
+		case "[":
+			return p.array()
+		case "-", "+":
+			n := p.next()
+			if n.kind == tokenIdent && n.text == "Infinity" {
+				return nil, p.errorAt(n, "Infinity is not supported")
+			}
+			if n.kind != tokenNumber {
+				return nil, p.errorAt(n, "expected a number")
+			}
+			return p.number(n, t.text == "-")
+		}
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null", "undefined":
+			return nil, nil
+		case "new":
+			name := p.next()
+			if name.kind != tokenIdent || !p.isPunct("(") {
+				return nil, p.errorAt(name, "expected a constructor call")
+			}
+			return p.helper(name)
+		}
+		if p.isPunct("(") {
+			return p.helper(t)
+		}
+		return nil, p.errorAt(t, "unknown identifier %s", t.text)
+	}
+	return nil, p.errorAt(t, "expected a value")
+}
+
+func (p *parser) number(t token, negative bool) (interface{}, error) {
+	text := t.text
+	if negative {
+		text = "-" + text
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorAt(t, "invalid number %s", t.text)
+	}
+	return f, nil
+}
+
+// object parses a relaxed JSON object: keys may be bare identifiers or
+// single-quoted, and a trailing comma is allowed.
+func (p *parser) object() (interface{}, error) {
+	doc := bson.D{}
+	for !p.isPunct("}") {
+		t := p.next()
+		if t.kind != tokenIdent && t.kind != tokenString && t.kind != tokenNumber {
+			return nil, p.errorAt(t, "expected a key")
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: t.text, Value: v})
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (p *parser) array() (interface{}, error) {
+	list := bson.A{}
+	for !p.isPunct("]") {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// helper evaluates the shell's type constructors.
+func (p *parser) helper(name token) (interface{}, error) {
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	switch name.text {
+	case "ObjectId", "ObjectID":
+		if len(args) == 0 {
+			return primitive.NewObjectID(), nil
+		}
+		hex, ok := singleString(args)
+		if !ok {
+			return nil, p.errorAt(name, "ObjectId expects a hex string")
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, p.errorAt(name, "invalid ObjectId %q", hex)
+		}
+		return id, nil
+	case "ISODate", "Date":
+		if len(args) == 0 {
+			return time.Now().UTC(), nil
+		}
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case int64:
+				return time.UnixMilli(v).UTC(), nil
+			case string:
+				for _, layout := range dateLayouts {
+					if ts, err := time.Parse(layout, v); err == nil {
+						return ts.UTC(), nil
+					}
+				}
+				return nil, p.errorAt(name, "invalid date %q", v)
+			}
+		}
+		return nil, p.errorAt(name, "%s expects a date string", name.text)
+	case "NumberLong", "NumberInt":
+		if len(args) != 1 {
+			return nil, p.errorAt(name, "%s expects one argument", name.text)
+		}
+		var n int64
+		switch v := args[0].(type) {
+		case int64:
+			n = v
+		case string:
+			n, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, p.errorAt(name, "invalid number %q", v)
+			}
+		default:
+			return nil, p.errorAt(name, "%s expects an integer", name.text)
+		}
+		if name.text == "NumberInt" {
+			return int32(n), nil
+		}
+		return n, nil
+	case "NumberDecimal":
+		s, ok := singleString(args)
+		if !ok {
+			return nil, p.errorAt(name, "NumberDecimal expects a string")
+		}
+		d, err := primitive.ParseDecimal128(s)
+		if err != nil {
+			return nil, p.errorAt(name, "invalid number %q", s)
+		}
+		return d, nil
+	}
+	return nil, p.errorAt(name, "unknown function %s", name.text)
+}
+
+func singleString(args []interface{}) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	s, ok := args[0].(string)
+	return s, ok
+}
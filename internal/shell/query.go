@@ -0,0 +1,428 @@
+// Package shell parses mongo shell statements such as
+// db.orders.find({status: 'new'}).sort({ts: -1}).limit(10) into queries the
+// storage service can run. It accepts relaxed JSON (bare keys, single
+// quotes, trailing commas), regex literals and the ObjectId, ISODate,
+// NumberLong, NumberInt and NumberDecimal helpers.
+package shell
+
+import (
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+// Operations, in their canonical form.
+const (
+	OpFind             = "find"
+	OpFindOne          = "findone"
+	OpCount            = "countdocuments"
+	OpDistinct         = "distinct"
+	OpAggregate        = "aggregate"
+	OpInsertOne        = "insertone"
+	OpInsertMany       = "insertmany"
+	OpUpdateOne        = "updateone"
+	OpUpdateMany       = "updatemany"
+	OpReplaceOne       = "replaceone"
+	OpFindOneAndUpdate = "findoneandupdate"
+	OpDeleteOne        = "deleteone"
+	OpDeleteMany       = "deletemany"
+)
+
+// aliases maps lowercased shell method names to canonical operations.
+var aliases = map[string]string{
+	"find":             OpFind,
+	"findone":          OpFindOne,
+	"countdocuments":   OpCount,
+	"count":            OpCount,
+	"distinct":         OpDistinct,
+	"aggregate":        OpAggregate,
+	"insertone":        OpInsertOne,
+	"insertmany":       OpInsertMany,
+	"insert":           OpInsertMany,
+	"updateone":        OpUpdateOne,
+	"updatemany":       OpUpdateMany,
+	"update":           OpUpdateMany,
+	"replaceone":       OpReplaceOne,
+	"findoneandupdate": OpFindOneAndUpdate,
+	"deleteone":        OpDeleteOne,
+	"deletemany":       OpDeleteMany,
+	"delete":           OpDeleteMany,
+	"remove":           OpDeleteMany,
+}
+
+// Query is a parsed shell statement. Filters, updates and documents are
+// plain maps as a JSON request body would decode; the pipeline keeps
+// bson.D stages so key order is preserved.
+type Query struct {
+	Collection string
+	// Method is the method as written, e.g. "findOne".
+	Method string
+	// Operation is the canonical operation, one of the Op constants.
+	Operation string
+
+	Filter map[string]interface{}
+	// Update holds the update document of updateOne, updateMany and
+	// findOneAndUpdate, and the replacement document of replaceOne.
+	Update    map[string]interface{}
+	Documents []interface{}
+	Pipeline  types.OrderedPipeline
+	// Field is the field of distinct.
+	Field string
+
+	Sort   map[string]int
+	Fields []string
+	Limit  int
+	Skip   int
+
+	Upsert bool
+	// ReturnNew makes findOneAndUpdate return the updated document.
+	ReturnNew bool
+}
+
+// CanonicalOperation returns the canonical form of a shell method name, or
+// "" if the method is not supported.
+func CanonicalOperation(method string) string {
+	return aliases[strings.ToLower(method)]
+}
+
+// IsWrite reports whether the operation changes data.
+func IsWrite(operation string) bool {
+	switch CanonicalOperation(operation) {
+	case OpInsertOne, OpInsertMany, OpUpdateOne, OpUpdateMany, OpReplaceOne, OpFindOneAndUpdate, OpDeleteOne, OpDeleteMany:
+		return true
+	}
+	return false
+}
+
+// Parse parses a single shell statement. Errors are *SyntaxError values
+// that carry the position of the offending token. Placeholders take their
+// default, or the zero value of their type.
+func Parse(src string) (*Query, error) {
+	return Bind(src, nil)
+}
+
+// Bind parses a statement and substitutes placeholder values. A placeholder
+// with neither a value nor a default is an error.
+func Bind(src string, values map[string]string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := Params(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens, values: values, params: make(map[string]Param, len(declared))}
+	for _, param := range declared {
+		p.params[param.Name] = param
+	}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return p.build(stmt)
+}
+
+func (p *parser) build(stmt statement) (*Query, error) {
+	m := stmt.method
+	q := &Query{
+		Collection: stmt.collection,
+		Method:     m.name,
+		Operation:  CanonicalOperation(m.name),
+	}
+	fail := func(c call, format string, args ...interface{}) error {
+		return syntaxError(p.src, c.pos, format, args...)
+	}
+	arity := func(min, max int) error {
+		if len(m.args) < min {
+			return fail(m, "%s: not enough arguments", m.name)
+		}
+		if len(m.args) > max {
+			return fail(m, "%s: too many arguments", m.name)
+		}
+		return nil
+	}
+	doc := func(i int, what phrase) (map[string]interface{}, error) {
+		if i >= len(m.args) || m.args[i] == nil {
+			return nil, nil
+		}
+		d, ok := m.args[i].(bson.D)
+		if !ok {
+			return nil, fail(m, "%s: %s must be an object", m.name, what)
+		}
+		return toMap(d), nil
+	}
+
+	var err error
+	switch q.Operation {
+	case "":
+		return nil, fail(m, "operation %s is not supported", m.name)
+	case OpFind, OpFindOne:
+		if err = arity(0, 2); err != nil {
+			return nil, err
+		}
+		if q.Filter, err = doc(0, "the filter"); err != nil {
+			return nil, err
+		}
+		var projection map[string]interface{}
+		if projection, err = doc(1, "the projection"); err != nil {
+			return nil, err
+		}
+		if q.Fields, err = projectionFields(projection); err != nil {
+			return nil, fail(m, "%s", err)
+		}
+		if q.Operation == OpFindOne {
+			q.Limit = 1
+		}
+	case OpCount:
+		if err = arity(0, 2); err != nil {
+			return nil, err
+		}
+		if q.Filter, err = doc(0, "the filter"); err != nil {
+			return nil, err
+		}
+	case OpDistinct:
+		if err = arity(1, 2); err != nil {
+			return nil, err
+		}
+		field, ok := m.args[0].(string)
+		if !ok || field == "" {
+			return nil, fail(m, "distinct: the field name must be a string")
+		}
+		q.Field = field
+		if q.Filter, err = doc(1, "the filter"); err != nil {
+			return nil, err
+		}
+	case OpAggregate:
+		// aggregate([stages], options) or the legacy aggregate(stage, stage, ...).
+		stages := m.args
+		if len(stages) > 0 {
+			if list, ok := stages[0].(bson.A); ok {
+				if len(stages) > 2 {
+					return nil, fail(m, "aggregate: too many arguments")
+				}
+				stages = list
+			}
+		}
+		if len(stages) == 0 {
+			return nil, fail(m, "aggregate: the pipeline is empty")
+		}
+		for _, stage := range stages {
+			d, ok := stage.(bson.D)
+			if !ok {
+				return nil, fail(m, "aggregate: a stage must be an object")
+			}
+			q.Pipeline = append(q.Pipeline, d)
+		}
+	case OpInsertOne, OpInsertMany:
+		if err = arity(1, 2); err != nil {
+			return nil, err
+		}
+		items := bson.A{m.args[0]}
+		if list, ok := m.args[0].(bson.A); ok {
+			if q.Operation == OpInsertOne {
+				return nil, fail(m, "insertOne: the document must be an object")
+			}
+			items = list
+		}
+		if len(items) == 0 {
+			return nil, fail(m, "%s: no documents", m.name)
+		}
+		for _, item := range items {
+			d, ok := item.(bson.D)
+			if !ok {
+				return nil, fail(m, "%s: a document must be an object", m.name)
+			}
+			q.Documents = append(q.Documents, toMap(d))
+		}
+		q.Operation = OpInsertMany
+		if len(q.Documents) == 1 {
+			q.Operation = OpInsertOne
+		}
+	case OpUpdateOne, OpUpdateMany, OpReplaceOne, OpFindOneAndUpdate:
+		if err = arity(2, 3); err != nil {
+			return nil, err
+		}
+		if _, ok := m.args[1].(bson.A); ok {
+			return nil, fail(m, "%s: pipeline updates are not supported", m.name)
+		}
+		if q.Filter, err = doc(0, "the filter"); err != nil {
+			return nil, err
+		}
+		if q.Update, err = doc(1, "the second argument"); err != nil {
+			return nil, err
+		}
+		if q.Update == nil {
+			return nil, fail(m, "%s: the second argument is required", m.name)
+		}
+		hasOperators := false
+		for key := range q.Update {
+			if strings.HasPrefix(key, "$") {
+				hasOperators = true
+			}
+		}
+		if q.Operation == OpReplaceOne && hasOperators {
+			return nil, fail(m, "replaceOne: the replacement document cannot contain operators")
+		}
+		if q.Operation == OpFindOneAndUpdate && !hasOperators {
+			return nil, fail(m, "findOneAndUpdate: the update must contain operators such as $set")
+		}
+		var options map[string]interface{}
+		if options, err = doc(2, "the options"); err != nil {
+			return nil, err
+		}
+		q.Upsert, _ = options["upsert"].(bool)
+		if sort, ok := options["sort"].(map[string]interface{}); ok && q.Operation != OpUpdateMany {
+			if q.Sort, err = sortSpec(sort); err != nil {
+				return nil, fail(m, "%s", err)
+			}
+		}
+		if q.Operation == OpFindOneAndUpdate {
+			q.ReturnNew, _ = options["returnNewDocument"].(bool)
+			if options["returnDocument"] == "after" {
+				q.ReturnNew = true
+			}
+			projection, _ := options["projection"].(map[string]interface{})
+			if q.Fields, err = projectionFields(projection); err != nil {
+				return nil, fail(m, "%s", err)
+			}
+		}
+	case OpDeleteOne, OpDeleteMany:
+		if err = arity(1, 2); err != nil {
+			return nil, err
+		}
+		if q.Filter, err = doc(0, "the filter"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range stmt.chain {
+		if err := p.applyChain(q, c); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// applyChain applies a cursor method such as .sort() or .limit().
+func (p *parser) applyChain(q *Query, c call) error {
+	fail := func(format string, args ...interface{}) error {
+		return syntaxError(p.src, c.pos, format, args...)
+	}
+	name := strings.ToLower(c.name)
+	switch name {
+	case "pretty", "toarray":
+		return nil
+	}
+	if q.Operation != OpFind {
+		return fail("method %s is not supported after %s", c.name, q.Method)
+	}
+	switch name {
+	case "sort", "projection", "project":
+		if len(c.args) != 1 {
+			return fail("%s expects one object", c.name)
+		}
+		d, ok := c.args[0].(bson.D)
+		if !ok {
+			return fail("%s expects an object", c.name)
+		}
+		var err error
+		if name == "sort" {
+			q.Sort, err = sortSpec(toMap(d))
+		} else {
+			q.Fields, err = projectionFields(toMap(d))
+		}
+		if err != nil {
+			return fail("%s", err)
+		}
+	case "limit", "skip":
+		if len(c.args) != 1 {
+			return fail("%s expects a number", c.name)
+		}
+		n, ok := c.args[0].(int64)
+		if !ok || n < 0 {
+			return fail("%s expects a non-negative integer", c.name)
+		}
+		if name == "limit" {
+			q.Limit = int(n)
+		} else {
+			q.Skip = int(n)
+		}
+	case "count", "itcount":
+		q.Operation = OpCount
+		q.Sort, q.Fields = nil, nil
+	default:
+		return fail("method %s is not supported", c.name)
+	}
+	return nil
+}
+
+func sortSpec(spec map[string]interface{}) (map[string]int, error) {
+	out := make(map[string]int, len(spec))
+	for field, v := range spec {
+		switch n := v.(type) {
+		case int64:
+			if n == 1 || n == -1 {
+				out[field] = int(n)
+				continue
+			}
+		case float64:
+			if n == 1 || n == -1 {
+				out[field] = int(n)
+				continue
+			}
+		}
+		return nil, newMessage("sort order of %s must be 1 or -1", field)
+	}
+	return out, nil
+}
+
+// projectionFields turns an inclusion projection into a field list.
+// Exclusions other than _id are not supported by the storage API.
+func projectionFields(spec map[string]interface{}) ([]string, error) {
+	var fields []string
+	for field, v := range spec {
+		include := true
+		switch n := v.(type) {
+		case bool:
+			include = n
+		case int64:
+			include = n != 0
+		case float64:
+			include = n != 0
+		}
+		if include {
+			fields = append(fields, field)
+		} else if field != "_id" {
+			return nil, newMessage("exclusion projections are not supported: %s", field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// toMap converts a parsed object to the map form a JSON body decodes to.
+func toMap(d bson.D) map[string]interface{} {
+	out := make(map[string]interface{}, len(d))
+	for _, e := range d {
+		out[e.Key] = toPlain(e.Value)
+	}
+	return out
+}
+
+func toPlain(v interface{}) interface{} {
+	switch val := v.(type) {
+	case bson.D:
+		return toMap(val)
+	case bson.A:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = toPlain(item)
+		}
+		return list
+	}
+	return v
+}
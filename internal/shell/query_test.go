@@ -0,0 +1,209 @@
+package shell
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/saiset-co/sai-storage/types"
+)
+
+func TestParseAccepts(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	cases := []struct {
+		name string
+		src  string
+		want Query
+	}{
+		{
+			name: "find with chain",
+			src:  `db.orders.find({status: 'new', total: {$gt: 10}}).sort({ts: -1}).skip(5).limit(10)`,
+			want: Query{Collection: "orders", Method: "find", Operation: OpFind,
+				Filter: map[string]interface{}{"status": "new", "total": map[string]interface{}{"$gt": int64(10)}},
+				Sort:   map[string]int{"ts": -1}, Skip: 5, Limit: 10},
+		},
+		{
+			name: "find without arguments",
+			src:  `db.orders.find()`,
+			want: Query{Collection: "orders", Method: "find", Operation: OpFind},
+		},
+		{
+			name: "findOne with projection",
+			src:  `db.users.findOne({_id: ObjectId("65a1b2c3d4e5f60718293a4b")}, {name: 1, _id: 0})`,
+			want: Query{Collection: "users", Method: "findOne", Operation: OpFindOne,
+				Filter: map[string]interface{}{"_id": oid}, Fields: []string{"name"}, Limit: 1},
+		},
+		{
+			name: "dotted collection name",
+			src:  `db.logs.2024.countDocuments({level: "error"})`,
+			want: Query{Collection: "logs.2024", Method: "countDocuments", Operation: OpCount,
+				Filter: map[string]interface{}{"level": "error"}},
+		},
+		{
+			name: "getCollection",
+			src:  `db.getCollection("a.b-c").find({}).count()`,
+			want: Query{Collection: "a.b-c", Method: "find", Operation: OpCount, Filter: map[string]interface{}{}},
+		},
+		{
+			name: "relaxed json, comments and trailing commas",
+			src: `// recent
+db.t.find({'a': "x", b: [1, 2,], /* note */ c: true, d: null,});`,
+			want: Query{Collection: "t", Method: "find", Operation: OpFind,
+				Filter: map[string]interface{}{"a": "x", "b": []interface{}{int64(1), int64(2)}, "c": true, "d": nil}},
+		},
+		{
+			name: "regex and helpers",
+			src:  `db.t.find({name: /^al/i, at: {$gte: ISODate("2026-01-02T03:04:05Z")}, n: NumberInt(7), big: NumberLong("9007199254740993")})`,
+			want: Query{Collection: "t", Method: "find", Operation: OpFind,
+				Filter: map[string]interface{}{
+					"name": primitive.Regex{Pattern: "^al", Options: "i"},
+					"at":   map[string]interface{}{"$gte": time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+					"n":    int32(7),
+					"big":  int64(9007199254740993),
+				}},
+		},
+		{
+			name: "distinct",
+			src:  `db.t.distinct("city", {active: true})`,
+			want: Query{Collection: "t", Method: "distinct", Operation: OpDistinct, Field: "city",
+				Filter: map[string]interface{}{"active": true}},
+		},
+		{
+			name: "aggregate keeps stage order",
+			src:  `db.t.aggregate([{$match: {a: 1}}, {$group: {_id: "$b", n: {$sum: 1}}}])`,
+			want: Query{Collection: "t", Method: "aggregate", Operation: OpAggregate,
+				Pipeline: types.OrderedPipeline{
+					bson.D{{Key: "$match", Value: bson.D{{Key: "a", Value: int64(1)}}}},
+					bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$b"}, {Key: "n", Value: bson.D{{Key: "$sum", Value: int64(1)}}}}}},
+				}},
+		},
+		{
+			name: "insertMany with one document",
+			src:  `db.t.insertMany([{a: 1}])`,
+			want: Query{Collection: "t", Method: "insertMany", Operation: OpInsertOne,
+				Documents: []interface{}{map[string]interface{}{"a": int64(1)}}},
+		},
+		{
+			name: "insert alias",
+			src:  `db.t.insert([{a: 1}, {a: 2}])`,
+			want: Query{Collection: "t", Method: "insert", Operation: OpInsertMany,
+				Documents: []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": int64(2)}}},
+		},
+		{
+			name: "updateOne with sort and upsert",
+			src:  `db.t.updateOne({a: 1}, {$set: {b: 2}}, {upsert: true, sort: {ts: -1}})`,
+			want: Query{Collection: "t", Method: "updateOne", Operation: OpUpdateOne,
+				Filter: map[string]interface{}{"a": int64(1)},
+				Update: map[string]interface{}{"$set": map[string]interface{}{"b": int64(2)}},
+				Sort:   map[string]int{"ts": -1}, Upsert: true},
+		},
+		{
+			name: "updateMany ignores sort",
+			src:  `db.t.updateMany({}, {$set: {b: 2}}, {sort: {ts: 1}})`,
+			want: Query{Collection: "t", Method: "updateMany", Operation: OpUpdateMany,
+				Filter: map[string]interface{}{},
+				Update: map[string]interface{}{"$set": map[string]interface{}{"b": int64(2)}}},
+		},
+		{
+			name: "replaceOne",
+			src:  `db.t.replaceOne({a: 1}, {a: 1, b: 3})`,
+			want: Query{Collection: "t", Method: "replaceOne", Operation: OpReplaceOne,
+				Filter: map[string]interface{}{"a": int64(1)},
+				Update: map[string]interface{}{"a": int64(1), "b": int64(3)}},
+		},
+		{
+			name: "findOneAndUpdate",
+			src:  `db.t.findOneAndUpdate({a: 1}, {$inc: {n: 1}}, {returnDocument: "after", sort: {ts: 1}, projection: {n: 1}})`,
+			want: Query{Collection: "t", Method: "findOneAndUpdate", Operation: OpFindOneAndUpdate,
+				Filter: map[string]interface{}{"a": int64(1)},
+				Update: map[string]interface{}{"$inc": map[string]interface{}{"n": int64(1)}},
+				Sort:   map[string]int{"ts": 1}, Fields: []string{"n"}, ReturnNew: true},
+		},
+		{
+			name: "remove alias",
+			src:  `db.t.remove({a: {$in: [1, 2]}})`,
+			want: Query{Collection: "t", Method: "remove", Operation: OpDeleteMany,
+				Filter: map[string]interface{}{"a": map[string]interface{}{"$in": []interface{}{int64(1), int64(2)}}}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := Parse(tc.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(*q, tc.want) {
+				t.Fatalf("Parse =\n%#v\nwant\n%#v", *q, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+	}{
+		{"empty", ``},
+		{"not a db statement", `orders.find()`},
+		{"collection missing", `db.find()`},
+		{"unknown method", `db.t.drop()`},
+		{"unterminated string", `db.t.find({a: "x})`},
+		{"unterminated object", `db.t.find({a: 1)`},
+		{"trailing garbage", `db.t.find({}) db.t.find({})`},
+		{"second statement", `db.t.find({}); db.t.deleteMany({})`},
+		{"filter not an object", `db.t.find("a")`},
+		{"too many find arguments", `db.t.find({}, {}, {})`},
+		{"exclusion projection", `db.t.find({}, {secret: 0})`},
+		{"bad sort order", `db.t.find().sort({a: 2})`},
+		{"negative limit", `db.t.find().limit(-1)`},
+		{"chain after a write", `db.t.deleteMany({}).limit(1)`},
+		{"unknown chain method", `db.t.find().explain()`},
+		{"distinct without field", `db.t.distinct({})`},
+		{"empty pipeline", `db.t.aggregate([])`},
+		{"stage not an object", `db.t.aggregate([1])`},
+		{"insertOne with an array", `db.t.insertOne([{a: 1}])`},
+		{"insert of no documents", `db.t.insertMany([])`},
+		{"update without update document", `db.t.updateOne({a: 1})`},
+		{"pipeline update", `db.t.updateMany({}, [{$set: {a: 1}}])`},
+		{"replacement with operators", `db.t.replaceOne({}, {$set: {a: 1}})`},
+		{"findOneAndUpdate without operators", `db.t.findOneAndUpdate({}, {a: 1})`},
+		{"bad updateOne sort", `db.t.updateOne({}, {$set: {a: 1}}, {sort: {a: "up"}})`},
+		{"invalid ObjectId", `db.t.find({_id: ObjectId("xyz")})`},
+		{"invalid date", `db.t.find({at: ISODate("yesterday")})`},
+		{"unknown function", `db.t.find({a: eval("1")})`},
+		{"javascript function", `db.t.find({$where: function() { return true }})`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := Parse(tc.src)
+			if err == nil {
+				t.Fatalf("Parse accepted %q as %#v", tc.src, q)
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("error %v (%T) is not a *SyntaxError", err, err)
+			}
+			if syntaxErr.Pos < 1 || syntaxErr.Pos > len([]rune(tc.src))+1 {
+				t.Fatalf("position %d is outside the query", syntaxErr.Pos)
+			}
+		})
+	}
+}
+
+func TestIsWrite(t *testing.T) {
+	cases := map[string]bool{
+		"find": false, "findOne": false, "countDocuments": false, "aggregate": false, "distinct": false,
+		"insertOne": true, "insert": true, "updateOne": true, "update": true, "replaceOne": true,
+		"findOneAndUpdate": true, "deleteOne": true, "remove": true, "drop": false,
+	}
+	for method, want := range cases {
+		if got := IsWrite(method); got != want {
+			t.Errorf("IsWrite(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
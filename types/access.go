@@ -0,0 +1,42 @@
+package types
+
+type AccessControlConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	KeyHeader   string `yaml:"key_header" json:"key_header"`
+	DefaultRole string `yaml:"default_role" json:"default_role"`
+}
+
+// AccessRule grants Operations on collections matching any of the Collections
+// glob patterns. A non-empty Filter is ANDed into every query; the "$user"
+// placeholder is replaced with the caller's user.
+type AccessRule struct {
+	Collections []string               `json:"collections"`
+	Operations  []string               `json:"operations"`
+	Filter      map[string]interface{} `json:"filter,omitempty"`
+}
+
+type AccessRole struct {
+	InternalID  string       `json:"internal_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Rules       []AccessRule `json:"rules"`
+}
+
+type APIKey struct {
+	InternalID string `json:"internal_id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	User       string `json:"user"`
+	Tenant     string `json:"tenant"`
+	KeyHash    string `json:"key_hash"`
+	KeyPrefix  string `json:"key_prefix"`
+	Disabled   bool   `json:"disabled"`
+	CrTime     int64  `json:"cr_time"`
+}
+
+type Principal struct {
+	Name   string `json:"name"`
+	User   string `json:"user"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"`
+}
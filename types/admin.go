@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 type CollectionStats struct {
 	Name        string `json:"name"`
@@ -8,6 +11,16 @@ type CollectionStats struct {
 	StorageSize int64  `json:"storage_size"`
 	IndexSize   int64  `json:"index_size"`
 	NumIndexes  int    `json:"num_indexes"`
+	Type        string `json:"type"`
+}
+
+// FieldInfo describes a field seen in a sample of documents. Path is dotted
+// for embedded documents; Count is the number of sampled documents that
+// have the field.
+type FieldInfo struct {
+	Path  string   `json:"path"`
+	Types []string `json:"types"`
+	Count int64    `json:"count"`
 }
 
 type IndexInfo struct {
@@ -15,6 +28,51 @@ type IndexInfo struct {
 	Fields map[string]int `json:"fields"`
 	Unique bool           `json:"unique"`
 	Sparse bool           `json:"sparse"`
+	// OrderedKeys lists the index keys in index order.
+	OrderedKeys []IndexKey `json:"ordered_keys,omitempty"`
+	Hidden      bool       `json:"hidden,omitempty"`
+	// ExpireAfterSeconds is set on TTL indexes.
+	ExpireAfterSeconds      *int32                 `json:"expire_after_seconds,omitempty"`
+	PartialFilterExpression map[string]interface{} `json:"partial_filter_expression,omitempty"`
+	Collation               *IndexCollation        `json:"collation,omitempty"`
+	// Weights and DefaultLanguage are set on text indexes, whose keys are
+	// stored as _fts and _ftsx; Weights names the indexed fields.
+	Weights         map[string]int `json:"weights,omitempty"`
+	DefaultLanguage string         `json:"default_language,omitempty"`
+	// WildcardProjection limits the fields of a $** index.
+	WildcardProjection map[string]int `json:"wildcard_projection,omitempty"`
+}
+
+// IndexCollation is the collation of an index. Only Locale is required.
+type IndexCollation struct {
+	Locale          string `json:"locale" bson:"locale"`
+	CaseLevel       bool   `json:"case_level,omitempty" bson:"caseLevel,omitempty"`
+	CaseFirst       string `json:"case_first,omitempty" bson:"caseFirst,omitempty"`
+	Strength        int    `json:"strength,omitempty" bson:"strength,omitempty"`
+	NumericOrdering bool   `json:"numeric_ordering,omitempty" bson:"numericOrdering,omitempty"`
+	Alternate       string `json:"alternate,omitempty" bson:"alternate,omitempty"`
+	MaxVariable     string `json:"max_variable,omitempty" bson:"maxVariable,omitempty"`
+	Backwards       bool   `json:"backwards,omitempty" bson:"backwards,omitempty"`
+}
+
+// IndexBuild is an index build in progress, as reported by currentOp.
+// Done and Total count documents or keys of the current phase.
+type IndexBuild struct {
+	Collection string   `json:"collection"`
+	Indexes    []string `json:"indexes"`
+	Phase      string   `json:"phase"`
+	Done       int64    `json:"done"`
+	Total      int64    `json:"total"`
+	Seconds    int64    `json:"seconds"`
+}
+
+// IndexKey is one key of a compound index. Direction is 1 or -1; special
+// index types such as "text", "2dsphere" or "hashed" have Direction 0 and
+// their Type set. A wildcard index has the field "$**" or "path.$**".
+type IndexKey struct {
+	Field     string `json:"field"`
+	Direction int    `json:"direction"`
+	Type      string `json:"type,omitempty"`
 }
 
 type SlowQuery struct {
@@ -27,6 +85,8 @@ type SlowQuery struct {
 	PlanSummary  string    `json:"plan_summary"`
 	FilterKeys   []string  `json:"filter_keys"`
 	Timestamp    time.Time `json:"timestamp"`
+	OperationID  string    `json:"operation_id,omitempty"`
+	PlanStages   []string  `json:"plan_stages,omitempty"`
 }
 
 type QueryStat struct {
@@ -49,17 +109,112 @@ type CustomQuery struct {
 	CrTime      int64                  `json:"cr_time"`
 }
 
+// CreateIndexRequest creates an index on Keys. A map has no order, so
+// compound indexes should set OrderedKeys, which takes precedence; Keys alone
+// are created in field name order. The remaining options are those of
+// IndexInfo.
 type CreateIndexRequest struct {
-	Collection string         `json:"collection"`
-	Keys       map[string]int `json:"keys"`
-	Unique     bool           `json:"unique"`
-	Sparse     bool           `json:"sparse"`
-	Name       string         `json:"name"`
+	Collection              string                 `json:"collection"`
+	Keys                    map[string]int         `json:"keys"`
+	OrderedKeys             []IndexKey             `json:"ordered_keys,omitempty"`
+	Unique                  bool                   `json:"unique"`
+	Sparse                  bool                   `json:"sparse"`
+	Name                    string                 `json:"name"`
+	Hidden                  bool                   `json:"hidden,omitempty"`
+	ExpireAfterSeconds      *int32                 `json:"expire_after_seconds,omitempty"`
+	PartialFilterExpression map[string]interface{} `json:"partial_filter_expression,omitempty"`
+	Collation               *IndexCollation        `json:"collation,omitempty"`
+	Weights                 map[string]int         `json:"weights,omitempty"`
+	DefaultLanguage         string                 `json:"default_language,omitempty"`
+	WildcardProjection      map[string]int         `json:"wildcard_projection,omitempty"`
+}
+
+// CreateIndexRequest returns the request that creates the index again with
+// the same keys and options.
+func (i IndexInfo) CreateIndexRequest(collection string) CreateIndexRequest {
+	req := CreateIndexRequest{
+		Collection:              collection,
+		OrderedKeys:             i.OrderedKeys,
+		Unique:                  i.Unique,
+		Sparse:                  i.Sparse,
+		Name:                    i.Name,
+		Hidden:                  i.Hidden,
+		ExpireAfterSeconds:      i.ExpireAfterSeconds,
+		PartialFilterExpression: i.PartialFilterExpression,
+		Collation:               i.Collation,
+		DefaultLanguage:         i.DefaultLanguage,
+		WildcardProjection:      i.WildcardProjection,
+	}
+	if len(i.Weights) > 0 {
+		// A text index is listed with its internal _fts/_ftsx keys; it is
+		// created from the weighted fields instead, keeping other keys.
+		req.OrderedKeys = nil
+		for _, key := range i.OrderedKeys {
+			switch key.Field {
+			case "_fts":
+				fields := make([]string, 0, len(i.Weights))
+				for field := range i.Weights {
+					fields = append(fields, field)
+				}
+				sort.Strings(fields)
+				for _, field := range fields {
+					req.OrderedKeys = append(req.OrderedKeys, IndexKey{Field: field, Type: "text"})
+				}
+			case "_ftsx":
+			default:
+				req.OrderedKeys = append(req.OrderedKeys, key)
+			}
+		}
+		req.Weights = i.Weights
+	}
+	return req
 }
 
+// UpsertOperation is one entry of StorageRepository.BulkUpsert or
+// BulkPatch.
+type UpsertOperation struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update map[string]interface{} `json:"update"`
+}
+
+// RestoreRequest undoes one archived operation. Archive limits the restore to
+// the "create", "update" or "delete" archive; by default all three are used.
+// InternalIDs restricts it to a subset of the operation's documents.
 type RestoreRequest struct {
-	Collection         string `json:"collection"`
-	ArchiveOperationID string `json:"archive_operation_id"`
+	Collection         string   `json:"collection" validate:"required"`
+	ArchiveOperationID string   `json:"archive_operation_id" validate:"required"`
+	Archive            string   `json:"archive,omitempty" validate:"omitempty,oneof=create update delete"`
+	InternalIDs        []string `json:"internal_ids,omitempty"`
+	DryRun             bool     `json:"dry_run,omitempty"`
+}
+
+// RestoredDocument is one document a restore puts back ("restore") or
+// removes because the operation created it ("delete").
+type RestoredDocument struct {
+	InternalID string `json:"internal_id"`
+	Archive    string `json:"archive"`
+	Action     string `json:"action"`
+}
+
+type RestoreResponse struct {
+	ArchiveOperationID string             `json:"archive_operation_id"`
+	DryRun             bool               `json:"dry_run,omitempty"`
+	Restored           int                `json:"restored"`
+	Deleted            int                `json:"deleted"`
+	Documents          []RestoredDocument `json:"documents"`
+}
+
+type ArchiveOperationsRequest struct {
+	Collection string `json:"collection" validate:"required"`
+	Archive    string `json:"archive" validate:"required,oneof=create update delete"`
+	Search     string `json:"search,omitempty"`
+	Skip       int    `json:"skip,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+type ArchiveOperationsResponse struct {
+	Data  []ArchiveGroup `json:"data"`
+	Total int64          `json:"total"`
 }
 
 type ArchiveGroup struct {
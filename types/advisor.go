@@ -0,0 +1,93 @@
+package types
+
+import "time"
+
+// IndexAdvisorConfig controls the index advisor. With AutoApply the
+// recommendations of every tenant are created every IntervalMinutes.
+// Recommendations backed by fewer than MinCalls calls are not reported.
+type IndexAdvisorConfig struct {
+	AutoApply       bool  `yaml:"auto_apply" json:"auto_apply"`
+	IntervalMinutes int   `yaml:"interval_minutes" json:"interval_minutes"`
+	MinCalls        int64 `yaml:"min_calls" json:"min_calls"`
+}
+
+// QueryShape is one observed query pattern split per the ESR rule:
+// equality fields, sort keys, range fields.
+type QueryShape struct {
+	Collection string     `json:"collection"`
+	Operation  string     `json:"operation"`
+	Equality   []string   `json:"equality,omitempty"`
+	Sort       []IndexKey `json:"sort,omitempty"`
+	Range      []string   `json:"range,omitempty"`
+	Calls      int64      `json:"calls"`
+	SlowCalls  int64      `json:"slow_calls"`
+}
+
+// IndexRecommendation is a compound index serving every shape in Shapes.
+type IndexRecommendation struct {
+	Collection string       `json:"collection"`
+	Name       string       `json:"name"`
+	Keys       []IndexKey   `json:"keys"`
+	Calls      int64        `json:"calls"`
+	SlowCalls  int64        `json:"slow_calls"`
+	Shapes     []QueryShape `json:"shapes"`
+}
+
+// RedundantIndex is an existing index made unnecessary by CoveredBy. Reason
+// is "duplicate" for identical keys or "prefix" when its keys are a prefix
+// of CoveredBy.
+type RedundantIndex struct {
+	Collection string     `json:"collection"`
+	Name       string     `json:"name"`
+	Keys       []IndexKey `json:"keys"`
+	CoveredBy  string     `json:"covered_by"`
+	Reason     string     `json:"reason"`
+}
+
+type IndexAdvice struct {
+	GeneratedAt     time.Time             `json:"generated_at"`
+	Shapes          int                   `json:"shapes"`
+	Covered         int                   `json:"covered"`
+	Recommendations []IndexRecommendation `json:"recommendations"`
+	Redundant       []RedundantIndex      `json:"redundant"`
+}
+
+type IndexAdvisorStatus struct {
+	AutoApply bool          `json:"auto_apply"`
+	Interval  time.Duration `json:"interval"`
+	LastRun   time.Time     `json:"last_run"`
+	Created   []string      `json:"created,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// IndexUsage is what the server reports about one index: Ops operations
+// used it since Since, when counting started at index creation or the last
+// restart. Size is in bytes.
+type IndexUsage struct {
+	Name  string    `json:"name"`
+	Ops   int64     `json:"ops"`
+	Since time.Time `json:"since"`
+	Size  int64     `json:"size"`
+}
+
+// IndexUsageEntry is an index with its usage. Unused is set when it had no
+// operations for the report's UnusedDays; ShadowedBy names an index that
+// makes it redundant, for the RedundantIndex Reason ShadowReason. Shapes
+// are the recorded query shapes it fully serves, PartialShapes those that
+// can only use its leading key.
+type IndexUsageEntry struct {
+	Index         IndexInfo    `json:"index"`
+	Usage         IndexUsage   `json:"usage"`
+	Unused        bool         `json:"unused"`
+	ShadowedBy    string       `json:"shadowed_by,omitempty"`
+	ShadowReason  string       `json:"shadow_reason,omitempty"`
+	Shapes        []QueryShape `json:"shapes,omitempty"`
+	PartialShapes []QueryShape `json:"partial_shapes,omitempty"`
+}
+
+type IndexUsageReport struct {
+	Collection  string            `json:"collection"`
+	UnusedDays  int               `json:"unused_days"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Indexes     []IndexUsageEntry `json:"indexes"`
+}
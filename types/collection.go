@@ -0,0 +1,111 @@
+package types
+
+import "strings"
+
+// Collection types reported in CollectionStats.Type.
+const (
+	CollectionTypeRegular    = "regular"
+	CollectionTypeCapped     = "capped"
+	CollectionTypeTimeSeries = "timeseries"
+	CollectionTypeClustered  = "clustered"
+)
+
+// CollectionOptions are the options a collection is created with. At most
+// one of Capped, TimeSeries and Clustered is set; none is a regular
+// collection. ExpireAfterSeconds removes old documents of time-series and
+// clustered collections.
+type CollectionOptions struct {
+	Capped             bool               `json:"capped,omitempty"`
+	Size               int64              `json:"size,omitempty"`
+	Max                int64              `json:"max,omitempty"`
+	TimeSeries         *TimeSeriesOptions `json:"timeseries,omitempty"`
+	Clustered          bool               `json:"clustered,omitempty"`
+	ExpireAfterSeconds int64              `json:"expire_after_seconds,omitempty"`
+}
+
+type TimeSeriesOptions struct {
+	TimeField   string `json:"time_field"`
+	MetaField   string `json:"meta_field,omitempty"`
+	Granularity string `json:"granularity,omitempty"`
+}
+
+// Type names the kind of collection the options create.
+func (o CollectionOptions) Type() string {
+	switch {
+	case o.Capped:
+		return CollectionTypeCapped
+	case o.TimeSeries != nil:
+		return CollectionTypeTimeSeries
+	case o.Clustered:
+		return CollectionTypeClustered
+	}
+	return CollectionTypeRegular
+}
+
+// CollectionRequest is a collection lifecycle operation. To is the new name
+// for rename and clone. Drop, truncate and convert must repeat the
+// collection name in Confirm. Options are used by create and convert.
+type CollectionRequest struct {
+	Collection string            `json:"collection" validate:"required"`
+	To         string            `json:"to,omitempty"`
+	Confirm    string            `json:"confirm,omitempty"`
+	Options    CollectionOptions `json:"options"`
+}
+
+// CollectionResponse reports what an operation did. Snapshot is the copy
+// made before a destructive operation, Companions the request log and
+// archive collections renamed along with the collection.
+type CollectionResponse struct {
+	Collection string   `json:"collection"`
+	Snapshot   string   `json:"snapshot,omitempty"`
+	Companions []string `json:"companions,omitempty"`
+	Documents  int64    `json:"documents"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// Collections the service keeps for itself are named by convention: admin
+// state by prefix, the request log and archives of a user collection by
+// suffix. The public API policy, the admin panel and the repositories all
+// read these lists, so a new kind of service collection is added here.
+var (
+	AdminCollectionPrefixes = []string{"_admin_", "system."}
+	AuditCollectionSuffixes = []string{"_request_logs", "_create_archive", "_update_archive", "_delete_archive"}
+)
+
+// SnapshotCollectionPrefix starts the name of the copy taken before a
+// destructive operation, e.g. "_snapshot_orders_20260101_120000_1a2b3c4d".
+// Snapshots are listed in the admin panel so they can be renamed back, but
+// the public API treats them as admin state.
+const SnapshotCollectionPrefix = "_snapshot_"
+
+// IsSnapshotCollection reports whether name is a snapshot.
+func IsSnapshotCollection(name string) bool {
+	return strings.HasPrefix(name, SnapshotCollectionPrefix)
+}
+
+// IsAdminStateCollection reports whether name holds internal admin state.
+func IsAdminStateCollection(name string) bool {
+	for _, prefix := range AdminCollectionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAuditCollection reports whether name is the request log or an archive
+// of another collection.
+func IsAuditCollection(name string) bool {
+	for _, suffix := range AuditCollectionSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsServiceCollection reports whether name belongs to the service rather
+// than to a user.
+func IsServiceCollection(name string) bool {
+	return IsAdminStateCollection(name) || IsAuditCollection(name)
+}
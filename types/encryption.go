@@ -0,0 +1,31 @@
+package types
+
+type EncryptionConfig struct {
+	Enabled     bool                             `yaml:"enabled" json:"enabled"`
+	KeyFile     string                           `yaml:"key_file" json:"key_file"`
+	Collections map[string]EncryptedFieldsConfig `yaml:"collections" json:"collections"`
+}
+
+// EncryptedFieldsConfig lists the dotted field paths to encrypt in a collection.
+// Deterministic fields can be matched by equality; randomized ones cannot be
+// used in filters at all.
+type EncryptedFieldsConfig struct {
+	Deterministic []string `yaml:"deterministic" json:"deterministic"`
+	Randomized    []string `yaml:"randomized" json:"randomized"`
+}
+
+// EncryptionKeyFile is the on-disk key ring. New values are encrypted with the
+// Active key; the others are kept to decrypt values written before a rotation.
+type EncryptionKeyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+type EncryptionStatus struct {
+	Enabled     bool                             `json:"enabled"`
+	KeyFile     string                           `json:"key_file"`
+	ActiveKey   string                           `json:"active_key"`
+	KeyIDs      []string                         `json:"key_ids"`
+	LoadError   string                           `json:"load_error,omitempty"`
+	Collections map[string]EncryptedFieldsConfig `json:"collections"`
+}
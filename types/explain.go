@@ -0,0 +1,29 @@
+package types
+
+// ExplainRequest describes a query to plan without running it. Updates and
+// deletes are planned by their filter, the same way Mongo selects their index.
+type ExplainRequest struct {
+	Collection string                 `json:"collection" validate:"required"`
+	Operation  string                 `json:"operation,omitempty" validate:"omitempty,oneof=find aggregate update delete"`
+	Filter     map[string]interface{} `json:"filter,omitempty"`
+	Sort       map[string]int         `json:"sort,omitempty"`
+	Pipeline   OrderedPipeline        `json:"pipeline,omitempty"`
+	Limit      int                    `json:"limit,omitempty"`
+	Skip       int                    `json:"skip,omitempty"`
+}
+
+// QueryPlan is the compact form of an explain result.
+type QueryPlan struct {
+	PlanSummary     string      `json:"plan_summary"`
+	Indexes         []string    `json:"indexes,omitempty"`
+	Stages          []string    `json:"stages,omitempty"`
+	KeysExamined    int64       `json:"keys_examined"`
+	DocsExamined    int64       `json:"docs_examined"`
+	Returned        int64       `json:"returned"`
+	ExecutionTimeMs int64       `json:"execution_time_ms"`
+	WinningPlan     interface{} `json:"winning_plan,omitempty"`
+}
+
+type ExplainResponse struct {
+	Data QueryPlan `json:"data"`
+}
@@ -0,0 +1,9 @@
+package types
+
+// ExportConfig caps downloads from the admin panel. MaxRows bounds every
+// export; a smaller limit can be chosen per download. Rows are read
+// BatchSize at a time.
+type ExportConfig struct {
+	MaxRows   int `yaml:"max_rows" json:"max_rows"`
+	BatchSize int `yaml:"batch_size" json:"batch_size"`
+}
@@ -0,0 +1,27 @@
+package types
+
+// DocumentVersion is one state of a document rebuilt from its archives.
+// Document is the state after Operation; it is nil for deletes and for
+// updates whose result was not archived.
+type DocumentVersion struct {
+	Version     int                    `json:"version"`
+	Operation   string                 `json:"operation"`
+	OperationID string                 `json:"operation_id,omitempty"`
+	Time        int64                  `json:"time"`
+	Document    map[string]interface{} `json:"document"`
+	Deleted     bool                   `json:"deleted,omitempty"`
+}
+
+type DocumentHistoryResponse struct {
+	Data  []DocumentVersion `json:"data"`
+	Total int               `json:"total"`
+}
+
+// FieldChange is one entry of the diff stored with an update archive.
+// Path is dotted; Op is "added", "removed" or "changed".
+type FieldChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
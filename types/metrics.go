@@ -0,0 +1,57 @@
+package types
+
+import "time"
+
+// MetricsCollection holds the per-minute operation rollups. In MongoDB it
+// is a time-series collection with ts as time field and meta as meta field.
+const MetricsCollection = "_admin_metrics"
+
+// MetricsConfig enables the operation rollups. RetentionDays is how long
+// they are kept, 30 by default.
+type MetricsConfig struct {
+	Enabled       bool `yaml:"enabled" json:"enabled"`
+	RetentionDays int  `yaml:"retention_days" json:"retention_days"`
+}
+
+// MetricsQuery selects rollups for the dashboard. Empty Collection or
+// Operation means all of them; Step is the width of a chart point.
+type MetricsQuery struct {
+	Collection string
+	Operation  string
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+}
+
+// MetricsPoint sums the operations of one period. Latencies are in
+// milliseconds and estimated from the latency histograms of the rollups.
+type MetricsPoint struct {
+	Time   time.Time `json:"time"`
+	Count  int64     `json:"count"`
+	Errors int64     `json:"errors"`
+	// Read is the number of documents returned, Written the number created,
+	// updated or deleted.
+	Read    int64   `json:"read"`
+	Written int64   `json:"written"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// MetricsRow is the total of one collection and operation over the range.
+type MetricsRow struct {
+	Collection string `json:"collection"`
+	Operation  string `json:"operation"`
+	MetricsPoint
+}
+
+// MetricsReport is the dashboard data: one point per step, with empty
+// periods included, the total of the range and its breakdown.
+type MetricsReport struct {
+	Query  MetricsQuery   `json:"-"`
+	Points []MetricsPoint `json:"points"`
+	Total  MetricsPoint   `json:"total"`
+	Rows   []MetricsRow   `json:"rows"`
+}
@@ -58,6 +58,9 @@ type ReadDocumentsRequest struct {
 	Skip       int                    `json:"skip,omitempty"`
 	Count      int                    `json:"count,omitempty"`
 	Fields     []string               `json:"fields,omitempty"`
+	AsOf       int64                  `json:"as_of,omitempty"`
+	// IncludeDeleted returns soft-deleted documents too.
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
 }
 
 type UpdateDocumentsRequest struct {
@@ -65,11 +68,19 @@ type UpdateDocumentsRequest struct {
 	Filter     map[string]interface{} `json:"filter"`
 	Data       interface{}            `json:"data"`
 	Upsert     bool                   `json:"upsert,omitempty"`
+	DryRun     bool                   `json:"dry_run,omitempty"`
+	// UpsertID is the internal_id given to a document inserted by an upsert.
+	// It is set by the service so the insert can be archived precisely.
+	UpsertID string `json:"-"`
 }
 
 type DeleteDocumentsRequest struct {
 	Collection string                 `json:"collection"`
 	Filter     map[string]interface{} `json:"filter"`
+	DryRun     bool                   `json:"dry_run,omitempty"`
+	// DeletedBy is recorded on soft-deleted documents. It is set by the
+	// handler from the authenticated caller.
+	DeletedBy string `json:"-"`
 }
 
 type AggregateField struct {
@@ -89,4 +100,6 @@ type AggregateDocumentsRequest struct {
 	Skip       int                    `json:"skip,omitempty"`
 	Fields     []string               `json:"fields,omitempty"`
 	Count      int                    `json:"count,omitempty"`
+	// IncludeDeleted aggregates over soft-deleted documents too.
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
 }
@@ -0,0 +1,21 @@
+package types
+
+// RequestLogConfig controls what ends up in <collection>_request_logs.
+// SampleRates is keyed by "collection:operation", "collection", "*:operation"
+// or "*" (most specific wins); rates are between 0 and 1, default 1.
+type RequestLogConfig struct {
+	RedactFields   []string           `yaml:"redact_fields" json:"redact_fields"`
+	RedactPatterns []string           `yaml:"redact_patterns" json:"redact_patterns"`
+	RedactHeaders  []string           `yaml:"redact_headers" json:"redact_headers"`
+	IncludeHeaders bool               `yaml:"include_headers" json:"include_headers"`
+	MaxBodyBytes   int                `yaml:"max_body_bytes" json:"max_body_bytes"`
+	SampleRates    map[string]float64 `yaml:"sample_rates" json:"sample_rates"`
+}
+
+// WriteBufferConfig sizes the background writer used for request logs and
+// query stats.
+type WriteBufferConfig struct {
+	Size            int `yaml:"size" json:"size"`
+	BatchSize       int `yaml:"batch_size" json:"batch_size"`
+	FlushIntervalMs int `yaml:"flush_interval_ms" json:"flush_interval_ms"`
+}
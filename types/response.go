@@ -10,14 +10,23 @@ type ReadDocumentsResponse struct {
 	Total int64                    `json:"total"`
 }
 
+// UpdateDocumentsResponse reports, for dry runs, how many documents match,
+// a sample of them and the state each sampled document would be left in.
 type UpdateDocumentsResponse struct {
-	Data    []string `json:"data"`
-	Updated int64    `json:"updated"`
+	Data       []string                 `json:"data"`
+	Updated    int64                    `json:"updated"`
+	DryRun     bool                     `json:"dry_run,omitempty"`
+	Matched    int64                    `json:"matched,omitempty"`
+	Sample     []map[string]interface{} `json:"sample,omitempty"`
+	PostImages []map[string]interface{} `json:"post_images,omitempty"`
 }
 
 type DeleteDocumentsResponse struct {
-	Data    []string `json:"data"`
-	Deleted int64    `json:"deleted"`
+	Data    []string                 `json:"data"`
+	Deleted int64                    `json:"deleted"`
+	DryRun  bool                     `json:"dry_run,omitempty"`
+	Matched int64                    `json:"matched,omitempty"`
+	Sample  []map[string]interface{} `json:"sample,omitempty"`
 }
 
 type AggregateDocumentsResponse struct {
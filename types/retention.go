@@ -0,0 +1,40 @@
+package types
+
+import "time"
+
+// RetentionTimeField is the BSON date stamped on log, archive and slow query
+// documents when retention is enabled; Mongo TTL indexes expire on it.
+const RetentionTimeField = "ttl_time"
+
+type RetentionConfig struct {
+	Enabled         bool              `yaml:"enabled" json:"enabled"`
+	IntervalMinutes int               `yaml:"interval_minutes" json:"interval_minutes"`
+	Policies        []RetentionPolicy `yaml:"policies" json:"policies"`
+}
+
+// RetentionPolicy applies to collections matching Pattern (path.Match syntax,
+// e.g. "*_request_logs"). The first matching policy wins.
+type RetentionPolicy struct {
+	Pattern      string `yaml:"pattern" json:"pattern"`
+	MaxAgeDays   int    `yaml:"max_age_days" json:"max_age_days"`
+	MaxDocuments int64  `yaml:"max_documents" json:"max_documents"`
+}
+
+type RetentionCollectionStatus struct {
+	Tenant     string          `json:"tenant,omitempty"`
+	Collection string          `json:"collection"`
+	Policy     RetentionPolicy `json:"policy"`
+	TTL        bool            `json:"ttl"`
+	Deleted    int64           `json:"deleted"`
+	Error      string          `json:"error,omitempty"`
+}
+
+type RetentionStatus struct {
+	Enabled     bool                        `json:"enabled"`
+	Policies    []RetentionPolicy           `json:"policies"`
+	Interval    time.Duration               `json:"interval"`
+	Running     bool                        `json:"running"`
+	LastRun     time.Time                   `json:"last_run"`
+	NextRun     time.Time                   `json:"next_run"`
+	Collections []RetentionCollectionStatus `json:"collections"`
+}
@@ -0,0 +1,50 @@
+package types
+
+// RollbackRequest selects the chain of archived operations to undo. The chain
+// starts at OperationID, or at From when no operation is given, and includes
+// every later archive entry of the selected documents. Documents default to
+// those touched by OperationID, or to everything archived between From and To.
+type RollbackRequest struct {
+	Collection  string   `json:"collection" validate:"required"`
+	OperationID string   `json:"operation_id,omitempty"`
+	InternalIDs []string `json:"internal_ids,omitempty"`
+	From        int64    `json:"from,omitempty"`
+	To          int64    `json:"to,omitempty"`
+	Force       bool     `json:"force,omitempty"`
+}
+
+// RollbackStep reverses one archive entry. Action is "delete" for creates and
+// upsert inserts, "restore" for updates and deletes.
+type RollbackStep struct {
+	OperationID string `json:"operation_id"`
+	Operation   string `json:"operation"`
+	InternalID  string `json:"internal_id"`
+	Time        int64  `json:"time"`
+	Action      string `json:"action"`
+}
+
+// RollbackConflict marks a document whose rollback discards changes outside
+// the selected operation or window, or whose live state no longer matches
+// its archives.
+type RollbackConflict struct {
+	InternalID  string `json:"internal_id"`
+	Reason      string `json:"reason"`
+	OperationID string `json:"operation_id,omitempty"`
+	Time        int64  `json:"time,omitempty"`
+}
+
+// RollbackPlan lists steps newest first, the order they are applied in.
+type RollbackPlan struct {
+	Collection string             `json:"collection"`
+	From       int64              `json:"from"`
+	Documents  int                `json:"documents"`
+	Steps      []RollbackStep     `json:"steps"`
+	Conflicts  []RollbackConflict `json:"conflicts"`
+}
+
+type RollbackResult struct {
+	Plan        RollbackPlan `json:"plan"`
+	OperationID string       `json:"operation_id"`
+	Deleted     int          `json:"deleted"`
+	Restored    int          `json:"restored"`
+}
@@ -0,0 +1,38 @@
+package types
+
+// RunSavedQueryRequest runs a query saved in the admin panel. Params fill the
+// query's {{name:type}} placeholders; values are converted to the declared
+// type and never spliced into the query text.
+type RunSavedQueryRequest struct {
+	ID     string                 `json:"id" validate:"required"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	DryRun bool                   `json:"dry_run,omitempty"`
+}
+
+// QueryResult is the outcome of a shell query. Which fields are set depends
+// on the operation.
+type QueryResult struct {
+	Operation string `json:"operation"`
+	// Documents holds the found documents, the aggregation output, or the
+	// single document of findOneAndUpdate.
+	Documents []map[string]interface{} `json:"documents,omitempty"`
+	// Values holds the result of distinct.
+	Values []interface{} `json:"values,omitempty"`
+	// Total is the number of matching documents for find, aggregate and
+	// countDocuments.
+	Total   int64 `json:"total"`
+	Created int64 `json:"created,omitempty"`
+	Updated int64 `json:"updated,omitempty"`
+	Deleted int64 `json:"deleted,omitempty"`
+	// Matched is the number of documents a dry run would change, or that
+	// replaceOne and findOneAndUpdate picked.
+	Matched int64 `json:"matched,omitempty"`
+	DryRun  bool  `json:"dry_run,omitempty"`
+	// Sample holds, for dry runs, updated documents as they would be left
+	// and deleted documents as they are.
+	Sample []map[string]interface{} `json:"sample,omitempty"`
+}
+
+type RunSavedQueryResponse struct {
+	Data QueryResult `json:"data"`
+}
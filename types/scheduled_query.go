@@ -0,0 +1,56 @@
+package types
+
+// QueryRunsCollection holds the history of scheduled query runs.
+const QueryRunsCollection = "_admin_query_runs"
+
+// QuerySchedulerConfig controls scheduled saved queries. A run keeps at most
+// SnapshotLimit result rows and only the newest KeepRuns runs of a query are
+// kept. Alerts are posted to WebhookURL unless the query sets its own.
+type QuerySchedulerConfig struct {
+	SnapshotLimit    int    `yaml:"snapshot_limit" json:"snapshot_limit"`
+	KeepRuns         int64  `yaml:"keep_runs" json:"keep_runs"`
+	WebhookURL       string `yaml:"webhook_url" json:"webhook_url"`
+	WebhookTimeoutMs int    `yaml:"webhook_timeout_ms" json:"webhook_timeout_ms"`
+}
+
+// QuerySchedule runs a saved read query on a cron expression. Params fill
+// the query's placeholders; Tenant is the namespace it runs in. Alert is a
+// rule such as "count > 0" or "count changed by 20%".
+type QuerySchedule struct {
+	Cron    string            `json:"cron"`
+	Params  map[string]string `json:"params,omitempty"`
+	Tenant  string            `json:"tenant,omitempty"`
+	Alert   string            `json:"alert,omitempty"`
+	Webhook string            `json:"webhook,omitempty"`
+}
+
+// QueryRun is one run of a scheduled query. Count is the number of matching
+// documents, or of values for distinct; Snapshot holds the first rows.
+type QueryRun struct {
+	QueryID           string        `json:"query_id"`
+	Name              string        `json:"name"`
+	Collection        string        `json:"collection"`
+	Tenant            string        `json:"tenant,omitempty"`
+	Time              int64         `json:"ts"`
+	DurationMs        int64         `json:"duration_ms"`
+	Count             int64         `json:"count"`
+	Snapshot          []interface{} `json:"snapshot,omitempty"`
+	SnapshotTruncated bool          `json:"snapshot_truncated,omitempty"`
+	Error             string        `json:"error"`
+	Alert             string        `json:"alert,omitempty"`
+	WebhookError      string        `json:"webhook_error,omitempty"`
+}
+
+// QueryAlert is logged and posted to the webhook when a run matches the
+// alert rule of its query.
+type QueryAlert struct {
+	QueryID       string `json:"query_id"`
+	Name          string `json:"name"`
+	Collection    string `json:"collection"`
+	Tenant        string `json:"tenant,omitempty"`
+	Rule          string `json:"rule"`
+	Message       string `json:"message"`
+	Count         int64  `json:"count"`
+	PreviousCount *int64 `json:"previous_count,omitempty"`
+	Time          int64  `json:"ts"`
+}
@@ -0,0 +1,30 @@
+package types
+
+// Fields set on documents deleted from a soft-delete collection.
+const (
+	SoftDeletedAtField = "deleted_at"
+	SoftDeletedByField = "deleted_by"
+)
+
+type SoftDeleteConfig struct {
+	PurgeIntervalMinutes int                `yaml:"purge_interval_minutes" json:"purge_interval_minutes"`
+	Collections          []SoftDeletePolicy `yaml:"collections" json:"collections"`
+}
+
+// SoftDeletePolicy enables soft delete for collections matching Pattern
+// (path.Match syntax). Tombstones older than PurgeAfterDays are removed for
+// good; zero keeps them forever. The first matching policy wins.
+type SoftDeletePolicy struct {
+	Pattern        string `yaml:"pattern" json:"pattern"`
+	PurgeAfterDays int    `yaml:"purge_after_days" json:"purge_after_days"`
+}
+
+type UndeleteDocumentsRequest struct {
+	Collection string                 `json:"collection"`
+	Filter     map[string]interface{} `json:"filter"`
+}
+
+type UndeleteDocumentsResponse struct {
+	Data     []string `json:"data"`
+	Restored int64    `json:"restored"`
+}
@@ -7,16 +7,37 @@ import (
 type StorageRepository interface {
 	CreateDocuments(ctx context.Context, request CreateDocumentsRequest) ([]string, error)
 	ReadDocuments(ctx context.Context, request ReadDocumentsRequest) ([]map[string]interface{}, int64, error)
+	// ForEachDocument passes the documents of a find to fn one by one,
+	// reading them batchSize at a time from a single cursor.
+	ForEachDocument(ctx context.Context, request ReadDocumentsRequest, batchSize int, fn func(map[string]interface{}) error) error
 	AggregateDocuments(ctx context.Context, request AggregateDocumentsRequest) ([]map[string]interface{}, int64, error)
 	UpdateDocuments(ctx context.Context, request UpdateDocumentsRequest) (int64, error)
 	DeleteDocuments(ctx context.Context, request DeleteDocumentsRequest) (int64, error)
+	BulkUpsert(ctx context.Context, collection string, operations []UpsertOperation) error
+	BulkPatch(ctx context.Context, collection string, operations []UpsertOperation) error
 	Close(ctx context.Context) error
 
 	GetAdminCollectionStats(ctx context.Context) ([]CollectionStats, error)
 	ListCollectionNames(ctx context.Context) ([]string, error)
+	CreateCollection(ctx context.Context, collection string, opts CollectionOptions) error
+	CollectionOptions(ctx context.Context, collection string) (CollectionOptions, error)
+	SetCollectionExpiry(ctx context.Context, collection string, seconds int64) error
+	RenameCollection(ctx context.Context, from, to string) error
+	DropCollection(ctx context.Context, collection string) error
+	TruncateCollection(ctx context.Context, collection string) (int64, error)
+	CopyCollection(ctx context.Context, from, to string) (int64, error)
+	ConvertToCapped(ctx context.Context, collection string, size int64) error
 	ListIndexes(ctx context.Context, collection string) ([]IndexInfo, error)
+	CollectionValidator(ctx context.Context, collection string) (map[string]interface{}, error)
 	CreateIndex(ctx context.Context, req CreateIndexRequest) error
+	DropIndex(ctx context.Context, collection, name string) error
+	SetIndexHidden(ctx context.Context, collection, name string, hidden bool) error
+	IndexBuilds(ctx context.Context, collection string) ([]IndexBuild, error)
+	IndexUsage(ctx context.Context, collection string) ([]IndexUsage, error)
+	EnsureTTLIndex(ctx context.Context, collection, field string, expireAfterSeconds int32) error
 	GetSlowQueries(ctx context.Context, limit int) ([]SlowQuery, error)
-	LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string) error
+	LogSlowQuery(ctx context.Context, collection, operation string, durationMs, docsCount int64, filterKeys []string, sortKeys map[string]int, operationID string, plan *QueryPlan) error
+	Explain(ctx context.Context, request ExplainRequest) (QueryPlan, error)
 	GetArchiveGroups(ctx context.Context, collection, search string, skip, limit int) ([]ArchiveGroup, int64, error)
+	ListTenants(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	TenancyModePrefix   = "prefix"
+	TenancyModeDatabase = "database"
+
+	TenantSourceHeader    = "header"
+	TenantSourceUser      = "user"
+	TenantSourceAccessKey = "access_key"
+)
+
+// TenantContextKey is a string so the tenant can be stored both with
+// context.WithValue and as a fasthttp user value on the request context.
+const TenantContextKey = "tenant"
+
+// TenantSeparator joins the tenant and the collection name in prefix mode.
+// Tenant IDs cannot contain '_', so the first separator always ends the tenant.
+const TenantSeparator = "__"
+
+type TenancyConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Mode     string `yaml:"mode" json:"mode"`
+	Source   string `yaml:"source" json:"source"`
+	Header   string `yaml:"header" json:"header"`
+	Required bool   `yaml:"required" json:"required"`
+}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, TenantContextKey, tenant)
+}
+
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant, _ := ctx.Value(TenantContextKey).(string)
+	return tenant
+}
+
+func TenantCollection(tenant, collection string) string {
+	if tenant == "" {
+		return collection
+	}
+	return tenant + TenantSeparator + collection
+}
+
+// SplitTenantCollection reverses TenantCollection. ok is false for names that
+// do not carry a well-formed tenant prefix.
+func SplitTenantCollection(name string) (tenant, collection string, ok bool) {
+	i := strings.Index(name, TenantSeparator)
+	if i <= 0 || i+len(TenantSeparator) == len(name) {
+		return "", name, false
+	}
+	tenant = name[:i]
+	if !ValidTenantID(tenant) {
+		return "", name, false
+	}
+	return tenant, name[i+len(TenantSeparator):], true
+}
+
+// ValidTenantID accepts 1-48 ASCII letters, digits and '-', starting with a
+// letter or digit, so a tenant is safe both as a collection prefix and as a
+// database name suffix.
+func ValidTenantID(tenant string) bool {
+	if tenant == "" || len(tenant) > 48 || tenant[0] == '-' {
+		return false
+	}
+	for i := 0; i < len(tenant); i++ {
+		c := tenant[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
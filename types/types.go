@@ -27,8 +27,20 @@ type StorageManagerConfig struct {
 }
 
 type StorageFeaturesConfig struct {
-	LogRequests          bool `yaml:"log_requests" json:"log_requests"`
-	ArchiveChanges       bool `yaml:"archive_changes" json:"archive_changes"`
-	TrackQueryStats      bool `yaml:"track_query_stats" json:"track_query_stats"`
-	SlowQueryThresholdMs int  `yaml:"slow_query_threshold_ms" json:"slow_query_threshold_ms"`
+	LogRequests          bool                 `yaml:"log_requests" json:"log_requests"`
+	ArchiveChanges       bool                 `yaml:"archive_changes" json:"archive_changes"`
+	TrackQueryStats      bool                 `yaml:"track_query_stats" json:"track_query_stats"`
+	SlowQueryThresholdMs int                  `yaml:"slow_query_threshold_ms" json:"slow_query_threshold_ms"`
+	AllowAuditReads      bool                 `yaml:"allow_audit_reads" json:"allow_audit_reads"`
+	AccessControl        AccessControlConfig  `yaml:"access_control" json:"access_control"`
+	Tenancy              TenancyConfig        `yaml:"tenancy" json:"tenancy"`
+	Encryption           EncryptionConfig     `yaml:"encryption" json:"encryption"`
+	RequestLogs          RequestLogConfig     `yaml:"request_logs" json:"request_logs"`
+	WriteBuffer          WriteBufferConfig    `yaml:"write_buffer" json:"write_buffer"`
+	Retention            RetentionConfig      `yaml:"retention" json:"retention"`
+	SoftDelete           SoftDeleteConfig     `yaml:"soft_delete" json:"soft_delete"`
+	IndexAdvisor         IndexAdvisorConfig   `yaml:"index_advisor" json:"index_advisor"`
+	ScheduledQueries     QuerySchedulerConfig `yaml:"scheduled_queries" json:"scheduled_queries"`
+	Export               ExportConfig         `yaml:"export" json:"export"`
+	Metrics              MetricsConfig        `yaml:"metrics" json:"metrics"`
 }